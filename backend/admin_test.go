@@ -0,0 +1,50 @@
+package main
+
+import (
+	"csv-processor/handlers"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminOnly(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		wantStatus    int
+		wantCode      string
+	}{
+		{"admin token not configured", "", "Bearer secret", http.StatusForbidden, handlers.ErrCodeForbidden},
+		{"no authorization", "secret", "", http.StatusUnauthorized, handlers.ErrCodeUnauthorized},
+		{"wrong token", "secret", "Bearer guess", http.StatusUnauthorized, handlers.ErrCodeUnauthorized},
+		{"right token", "secret", "Bearer secret", http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/reload-rules", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			adminOnly(tt.token, ok)(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			var apiErr handlers.APIError
+			if err := json.NewDecoder(rec.Body).Decode(&apiErr); err != nil {
+				t.Fatalf("body is not an API error: %v", err)
+			}
+			if apiErr.Code != tt.wantCode || apiErr.Message == "" {
+				t.Errorf("error = %+v, want code %s with a message", apiErr, tt.wantCode)
+			}
+		})
+	}
+}
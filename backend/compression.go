@@ -0,0 +1,176 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// incompressibleTypes are content types that are already compressed
+var incompressibleTypes = []string{
+	"image/", "video/", "audio/",
+	"application/gzip", "application/zip", "application/x-gzip",
+	"application/pdf", "application/octet-stream",
+}
+
+// gzipMiddleware compresses responses for clients that accept gzip. Bodies smaller
+// than minSize are sent as-is since compressing them isn't worth the overhead.
+func gzipMiddleware(minSize int) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize, statusCode: http.StatusOK}
+			defer gw.Close()
+
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip: listed as gzip
+// or x-gzip, or covered by *, with a non-zero quality value
+func acceptsGzip(acceptEncoding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		accepted := true
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(param, "=")
+			if ok && strings.EqualFold(strings.TrimSpace(name), "q") {
+				q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				accepted = err == nil && q > 0
+			}
+		}
+		switch coding {
+		case "gzip", "x-gzip":
+			return accepted
+		case "*":
+			wildcard = accepted
+		}
+	}
+	return wildcard
+}
+
+// gzipResponseWriter buffers the start of a response until it knows whether the body
+// is worth compressing, then either streams it through gzip or passes it through
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	buf         []byte
+	minSize     int
+	statusCode  int
+	wroteHeader bool
+	decided     bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.statusCode = statusCode
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends everything written so far, deciding on compression immediately so
+// streaming responses keep flowing through the gzip writer
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide(true)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close finishes the response once the handler has returned
+func (w *gzipResponseWriter) Close() error {
+	if !w.decided {
+		if err := w.decide(len(w.buf) >= w.minSize); err != nil {
+			return err
+		}
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+// decide commits the response headers and writes out the buffered bytes
+func (w *gzipResponseWriter) decide(largeEnough bool) error {
+	w.decided = true
+	header := w.Header()
+
+	if header.Get("Content-Type") == "" && len(w.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	compress := largeEnough &&
+		header.Get("Content-Encoding") == "" &&
+		w.statusCode != http.StatusNoContent &&
+		w.statusCode != http.StatusNotModified &&
+		isCompressible(header.Get("Content-Type"))
+
+	if compress {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.statusCode)
+
+	buffered := w.buf
+	w.buf = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+	if w.gz != nil {
+		_, err := w.gz.Write(buffered)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buffered)
+	return err
+}
+
+func isCompressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// newGzipRouter serves body from /data, as JSON, through the gzip middleware
+func newGzipRouter(minSize int, body string) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(gzipMiddleware(minSize))
+	router.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", "123")
+		if r.Method == http.MethodHead {
+			return
+		}
+		io.WriteString(w, body)
+	}).Methods("GET", "HEAD")
+	return router
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"GZIP", true},
+		{"x-gzip", true},
+		{"deflate, gzip", true},
+		{"gzip;q=0.5", true},
+		{"gzip; q=1.0, br", true},
+		{"gzip;q=0", false},
+		{"gzip;q=0.000", false},
+		{"gzip;q=invalid", false},
+		{"br, deflate", false},
+		{"*", true},
+		{"*;q=0", false},
+		{"*, gzip;q=0", false},
+		{"gzip;q=0, *", false},
+		{"identity", false},
+		{"notgzip", false},
+	}
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.header); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGzipMiddlewareCompresses(t *testing.T) {
+	body := strings.Repeat(`{"name":"Ada","title":"Software Engineer"},`, 100)
+	router := newGzipRouter(64, body)
+
+	req := httptest.NewRequest(http.MethodGet, "/data", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := rec.Header().Get("Content-Length"); got != "" {
+		t.Errorf("Content-Length = %q, want it removed", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", got)
+	}
+	if rec.Body.Len() >= len(body) {
+		t.Errorf("compressed body is %d bytes, not smaller than %d", rec.Body.Len(), len(body))
+	}
+
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("body is not gzip: %v", err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to decompress body: %v", err)
+	}
+	if string(decompressed) != body {
+		t.Errorf("decompressed body differs from the original")
+	}
+}
+
+func TestGzipMiddlewarePassesThrough(t *testing.T) {
+	body := strings.Repeat("x", 200)
+
+	tests := []struct {
+		name           string
+		minSize        int
+		acceptEncoding string
+	}{
+		{"no accept-encoding", 64, ""},
+		{"gzip refused", 64, "gzip;q=0, deflate"},
+		{"other encodings only", 64, "br"},
+		{"body below threshold", 1024, "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/data", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			newGzipRouter(tt.minSize, body).ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("Content-Encoding = %q, want none", got)
+			}
+			if rec.Body.String() != body {
+				t.Errorf("body was modified")
+			}
+		})
+	}
+}
+
+func TestGzipMiddlewareHead(t *testing.T) {
+	req := httptest.NewRequest(http.MethodHead, "/data", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	newGzipRouter(0, "").ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none for HEAD", got)
+	}
+	if got := rec.Header().Get("Content-Length"); got != "123" {
+		t.Errorf("Content-Length = %q, want the handler's 123", got)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("HEAD response has a %d byte body", rec.Body.Len())
+	}
+}
+
+func TestGzipMiddlewareFlush(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(gzipMiddleware(1024))
+	router.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		io.WriteString(w, "{\"line\":1}\n")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "{\"line\":2}\n")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if !rec.Flushed {
+		t.Errorf("flush did not reach the underlying writer")
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip once flushed", got)
+	}
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("body is not gzip: %v", err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to decompress body: %v", err)
+	}
+	if want := "{\"line\":1}\n{\"line\":2}\n"; string(decompressed) != want {
+		t.Errorf("decompressed body = %q, want %q", decompressed, want)
+	}
+}
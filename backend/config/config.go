@@ -0,0 +1,33 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+// GetEnv returns the value of an environment variable or a default
+func GetEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// GetEnvInt returns an integer environment variable or a default if unset or invalid
+func GetEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// GetEnvFloat returns a float environment variable or a default if unset or invalid
+func GetEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
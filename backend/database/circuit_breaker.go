@@ -0,0 +1,143 @@
+package database
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of calling the database while the circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("database circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState int
+
+const (
+	// Closed lets every call through
+	Closed CircuitState = iota
+	// Open rejects every call until the cooldown has passed
+	Open
+	// HalfOpen lets a single probe call through to decide whether to close again
+	HalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker stops calling the database after consecutive failures, so an
+// overloaded server gets time to recover instead of more load. Only errors that
+// isFailure accepts count; a query that fails on its own merits still shows the
+// database is answering.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	isFailure func(error) bool
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int // consecutive failures
+	openedAt time.Time
+	trips    int64 // times the circuit opened since startup
+}
+
+// CircuitStats is a snapshot of a circuit breaker for health reporting
+type CircuitStats struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+	Trips               int64      `json:"trips"`
+}
+
+// NewCircuitBreaker returns a closed breaker that opens after threshold consecutive
+// failures and lets a probe through once it has been open for cooldown
+func NewCircuitBreaker(threshold int, cooldown time.Duration, isFailure func(error) bool) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown, isFailure: isFailure}
+}
+
+// Allow reports whether a call may go ahead, returning ErrCircuitOpen if not. Every
+// allowed call must be followed by Record with its outcome.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = HalfOpen
+		return nil
+	case HalfOpen:
+		// The probe is still running
+		return ErrCircuitOpen
+	default:
+		return nil
+	}
+}
+
+// Record reports the outcome of a call that Allow let through
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil || !b.isFailure(err) {
+		b.state = Closed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		if b.state != Open {
+			b.trips++
+		}
+		b.state = Open
+		b.openedAt = time.Now()
+	}
+}
+
+// Do runs fn unless the circuit is open and records its outcome
+func (b *CircuitBreaker) Do(fn func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.Record(err)
+	return err
+}
+
+// State returns the current state of the breaker
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Stats returns a snapshot of the breaker
+func (b *CircuitBreaker) Stats() *CircuitStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := &CircuitStats{
+		State:               b.state.String(),
+		ConsecutiveFailures: b.failures,
+		Trips:               b.trips,
+	}
+	if b.state != Closed {
+		openedAt := b.openedAt
+		stats.OpenedAt = &openedAt
+	}
+	return stats
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var errUnavailable = errors.New("connection refused")
+
+// countsUnavailable counts only errUnavailable as a failure
+func countsUnavailable(err error) bool {
+	return errors.Is(err, errUnavailable)
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	breaker := NewCircuitBreaker(3, time.Hour, countsUnavailable)
+	fail := func() error { return errUnavailable }
+
+	for i := 0; i < 2; i++ {
+		breaker.Do(fail)
+	}
+	if breaker.State() != Closed {
+		t.Fatalf("state = %v after 2 of 3 failures, want closed", breaker.State())
+	}
+	// An error that doesn't count shows the database is answering
+	breaker.Do(func() error { return errors.New("duplicate key") })
+	for i := 0; i < 2; i++ {
+		breaker.Do(fail)
+	}
+	if breaker.State() != Closed {
+		t.Fatalf("state = %v after an error that doesn't count and 2 failures, want closed", breaker.State())
+	}
+
+	breaker.Do(fail)
+	if breaker.State() != Open {
+		t.Fatalf("state = %v after 3 failures, want open", breaker.State())
+	}
+	called := false
+	err := breaker.Do(func() error { called = true; return nil })
+	if !errors.Is(err, ErrCircuitOpen) || called {
+		t.Errorf("Do() = %v and called = %v while open, want ErrCircuitOpen without calling", err, called)
+	}
+
+	stats := breaker.Stats()
+	if stats.State != "open" || stats.Trips != 1 || stats.ConsecutiveFailures != 3 || stats.OpenedAt == nil {
+		t.Errorf("Stats() = %+v, want open after 1 trip and 3 failures", stats)
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	breaker := NewCircuitBreaker(2, time.Hour, countsUnavailable)
+	breaker.Do(func() error { return errUnavailable })
+	breaker.Do(func() error { return nil })
+	breaker.Do(func() error { return errUnavailable })
+	if breaker.State() != Closed {
+		t.Errorf("state = %v, want closed as the failures weren't consecutive", breaker.State())
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		probe     error
+		wantState CircuitState
+		wantTrips int64
+	}{
+		{"probe succeeds", nil, Closed, 1},
+		{"probe fails", errUnavailable, Open, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := NewCircuitBreaker(1, 10*time.Millisecond, countsUnavailable)
+			breaker.Do(func() error { return errUnavailable })
+			time.Sleep(20 * time.Millisecond)
+
+			if err := breaker.Allow(); err != nil {
+				t.Fatalf("Allow() = %v after the cooldown, want the probe let through", err)
+			}
+			if breaker.State() != HalfOpen {
+				t.Fatalf("state = %v during the probe, want half-open", breaker.State())
+			}
+			if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+				t.Errorf("Allow() = %v during the probe, want ErrCircuitOpen", err)
+			}
+
+			breaker.Record(tt.probe)
+			if breaker.State() != tt.wantState {
+				t.Errorf("state = %v after the probe, want %v", breaker.State(), tt.wantState)
+			}
+			if trips := breaker.Stats().Trips; trips != tt.wantTrips {
+				t.Errorf("trips = %d, want %d", trips, tt.wantTrips)
+			}
+		})
+	}
+}
@@ -1,16 +1,24 @@
 package database
 
 import (
+	"csv-processor/config"
 	"database/sql"
+	_ "embed"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
 var DB *sql.DB
 
+// schema is applied on every startup, so all statements in it must be idempotent
+//
+//go:embed init.sql
+var schema string
+
 // InitDB initializes the database connection
 func InitDB() error {
 	host := getEnv("DB_HOST", "localhost")
@@ -22,16 +30,24 @@ func InitDB() error {
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		host, port, user, password, dbname)
 
+	// PostgreSQL may still be starting, so retry with exponential backoff
+	maxAttempts := config.GetEnvInt("DB_MAX_CONNECT_RETRIES", 10)
+	delay := time.Duration(config.GetEnvInt("DB_CONNECT_RETRY_DELAY_MS", 500)) * time.Millisecond
 	var err error
-	DB, err = sql.Open("postgres", connStr)
-	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
-	}
-
-	// Test connection
-	err = DB.Ping()
-	if err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+	for attempt := 1; ; attempt++ {
+		DB, err = connect(connStr)
+		if err == nil {
+			break
+		}
+		if attempt >= maxAttempts {
+			return err
+		}
+		log.Printf("WARN: database connection attempt %d/%d failed, retrying in %s: %v", attempt, maxAttempts, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxConnectRetryDelay {
+			delay = maxConnectRetryDelay
+		}
 	}
 
 	// Set connection pool settings
@@ -39,9 +55,33 @@ func InitDB() error {
 	DB.SetMaxIdleConns(5)
 
 	log.Println("Database connection established")
+
+	// Bring existing databases up to date with the current schema
+	if _, err = DB.Exec(schema); err != nil {
+		return fmt.Errorf("failed to apply schema: %w", err)
+	}
+
 	return nil
 }
 
+// maxConnectRetryDelay caps the backoff between connection attempts
+const maxConnectRetryDelay = 30 * time.Second
+
+// connect opens a connection pool and checks that the database answers
+func connect(connStr string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Test connection
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	return db, nil
+}
+
 // CloseDB closes the database connection
 func CloseDB() {
 	if DB != nil {
@@ -42,7 +42,316 @@ END;
 $$ LANGUAGE plpgsql;
 
 -- Trigger to automatically update search vector
-CREATE TRIGGER records_search_vector_update
+CREATE OR REPLACE TRIGGER records_search_vector_update
     BEFORE INSERT OR UPDATE ON records
     FOR EACH ROW
     EXECUTE FUNCTION update_search_vector();
+
+-- Keep the raw upload so files can be previewed and reprocessed
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS raw_content BYTEA;
+
+-- Data completeness computed after processing
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS completeness_score REAL;
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS column_stats JSONB;
+
+-- Audit log of file lifecycle changes (no FK so history survives deletion)
+CREATE TABLE IF NOT EXISTS csv_file_events (
+    id SERIAL PRIMARY KEY,
+    csv_file_id INT NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    old_status VARCHAR(50),
+    new_status VARCHAR(50),
+    actor VARCHAR(255) NOT NULL DEFAULT 'system',
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_csv_file_events_file_id ON csv_file_events(csv_file_id, occurred_at);
+
+-- Manual group merges/renames, re-applied whenever a file is regrouped
+CREATE TABLE IF NOT EXISTS group_overrides (
+    id SERIAL PRIMARY KEY,
+    csv_file_id INT NOT NULL REFERENCES csv_files(id) ON DELETE CASCADE,
+    source_category VARCHAR(100) NOT NULL,
+    target_category VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_overrides_file_id ON group_overrides(csv_file_id);
+
+-- Worksheet used when the upload was an Excel workbook
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS sheet_name VARCHAR(255);
+
+-- Per-upload processing options, reused when a file is reprocessed
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS processing_config JSONB;
+
+-- Optimistic locking: bumped on every status change
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 0;
+
+-- Per-row validation failures against the upload's column rules
+CREATE TABLE IF NOT EXISTS record_violations (
+    id SERIAL PRIMARY KEY,
+    csv_file_id INT NOT NULL REFERENCES csv_files(id) ON DELETE CASCADE,
+    record_id INT NOT NULL,
+    column_name VARCHAR(255) NOT NULL,
+    rule VARCHAR(50) NOT NULL,
+    value TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_record_violations_file_id ON record_violations(csv_file_id, record_id);
+
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS violation_count INT NOT NULL DEFAULT 0;
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS violation_summary JSONB;
+
+-- Learned term normalizations (variation -> canonical term)
+CREATE TABLE IF NOT EXISTS term_normalizations (
+    variation VARCHAR(255) PRIMARY KEY,
+    canonical_term VARCHAR(255) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Row-level issues so records with warnings or violations can be filtered on
+ALTER TABLE records ADD COLUMN IF NOT EXISTS row_number INT;
+ALTER TABLE records ADD COLUMN IF NOT EXISTS warning_count INT NOT NULL DEFAULT 0;
+ALTER TABLE records ADD COLUMN IF NOT EXISTS violation_count INT NOT NULL DEFAULT 0;
+ALTER TABLE records ADD COLUMN IF NOT EXISTS warnings JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_records_with_warnings ON records(csv_file_id, id) WHERE warning_count > 0;
+CREATE INDEX IF NOT EXISTS idx_records_with_violations ON records(csv_file_id, id) WHERE violation_count > 0;
+
+-- Per-stage processing time breakdown
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS timings JSONB;
+
+-- Text search configuration per file. Files that existed before this column was added
+-- were indexed in English; new files without a language use 'simple'.
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS search_language VARCHAR(64) DEFAULT 'english';
+ALTER TABLE csv_files ALTER COLUMN search_language DROP DEFAULT;
+
+CREATE OR REPLACE FUNCTION update_search_vector() RETURNS TRIGGER AS $$
+DECLARE
+    language REGCONFIG;
+BEGIN
+    SELECT COALESCE(search_language, 'simple')::regconfig INTO language
+    FROM csv_files WHERE id = NEW.csv_file_id;
+
+    NEW.search_vector := to_tsvector(COALESCE(language, 'simple'::regconfig),
+        COALESCE(NEW.cleaned_data::text, '') || ' ' ||
+        COALESCE(NEW.grouped_category, '')
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Trigram index for substring search. pg_trgm is optional: without it substring
+-- search still works, just without an index.
+DO $$
+BEGIN
+    CREATE EXTENSION IF NOT EXISTS pg_trgm;
+EXCEPTION WHEN OTHERS THEN
+    RAISE NOTICE 'pg_trgm is not available: %', SQLERRM;
+END
+$$;
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm') THEN
+        EXECUTE 'CREATE INDEX IF NOT EXISTS idx_records_cleaned_text_trgm ON records USING GIN ((cleaned_data::text) gin_trgm_ops)';
+    END IF;
+END
+$$;
+
+-- Upload idempotency keys, kept for 24 hours. response is NULL while the upload is in flight.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key TEXT PRIMARY KEY,
+    file_id INT,
+    response JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Mean embedding vector of each category, used to suggest groups for unmatched terms
+CREATE TABLE IF NOT EXISTS category_centroids (
+    category VARCHAR(255) PRIMARY KEY,
+    centroid DOUBLE PRECISION[] NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- PII masking: keyed hashes of redacted values, and which files were masked
+ALTER TABLE records ADD COLUMN IF NOT EXISTS pii_hashes JSONB;
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS pii_masked BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS masked_columns JSONB;
+
+-- Likely duplicate records, found on demand. One report per file; rerunning replaces it.
+CREATE TABLE IF NOT EXISTS dedupe_reports (
+    csv_file_id INT PRIMARY KEY REFERENCES csv_files(id) ON DELETE CASCADE,
+    status VARCHAR(50) NOT NULL, -- running, completed, failed
+    columns JSONB NOT NULL,
+    threshold REAL NOT NULL,
+    cluster_count INT NOT NULL DEFAULT 0,
+    error_message TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS dedupe_clusters (
+    id SERIAL PRIMARY KEY,
+    csv_file_id INT NOT NULL REFERENCES csv_files(id) ON DELETE CASCADE,
+    confidence REAL NOT NULL,
+    record_ids INT[] NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_dedupe_clusters_file_id ON dedupe_clusters(csv_file_id, confidence DESC);
+
+-- Free-form labels for telling files of different projects apart
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS idx_csv_files_tags ON csv_files USING GIN (tags);
+
+-- Human-friendly name and notes for files
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS display_name VARCHAR(200);
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS description TEXT;
+
+-- Owner of each upload, so teams sharing a deployment only see their own files
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_csv_files_owner ON csv_files(owner);
+
+-- What the cleaner and normalizer changed in each processed file
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS normalization_report JSONB;
+
+-- Smaller and faster than the default GIN index for the @> containment filters on cleaned values
+CREATE INDEX IF NOT EXISTS idx_records_cleaned_data_path ON records USING GIN (cleaned_data jsonb_path_ops);
+
+-- The file's own record key, e.g. an employee or order number
+ALTER TABLE records ADD COLUMN IF NOT EXISTS natural_key VARCHAR(255);
+
+-- Reprocessing writes a new generation of records next to the current one and
+-- switches over once it is complete, so readers never see a half-written file.
+-- Existing rows and files start out at generation 1.
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS active_generation INT NOT NULL DEFAULT 1;
+ALTER TABLE records ADD COLUMN IF NOT EXISTS generation INT NOT NULL DEFAULT 1;
+DROP INDEX IF EXISTS idx_records_natural_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_records_generation_natural_key ON records(csv_file_id, generation, natural_key);
+CREATE INDEX IF NOT EXISTS idx_records_file_generation ON records(csv_file_id, generation, id);
+
+-- Transient database errors (e.g. a failover) retried while processing a file
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS retry_count INT NOT NULL DEFAULT 0;
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS last_retry_error TEXT;
+
+-- Named bundles of upload options, applied with profile=<name>
+CREATE TABLE IF NOT EXISTS processing_profiles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    options JSONB NOT NULL,
+    version INT NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Recurring imports of a CSV published at a URL
+CREATE TABLE IF NOT EXISTS import_schedules (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    cron VARCHAR(100),
+    interval_seconds INT,
+    profile VARCHAR(100),
+    owner VARCHAR(255) NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMPTZ NOT NULL,
+    last_run_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_schedules_due ON import_schedules(next_run_at) WHERE enabled;
+
+-- One row per time a schedule fired; the outcome of an import is its file's status
+CREATE TABLE IF NOT EXISTS schedule_runs (
+    id SERIAL PRIMARY KEY,
+    schedule_id INT NOT NULL REFERENCES import_schedules(id) ON DELETE CASCADE,
+    csv_file_id INT,
+    status VARCHAR(50) NOT NULL,
+    error_message TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule_id ON schedule_runs(schedule_id, started_at);
+
+-- raw_content is gzip-compressed unless this says identity
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS raw_content_encoding VARCHAR(10) NOT NULL DEFAULT 'identity';
+
+-- Structured detail of timeline events, e.g. row counts and error messages
+ALTER TABLE csv_file_events ADD COLUMN IF NOT EXISTS detail JSONB;
+
+-- Line of the uploaded file each record starts on, so it can be found in the source
+ALTER TABLE records ADD COLUMN IF NOT EXISTS line_number INT;
+CREATE INDEX IF NOT EXISTS idx_records_file_line ON records(csv_file_id, generation, line_number);
+
+-- Datasets read several files as one; members leave a dataset when their file is deleted
+CREATE TABLE IF NOT EXISTS datasets (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    owner VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS dataset_files (
+    dataset_id INT NOT NULL REFERENCES datasets(id) ON DELETE CASCADE,
+    csv_file_id INT NOT NULL REFERENCES csv_files(id) ON DELETE CASCADE,
+    PRIMARY KEY (dataset_id, csv_file_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_dataset_files_file ON dataset_files(csv_file_id);
+
+-- Every group a record matches, its primary grouped_category first. Records stored
+-- before this column existed are read as having only their primary group.
+ALTER TABLE records ADD COLUMN IF NOT EXISTS grouped_categories TEXT[];
+
+-- Background field-level diffs of two files matched on a key column
+CREATE TABLE IF NOT EXISTS diff_jobs (
+    id SERIAL PRIMARY KEY,
+    file_a INT NOT NULL REFERENCES csv_files(id) ON DELETE CASCADE,
+    file_b INT NOT NULL REFERENCES csv_files(id) ON DELETE CASCADE,
+    key_column TEXT NOT NULL,
+    owner VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(50) NOT NULL, -- running, completed, failed
+    added_count INT NOT NULL DEFAULT 0,
+    removed_count INT NOT NULL DEFAULT 0,
+    changed_count INT NOT NULL DEFAULT 0,
+    duplicate_count INT NOT NULL DEFAULT 0,
+    error_message TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+-- One row per key of a diff job; detail holds the record, the changed values or the
+-- duplicate counts, with encrypted columns kept encrypted
+CREATE TABLE IF NOT EXISTS diff_entries (
+    id SERIAL PRIMARY KEY,
+    job_id INT NOT NULL REFERENCES diff_jobs(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL, -- added, removed, changed, duplicates
+    key TEXT NOT NULL,
+    detail JSONB NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_diff_entries_job ON diff_entries(job_id, kind, key);
+
+-- Containment lookups on whole records. Search terms that look like complete values
+-- (emails, order numbers, dates) are matched with cleaned_data @> '{"column": "value"}',
+-- served by idx_records_cleaned_data and idx_records_cleaned_data_path above instead
+-- of a substring scan of every record; this one does the same for the values as
+-- uploaded. The trade-off is size: a GIN index over whole records can grow as large
+-- as the JSONB it covers and slows every insert, in exchange for turning exact-value
+-- lookups from a full scan into an index scan. jsonb_path_ops keeps it to roughly
+-- half the size of the default operator class, at the cost of supporting only @>.
+CREATE INDEX IF NOT EXISTS idx_records_original_data_path ON records USING GIN (original_data jsonb_path_ops);
+
+-- Uploads per client address per UTC day, for MAX_UPLOADS_PER_IP_PER_DAY. Rows from
+-- before yesterday are pruned hourly.
+CREATE TABLE IF NOT EXISTS upload_quota_log (
+    ip_address TEXT NOT NULL,
+    upload_count INT NOT NULL DEFAULT 0,
+    date DATE NOT NULL,
+    PRIMARY KEY (ip_address, date)
+);
+
+-- Hex SHA-256 of an upload whose client-sent checksum matched the bytes received
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS content_sha256 TEXT;
+
+-- Columns likely holding personal data, detected while processing: column -> email, phone, name or address
+ALTER TABLE csv_files ADD COLUMN IF NOT EXISTS pii_columns JSONB;
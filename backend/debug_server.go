@@ -0,0 +1,43 @@
+package main
+
+import (
+	"csv-processor/config"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"time"
+)
+
+// newDebugServer returns the pprof server, or nil unless ENABLE_PPROF=true. It
+// listens on its own port, DEBUG_PORT, so profiles are never reachable through the
+// API and the port can be kept off the public network.
+func newDebugServer() *http.Server {
+	if config.GetEnv("ENABLE_PPROF", "false") != "true" {
+		return nil
+	}
+
+	addr := config.GetEnv("DEBUG_PORT", ":6060")
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	if config.GetEnv("GIN_MODE", "") == "release" || config.GetEnv("APP_ENV", "") == "production" {
+		log.Printf("Warning: pprof is enabled in production on %s; profiles expose memory contents and cost CPU while running", addr)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile) // CPU profile, ?seconds=30 by default
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
+	mux.Handle("/debug/pprof/heap", pprof.Handler("heap"))
+
+	// No write timeout: CPU profiles and traces stream for as long as requested
+	return &http.Server{
+		Handler:     mux,
+		Addr:        addr,
+		ReadTimeout: 60 * time.Second,
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultAggregateLimit = 10
+	maxAggregateLimit     = 100
+)
+
+// HandleAggregate returns record counts per distinct value of a column,
+// optionally with the sum or average of a numeric column per bucket
+func (h *Handler) HandleAggregate(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	params, ok := parseAggregateParams(w, r)
+	if !ok {
+		return
+	}
+
+	file, err := h.dbService.GetCSVFile(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+		return
+	}
+
+	// Only allow columns that actually exist in the file
+	headers, err := h.dbService.GetFileHeaders(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching headers: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	if !params.checkColumns(w, headers, h.dbService.IsEncryptedColumn) {
+		return
+	}
+
+	response, err := h.aggregator.Aggregate(file, params.by, params.metric, params.of, params.limit)
+	if err != nil {
+		writeQueryError(w, "Error aggregating records: ", err)
+		return
+	}
+
+	if file.Status == "completed" {
+		w.Header().Set("Cache-Control", "private, max-age=300")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// aggregateParams are the query parameters of an aggregate request
+type aggregateParams struct {
+	by, metric, of string
+	limit          int
+}
+
+// parseAggregateParams reads the by, metric, of and limit query parameters,
+// answering 400 and returning false if they are invalid
+func parseAggregateParams(w http.ResponseWriter, r *http.Request) (*aggregateParams, bool) {
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "by parameter is required"}, http.StatusBadRequest)
+		return nil, false
+	}
+
+	metric := r.URL.Query().Get("metric")
+	of := r.URL.Query().Get("of")
+	if metric != "" && metric != "sum" && metric != "avg" {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "metric must be sum or avg"}, http.StatusBadRequest)
+		return nil, false
+	}
+	if (metric == "") != (of == "") {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "metric and of must be provided together"}, http.StatusBadRequest)
+		return nil, false
+	}
+
+	limit := defaultAggregateLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= maxAggregateLimit {
+			limit = l
+		}
+	}
+	return &aggregateParams{by: by, metric: metric, of: of, limit: limit}, true
+}
+
+// checkColumns answers 400 and returns false unless the by and of columns are
+// among headers and not encrypted at rest
+func (p *aggregateParams) checkColumns(w http.ResponseWriter, headers []string, isEncrypted func(column string) bool) bool {
+	known := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		known[header] = true
+	}
+	for _, column := range []string{p.by, p.of} {
+		if column != "" && !known[column] {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Unknown column: " + column}, http.StatusBadRequest)
+			return false
+		}
+		// Encrypted values are unique per record, so they can't be grouped or summed
+		if column != "" && isEncrypted(column) {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Column " + column + " is encrypted at rest and cannot be aggregated"}, http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"csv-processor/services"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAggregateCheckColumns(t *testing.T) {
+	db := services.NewDBService()
+	encryptor, err := services.NewFieldEncryptor(base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetFieldEncryption(encryptor, []string{"Email", "Salary"})
+	headers := []string{"Department", "email", "Salary", "Age"}
+
+	tests := []struct {
+		name   string
+		params aggregateParams
+		wantOK bool
+	}{
+		{"plain columns", aggregateParams{by: "Department", metric: "avg", of: "Age"}, true},
+		{"unknown column", aggregateParams{by: "Team"}, false},
+		{"encrypted by", aggregateParams{by: "email"}, false},
+		{"encrypted of", aggregateParams{by: "Department", metric: "sum", of: "Salary"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			if ok := tt.params.checkColumns(rec, headers, db.IsEncryptedColumn); ok != tt.wantOK {
+				t.Fatalf("checkColumns() = %v, want %v", ok, tt.wantOK)
+			}
+			if tt.wantOK {
+				return
+			}
+			var apiErr APIError
+			json.NewDecoder(rec.Body).Decode(&apiErr)
+			if rec.Code != http.StatusBadRequest || apiErr.Code != ErrCodeInvalidInput {
+				t.Errorf("status %d, code %q, want 400 %s", rec.Code, apiErr.Code, ErrCodeInvalidInput)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"bytes"
+	"csv-processor/models"
+	"csv-processor/services"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// storeUploadParts creates a file per part of an upload and processes each in the
+// background, responding with their IDs. archive names the zip the parts came from,
+// if any.
+func (h *Handler) storeUploadParts(w http.ResponseWriter, r *http.Request, parts []*services.UploadPart, skipped []*models.SkippedEntry, archive, message string) {
+	cfg, ok := h.uploadConfig(w, r)
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("dryRun") == "true" {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Dry runs need a single file, but this upload creates several"}, http.StatusBadRequest)
+		return
+	}
+	searchLanguage, ok := h.uploadSearchLanguage(w, r)
+	if !ok {
+		return
+	}
+
+	// Either every part gets a file or none does
+	files := make([]*models.CSVFile, 0, len(parts))
+	for _, part := range parts {
+		csvFile, err := h.createUploadedFile(r, part.Filename, int64(len(part.Raw)), part.Raw, part.SheetName, searchLanguage, cfg, archive, "")
+		if err != nil {
+			for _, created := range files {
+				if err := h.dbService.DeleteCSVFile(created.ID, "api"); err != nil {
+					log.Printf("Error deleting file %d of a failed upload: %v", created.ID, err)
+				}
+			}
+			WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error creating file record for " + part.Filename + ": " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		files = append(files, csvFile)
+	}
+
+	response := models.UploadResponse{
+		Message: message,
+		Files:   files,
+		Skipped: skipped,
+		Mode:    "async",
+	}
+	for i, csvFile := range files {
+		h.asyncProcessor.ProcessCSVAsync(h.ctx, csvFile.ID, bytes.NewReader(parts[i].Content), cfg)
+		response.FileIDs = append(response.FileIDs, csvFile.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"csv-processor/services"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// uploadChecksums reads the digests sent with an upload: a SHA-256 in the
+// contentSha256 form field or X-Content-SHA256 header, and an MD5 in the Content-MD5
+// header, each in hex or base64. The form must already be parsed.
+func uploadChecksums(r *http.Request) ([]*services.ContentChecksum, error) {
+	sha256Value, source := strings.TrimSpace(r.FormValue("contentSha256")), "contentSha256"
+	if sha256Value == "" {
+		sha256Value, source = strings.TrimSpace(r.Header.Get("X-Content-SHA256")), "X-Content-SHA256"
+	}
+	return services.ParseContentChecksums(sha256Value, source, strings.TrimSpace(r.Header.Get("Content-MD5")))
+}
+
+// verifyUploadChecksum checks the uploaded bytes against the digests the client sent,
+// so a truncated or corrupted upload is refused before any file is created. It
+// returns the hex SHA-256 of the bytes once a digest matched, "" when none was sent,
+// and false after answering 400 for a malformed digest or 422 for a mismatch.
+func verifyUploadChecksum(w http.ResponseWriter, r *http.Request, received []byte) (string, bool) {
+	checksums, err := uploadChecksums(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+		return "", false
+	}
+
+	sum, err := services.VerifyContentChecksums(checksums, received)
+	var mismatch *services.ChecksumMismatchError
+	if errors.As(err, &mismatch) {
+		WriteError(w, APIError{
+			Code:    ErrCodeChecksumMismatch,
+			Message: mismatch.Error() + "; the upload may have been truncated",
+			Details: map[string]interface{}{
+				"expected":      hex.EncodeToString(mismatch.Expected),
+				"actual":        hex.EncodeToString(mismatch.Actual),
+				"receivedBytes": mismatch.Size,
+			},
+		}, http.StatusUnprocessableEntity)
+		return "", false
+	}
+	return sum, true
+}
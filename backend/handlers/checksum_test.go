@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestVerifyUploadChecksum(t *testing.T) {
+	content := []byte("name,title\nAda Lovelace,Software Engineer\n")
+	sha := sha256.Sum256(content)
+	md := md5.Sum(content)
+	shaHex := hex.EncodeToString(sha[:])
+	otherSHA := sha256.Sum256([]byte("name,title\nAda Lovelace,Soft"))
+
+	tests := []struct {
+		name       string
+		header     map[string]string
+		form       url.Values
+		wantOK     bool
+		wantSum    string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "no digest", wantOK: true},
+		{name: "sha-256 header in hex", header: map[string]string{"X-Content-SHA256": shaHex}, wantOK: true, wantSum: shaHex},
+		{name: "sha-256 header in base64", header: map[string]string{"X-Content-SHA256": base64.StdEncoding.EncodeToString(sha[:])}, wantOK: true, wantSum: shaHex},
+		{name: "sha-256 form field", form: url.Values{"contentSha256": {strings.ToUpper(shaHex)}}, wantOK: true, wantSum: shaHex},
+		{name: "content-md5", header: map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(md[:])}, wantOK: true, wantSum: shaHex},
+		{name: "sha-256 mismatch", header: map[string]string{"X-Content-SHA256": hex.EncodeToString(otherSHA[:])}, wantStatus: http.StatusUnprocessableEntity, wantCode: ErrCodeChecksumMismatch},
+		{name: "md5 mismatch", header: map[string]string{"X-Content-SHA256": shaHex, "Content-MD5": base64.StdEncoding.EncodeToString(make([]byte, md5.Size))}, wantStatus: http.StatusUnprocessableEntity, wantCode: ErrCodeChecksumMismatch},
+		{name: "malformed digest", header: map[string]string{"X-Content-SHA256": "abc"}, wantStatus: http.StatusBadRequest, wantCode: ErrCodeInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/upload", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+			req.ParseForm()
+			rec := httptest.NewRecorder()
+
+			sum, ok := verifyUploadChecksum(rec, req, content)
+			if ok != tt.wantOK {
+				t.Fatalf("verifyUploadChecksum() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok {
+				if sum != tt.wantSum {
+					t.Errorf("verifyUploadChecksum() sum = %q, want %q", sum, tt.wantSum)
+				}
+				if rec.Body.Len() != 0 {
+					t.Errorf("accepted upload got a response: %s", rec.Body.String())
+				}
+				return
+			}
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if apiErr := decodeAPIError(t, rec); apiErr.Code != tt.wantCode {
+				t.Errorf("error code = %q, want %q", apiErr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestVerifyUploadChecksumMismatchDetails(t *testing.T) {
+	content := []byte("name\nAda\n")
+	expected := sha256.Sum256([]byte("name\nAda\nGrace\n"))
+	actual := sha256.Sum256(content)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", nil)
+	req.Header.Set("X-Content-SHA256", hex.EncodeToString(expected[:]))
+	rec := httptest.NewRecorder()
+	if _, ok := verifyUploadChecksum(rec, req, content); ok {
+		t.Fatal("verifyUploadChecksum() accepted a truncated upload")
+	}
+
+	var body struct {
+		Details struct {
+			Expected      string `json:"expected"`
+			Actual        string `json:"actual"`
+			ReceivedBytes int    `json:"receivedBytes"`
+		} `json:"details"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("body is not an API error: %v", err)
+	}
+	if body.Details.Expected != hex.EncodeToString(expected[:]) || body.Details.Actual != hex.EncodeToString(actual[:]) || body.Details.ReceivedBytes != len(content) {
+		t.Errorf("details = %+v, want expected and actual digests and %d bytes received", body.Details, len(content))
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"csv-processor/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// maxClassifyValues caps the number of values classified in one request
+const maxClassifyValues = 500
+
+// HandleClassify explains how each given value would be cleaned, normalized and
+// grouped, without storing anything
+func (h *Handler) HandleClassify(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Values map[string]string `json:"values"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+	if len(req.Values) == 0 {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "values is required"}, http.StatusBadRequest)
+		return
+	}
+	if len(req.Values) > maxClassifyValues {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: fmt.Sprintf("Too many values (max %d)", maxClassifyValues)}, http.StatusBadRequest)
+		return
+	}
+
+	fields := make([]string, 0, len(req.Values))
+	for field := range req.Values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	results := make([]*models.ClassifyResult, 0, len(fields))
+	for _, field := range fields {
+		results = append(results, h.csvProcessor.Classify(field, req.Values[field]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+		"count":   len(results),
+	})
+}
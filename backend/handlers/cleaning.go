@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HandleGetCasingExceptions lists the terms whose casing survives title casing
+func (h *Handler) HandleGetCasingExceptions(w http.ResponseWriter, r *http.Request) {
+	terms := h.csvProcessor.Cleaner().CasingExceptions()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"terms": terms,
+		"count": len(terms),
+	})
+}
+
+// HandleAddCasingExceptions registers more casing exceptions. They apply to files
+// processed from now on.
+func (h *Handler) HandleAddCasingExceptions(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Terms []string `json:"terms"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+	if len(req.Terms) == 0 {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "terms is required"}, http.StatusBadRequest)
+		return
+	}
+
+	cleaner := h.csvProcessor.Cleaner()
+	cleaner.AddCasingExceptions(req.Terms...)
+	terms := cleaner.CasingExceptions()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"terms": terms,
+		"count": len(terms),
+	})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// HandleCompareFiles reports the records added, removed and changed between two
+// files, matching records on a key column present in both
+func (h *Handler) HandleCompareFiles(w http.ResponseWriter, r *http.Request) {
+	fileA, errA := strconv.Atoi(r.URL.Query().Get("fileA"))
+	fileB, errB := strconv.Atoi(r.URL.Query().Get("fileB"))
+	if errA != nil || errB != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "fileA and fileB must be file IDs"}, http.StatusBadRequest)
+		return
+	}
+	keyColumn := r.URL.Query().Get("keyColumn")
+	if !h.checkKeyColumn(w, keyColumn) {
+		return
+	}
+
+	for _, fileID := range []int{fileA, fileB} {
+		if _, err := h.dbService.GetCSVFile(fileID); err != nil {
+			WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+			return
+		}
+		if !h.checkFileHasKey(w, fileID, keyColumn) {
+			return
+		}
+	}
+
+	diff, err := h.dbService.CompareFiles(fileA, fileB, keyColumn)
+	if err != nil {
+		writeQueryError(w, "Error comparing files: ", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diff)
+}
+
+// checkKeyColumn answers 400 and returns false if records can't be matched on
+// keyColumn
+func (h *Handler) checkKeyColumn(w http.ResponseWriter, keyColumn string) bool {
+	if keyColumn == "" {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "keyColumn is required"}, http.StatusBadRequest)
+		return false
+	}
+	// Encrypted values never match across records, so they can't be joined on
+	if h.dbService.IsEncryptedColumn(keyColumn) {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "keyColumn is encrypted at rest and cannot be used as a key"}, http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// checkFileHasKey answers 400 and returns false unless keyColumn is one of the
+// file's columns
+func (h *Handler) checkFileHasKey(w http.ResponseWriter, fileID int, keyColumn string) bool {
+	headers, err := h.dbService.GetFileHeaders(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching headers: " + err.Error()}, http.StatusInternalServerError)
+		return false
+	}
+	for _, header := range headers {
+		if header == keyColumn {
+			return true
+		}
+	}
+	WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Unknown key column for file " + strconv.Itoa(fileID) + ": " + keyColumn}, http.StatusBadRequest)
+	return false
+}
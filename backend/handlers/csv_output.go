@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"csv-processor/models"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// recordsFormat returns how records should be written: json, csv or ndjson, from the
+// format parameter or else the Accept header
+func recordsFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "json", "csv", "ndjson":
+		return format, nil
+	case "":
+		accept := r.Header.Get("Accept")
+		if strings.Contains(accept, "text/csv") {
+			return "csv", nil
+		}
+		if strings.Contains(accept, "application/x-ndjson") {
+			return "ndjson", nil
+		}
+		return "json", nil
+	default:
+		return "", fmt.Errorf("format must be json, csv or ndjson, got %q", format)
+	}
+}
+
+// csvColumns returns the cleaned data keys of the first record, in the order of
+// the file's headers where known
+func csvColumns(records []*models.Record, fileHeaders []string) []string {
+	if len(records) == 0 {
+		return nil
+	}
+	first := records[0].CleanedData
+	columns := make([]string, 0, len(first))
+	seen := make(map[string]bool, len(first))
+	for _, header := range fileHeaders {
+		if _, ok := first[header]; ok && !seen[header] {
+			seen[header] = true
+			columns = append(columns, header)
+		}
+	}
+	var rest []string
+	for key := range first {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	return append(columns, rest...)
+}
+
+// writeRecordsCSV writes the cleaned data of records as CSV with a header row.
+// includeLine prepends each record's line number in the uploaded file.
+func writeRecordsCSV(w http.ResponseWriter, records []*models.Record, fileHeaders []string, includeLine bool) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="records.csv"`)
+
+	columns := csvColumns(records, fileHeaders)
+	if len(columns) == 0 {
+		return
+	}
+
+	header := columns
+	if includeLine {
+		header = append([]string{"line_number"}, columns...)
+	}
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	row := make([]string, len(header))
+	for _, record := range records {
+		cells := row
+		if includeLine {
+			row[0] = ""
+			if record.LineNumber > 0 {
+				row[0] = strconv.Itoa(record.LineNumber)
+			}
+			cells = row[1:]
+		}
+		for i, column := range columns {
+			cells[i] = record.CleanedData[column]
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("Error writing CSV records: %v", err)
+	}
+}
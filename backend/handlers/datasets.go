@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"csv-processor/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maxDatasetFiles is how many files a dataset may read together
+const maxDatasetFiles = 100
+
+// datasetRequest is the body of POST /api/datasets
+type datasetRequest struct {
+	Name    string `json:"name"`
+	FileIDs []int  `json:"fileIds"`
+}
+
+// recordSource is what a records request reads: a single file, or the files of a
+// dataset
+type recordSource struct {
+	fileIDs []int
+	dataset *models.Dataset // nil for a single file
+}
+
+// noun names the source in messages
+func (s *recordSource) noun() string {
+	if s.dataset != nil {
+		return "dataset"
+	}
+	return "file"
+}
+
+// limiterKey is the search limiter bucket of the source. Datasets get their own,
+// kept apart from the files' by a negative key.
+func (s *recordSource) limiterKey() int {
+	if s.dataset != nil {
+		return -s.dataset.ID
+	}
+	return s.fileIDs[0]
+}
+
+// recordSourceParam reads the fileId or datasetId query parameter of a records
+// request, answering 400 or 404 and returning false if it names nothing readable
+func (h *Handler) recordSourceParam(w http.ResponseWriter, r *http.Request) (*recordSource, bool) {
+	datasetParam := r.URL.Query().Get("datasetId")
+	if datasetParam == "" {
+		fileID, ok := h.fileIDParam(w, r)
+		if !ok {
+			return nil, false
+		}
+		return &recordSource{fileIDs: []int{fileID}}, true
+	}
+	if r.URL.Query().Get("fileId") != "" {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "fileId and datasetId cannot be combined"}, http.StatusBadRequest)
+		return nil, false
+	}
+	datasetID, perr := intParam(r, "datasetId", 0, 1, 0)
+	if perr != nil {
+		writeParamError(w, perr)
+		return nil, false
+	}
+	dataset, ok := h.findDataset(w, r, datasetID)
+	if !ok {
+		return nil, false
+	}
+	return &recordSource{fileIDs: dataset.FileIDs, dataset: dataset}, true
+}
+
+// sourceHeaders returns the columns of the given files, in the order they first
+// appear
+func (h *Handler) sourceHeaders(fileIDs []int) ([]string, error) {
+	var headers []string
+	seen := make(map[string]bool)
+	for _, fileID := range fileIDs {
+		fileHeaders, err := h.dbService.GetFileHeaders(fileID)
+		if err != nil {
+			return nil, err
+		}
+		for _, header := range fileHeaders {
+			if !seen[header] {
+				seen[header] = true
+				headers = append(headers, header)
+			}
+		}
+	}
+	return headers, nil
+}
+
+// attachViolations embeds each record's violations, for records of any number of
+// files
+func (h *Handler) attachViolations(records []*models.Record) error {
+	byFile := make(map[int][]*models.Record)
+	var fileIDs []int
+	for _, record := range records {
+		if _, ok := byFile[record.CSVFileID]; !ok {
+			fileIDs = append(fileIDs, record.CSVFileID)
+		}
+		byFile[record.CSVFileID] = append(byFile[record.CSVFileID], record)
+	}
+	for _, fileID := range fileIDs {
+		if err := h.dbService.AttachViolations(fileID, byFile[fileID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sourceFilenames maps the files of a dataset to their names, or returns nil for a
+// single file, whose records need no provenance
+func (h *Handler) sourceFilenames(source *recordSource) (map[int]string, error) {
+	if source.dataset == nil {
+		return nil, nil
+	}
+	return h.dbService.GetFilenames(source.fileIDs)
+}
+
+// setSourceFilenames tells each record of a dataset listing which file it came from
+func (h *Handler) setSourceFilenames(source *recordSource, records []*models.Record) error {
+	if source.dataset == nil || len(records) == 0 {
+		return nil
+	}
+	names, err := h.sourceFilenames(source)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		record.SourceFilename = names[record.CSVFileID]
+	}
+	return nil
+}
+
+// sourceGroups returns the record IDs of each group across the source's files.
+// noCache reads them from the database instead of the group cache.
+func (h *Handler) sourceGroups(source *recordSource, noCache bool) (map[string][]int, error) {
+	merged := make(map[string][]int)
+	for _, fileID := range source.fileIDs {
+		var groups map[string][]int
+		var err error
+		if noCache {
+			groups, err = h.dbService.GetGroupsByFileID(fileID)
+		} else {
+			groups, err = h.groups.Get(fileID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(source.fileIDs) == 1 {
+			return groups, nil
+		}
+		for group, ids := range groups {
+			merged[group] = append(merged[group], ids...)
+		}
+	}
+	return merged, nil
+}
+
+// findDataset loads a dataset visible to the requesting owner, answering 404 if
+// there is none
+func (h *Handler) findDataset(w http.ResponseWriter, r *http.Request, id int) (*models.Dataset, bool) {
+	scope, err := h.ownerScope(r)
+	if err != nil {
+		writeOwnerScopeError(w, err)
+		return nil, false
+	}
+	dataset, err := h.dbService.GetDataset(id, scope)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeNotFound, Message: fmt.Sprintf("Dataset %d not found", id)}, http.StatusNotFound)
+		return nil, false
+	}
+	return dataset, true
+}
+
+// loadDataset loads the dataset named by the {datasetId} path variable
+func (h *Handler) loadDataset(w http.ResponseWriter, r *http.Request) (*models.Dataset, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["datasetId"])
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid dataset ID"}, http.StatusBadRequest)
+		return nil, false
+	}
+	return h.findDataset(w, r, id)
+}
+
+// HandleCreateDataset creates a dataset reading the given files as one
+func (h *Handler) HandleCreateDataset(w http.ResponseWriter, r *http.Request) {
+	var req datasetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "name is required"}, http.StatusBadRequest)
+		return
+	}
+	if len(req.FileIDs) == 0 {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "fileIds must list at least one file"}, http.StatusBadRequest)
+		return
+	}
+	if len(req.FileIDs) > maxDatasetFiles {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: fmt.Sprintf("A dataset can hold at most %d files", maxDatasetFiles)}, http.StatusBadRequest)
+		return
+	}
+
+	scope, err := h.ownerScope(r)
+	if err != nil {
+		writeOwnerScopeError(w, err)
+		return
+	}
+	seen := make(map[int]bool, len(req.FileIDs))
+	for _, fileID := range req.FileIDs {
+		if fileID <= 0 || seen[fileID] {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "fileIds must be distinct positive file IDs"}, http.StatusBadRequest)
+			return
+		}
+		seen[fileID] = true
+
+		visible, err := h.dbService.FileVisible(fileID, scope)
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error checking file access: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		if !visible {
+			WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: fmt.Sprintf("File %d not found", fileID)}, http.StatusNotFound)
+			return
+		}
+	}
+
+	dataset, err := h.dbService.CreateDataset(req.Name, requestOwner(r), req.FileIDs)
+	if err != nil {
+		writeQueryError(w, "Error creating dataset: ", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(dataset)
+}
+
+// HandleListDatasets lists the datasets of the requesting owner
+func (h *Handler) HandleListDatasets(w http.ResponseWriter, r *http.Request) {
+	scope, err := h.ownerScope(r)
+	if err != nil {
+		writeOwnerScopeError(w, err)
+		return
+	}
+	datasets, err := h.dbService.ListDatasets(scope)
+	if err != nil {
+		writeQueryError(w, "Error fetching datasets: ", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"datasets": datasets,
+		"count":    len(datasets),
+	})
+}
+
+// HandleGetDataset returns a dataset with its current files
+func (h *Handler) HandleGetDataset(w http.ResponseWriter, r *http.Request) {
+	dataset, ok := h.loadDataset(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dataset)
+}
+
+// HandleDeleteDataset removes a dataset. Its files stay.
+func (h *Handler) HandleDeleteDataset(w http.ResponseWriter, r *http.Request) {
+	dataset, ok := h.loadDataset(w, r)
+	if !ok {
+		return
+	}
+	if err := h.dbService.DeleteDataset(dataset.ID); err != nil {
+		writeQueryError(w, "Error deleting dataset: ", err)
+		return
+	}
+	h.searchLimiter.forget(-dataset.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDatasetAggregate builds a group-by breakdown across the files of a dataset,
+// with the parameters of the file aggregate endpoint
+func (h *Handler) HandleDatasetAggregate(w http.ResponseWriter, r *http.Request) {
+	params, ok := parseAggregateParams(w, r)
+	if !ok {
+		return
+	}
+	dataset, ok := h.loadDataset(w, r)
+	if !ok {
+		return
+	}
+
+	headers, err := h.sourceHeaders(dataset.FileIDs)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching headers: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	if !params.checkColumns(w, headers, h.dbService.IsEncryptedColumn) {
+		return
+	}
+
+	response, err := h.aggregator.AggregateDataset(dataset, params.by, params.metric, params.of, params.limit)
+	if err != nil {
+		writeQueryError(w, "Error aggregating records: ", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
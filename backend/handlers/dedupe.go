@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"csv-processor/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultDedupeThreshold is the similarity two records need to be reported as likely
+// duplicates when the request doesn't set one
+const defaultDedupeThreshold = 0.85
+
+// HandleStartDedupeReport starts a search for likely duplicate records of a file,
+// comparing the columns given as {"columns": [...], "threshold": 0.85}. The report
+// is built in the background; poll GET on the same path for its status.
+func (h *Handler) HandleStartDedupeReport(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Columns   []string `json:"columns"`
+		Threshold *float64 `json:"threshold"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+	if len(req.Columns) == 0 {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "columns is required"}, http.StatusBadRequest)
+		return
+	}
+	threshold := defaultDedupeThreshold
+	if req.Threshold != nil {
+		threshold = *req.Threshold
+	}
+	if threshold <= 0 || threshold > 1 {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "threshold must be greater than 0 and at most 1"}, http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.dbService.GetCSVFile(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+		return
+	}
+	if file.Status != "completed" {
+		WriteError(w, APIError{Code: ErrCodeConflict, Message: "File is not processed"}, http.StatusConflict)
+		return
+	}
+
+	// Columns are matched to the cleaned headers case-insensitively
+	headers, err := h.dbService.GetFileHeaders(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching headers: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	columns := make([]string, 0, len(req.Columns))
+	for _, column := range req.Columns {
+		found := ""
+		for _, header := range headers {
+			if strings.EqualFold(header, strings.TrimSpace(column)) {
+				found = header
+				break
+			}
+		}
+		if found == "" {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Unknown column: " + column}, http.StatusBadRequest)
+			return
+		}
+		columns = append(columns, found)
+	}
+
+	report, err := h.deduplicator.StartReport(h.ctx, fileID, columns, threshold)
+	if errors.Is(err, models.ErrReportRunning) {
+		WriteError(w, APIError{Code: ErrCodeConflict, Message: "A dedupe report for this file is still running"}, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error starting dedupe report: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(report)
+}
+
+// HandleGetDedupeReport returns the status of a file's dedupe report and a page of
+// its clusters, each with its member records side by side
+func (h *Handler) HandleGetDedupeReport(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	page := 1
+	perPage := 20
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if pp, err := strconv.Atoi(r.URL.Query().Get("perPage")); err == nil && pp > 0 && pp <= 100 {
+		perPage = pp
+	}
+	offset := (page - 1) * perPage
+
+	report, err := h.dbService.GetDedupeReport(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching dedupe report: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	if report == nil {
+		WriteError(w, APIError{Code: ErrCodeNotFound, Message: "No dedupe report for this file"}, http.StatusNotFound)
+		return
+	}
+
+	clusters, err := h.dbService.GetDedupeClusters(fileID, perPage, offset)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching dedupe clusters: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	// Fetch the members of every cluster on the page at once
+	var ids []int
+	for _, cluster := range clusters {
+		ids = append(ids, cluster.RecordIDs...)
+	}
+	if len(ids) > 0 {
+		records, err := h.dbService.GetRecordsByIDs(fileID, ids)
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching records: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		byID := make(map[int]*models.Record, len(records))
+		for _, record := range records {
+			byID[record.ID] = record
+		}
+		for _, cluster := range clusters {
+			for _, id := range cluster.RecordIDs {
+				if record, ok := byID[id]; ok {
+					cluster.Records = append(cluster.Records, record)
+				}
+			}
+		}
+	}
+
+	pages := totalPages(report.ClusterCount, perPage)
+	setPaginationLinks(w, r, page, pages)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"report":     report,
+		"clusters":   clusters,
+		"count":      len(clusters),
+		"page":       page,
+		"perPage":    perPage,
+		"totalPages": pages,
+		"hasMore":    page < pages,
+	})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"csv-processor/models"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// diffFlushInterval is how many diff entries are written between flushes
+const diffFlushInterval = 500
+
+// HandleGetFileDiff streams every cell the cleaner changed as a JSON array of
+// {recordId, field, original, cleaned}. ?field= limits it to one column.
+func (h *Handler) HandleGetFileDiff(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.dbService.GetCSVFile(fileID); err != nil {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	written := 0
+	err = h.dbService.StreamDiff(fileID, r.URL.Query().Get("field"), func(entry models.DiffEntry) error {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		separator := ","
+		if written == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			separator = "["
+		}
+		if _, err := w.Write(append([]byte(separator), data...)); err != nil {
+			return err
+		}
+		written++
+		if flusher != nil && written%diffFlushInterval == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+
+	if err != nil {
+		// Once the array has started the status is already sent; the client sees it truncated
+		if written == 0 {
+			writeQueryError(w, "Error computing diff: ", err)
+			return
+		}
+		log.Printf("Error streaming diff for file %d after %d entries: %v", fileID, written, err)
+		return
+	}
+
+	if written == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("["))
+	}
+	w.Write([]byte("]"))
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"csv-processor/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// diffJobRequest is the body of POST /api/diff
+type diffJobRequest struct {
+	FileIDA   int    `json:"fileIdA"`
+	FileIDB   int    `json:"fileIdB"`
+	KeyColumn string `json:"keyColumn"`
+}
+
+// HandleStartDiff starts a field-level diff of two processed files, matching their
+// records on the cleaned value of a key column present in both. The diff is built
+// in the background; poll GET /api/diff/{jobId} for its status and entries.
+func (h *Handler) HandleStartDiff(w http.ResponseWriter, r *http.Request) {
+	var req diffJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+	if req.FileIDA <= 0 || req.FileIDB <= 0 || req.FileIDA == req.FileIDB {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "fileIdA and fileIdB must be two different file IDs"}, http.StatusBadRequest)
+		return
+	}
+	if !h.checkKeyColumn(w, req.KeyColumn) {
+		return
+	}
+
+	scope, err := h.ownerScope(r)
+	if err != nil {
+		writeOwnerScopeError(w, err)
+		return
+	}
+	for _, fileID := range []int{req.FileIDA, req.FileIDB} {
+		visible, err := h.dbService.FileVisible(fileID, scope)
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error checking file access: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		if !visible {
+			WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: fmt.Sprintf("File %d not found", fileID)}, http.StatusNotFound)
+			return
+		}
+		file, err := h.dbService.GetCSVFile(fileID)
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+			return
+		}
+		if file.Status != "completed" {
+			WriteError(w, APIError{Code: ErrCodeConflict, Message: fmt.Sprintf("File %d is not processed", fileID)}, http.StatusConflict)
+			return
+		}
+		if !h.checkFileHasKey(w, fileID, req.KeyColumn) {
+			return
+		}
+	}
+
+	job, err := h.differ.StartJob(h.ctx, req.FileIDA, req.FileIDB, req.KeyColumn, requestOwner(r))
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error starting diff: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// HandleGetDiff returns the status of a diff job and a page of one of its sets:
+// added, removed, changed (the default) or duplicates, keys repeated within a file
+// that couldn't be matched
+func (h *Handler) HandleGetDiff(w http.ResponseWriter, r *http.Request) {
+	jobID, err := strconv.Atoi(mux.Vars(r)["jobId"])
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid diff job ID"}, http.StatusBadRequest)
+		return
+	}
+	set := r.URL.Query().Get("set")
+	if set == "" {
+		set = "changed"
+	}
+	if !services.ValidDiffKind(set) {
+		writeParamError(w, &paramError{Parameter: "set", Accepted: "added, removed, changed or duplicates"})
+		return
+	}
+	page, perPage, perr := parsePagination(r, 100, 1000)
+	if perr != nil {
+		writeParamError(w, perr)
+		return
+	}
+
+	scope, err := h.ownerScope(r)
+	if err != nil {
+		writeOwnerScopeError(w, err)
+		return
+	}
+	job, err := h.dbService.GetDiffJob(jobID, scope)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeNotFound, Message: fmt.Sprintf("Diff job %d not found", jobID)}, http.StatusNotFound)
+		return
+	}
+
+	entries, err := h.dbService.GetDiffEntries(job.ID, set, perPage, (page-1)*perPage)
+	if err != nil {
+		writeQueryError(w, "Error fetching diff entries: ", err)
+		return
+	}
+
+	total := map[string]int{
+		"added":      job.AddedCount,
+		"removed":    job.RemovedCount,
+		"changed":    job.ChangedCount,
+		"duplicates": job.DuplicateCount,
+	}[set]
+	pages := totalPages(total, perPage)
+	setPaginationLinks(w, r, page, pages)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job":        job,
+		"set":        set,
+		"entries":    entries,
+		"count":      len(entries),
+		"page":       page,
+		"perPage":    perPage,
+		"totalPages": pages,
+		"hasMore":    page < pages,
+	})
+}
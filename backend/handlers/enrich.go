@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"csv-processor/services"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// maxLookupBytes caps the size of a lookup table upload
+const maxLookupBytes = 10 << 20
+
+// HandleEnrichFile joins a lookup CSV onto a file's records: for each record, the
+// lookup row whose lookupKeyColumn equals the record's joinColumn supplies the
+// values of columnsToAdd. Unmatched records get empty values, or defaultValue with
+// unmatched=default.
+func (h *Handler) HandleEnrichFile(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseMultipartForm(maxLookupBytes); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Lookup table too large or invalid"}, http.StatusBadRequest)
+		return
+	}
+	lookupFile, _, err := r.FormFile("file")
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "No lookup table uploaded"}, http.StatusBadRequest)
+		return
+	}
+	defer lookupFile.Close()
+
+	joinColumn := strings.TrimSpace(r.FormValue("joinColumn"))
+	lookupKeyColumn := strings.TrimSpace(r.FormValue("lookupKeyColumn"))
+	columnsToAdd := splitList(r.FormValue("columnsToAdd"))
+	if joinColumn == "" || lookupKeyColumn == "" || len(columnsToAdd) == 0 {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "joinColumn, lookupKeyColumn and columnsToAdd are required"}, http.StatusBadRequest)
+		return
+	}
+
+	var opts services.EnrichOptions
+	switch r.FormValue("unmatched") {
+	case "", "blank":
+	case "default":
+		defaultValue := r.FormValue("defaultValue")
+		opts.Default = &defaultValue
+	default:
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "unmatched must be blank or default"}, http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.dbService.GetCSVFile(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+		return
+	}
+	if file.Status != "completed" {
+		WriteError(w, APIError{Code: ErrCodeConflict, Message: "File is not processed"}, http.StatusConflict)
+		return
+	}
+
+	// The join column must exist; added columns must not, so no data is overwritten
+	headers, err := h.dbService.GetFileHeaders(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching headers: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	for _, header := range headers {
+		if strings.EqualFold(header, joinColumn) {
+			opts.JoinColumn = header
+		}
+	}
+	if opts.JoinColumn == "" {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Unknown column: " + joinColumn}, http.StatusBadRequest)
+		return
+	}
+
+	lookup, err := services.LoadLookupTable(lookupFile, lookupKeyColumn, columnsToAdd, h.enrichMaxRows)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid lookup table: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	for _, column := range lookup.Columns {
+		for _, header := range headers {
+			if strings.EqualFold(header, column) {
+				WriteError(w, APIError{Code: ErrCodeConflict, Message: "File already has a column " + header}, http.StatusConflict)
+				return
+			}
+		}
+	}
+
+	result, err := h.dbService.EnrichRecords(r.Context(), fileID, lookup, opts)
+	if err != nil {
+		writeQueryError(w, "Error enriching records: ", err)
+		return
+	}
+	h.aggregator.Invalidate(fileID)
+
+	h.recordEvent(r, fileID, "enriched", map[string]interface{}{
+		"joinColumn":   result.JoinColumn,
+		"columnsAdded": result.ColumnsAdded,
+		"matched":      result.Matched,
+		"unmatched":    result.Unmatched,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
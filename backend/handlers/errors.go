@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Machine-readable error codes returned in APIError.Code
+const (
+	ErrCodeInvalidInput     = "INVALID_INPUT"
+	ErrCodeFileNotFound     = "FILE_NOT_FOUND"
+	ErrCodeNotFound         = "NOT_FOUND"
+	ErrCodeProcessingFailed = "PROCESSING_FAILED"
+	ErrCodeDuplicate        = "DUPLICATE"
+	ErrCodeConflict         = "CONFLICT"
+	ErrCodePayloadTooLarge  = "PAYLOAD_TOO_LARGE"
+	ErrCodeUnauthorized     = "UNAUTHORIZED"
+	ErrCodeForbidden        = "FORBIDDEN"
+	ErrCodeServiceBusy      = "SERVICE_BUSY"
+	ErrCodeRateLimited      = "RATE_LIMITED"
+	ErrCodeChecksumMismatch = "CHECKSUM_MISMATCH"
+	ErrCodeInternal         = "INTERNAL_ERROR"
+)
+
+// APIError is the JSON body of every error response
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// WriteError responds with err as JSON and the given status code
+func WriteError(w http.ResponseWriter, err APIError, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(err)
+}
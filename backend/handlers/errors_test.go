@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"csv-processor/database"
+	"csv-processor/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// decodeAPIError parses the structured error body of a response
+func decodeAPIError(t *testing.T, rec *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var apiErr APIError
+	if err := json.NewDecoder(rec.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("body is not an API error: %v", err)
+	}
+	return apiErr
+}
+
+func TestWriteError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteError(rec, APIError{Code: ErrCodeFileNotFound, Message: "CSV file not found", Details: map[string]int{"fileId": 7}}, http.StatusNotFound)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+	if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+	apiErr := decodeAPIError(t, rec)
+	if apiErr.Code != ErrCodeFileNotFound || apiErr.Message != "CSV file not found" {
+		t.Errorf("error = %+v, want %s with the message", apiErr, ErrCodeFileNotFound)
+	}
+	if details, ok := apiErr.Details.(map[string]interface{}); !ok || details["fileId"] != float64(7) {
+		t.Errorf("details = %v, want fileId 7", apiErr.Details)
+	}
+}
+
+func TestWriteErrorWithoutDetails(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteError(rec, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if _, ok := body["details"]; ok {
+		t.Errorf("body = %v, want no details", body)
+	}
+	if body["code"] != ErrCodeInvalidInput || body["message"] != "Invalid file ID" {
+		t.Errorf("body = %v, want code and message", body)
+	}
+}
+
+func TestWriteQueryError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantStatus     int
+		wantCode       string
+		wantMessage    string
+		wantRetryAfter bool
+	}{
+		{"database down", fmt.Errorf("query failed: %w", database.ErrCircuitOpen), http.StatusServiceUnavailable, ErrCodeServiceBusy, "Database is unavailable", true},
+		{"too many queries", models.ErrTooManyQueries, http.StatusServiceUnavailable, ErrCodeServiceBusy, "Server is busy", true},
+		{"bad search syntax", fmt.Errorf("%w: unclosed quote", models.ErrInvalidSearchQuery), http.StatusBadRequest, ErrCodeInvalidInput, "unclosed quote", false},
+		{"other error", errors.New("connection reset"), http.StatusInternalServerError, ErrCodeInternal, "Error fetching records: connection reset", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeQueryError(rec, "Error fetching records: ", tt.err)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Retry-After") != ""; got != tt.wantRetryAfter {
+				t.Errorf("Retry-After set = %v, want %v", got, tt.wantRetryAfter)
+			}
+			apiErr := decodeAPIError(t, rec)
+			if apiErr.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", apiErr.Code, tt.wantCode)
+			}
+			if !strings.Contains(apiErr.Message, tt.wantMessage) {
+				t.Errorf("message = %q, want it to contain %q", apiErr.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestWriteQueryErrorSearchSyntax(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeQueryError(rec, "Error searching records: ", fmt.Errorf("%w: unclosed quote", models.ErrInvalidSearchQuery))
+
+	var body struct {
+		Details struct {
+			Syntax string `json:"syntax"`
+		} `json:"details"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("body is not an API error: %v", err)
+	}
+	if !strings.HasPrefix(body.Details.Syntax, "Search syntax:") {
+		t.Errorf("details.syntax = %q, want the search syntax help", body.Details.Syntax)
+	}
+}
+
+func TestIntParamError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/files/1/data?perPage=5000", nil)
+	_, paramErr := intParam(req, "perPage", 100, 1, 1000)
+	if paramErr == nil {
+		t.Fatal("intParam() accepted perPage=5000 with a maximum of 1000")
+	}
+	rec := httptest.NewRecorder()
+	writeParamError(rec, paramErr)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	var body struct {
+		Code    string     `json:"code"`
+		Message string     `json:"message"`
+		Details paramError `json:"details"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("body is not an API error: %v", err)
+	}
+	want := paramError{Parameter: "perPage", Accepted: "an integer from 1 to 1000"}
+	if body.Code != ErrCodeInvalidInput || body.Details != want || body.Message != want.Error() {
+		t.Errorf("body = %+v, want %s for %+v", body, ErrCodeInvalidInput, want)
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"csv-processor/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// eventPingInterval is how often an idle event stream sends a keep-alive comment
+const eventPingInterval = 15 * time.Second
+
+// eventReplayLimit is how many missed timeline events a reconnecting stream replays
+const eventReplayLimit = 1000
+
+// HandleStreamEvents streams status changes of the caller's files as server-sent
+// events, e.g. data: {"type":"file_updated","fileId":1,"status":"completed"}.
+// Timeline events are sent as file_event with their ID, so a client reconnecting
+// with Last-Event-ID (or ?lastEventId=) first gets the events it missed.
+func (h *Handler) HandleStreamEvents(w http.ResponseWriter, r *http.Request) {
+	scope, err := h.ownerScope(r)
+	if err != nil {
+		writeOwnerScopeError(w, err)
+		return
+	}
+
+	lastEventID := 0
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("lastEventId")
+	}
+	if raw != "" {
+		if lastEventID, err = strconv.Atoi(raw); err != nil || lastEventID < 0 {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid Last-Event-ID"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Streaming is not supported"}, http.StatusInternalServerError)
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Error clearing write deadline for event stream: %v", err)
+	}
+
+	// Subscribe before replaying so nothing recorded in between is lost
+	updates, unsubscribe := h.events.Subscribe()
+	defer unsubscribe()
+
+	var missed []*models.FileEvent
+	if lastEventID > 0 {
+		if missed, err = h.dbService.GetFileEventsSince(lastEventID, scope, eventReplayLimit); err != nil {
+			WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching missed events: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	for _, event := range missed {
+		if err := writeStreamUpdate(w, models.FileUpdate{Type: "file_event", FileID: event.CSVFileID, Event: event}); err != nil {
+			return
+		}
+		lastEventID = event.ID
+	}
+	flusher.Flush()
+
+	ping := time.NewTicker(eventPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.ctx.Done():
+			return
+		case <-ping.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case update := <-updates:
+			if update.Event != nil && update.Event.ID <= lastEventID {
+				continue // already replayed
+			}
+			if visible, err := h.dbService.FileVisible(update.FileID, scope); err != nil || !visible {
+				continue
+			}
+			if err := writeStreamUpdate(w, update); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeStreamUpdate writes an update as a server-sent event, with the ID of its
+// timeline event if it has one. Only write errors are returned.
+func writeStreamUpdate(w http.ResponseWriter, update models.FileUpdate) error {
+	data, err := json.Marshal(update)
+	if err != nil {
+		log.Printf("Error encoding file update: %v", err)
+		return nil
+	}
+	if update.Event != nil {
+		if _, err := fmt.Fprintf(w, "id: %d\n", update.Event.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+// recordEvent adds a change made through the API to a file's timeline
+func (h *Handler) recordEvent(r *http.Request, fileID int, eventType string, detail map[string]interface{}) {
+	h.dbService.RecordEvent(context.WithoutCancel(r.Context()), &models.FileEvent{
+		CSVFileID: fileID,
+		EventType: eventType,
+		Actor:     "api",
+		Detail:    detail,
+	})
+}
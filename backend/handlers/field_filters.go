@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// fieldFilterPrefix marks query parameters filtering on a column's cleaned value,
+// e.g. field.city=Boston
+const fieldFilterPrefix = "field."
+
+// parseFieldFilters reads the field.<column>=<value> and has=<column> parameters
+// of a record listing. Columns must be headers of the file; encrypted columns can
+// only be matched on their ciphertext and are rejected.
+func (h *Handler) parseFieldFilters(r *http.Request, fileIDs []int) (map[string]string, []string, error) {
+	equals := make(map[string]string)
+	var hasValue []string
+	for key, values := range r.URL.Query() {
+		if column := strings.TrimPrefix(key, fieldFilterPrefix); column != key {
+			equals[column] = values[len(values)-1]
+		}
+	}
+	for _, value := range r.URL.Query()["has"] {
+		for _, column := range strings.Split(value, ",") {
+			if column = strings.TrimSpace(column); column != "" {
+				hasValue = append(hasValue, column)
+			}
+		}
+	}
+	if len(equals) == 0 && len(hasValue) == 0 {
+		return nil, nil, nil
+	}
+
+	headers, err := h.sourceHeaders(fileIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	known := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		known[header] = true
+	}
+	columns := append([]string{}, hasValue...)
+	for column := range equals {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		if !known[column] {
+			return nil, nil, fmt.Errorf("unknown column %q; valid columns: %s", column, strings.Join(headers, ", "))
+		}
+		if h.dbService.IsEncryptedColumn(column) {
+			return nil, nil, fmt.Errorf("column %q is encrypted at rest and cannot be filtered on", column)
+		}
+	}
+	return equals, hasValue, nil
+}
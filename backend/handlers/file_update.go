@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"csv-processor/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Length limits of the editable file fields, in characters
+const (
+	maxDisplayNameLength = 200
+	maxDescriptionLength = 2000
+)
+
+// HandleUpdateFile changes the editable fields of a file: displayName, description
+// and tags. Omitted fields are left as they are; any other field is rejected.
+func (h *Handler) HandleUpdateFile(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		DisplayName *string   `json:"displayName"`
+		Description *string   `json:"description"`
+		Tags        *[]string `json:"tags"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		WriteError(w, APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Invalid request body: only displayName, description and tags can be changed",
+			Details: err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+	if req.DisplayName != nil {
+		trimmed := strings.TrimSpace(*req.DisplayName)
+		if utf8.RuneCountInString(trimmed) > maxDisplayNameLength {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: fmt.Sprintf("displayName must be at most %d characters", maxDisplayNameLength)}, http.StatusBadRequest)
+			return
+		}
+		req.DisplayName = &trimmed
+	}
+	if req.Description != nil && utf8.RuneCountInString(*req.Description) > maxDescriptionLength {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: fmt.Sprintf("description must be at most %d characters", maxDescriptionLength)}, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.dbService.GetCSVFile(fileID); err != nil {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+		return
+	}
+
+	if req.DisplayName != nil || req.Description != nil {
+		if err := h.dbService.UpdateCSVFileDetails(fileID, req.DisplayName, req.Description); err != nil {
+			WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error updating file: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		detail := map[string]interface{}{}
+		if req.DisplayName != nil {
+			detail["displayName"] = *req.DisplayName
+		}
+		if req.Description != nil {
+			detail["description"] = *req.Description
+		}
+		h.recordEvent(r, fileID, "details_changed", detail)
+	}
+	if req.Tags != nil {
+		if err := h.dbService.UpdateCSVFileTags(fileID, services.NormalizeTags(*req.Tags)); err != nil {
+			WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error updating tags: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		h.recordEvent(r, fileID, "tags_changed", map[string]interface{}{"tags": services.NormalizeTags(*req.Tags)})
+	}
+
+	file, err := h.dbService.GetCSVFile(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching file: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(file)
+}
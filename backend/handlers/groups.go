@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"csv-processor/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleMergeGroups merges one or more groups of a file into a target group. The
+// body names them as {"sources": [...], "target": ...}, or {"source": ...} for one.
+func (h *Handler) HandleMergeGroups(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Source  string   `json:"source"`
+		Sources []string `json:"sources"`
+		Target  string   `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+	if source := strings.TrimSpace(req.Source); source != "" {
+		req.Sources = append(req.Sources, source)
+	}
+	req.Target = strings.TrimSpace(req.Target)
+	if len(req.Sources) == 0 || req.Target == "" {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "source(s) and target are required"}, http.StatusBadRequest)
+		return
+	}
+	for _, source := range req.Sources {
+		if source == req.Target {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "A group cannot be merged into itself"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	h.changeGroups(w, r, fileID, req.Sources, req.Target)
+}
+
+// HandleRenameGroup renames a single group of a file
+func (h *Handler) HandleRenameGroup(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "name is required"}, http.StatusBadRequest)
+		return
+	}
+
+	h.changeGroups(w, r, fileID, []string{mux.Vars(r)["name"]}, req.Name)
+}
+
+// changeGroups applies a merge/rename and responds with the number of records affected
+func (h *Handler) changeGroups(w http.ResponseWriter, r *http.Request, fileID int, sources []string, target string) {
+	if _, err := h.dbService.GetCSVFile(fileID); err != nil {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+		return
+	}
+
+	affected, err := h.dbService.MergeGroups(fileID, sources, target)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error updating groups: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	h.aggregator.Invalidate(fileID)
+	h.groups.Invalidate(fileID)
+
+	h.recordEvent(r, fileID, "groups_changed", map[string]interface{}{
+		"sources":  sources,
+		"target":   target,
+		"affected": affected,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sources":  sources,
+		"target":   target,
+		"affected": affected,
+	})
+}
+
+// maxCategoryOverrides is how many records one category override request may change
+const maxCategoryOverrides = 1000
+
+// HandleOverrideCategories sets the category of individual records by hand, from a
+// body of {"overrides": [{"recordId": 1, "category": "doctor"}, ...]}. Categories
+// must be defined by the grouping rules. Each override is added to the file's timeline.
+func (h *Handler) HandleOverrideCategories(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Overrides []*models.CategoryOverride `json:"overrides"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+	if len(req.Overrides) == 0 {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "overrides is required"}, http.StatusBadRequest)
+		return
+	}
+	if len(req.Overrides) > maxCategoryOverrides {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: fmt.Sprintf("At most %d overrides are accepted per request", maxCategoryOverrides)}, http.StatusBadRequest)
+		return
+	}
+
+	categories := h.grouper.GroupDefinitions()
+	seen := make(map[int]bool, len(req.Overrides))
+	var unknown []string
+	for _, override := range req.Overrides {
+		if override == nil || override.RecordID <= 0 {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Every override needs a positive recordId"}, http.StatusBadRequest)
+			return
+		}
+		if seen[override.RecordID] {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: fmt.Sprintf("Record %d is overridden more than once", override.RecordID)}, http.StatusBadRequest)
+			return
+		}
+		seen[override.RecordID] = true
+		override.Category = strings.TrimSpace(override.Category)
+		override.PreviousCategory = ""
+		if _, ok := categories[override.Category]; !ok {
+			unknown = append(unknown, override.Category)
+		}
+	}
+	if len(unknown) > 0 {
+		known := make([]string, 0, len(categories))
+		for category := range categories {
+			known = append(known, category)
+		}
+		sort.Strings(known)
+		WriteError(w, APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: "Unknown categories: " + strings.Join(unknown, ", "),
+			Details: map[string]interface{}{"unknown": unknown, "categories": known},
+		}, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.dbService.GetCSVFile(fileID); err != nil {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+		return
+	}
+
+	if err := h.dbService.BatchUpdateCategories(fileID, req.Overrides); err != nil {
+		if errors.Is(err, models.ErrRecordNotFound) {
+			WriteError(w, APIError{Code: ErrCodeNotFound, Message: err.Error()}, http.StatusNotFound)
+			return
+		}
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error updating categories: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	h.aggregator.Invalidate(fileID)
+	h.groups.Invalidate(fileID)
+
+	for _, override := range req.Overrides {
+		h.recordEvent(r, fileID, "category_overridden", map[string]interface{}{
+			"recordId":         override.RecordID,
+			"previousCategory": override.PreviousCategory,
+			"category":         override.Category,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"updated":   len(req.Overrides),
+		"overrides": req.Overrides,
+	})
+}
@@ -2,99 +2,652 @@ package handlers
 
 import (
 	"bytes"
+	"context"
+	"csv-processor/config"
+	"csv-processor/database"
 	"csv-processor/models"
 	"csv-processor/services"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
 )
 
 type Handler struct {
+	ctx            context.Context // server lifetime; background processing stops when it ends
 	dbService      *services.DBService
 	asyncProcessor *services.AsyncProcessor
+	aggregator     *services.Aggregator
+	groups         *services.GroupCache
+	deduplicator   *services.Deduplicator
+	differ         *services.Differ
+	csvProcessor   *services.CSVProcessor
+	grouper        *services.CategoryGrouper
+	events         *services.EventBus
+
+	syncMaxBytes    int
+	syncMaxRows     int
+	syncTimeout     time.Duration
+	dryRunMaxBytes  int
+	sampleMaxRows   int
+	lintMaxFraction float64
+	searchLanguage  string // default text search configuration of uploads
+	adminToken      string // lets requests see the files of every owner
+	openAPISpec     []byte
+	openAPIETag     string
+	searchLimiter   *searchLimiter
+	enrichMaxRows   int
+	zipLimits       services.ZipLimits
+	uploadQuota     int  // uploads per client address per day; 0 turns the quota off
+	trustProxy      bool // take client addresses from the proxy's headers
+	allowPrivateURL bool // let schedules import from the server's own network
 }
 
-func NewHandler(dbService *services.DBService, asyncProcessor *services.AsyncProcessor) *Handler {
+func NewHandler(ctx context.Context, dbService *services.DBService, asyncProcessor *services.AsyncProcessor, aggregator *services.Aggregator, groups *services.GroupCache, deduplicator *services.Deduplicator, differ *services.Differ, csvProcessor *services.CSVProcessor, grouper *services.CategoryGrouper, events *services.EventBus, lintMaxFraction float64) *Handler {
 	return &Handler{
+		ctx:            ctx,
 		dbService:      dbService,
 		asyncProcessor: asyncProcessor,
+		aggregator:     aggregator,
+		groups:         groups,
+		deduplicator:   deduplicator,
+		differ:         differ,
+		csvProcessor:   csvProcessor,
+		grouper:        grouper,
+		events:         events,
+
+		syncMaxBytes:    config.GetEnvInt("SYNC_MAX_FILE_SIZE", 1<<20),
+		syncMaxRows:     config.GetEnvInt("SYNC_MAX_ROWS", 5000),
+		syncTimeout:     time.Duration(config.GetEnvInt("SYNC_TIMEOUT_SECONDS", 10)) * time.Second,
+		dryRunMaxBytes:  config.GetEnvInt("DRY_RUN_MAX_FILE_SIZE", 5<<20),
+		sampleMaxRows:   config.GetEnvInt("SAMPLE_MAX_ROWS", 1000),
+		lintMaxFraction: lintMaxFraction,
+		searchLanguage:  config.GetEnv("SEARCH_LANGUAGE", ""),
+		searchLimiter:   newSearchLimiter(config.GetEnvInt("SEARCH_RATE_PER_FILE", 5)),
+		enrichMaxRows:   config.GetEnvInt("ENRICH_MAX_LOOKUP_ROWS", 100000),
+		uploadQuota:     config.GetEnvInt("MAX_UPLOADS_PER_IP_PER_DAY", 20),
+		trustProxy:      config.GetEnv("TRUST_PROXY_HEADERS", "false") == "true",
+		zipLimits:       services.ZipLimitsFromEnv(),
+		allowPrivateURL: config.GetEnv("SCHEDULE_ALLOW_PRIVATE_URLS", "false") == "true",
 	}
 }
 
-// HandleUpload processes CSV file uploads
+// fileIDFromPath parses the {id} route variable
+func fileIDFromPath(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["id"])
+}
+
+// HandleUpload processes CSV file uploads. Requests with an X-Idempotency-Key are
+// processed at most once per key, and replays don't count against the upload quota.
 func (h *Handler) HandleUpload(w http.ResponseWriter, r *http.Request) {
+	if key := strings.TrimSpace(r.Header.Get("X-Idempotency-Key")); key != "" {
+		h.handleIdempotentUpload(w, r, key)
+		return
+	}
+	h.handleUpload(w, r)
+}
+
+func (h *Handler) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if !h.checkUploadQuota(w, r) {
+		return
+	}
+
+	// JSON records are posted as the request body and stored as CSV; the upload
+	// options then come from the query string
+	if ndjson, ok := jsonUploadType(r); ok {
+		filename, body, err := readJSONUpload(w, r, ndjson)
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+		contentSHA256, ok := verifyUploadChecksum(w, r, body)
+		if !ok {
+			return
+		}
+		content, err := services.JSONToCSV(body, ndjson)
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid JSON upload: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		prepared, err := services.PrepareUpload(filename, content, services.UploadOptions{})
+		if err != nil {
+			writeUploadError(w, err)
+			return
+		}
+		h.storeUpload(w, r, prepared.Parts[0], int64(len(body)), prepared.Warnings, contentSHA256)
+		return
+	}
+
 	// Parse multipart form (max 100MB)
 	err := r.ParseMultipartForm(100 << 20)
 	if err != nil {
-		http.Error(w, "File too large or invalid", http.StatusBadRequest)
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "File too large or invalid"}, http.StatusBadRequest)
 		return
 	}
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
-		http.Error(w, "No file uploaded", http.StatusBadRequest)
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "No file uploaded"}, http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
 
-	// Create CSV file record in database
-	csvFile, err := h.dbService.CreateCSVFile(header.Filename, header.Size)
+	// Read file content into memory
+	fileBytes, err := io.ReadAll(file)
 	if err != nil {
-		http.Error(w, "Error creating file record: "+err.Error(), http.StatusInternalServerError)
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error reading file: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	contentSHA256, ok := verifyUploadChecksum(w, r, fileBytes)
+	if !ok {
 		return
 	}
 
-	// Read file content into memory
-	fileBytes, err := io.ReadAll(file)
+	// Zip archives and workbooks with allSheets=true are stored as several files
+	prepared, err := services.PrepareUpload(header.Filename, fileBytes, services.UploadOptions{
+		Sheet:     r.FormValue("sheet"),
+		AllSheets: r.FormValue("allSheets") == "true",
+		ZipLimits: h.zipLimits,
+	})
 	if err != nil {
-		http.Error(w, "Error reading file: "+err.Error(), http.StatusInternalServerError)
+		writeUploadError(w, err)
+		return
+	}
+	if prepared.Multiple {
+		archive, message := "", "Workbook uploaded successfully. Processing its sheets in background."
+		if prepared.Archive {
+			archive, message = header.Filename, "Archive uploaded successfully. Processing its CSV files in background."
+		}
+		h.storeUploadParts(w, r, prepared.Parts, prepared.Skipped, archive, message)
 		return
 	}
 
-	// Process CSV asynchronously
-	h.asyncProcessor.ProcessCSVAsync(csvFile.ID, bytes.NewReader(fileBytes))
+	h.storeUpload(w, r, prepared.Parts[0], header.Size, prepared.Warnings, contentSHA256)
+}
+
+// writeUploadError answers an upload services.PrepareUpload refused: 413 for
+// archives over their limits and 400 otherwise, with the sheets or skipped entries
+// as details where there are some
+func writeUploadError(w http.ResponseWriter, err error) {
+	var sheetChoice *services.SheetChoiceError
+	var nothingToStore *services.NothingToStoreError
+	switch {
+	case errors.Is(err, models.ErrArchiveTooLarge):
+		WriteError(w, APIError{Code: ErrCodePayloadTooLarge, Message: err.Error()}, http.StatusRequestEntityTooLarge)
+	case errors.As(err, &sheetChoice):
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error(), Details: sheetChoice.Sheets}, http.StatusBadRequest)
+	case errors.As(err, &nothingToStore):
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error(), Details: nothingToStore.Skipped}, http.StatusBadRequest)
+	default:
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+	}
+}
+
+// storeUpload creates the file record of an upload stored as a single file and
+// processes its CSV content. fileSize is the size of the upload as sent, and
+// contentSHA256 is its verified checksum, if the client sent one.
+func (h *Handler) storeUpload(w http.ResponseWriter, r *http.Request, part *services.UploadPart, fileSize int64, warnings []string, contentSHA256 string) {
+	cfg, ok := h.uploadConfig(w, r)
+	if !ok {
+		return
+	}
+
+	if r.URL.Query().Get("dryRun") == "true" {
+		h.processUploadDryRun(w, r, part.Content, cfg, warnings)
+		return
+	}
+
+	searchLanguage, ok := h.uploadSearchLanguage(w, r)
+	if !ok {
+		return
+	}
+
+	// Create CSV file record in database
+	csvFile, err := h.createUploadedFile(r, part.Filename, fileSize, part.Raw, part.SheetName, searchLanguage, cfg, "", contentSHA256)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error creating file record: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
 
 	// Send immediate response
 	response := models.UploadResponse{
-		Message: "CSV file uploaded successfully. Processing in background.",
-		FileID:  csvFile.ID,
-		File:    csvFile,
+		Message:   "CSV file uploaded successfully. Processing in background.",
+		FileID:    csvFile.ID,
+		StatusURL: fileStatusURL(csvFile.ID),
+		File:      csvFile,
+		Mode:      "async",
+		Warnings:  warnings,
+	}
+
+	if r.FormValue("sync") == "true" {
+		if h.fitsSyncLimits(part.Content) {
+			h.processUploadSync(w, csvFile, part.Content, cfg, warnings)
+			return
+		}
+		response.Message = "File exceeds the synchronous processing limit. Processing in background."
+	}
+
+	// Process CSV asynchronously
+	h.asyncProcessor.ProcessCSVAsync(h.ctx, csvFile.ID, bytes.NewReader(part.Content), cfg)
+
+	writeUploadResponse(w, response, http.StatusAccepted)
+}
+
+// uploadConfig reads the processing options of an upload, on top of those of the
+// profile it names, and writes the error response when they are invalid
+func (h *Handler) uploadConfig(w http.ResponseWriter, r *http.Request) (*models.ProcessorConfig, bool) {
+	// A profile supplies the options the upload doesn't set itself
+	var profileOptions *models.ProcessorConfig
+	if name := strings.TrimSpace(r.FormValue("profile")); name != "" {
+		profile, err := h.dbService.GetProfile(name)
+		if errors.Is(err, models.ErrProfileNotFound) {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: fmt.Sprintf("Unknown processing profile %q", name)}, http.StatusBadRequest)
+			return nil, false
+		}
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error loading processing profile: " + err.Error()}, http.StatusInternalServerError)
+			return nil, false
+		}
+		profileOptions = profile.Options
+		profileOptions.Profile, profileOptions.ProfileVersion = profile.Name, profile.Version
+	}
+
+	cfg, err := parseProcessorConfig(r.Form, profileOptions)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+		return nil, false
 	}
+	return cfg, true
+}
 
+// uploadSearchLanguage returns the text search configuration of an upload, writing
+// the error response when the database doesn't support it
+func (h *Handler) uploadSearchLanguage(w http.ResponseWriter, r *http.Request) (string, bool) {
+	// Search stemming follows the file's language; unsupported names would fail every search
+	searchLanguage := h.searchLanguage
+	if language := strings.TrimSpace(r.FormValue("searchLanguage")); language != "" {
+		searchLanguage = strings.ToLower(language)
+	}
+	if searchLanguage != "" {
+		supported, err := h.dbService.IsSearchLanguageSupported(searchLanguage)
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error checking search language: " + err.Error()}, http.StatusInternalServerError)
+			return "", false
+		}
+		if !supported {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: fmt.Sprintf("Unsupported search language %q", searchLanguage)}, http.StatusBadRequest)
+			return "", false
+		}
+	}
+	return searchLanguage, true
+}
+
+// createUploadedFile stores the file record of an upload, tagged from the form, and
+// adds the upload to its timeline. archive names the zip the file came from, if any.
+func (h *Handler) createUploadedFile(r *http.Request, filename string, fileSize int64, fileBytes []byte, sheetName, searchLanguage string, cfg *models.ProcessorConfig, archive, contentSHA256 string) (*models.CSVFile, error) {
+	tags := services.NormalizeTags(strings.Split(r.FormValue("tags"), ","))
+	csvFile, err := h.dbService.CreateCSVFile(filename, fileSize, fileBytes, sheetName, searchLanguage, requestOwner(r), tags, cfg, contentSHA256)
+	if err != nil {
+		return nil, err
+	}
+	uploaded := map[string]interface{}{"filename": filename, "fileSize": fileSize}
+	if sheetName != "" {
+		uploaded["sheetName"] = sheetName
+	}
+	if archive != "" {
+		uploaded["archive"] = archive
+	}
+	if cfg != nil && cfg.Profile != "" {
+		uploaded["profile"], uploaded["profileVersion"] = cfg.Profile, cfg.ProfileVersion
+	}
+	h.recordEvent(r, csvFile.ID, models.FileEventUploaded, uploaded)
+	return csvFile, nil
+}
+
+// fileStatusURL is the resource reporting a file's processing status
+func fileStatusURL(fileID int) string {
+	return fmt.Sprintf("/api/files/%d", fileID)
+}
+
+// writeUploadResponse sends the response of a stored upload with a Location header
+// pointing at its status: 202 while it still processes, 201 once it has finished
+func writeUploadResponse(w http.ResponseWriter, response models.UploadResponse, status int) {
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", response.StatusURL)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(response)
 }
 
-// HandleGetFiles returns all CSV files
+// parseProcessorConfig builds the processing options of an upload from its form values:
+// categoryColumns and nullValues, both comma-separated, dateFormat, a JSON
+// validation schema with strict and maxViolations, JSON computedColumns and a rowFilter. An empty nullValues keeps every value as-is.
+// Options given override those of base, e.g. a processing profile; without a base it
+// returns nil when no options were given.
+func parseProcessorConfig(form url.Values, base *models.ProcessorConfig) (*models.ProcessorConfig, error) {
+	cfg := &models.ProcessorConfig{}
+	if base != nil {
+		copied := *base
+		cfg = &copied
+	}
+
+	if _, ok := form["categoryColumns"]; ok {
+		cfg.CategoryColumns = splitList(form.Get("categoryColumns"))
+	}
+	if _, ok := form["nullValues"]; ok {
+		cfg.NullValues = splitList(form.Get("nullValues"))
+		if cfg.NullValues == nil {
+			cfg.NullValues = []string{}
+		}
+	}
+
+	if schema := form.Get("validation"); schema != "" {
+		cfg.Validation = nil
+		if err := json.Unmarshal([]byte(schema), &cfg.Validation); err != nil {
+			return nil, fmt.Errorf("invalid validation schema: %v", err)
+		}
+	}
+	if computed := form.Get("computedColumns"); computed != "" {
+		cfg.ComputedColumns = nil
+		if err := json.Unmarshal([]byte(computed), &cfg.ComputedColumns); err != nil {
+			return nil, fmt.Errorf("invalid computedColumns: %v", err)
+		}
+	}
+	if filter := strings.TrimSpace(form.Get("rowFilter")); filter != "" {
+		cfg.RowFilter = filter
+	}
+	if dateFormat := form.Get("dateFormat"); dateFormat != "" {
+		cfg.DateOutputFormat = dateFormat
+	}
+	if _, ok := form["maskPII"]; ok {
+		cfg.MaskPII = form.Get("maskPII") == "true"
+	}
+	if _, ok := form["fallbackToSelf"]; ok {
+		cfg.FallbackToSelf = form.Get("fallbackToSelf") == "true"
+	}
+	if naturalKey := strings.TrimSpace(form.Get("naturalKeyColumn")); naturalKey != "" {
+		cfg.NaturalKeyColumn = naturalKey
+	}
+	if _, ok := form["strict"]; ok {
+		cfg.Strict = form.Get("strict") == "true"
+	}
+	if maxStr := form.Get("maxViolations"); maxStr != "" {
+		n, err := strconv.Atoi(maxStr)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("maxViolations must be a non-negative integer")
+		}
+		cfg.MaxViolations = n
+	}
+	if err := validateProcessorConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	if base == nil && len(cfg.CategoryColumns) == 0 && cfg.NullValues == nil && len(cfg.Validation) == 0 && cfg.DateOutputFormat == "" && !cfg.MaskPII && !cfg.FallbackToSelf &&
+		cfg.NaturalKeyColumn == "" && len(cfg.ComputedColumns) == 0 && cfg.RowFilter == "" {
+		return nil, nil
+	}
+	return cfg, nil
+}
+
+// validateProcessorConfig checks processing options before they are stored
+func validateProcessorConfig(cfg *models.ProcessorConfig) error {
+	if err := services.ValidateColumnRules(cfg.Validation); err != nil {
+		return fmt.Errorf("invalid validation schema: %v", err)
+	}
+	for column, rule := range cfg.Validation {
+		if rule.StoreOriginal != nil && !*rule.StoreOriginal && !rule.Mask && !cfg.MaskPII {
+			return fmt.Errorf("invalid validation schema: column %q sets storeOriginal=false without masking", column)
+		}
+	}
+	if err := services.ValidateComputedColumns(cfg.ComputedColumns); err != nil {
+		return fmt.Errorf("invalid computedColumns: %v", err)
+	}
+	if cfg.RowFilter != "" {
+		if err := services.ValidateRowFilter(cfg.RowFilter); err != nil {
+			return fmt.Errorf("invalid rowFilter: %v", err)
+		}
+	}
+	if cfg.DateOutputFormat != "" {
+		if err := services.ValidateDateFormat(cfg.DateOutputFormat); err != nil {
+			return err
+		}
+	}
+	if cfg.MaxViolations < 0 {
+		return fmt.Errorf("maxViolations must be a non-negative integer")
+	}
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping blank entries
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// fitsSyncLimits reports whether a file is small enough to be processed inline
+func (h *Handler) fitsSyncLimits(fileBytes []byte) bool {
+	if len(fileBytes) > h.syncMaxBytes {
+		return false
+	}
+	// Every data row ends with a newline (except possibly the last), plus one header row
+	return bytes.Count(fileBytes, []byte("\n")) <= h.syncMaxRows
+}
+
+// processUploadSync processes a small upload within the request and responds with the
+// completed file and its first page of records. If the deadline passes first, the file
+// keeps processing in the background and the response says so.
+func (h *Handler) processUploadSync(w http.ResponseWriter, csvFile *models.CSVFile, fileBytes []byte, cfg *models.ProcessorConfig, warnings []string) {
+	response := models.UploadResponse{
+		FileID:    csvFile.ID,
+		StatusURL: fileStatusURL(csvFile.ID),
+		File:      csvFile,
+		Mode:      "async",
+		Warnings:  warnings,
+	}
+
+	finished, procErr := h.asyncProcessor.ProcessCSVSync(h.ctx, csvFile.ID, bytes.NewReader(fileBytes), cfg, h.syncTimeout)
+	if !finished {
+		response.Message = "Processing did not finish within the synchronous deadline. Processing in background."
+		writeUploadResponse(w, response, http.StatusAccepted)
+		return
+	}
+
+	file, err := h.dbService.GetCSVFile(csvFile.ID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching file: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	response.File = file
+	response.Mode = "sync"
+
+	if procErr != nil {
+		response.Message = "CSV file processing failed."
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	perPage := 100
+	records, totalCount, err := h.dbService.GetRecordsByFileID(file.ID, perPage, 0, nil, nil, nil)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching records: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	groups, err := h.groups.Get(file.ID)
+	if err != nil {
+		writeQueryError(w, "Error fetching groups: ", err)
+		return
+	}
+
+	response.Message = "CSV file processed successfully."
+	response.Data = &models.DataResponse{
+		Records:    records,
+		Groups:     groups,
+		Count:      len(records),
+		TotalCount: totalCount,
+		Page:       1,
+		PerPage:    perPage,
+		TotalPages: totalPages(totalCount, perPage),
+		HasMore:    totalPages(totalCount, perPage) > 1,
+	}
+
+	writeUploadResponse(w, response, http.StatusCreated)
+}
+
+// processUploadDryRun cleans and categorizes an upload in memory and responds with the
+// first page of records and the groups, without storing anything
+func (h *Handler) processUploadDryRun(w http.ResponseWriter, r *http.Request, content []byte, cfg *models.ProcessorConfig, warnings []string) {
+	if len(content) > h.dryRunMaxBytes {
+		WriteError(w, APIError{Code: ErrCodePayloadTooLarge, Message: fmt.Sprintf("File too large for a dry run (max %d bytes)", h.dryRunMaxBytes)}, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	records, _, err := h.csvProcessor.ProcessCSV(r.Context(), bytes.NewReader(content), cfg)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeProcessingFailed, Message: "Error processing CSV: " + err.Error()}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	groups := make(map[string][]int)
+	for _, record := range records {
+		for _, category := range record.GroupedCategories {
+			groups[category] = append(groups[category], record.ID)
+		}
+	}
+
+	perPage := 100
+	page := records
+	if len(page) > perPage {
+		page = page[:perPage]
+	}
+
+	response := models.UploadResponse{
+		Message:  "Dry run completed. Nothing was stored.",
+		Mode:     "dryRun",
+		Warnings: warnings,
+		Data: &models.DataResponse{
+			Records:    page,
+			Groups:     groups,
+			Count:      len(page),
+			TotalCount: len(records),
+			Page:       1,
+			PerPage:    perPage,
+			TotalPages: totalPages(len(records), perPage),
+			HasMore:    totalPages(len(records), perPage) > 1,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// maxFilesPerPage is the largest page of the files list
+const maxFilesPerPage = 200
+
+// HandleGetFiles returns a page of the CSV files of the caller's owner, optionally filtered by
+// status, upload time, filename prefix and tags
 func (h *Handler) HandleGetFiles(w http.ResponseWriter, r *http.Request) {
-	files, err := h.dbService.GetAllCSVFiles()
+	scope, err := h.ownerScope(r)
 	if err != nil {
-		http.Error(w, "Error fetching files: "+err.Error(), http.StatusInternalServerError)
+		writeOwnerScopeError(w, err)
 		return
 	}
 
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy != "" && sortBy != "uploaded" && sortBy != "completeness" {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "sort must be uploaded or completeness"}, http.StatusBadRequest)
+		return
+	}
+
+	// tag may be repeated or comma-separated; tagMode=all requires every tag
+	var tags []string
+	for _, value := range r.URL.Query()["tag"] {
+		tags = append(tags, strings.Split(value, ",")...)
+	}
+	tagMode := r.URL.Query().Get("tagMode")
+	if tagMode != "" && tagMode != "any" && tagMode != "all" {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "tagMode must be any or all"}, http.StatusBadRequest)
+		return
+	}
+
+	filter := &models.FileFilter{
+		Status:       r.URL.Query().Get("status"),
+		Filename:     strings.TrimSpace(r.URL.Query().Get("filename")),
+		Tags:         services.NormalizeTags(tags),
+		MatchAllTags: tagMode == "all",
+	}
+	switch filter.Status {
+	case "", "processing", "completed", "failed":
+	default:
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "status must be processing, completed or failed"}, http.StatusBadRequest)
+		return
+	}
+	if filter.UploadedAfter, err = parseTimeParam(r, "uploadedAfter"); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if filter.UploadedBefore, err = parseTimeParam(r, "uploadedBefore"); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if filter.UploadedAfter != nil && filter.UploadedBefore != nil && filter.UploadedAfter.After(*filter.UploadedBefore) {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "uploadedAfter must not be later than uploadedBefore"}, http.StatusBadRequest)
+		return
+	}
+
+	page, perPage, perr := parsePagination(r, 50, maxFilesPerPage)
+	if perr != nil {
+		writeParamError(w, perr)
+		return
+	}
+
+	files, totalCount, err := h.dbService.GetAllCSVFiles(scope, sortBy, filter, perPage, (page-1)*perPage)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching files: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	pages := totalPages(totalCount, perPage)
 	response := models.FilesListResponse{
-		Files: files,
-		Count: len(files),
+		Files:      files,
+		Count:      len(files),
+		TotalCount: totalCount,
+		Page:       page,
+		PerPage:    perPage,
+		TotalPages: pages,
+		HasMore:    page < pages,
+		Filters:    filter,
 	}
 
+	setPaginationLinks(w, r, page, pages)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
 // HandleGetFile returns a specific CSV file
 func (h *Handler) HandleGetFile(w http.ResponseWriter, r *http.Request) {
-	fileIDStr := r.URL.Query().Get("id")
-	fileID, err := strconv.Atoi(fileIDStr)
+	fileID, err := fileIDFromPath(r)
 	if err != nil {
-		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
 		return
 	}
 
 	file, err := h.dbService.GetCSVFile(fileID)
 	if err != nil {
-		http.Error(w, "File not found: "+err.Error(), http.StatusNotFound)
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
 		return
 	}
 
@@ -102,63 +655,474 @@ func (h *Handler) HandleGetFile(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(file)
 }
 
-// HandleGetRecords returns all records for a specific file with pagination and optional search
-func (h *Handler) HandleGetRecords(w http.ResponseWriter, r *http.Request) {
-	fileIDStr := r.URL.Query().Get("fileId")
-	fileID, err := strconv.Atoi(fileIDStr)
+// HandleGetHeaders returns the column names of a file's records
+func (h *Handler) HandleGetHeaders(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
 	if err != nil {
-		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
 		return
 	}
 
-	// Pagination parameters
-	pageStr := r.URL.Query().Get("page")
-	perPageStr := r.URL.Query().Get("perPage")
-	query := r.URL.Query().Get("q") // Optional search query
-	
-	page := 1
-	perPage := 100 // Default page size
-	
-	if pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
+	headers, err := h.dbService.GetFileHeaders(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching headers: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	columns := make([]string, 0, len(headers))
+	for _, header := range headers {
+		if !services.IsSyntheticColumn(header) {
+			columns = append(columns, header)
 		}
 	}
-	
-	if perPageStr != "" {
-		if pp, err := strconv.Atoi(perPageStr); err == nil && pp > 0 && pp <= 1000 {
-			perPage = pp
+	if len(columns) == 0 {
+		WriteError(w, APIError{Code: ErrCodeNotFound, Message: "File has no records yet"}, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"headers": columns,
+	})
+}
+
+// loadFileContent returns the stored upload of a file as CSV, converting the
+// selected sheet when the upload was an Excel workbook
+func (h *Handler) loadFileContent(file *models.CSVFile) ([]byte, error) {
+	rawContent, err := h.dbService.GetRawContent(file.ID)
+	if err != nil {
+		return nil, err
+	}
+	return services.ToCSVContent(rawContent, file.SheetName)
+}
+
+// HandleDeleteFile deletes a CSV file and its records
+func (h *Handler) HandleDeleteFile(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.dbService.GetCSVFile(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+		return
+	}
+	if file.Status == "processing" {
+		WriteError(w, APIError{Code: ErrCodeConflict, Message: "File is still processing"}, http.StatusConflict)
+		return
+	}
+
+	if err := h.dbService.DeleteCSVFile(fileID, "api"); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error deleting file: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	h.aggregator.Invalidate(fileID)
+	h.groups.Invalidate(fileID)
+	h.searchLimiter.forget(fileID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maxBulkDeleteFiles caps how many files one bulk delete names
+const maxBulkDeleteFiles = 1000
+
+// HandleBulkDeleteFiles deletes the files listed in a {"ids": [...]} body. Nothing is
+// deleted if any of them is still processing; IDs of files that don't exist are
+// skipped.
+func (h *Handler) HandleBulkDeleteFiles(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []int `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 || len(req.IDs) > maxBulkDeleteFiles {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: fmt.Sprintf("ids must list 1 to %d files", maxBulkDeleteFiles)}, http.StatusBadRequest)
+		return
+	}
+
+	scope, err := h.ownerScope(r)
+	if err != nil {
+		writeOwnerScopeError(w, err)
+		return
+	}
+
+	// Other owners' files are skipped like missing ones, so their existence is not revealed
+	response := models.BulkDeleteResponse{Errors: []string{}}
+	var fileIDs, processing []int
+	seen := make(map[int]bool, len(req.IDs))
+	for _, fileID := range req.IDs {
+		if seen[fileID] {
+			continue
+		}
+		seen[fileID] = true
+
+		visible, err := h.dbService.FileVisible(fileID, scope)
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error checking file: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		status := ""
+		if visible {
+			status, err = h.dbService.GetCSVFileStatus(fileID)
 		}
+		if !visible || err != nil {
+			response.Skipped++
+			response.Errors = append(response.Errors, fmt.Sprintf("file %d not found", fileID))
+			continue
+		}
+		if status == "processing" {
+			processing = append(processing, fileID)
+		}
+		fileIDs = append(fileIDs, fileID)
+	}
+	if len(processing) > 0 {
+		WriteError(w, APIError{Code: ErrCodeConflict, Message: "Some files are still processing", Details: map[string]interface{}{"ids": processing}}, http.StatusConflict)
+		return
+	}
+
+	if len(fileIDs) > 0 {
+		deleted, err := h.dbService.DeleteCSVFiles(fileIDs, "api")
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error deleting files: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		response.Deleted = deleted
+		if missed := len(fileIDs) - deleted; missed > 0 {
+			response.Skipped += missed
+			response.Errors = append(response.Errors, fmt.Sprintf("%d files were deleted or started processing in the meantime", missed))
+		}
+	}
+	for _, fileID := range fileIDs {
+		h.aggregator.Invalidate(fileID)
+		h.groups.Invalidate(fileID)
+		h.searchLimiter.forget(fileID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleReprocessFile discards a file's records and processes its raw upload again
+func (h *Handler) HandleReprocessFile(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.dbService.GetCSVFile(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+		return
+	}
+	if file.Status == "processing" {
+		WriteError(w, APIError{Code: ErrCodeConflict, Message: "File is already processing"}, http.StatusConflict)
+		return
+	}
+
+	content, err := h.loadFileContent(file)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeConflict, Message: "Cannot reprocess file: " + err.Error()}, http.StatusConflict)
+		return
+	}
+
+	oldStatus, err := h.dbService.ResetCSVFileForReprocess(fileID)
+	if errors.Is(err, models.ErrFileProcessing) {
+		// Another request started reprocessing it since the check above
+		WriteError(w, APIError{Code: ErrCodeConflict, Message: "File is already processing"}, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error resetting file: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	h.aggregator.Invalidate(fileID)
+	h.groups.Invalidate(fileID)
+
+	h.dbService.RecordEvent(context.WithoutCancel(r.Context()), &models.FileEvent{
+		CSVFileID: fileID,
+		EventType: models.FileEventReprocessed,
+		OldStatus: oldStatus,
+		NewStatus: "processing",
+		Actor:     "api",
+		Detail:    map[string]interface{}{"generation": file.Generation + 1},
+	})
+
+	h.asyncProcessor.ProcessCSVAsync(h.ctx, fileID, bytes.NewReader(content), file.ProcessingConfig)
+
+	file.Status = "processing"
+	file.Version++ // the reset bumped the version
+	response := models.UploadResponse{
+		Message: "Reprocessing started in background.",
+		FileID:  fileID,
+		File:    file,
+		Mode:    "async",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleGetFileEvents returns the timeline of a file, oldest first
+func (h *Handler) HandleGetFileEvents(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
 	}
 
+	events, err := h.dbService.GetFileEvents(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching events: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events": events,
+		"count":  len(events),
+	})
+}
+
+// HandlePreviewFile cleans and categorizes the first rows of an uploaded file
+// without writing anything to the database
+func (h *Handler) HandlePreviewFile(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	rows := 10
+	if rowsStr := r.URL.Query().Get("rows"); rowsStr != "" {
+		if n, err := strconv.Atoi(rowsStr); err == nil && n > 0 && n <= 100 {
+			rows = n
+		}
+	}
+
+	file, err := h.dbService.GetCSVFile(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+		return
+	}
+
+	content, err := h.loadFileContent(file)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeConflict, Message: "Cannot preview file: " + err.Error()}, http.StatusConflict)
+		return
+	}
+
+	// Processing options can be overridden to try them out before reprocessing
+	cfg := file.ProcessingConfig
+	override, err := parseProcessorConfig(r.URL.Query(), nil)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if override != nil {
+		cfg = override
+	}
+
+	headers, categoryColumn, records, err := h.csvProcessor.PreviewCSV(r.Context(), bytes.NewReader(content), rows, cfg)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeProcessingFailed, Message: "Error parsing CSV: " + err.Error()}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	response := models.PreviewResponse{
+		FileID:         fileID,
+		Headers:        headers,
+		CategoryColumn: categoryColumn,
+		Records:        records,
+		Count:          len(records),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleGetRecords returns all records for a specific file, or for the files of a
+// dataset, with pagination and optional search.
+// The cleaned data is written as CSV instead of JSON for format=csv or Accept: text/csv.
+// format=ndjson or Accept: application/x-ndjson streams every matching record instead
+// of a page.
+func (h *Handler) HandleGetRecords(w http.ResponseWriter, r *http.Request) {
+	source, ok := h.recordSourceParam(w, r)
+	if !ok {
+		return
+	}
+
+	format, err := recordsFormat(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query().Get("q") // Optional search query
+
+	page, perPage, perr := parsePagination(r, 100, 1000)
+	if perr != nil {
+		writeParamError(w, perr)
+		return
+	}
 	offset := (page - 1) * perPage
 
+	projection, warnings, err := h.parseProjection(r, source.fileIDs)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching headers: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
 	// Choose between search and regular fetch based on query parameter
 	var records []*models.Record
 	var totalCount int
-	
+
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != "fulltext" && mode != "substring" {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "mode must be fulltext or substring"}, http.StatusBadRequest)
+		return
+	}
+
+	// Searches are the expensive part of this endpoint, so very short terms are
+	// refused and each file only gets a few per second
 	if query != "" {
+		if utf8.RuneCountInString(strings.TrimSpace(query)) < minSearchQueryLength {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: fmt.Sprintf("Search query must be at least %d characters", minSearchQueryLength)}, http.StatusBadRequest)
+			return
+		}
+		if !h.searchLimiter.allow(source.limiterKey()) {
+			w.Header().Set("Retry-After", "1")
+			WriteError(w, APIError{Code: ErrCodeRateLimited, Message: "too many search requests for this " + source.noun()}, http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	filter := &services.RecordFilter{
+		Query:         query,
+		Substring:     mode == "substring" && query != "",
+		Group:         r.URL.Query().Get("group"),
+		HasWarnings:   r.URL.Query().Get("hasWarnings") == "true",
+		HasViolations: r.URL.Query().Get("hasViolations") == "true",
+		Sort:          r.URL.Query().Get("sort"),
+	}
+	if !services.ValidRecordSort(filter.Sort) {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "sort must be id, lineNumber or -lineNumber"}, http.StatusBadRequest)
+		return
+	}
+	if filter.CreatedAfter, err = parseTimeParam(r, "createdAfter"); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if filter.CreatedBefore, err = parseTimeParam(r, "createdBefore"); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if filter.CreatedAfter != nil && filter.CreatedBefore != nil && filter.CreatedAfter.After(*filter.CreatedBefore) {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "createdAfter must not be later than createdBefore"}, http.StatusBadRequest)
+		return
+	}
+	if filter.Equals, filter.HasValue, err = h.parseFieldFilters(r, source.fileIDs); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	// The records replaced by the last reprocess stay readable until the next one
+	switch r.URL.Query().Get("generation") {
+	case "", "current":
+	case "previous":
+		if source.dataset != nil {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "generation=previous is only supported for a single file"}, http.StatusBadRequest)
+			return
+		}
+		file, err := h.dbService.GetCSVFile(source.fileIDs[0])
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+			return
+		}
+		if file.Generation < 2 {
+			WriteError(w, APIError{Code: ErrCodeNotFound, Message: "File has not been reprocessed, so there is no previous generation"}, http.StatusNotFound)
+			return
+		}
+		filter.Previous = true
+	default:
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "generation must be current or previous"}, http.StatusBadRequest)
+		return
+	}
+	
+	if filter.Substring {
+		if installed, err := h.dbService.HasTrigramSupport(); err == nil && !installed {
+			warnings = append(warnings, "pg_trgm is not installed; substring search runs without an index and may be slow")
+		}
+	}
+
+	if format == "ndjson" {
+		h.streamRecordsNDJSON(w, r, source, filter, projection, warnings)
+		return
+	}
+
+	// Datasets span files, which only the filtered listing can read together
+	if source.dataset != nil || filter.Substring || filter.Group != "" || filter.HasWarnings || filter.HasViolations || filter.FiltersFields() || filter.Previous || filter.Sort != "" {
+		// Triage listings embed each record's violations next to its warnings
+		records, totalCount, err = h.dbService.FilterRecords(source.fileIDs, filter, perPage, offset, projection)
+		if err != nil {
+			writeQueryError(w, "Error fetching records: ", err)
+			return
+		}
+		if filter.HasWarnings || filter.HasViolations {
+			if err := h.attachViolations(records); err != nil {
+				WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching violations: " + err.Error()}, http.StatusInternalServerError)
+				return
+			}
+		}
+	} else if query != "" {
 		// Perform optimized full-text search
-		records, totalCount, err = h.dbService.SearchRecords(fileID, query, perPage, offset)
+		records, totalCount, err = h.dbService.SearchRecords(source.fileIDs[0], query, perPage, offset, filter.CreatedAfter, filter.CreatedBefore, projection)
 		if err != nil {
-			http.Error(w, "Error searching records: "+err.Error(), http.StatusInternalServerError)
+			writeQueryError(w, "Error searching records: ", err)
 			return
 		}
 	} else {
 		// Regular fetch all records
-		records, totalCount, err = h.dbService.GetRecordsByFileID(fileID, perPage, offset)
+		records, totalCount, err = h.dbService.GetRecordsByFileID(source.fileIDs[0], perPage, offset, filter.CreatedAfter, filter.CreatedBefore, projection)
 		if err != nil {
-			http.Error(w, "Error fetching records: "+err.Error(), http.StatusInternalServerError)
+			WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching records: " + err.Error()}, http.StatusInternalServerError)
 			return
 		}
 	}
 
+	if err := h.setSourceFilenames(source, records); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching filenames: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	if format == "csv" {
+		fileHeaders, err := h.sourceHeaders(source.fileIDs)
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching headers: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		setPaginationLinks(w, r, page, totalPages(totalCount, perPage))
+		writeRecordsCSV(w, records, fileHeaders, r.URL.Query().Get("includeLineNumber") == "true")
+		return
+	}
+
+	if r.URL.Query().Get("explain") == "true" {
+		for _, record := range records {
+			record.CategorizationExplanation = h.csvProcessor.ExplainCategorization(record.CleanedData)
+		}
+	}
+
 	// Fetch groups only on first page request (without search)
 	var groups map[string][]int
-	if page == 1 && query == "" {
-		groups, err = h.dbService.GetGroupsByFileID(fileID)
+	if page == 1 && query == "" && filter.Group == "" && !filter.HasWarnings && !filter.HasViolations &&
+		filter.CreatedAfter == nil && filter.CreatedBefore == nil && !filter.FiltersFields() && !filter.Previous {
+		// cacheControl=no-cache reads them from the database, for debugging the cache
+		groups, err = h.sourceGroups(source, r.URL.Query().Get("cacheControl") == "no-cache")
 		if err != nil {
-			http.Error(w, "Error fetching groups: "+err.Error(), http.StatusInternalServerError)
+			writeQueryError(w, "Error fetching groups: ", err)
 			return
 		}
 	}
@@ -170,72 +1134,238 @@ func (h *Handler) HandleGetRecords(w http.ResponseWriter, r *http.Request) {
 		TotalCount: totalCount,
 		Page:       page,
 		PerPage:    perPage,
-		HasMore:    offset+len(records) < totalCount,
+		TotalPages: totalPages(totalCount, perPage),
+		HasMore:    page < totalPages(totalCount, perPage),
+		Warnings:   warnings,
 	}
 
+	setPaginationLinks(w, r, page, response.TotalPages)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// parseTimeParam reads an optional RFC 3339 timestamp query parameter
+func parseTimeParam(r *http.Request, name string) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp, e.g. 2024-01-01T00:00:00Z", name)
+	}
+	return &t, nil
+}
 
+// parseProjection reads the fields and includeOriginal parameters. Unknown field
+// names are dropped and reported as warnings instead of failing the request.
+func (h *Handler) parseProjection(r *http.Request, fileIDs []int) (*services.RecordProjection, []string, error) {
+	fieldsParam := r.URL.Query().Get("fields")
+	includeOriginal := r.URL.Query().Get("includeOriginal") != "false"
+	if fieldsParam == "" && includeOriginal {
+		return nil, nil, nil
+	}
 
-// HandleGetGroupRecords returns records for a specific group with pagination
-func (h *Handler) HandleGetGroupRecords(w http.ResponseWriter, r *http.Request) {
-	fileIDStr := r.URL.Query().Get("fileId")
-	fileID, err := strconv.Atoi(fileIDStr)
+	projection := &services.RecordProjection{IncludeOriginal: includeOriginal}
+	if fieldsParam == "" {
+		return projection, nil, nil
+	}
+
+	headers, err := h.sourceHeaders(fileIDs)
 	if err != nil {
-		http.Error(w, "Invalid file ID", http.StatusBadRequest)
-		return
+		return nil, nil, err
+	}
+	known := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		known[header] = true
 	}
 
-	groupCategory := r.URL.Query().Get("group")
-	if groupCategory == "" {
-		http.Error(w, "Group parameter is required", http.StatusBadRequest)
+	var warnings []string
+	for _, field := range strings.Split(fieldsParam, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !known[field] {
+			warnings = append(warnings, "unknown field ignored: "+field)
+			continue
+		}
+		projection.Fields = append(projection.Fields, field)
+	}
+
+	// Every requested field was unknown; return no data keys rather than all of them
+	if len(projection.Fields) == 0 {
+		projection.Fields = []string{}
+		warnings = append(warnings, "no known fields requested")
+	}
+
+	return projection, warnings, nil
+}
+
+// HandleGetGroupRecords returns records for one or more groups with pagination
+func (h *Handler) HandleGetGroupRecords(w http.ResponseWriter, r *http.Request) {
+	source, ok := h.recordSourceParam(w, r)
+	if !ok {
 		return
 	}
 
-	// Pagination parameters
-	pageStr := r.URL.Query().Get("page")
-	perPageStr := r.URL.Query().Get("perPage")
-	
-	page := 1
-	perPage := 20 // Default smaller page size for groups
-	
-	if pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
+	// group may be repeated and each value may list several groups
+	var groupCategories []string
+	seen := make(map[string]bool)
+	for _, value := range r.URL.Query()["group"] {
+		for _, group := range strings.Split(value, ",") {
+			group = strings.TrimSpace(group)
+			if group != "" && !seen[group] {
+				seen[group] = true
+				groupCategories = append(groupCategories, group)
+			}
 		}
 	}
-	
-	if perPageStr != "" {
-		if pp, err := strconv.Atoi(perPageStr); err == nil && pp > 0 && pp <= 100 {
-			perPage = pp
-		}
+	if len(groupCategories) == 0 {
+		h.writeUnknownGroups(w, source, "Group parameter is required")
+		return
 	}
 
+	// Smaller default page size for groups
+	page, perPage, perr := parsePagination(r, 20, 100)
+	if perr != nil {
+		writeParamError(w, perr)
+		return
+	}
 	offset := (page - 1) * perPage
 
-	records, totalCount, err := h.dbService.GetRecordsByGroup(fileID, groupCategory, perPage, offset)
+	projection, warnings, err := h.parseProjection(r, source.fileIDs)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching headers: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	records, groupCounts, totalCount, err := h.dbService.GetRecordsByGroup(source.fileIDs, groupCategories, perPage, offset, projection)
 	if err != nil {
-		http.Error(w, "Error fetching group records: "+err.Error(), http.StatusInternalServerError)
+		writeQueryError(w, "Error fetching group records: ", err)
+		return
+	}
+	if len(groupCounts) == 0 {
+		h.writeUnknownGroups(w, source, "None of the requested groups exist in this "+source.noun())
+		return
+	}
+	if err := h.setSourceFilenames(source, records); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching filenames: " + err.Error()}, http.StatusInternalServerError)
 		return
 	}
 
+	for _, group := range groupCategories {
+		if _, ok := groupCounts[group]; !ok {
+			warnings = append(warnings, fmt.Sprintf("group %q has no records in this %s", group, source.noun()))
+		}
+	}
+
 	response := models.DataResponse{
-		Records:    records,
-		Count:      len(records),
-		TotalCount: totalCount,
-		Page:       page,
-		PerPage:    perPage,
-		HasMore:    offset+len(records) < totalCount,
+		Records:     records,
+		Count:       len(records),
+		TotalCount:  totalCount,
+		Page:        page,
+		PerPage:     perPage,
+		TotalPages:  totalPages(totalCount, perPage),
+		HasMore:     page < totalPages(totalCount, perPage),
+		GroupCounts: groupCounts,
+		Warnings:    warnings,
 	}
 
+	setPaginationLinks(w, r, page, response.TotalPages)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// writeUnknownGroups rejects a group records request, listing the source's groups
+func (h *Handler) writeUnknownGroups(w http.ResponseWriter, source *recordSource, message string) {
+	names, err := h.dbService.GetGroupNames(source.fileIDs)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching groups: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	WriteError(w, APIError{
+		Code:    ErrCodeInvalidInput,
+		Message: message + "; valid groups: " + strings.Join(names, ", "),
+		Details: map[string][]string{"validGroups": names},
+	}, http.StatusBadRequest)
+}
+
+// HandleGetCategoryStats returns grouped category usage across all files of the
+// caller's owner
+func (h *Handler) HandleGetCategoryStats(w http.ResponseWriter, r *http.Request) {
+	scope, err := h.ownerScope(r)
+	if err != nil {
+		writeOwnerScopeError(w, err)
+		return
+	}
+
+	stats, err := h.dbService.GetGlobalCategoryStats(scope)
+	if err != nil {
+		writeQueryError(w, "Error fetching category stats: ", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"categories": stats,
+		"count":      len(stats),
+	})
+}
+
 // HandleHealth is a health check endpoint
 func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	// Database calls are refused while the circuit breaker is not closed
+	circuit := h.dbService.CircuitStats()
+	status := "ok"
+	if circuit.State != database.Closed.String() {
+		status = "degraded"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   status,
+		"database": circuit,
+	})
+}
+
+// HandleMetrics reports runtime load figures used to tune the server's limits
+func (h *Handler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"heavyQueries":      h.dbService.HeavyQueryStats(),
+		"processingRetries": h.asyncProcessor.RetryStats(),
+		"goroutineCount":    h.asyncProcessor.Running(),
+		"groupCache":        h.groups.Stats(),
+	})
+}
+
+// busyRetryAfterSeconds is the Retry-After sent when expensive queries are saturated
+const busyRetryAfterSeconds = "2"
+
+// circuitRetryAfterSeconds is the Retry-After sent while the database circuit is open
+const circuitRetryAfterSeconds = "30"
+
+// writeQueryError reports a failed query. When the database is saturated with
+// expensive queries the client is asked to retry later instead, and unparseable
+// search queries are rejected along with the search syntax.
+func writeQueryError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, database.ErrCircuitOpen) {
+		w.Header().Set("Retry-After", circuitRetryAfterSeconds)
+		WriteError(w, APIError{Code: ErrCodeServiceBusy, Message: "Database is unavailable, please retry later"}, http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, models.ErrTooManyQueries) {
+		w.Header().Set("Retry-After", busyRetryAfterSeconds)
+		WriteError(w, APIError{Code: ErrCodeServiceBusy, Message: "Server is busy, please retry shortly"}, http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, models.ErrInvalidSearchQuery) {
+		WriteError(w, APIError{
+			Code:    ErrCodeInvalidInput,
+			Message: err.Error() + ". " + services.SearchSyntaxHelp,
+			Details: map[string]string{"syntax": services.SearchSyntaxHelp},
+		}, http.StatusBadRequest)
+		return
+	}
+	WriteError(w, APIError{Code: ErrCodeInternal, Message: message + err.Error()}, http.StatusInternalServerError)
 }
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"csv-processor/models"
+	"csv-processor/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteUploadResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		status int
+	}{
+		{"async upload", "async", http.StatusAccepted},
+		{"sync upload", "sync", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeUploadResponse(rec, models.UploadResponse{
+				Message:   "CSV file uploaded",
+				FileID:    42,
+				StatusURL: fileStatusURL(42),
+				Mode:      tt.mode,
+			}, tt.status)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("Location"); got != "/api/files/42" {
+				t.Errorf("Location = %q, want /api/files/42", got)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+
+			var body models.UploadResponse
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("body is not an upload response: %v", err)
+			}
+			if body.FileID != 42 || body.StatusURL != "/api/files/42" || body.Mode != tt.mode {
+				t.Errorf("body = %+v, want file 42 with statusUrl /api/files/42 in %s mode", body, tt.mode)
+			}
+		})
+	}
+}
+
+func TestSetReplayLocation(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored string
+		want   string
+	}{
+		{"upload", `{"message":"CSV file uploaded","fileId":42,"mode":"async"}`, "/api/files/42"},
+		{"dry run", `{"message":"Dry run","fileId":0}`, ""},
+		{"archive", `{"message":"Archive uploaded","fileIds":[7,8]}`, ""},
+		{"not an upload response", `not json`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			setReplayLocation(rec, []byte(tt.stored))
+			if got := rec.Header().Get("Location"); got != tt.want {
+				t.Errorf("Location = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteUploadError(t *testing.T) {
+	sheets := []*models.SheetInfo{{Name: "People", Rows: 2}, {Name: "Teams", Rows: 3}}
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		code    string
+		details bool
+	}{
+		{"archive too large", fmt.Errorf("%w: more than 10 entries", models.ErrArchiveTooLarge), http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, false},
+		{"sheet choice", &services.SheetChoiceError{Sheets: sheets}, http.StatusBadRequest, ErrCodeInvalidInput, true},
+		{"nothing to store", &services.NothingToStoreError{Message: "Archive contains no CSV files", Skipped: []*models.SkippedEntry{{Path: "notes.txt"}}}, http.StatusBadRequest, ErrCodeInvalidInput, true},
+		{"not csv", errors.New("Upload rejected: binary content"), http.StatusBadRequest, ErrCodeInvalidInput, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeUploadError(rec, tt.err)
+
+			var apiErr APIError
+			if err := json.NewDecoder(rec.Body).Decode(&apiErr); err != nil {
+				t.Fatalf("body is not an error: %v", err)
+			}
+			if rec.Code != tt.status || apiErr.Code != tt.code || apiErr.Message != tt.err.Error() {
+				t.Errorf("writeUploadError() = %d %+v, want %d %s", rec.Code, apiErr, tt.status, tt.code)
+			}
+			if (apiErr.Details != nil) != tt.details {
+				t.Errorf("details = %v, want some: %v", apiErr.Details, tt.details)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"csv-processor/models"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// maxIdempotencyKeyLength caps the length of an X-Idempotency-Key header
+const maxIdempotencyKeyLength = 255
+
+// responseCapture buffers a response so it can be stored before being sent
+type responseCapture struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseCapture() *responseCapture {
+	return &responseCapture{header: make(http.Header), status: http.StatusOK}
+}
+
+func (c *responseCapture) Header() http.Header         { return c.header }
+func (c *responseCapture) Write(p []byte) (int, error) { return c.body.Write(p) }
+func (c *responseCapture) WriteHeader(status int)      { c.status = status }
+
+// writeTo sends the captured response to w
+func (c *responseCapture) writeTo(w http.ResponseWriter) {
+	for key, values := range c.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(c.status)
+	w.Write(c.body.Bytes())
+}
+
+// setReplayLocation sets the Location header a stored upload response was first sent
+// with. Archives create several files, so they have no single status to point at.
+func setReplayLocation(w http.ResponseWriter, stored []byte) {
+	var response models.UploadResponse
+	if err := json.Unmarshal(stored, &response); err != nil || response.FileID == 0 {
+		return
+	}
+	w.Header().Set("Location", fileStatusURL(response.FileID))
+}
+
+// handleIdempotentUpload runs an upload at most once per idempotency key. A repeated
+// key gets the original response body back with 200 OK and X-Idempotency-Replay: true,
+// as nothing new was created. Failed uploads release the key so they can be retried.
+func (h *Handler) handleIdempotentUpload(w http.ResponseWriter, r *http.Request, key string) {
+	if len(key) > maxIdempotencyKeyLength {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "X-Idempotency-Key is too long"}, http.StatusBadRequest)
+		return
+	}
+	// Keys are per owner, so one owner cannot replay another's upload
+	if owner := requestOwner(r); owner != "" {
+		key = owner + ":" + key
+	}
+
+	claimed, stored, err := h.dbService.ClaimIdempotencyKey(key)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error checking idempotency key: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	if !claimed {
+		if stored == nil {
+			WriteError(w, APIError{Code: ErrCodeDuplicate, Message: "A request with this idempotency key is still in progress"}, http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Idempotency-Replay", "true")
+		setReplayLocation(w, stored)
+		w.Write(stored)
+		return
+	}
+
+	capture := newResponseCapture()
+	h.handleUpload(capture, r)
+
+	if capture.status >= 200 && capture.status < 300 {
+		var response struct {
+			FileID int `json:"fileId"`
+		}
+		json.Unmarshal(capture.body.Bytes(), &response)
+		if err := h.dbService.CompleteIdempotencyKey(key, response.FileID, capture.body.Bytes()); err != nil {
+			log.Printf("Error storing response for idempotency key: %v", err)
+		}
+	} else if err := h.dbService.ReleaseIdempotencyKey(key); err != nil {
+		log.Printf("Error releasing idempotency key: %v", err)
+	}
+
+	capture.writeTo(w)
+}
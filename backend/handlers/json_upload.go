@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// maxJSONUploadBytes matches the size limit of multipart uploads
+const maxJSONUploadBytes = 100 << 20
+
+// jsonUploadType reports whether an upload posts JSON records as its body, and
+// whether they are newline-delimited
+func jsonUploadType(r *http.Request) (ndjson bool, ok bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false, false
+	}
+	switch mediaType {
+	case "application/json":
+		return false, true
+	case "application/x-ndjson":
+		return true, true
+	}
+	return false, false
+}
+
+// readJSONUpload reads the body of a JSON upload and its query string. The filename
+// comes from the filename query parameter, defaulting to upload.json or
+// upload.ndjson.
+func readJSONUpload(w http.ResponseWriter, r *http.Request, ndjson bool) (string, []byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONUploadBytes))
+	if err != nil {
+		return "", nil, fmt.Errorf("File too large or invalid")
+	}
+	if err := r.ParseForm(); err != nil {
+		return "", nil, fmt.Errorf("Invalid query string")
+	}
+
+	filename := strings.TrimSpace(r.URL.Query().Get("filename"))
+	if filename == "" {
+		filename = "upload.json"
+		if ndjson {
+			filename = "upload.ndjson"
+		}
+	}
+	return filename, body, nil
+}
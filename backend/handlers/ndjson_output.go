@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"csv-processor/models"
+	"csv-processor/services"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// streamRecordsNDJSON writes every record of source matching filter as
+// newline-delimited JSON, flushing after each batch. The query stops when the client
+// goes away. X-Total-Count is set when the count is known without another query.
+func (h *Handler) streamRecordsNDJSON(w http.ResponseWriter, r *http.Request, source *recordSource, filter *services.RecordFilter, projection *services.RecordProjection, warnings []string) {
+	if filter.Empty() && source.dataset == nil {
+		if file, err := h.dbService.GetCSVFile(source.fileIDs[0]); err == nil && file.Status == "completed" {
+			w.Header().Set("X-Total-Count", strconv.Itoa(file.RecordCount))
+		}
+	}
+	for _, warning := range warnings {
+		w.Header().Add("Warning", "299 - "+strconv.Quote(warning))
+	}
+
+	filenames, err := h.sourceFilenames(source)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching filenames: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	written := 0
+	err = h.dbService.StreamRecords(r.Context(), source.fileIDs, filter, projection, func(records []*models.Record) error {
+		if filter.HasWarnings || filter.HasViolations {
+			if err := h.attachViolations(records); err != nil {
+				return err
+			}
+		}
+		if written == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		for _, record := range records {
+			if filenames != nil {
+				record.SourceFilename = filenames[record.CSVFileID]
+			}
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+			written++
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+
+	if err != nil {
+		// Once records were sent the status is already out; the client sees the stream end early
+		if written == 0 && r.Context().Err() == nil {
+			writeQueryError(w, "Error streaming records: ", err)
+			return
+		}
+		log.Printf("Stopped streaming records of %s %v after %d records: %v", source.noun(), source.fileIDs, written, err)
+		return
+	}
+
+	if written == 0 {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+}
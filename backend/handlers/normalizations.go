@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// HandleResetNormalizations forgets every learned term normalization, in memory and
+// in the database. The grouping keywords stay registered as canonical terms.
+func (h *Handler) HandleResetNormalizations(w http.ResponseWriter, r *http.Request) {
+	discarded := h.grouper.ResetNormalizer()
+
+	deleted, err := h.dbService.DeleteTermNormalizations(r.Context())
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error deleting stored normalizations: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Reset term normalizations: discarded %d learned entries and %d stored rows", discarded, deleted)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"discarded":     discarded,
+		"deletedStored": deleted,
+	})
+}
+
+// HandleGetNormalizationReport returns what was normalized in a processed file
+func (h *Handler) HandleGetNormalizationReport(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.dbService.GetNormalizationReport(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+		return
+	}
+	if report == nil {
+		WriteError(w, APIError{Code: ErrCodeNotFound, Message: "The file has no normalization report yet"}, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
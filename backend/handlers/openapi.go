@@ -0,0 +1,931 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"csv-processor/database"
+	"csv-processor/models"
+	"csv-processor/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// apiOperation documents one route of the API. Body and Response hold a zero value
+// of the JSON request and response types; their schemas are derived from them.
+type apiOperation struct {
+	Summary     string
+	Params      []apiParam
+	Body        interface{} // JSON request body
+	Form        []apiParam  // multipart/form-data request fields
+	FormExample map[string]interface{}
+	Status      int               // success status, 200 when not set
+	AltStatuses []int             // other success statuses answered with the same body
+	Headers     map[string]string // success response headers and what they hold
+	Response    interface{}       // JSON response body, nil for none
+	ContentType string            // success content type when it is not JSON
+	Example     interface{}       // example of the success response
+
+	// AltBodies are the schemas of request bodies accepted instead of Form, by content type
+	AltBodies map[string]interface{}
+}
+
+// apiParam documents a query parameter or form field
+type apiParam struct {
+	Name        string
+	Type        string // string, integer, number or boolean
+	Description string
+	Required    bool
+	Repeated    bool // may be given several times
+}
+
+// pathParamDescriptions describes the path variables used in the route table
+var pathParamDescriptions = map[string]string{
+	"id":         "File ID",
+	"name":       "Group or processing profile name",
+	"scheduleId": "Import schedule ID",
+	"jobId":      "Diff job ID",
+}
+
+// paginationParams are the page and perPage parameters of paginated listings
+func paginationParams(maxPerPage int) []apiParam {
+	return []apiParam{
+		{Name: "page", Type: "integer", Description: "Page number, starting at 1"},
+		{Name: "perPage", Type: "integer", Description: fmt.Sprintf("Items per page (max %d)", maxPerPage)},
+	}
+}
+
+// ownerParam lets admins look at the files of another owner
+var ownerParam = apiParam{Name: "owner", Type: "string", Description: "Admins only: another owner's name, or all for every owner"}
+
+// Response shapes of handlers that write ad-hoc maps
+type (
+	headersResponse struct {
+		Headers []string `json:"headers"`
+	}
+	eventsResponse struct {
+		Events []*models.FileEvent `json:"events"`
+		Count  int                 `json:"count"`
+	}
+	categoryStatsResponse struct {
+		Categories []*models.CategoryStat `json:"categories"`
+		Count      int                    `json:"count"`
+	}
+	tagsResponse struct {
+		Tags  []*models.TagCount `json:"tags"`
+		Count int                `json:"count"`
+	}
+	termsResponse struct {
+		Terms []string `json:"terms"`
+		Count int      `json:"count"`
+	}
+	schedulesResponse struct {
+		Schedules []*models.ImportSchedule `json:"schedules"`
+		Count     int                      `json:"count"`
+	}
+	datasetsResponse struct {
+		Datasets []*models.Dataset `json:"datasets"`
+		Count    int               `json:"count"`
+	}
+	scheduleRunsResponse struct {
+		Runs  []*models.ScheduleRun `json:"runs"`
+		Count int                   `json:"count"`
+	}
+	profilesResponse struct {
+		Profiles []*models.ProcessingProfile `json:"profiles"`
+		Count    int                         `json:"count"`
+	}
+	regexRulesResponse struct {
+		Patterns []services.RegexRuleDefinition `json:"patterns"`
+		Count    int                            `json:"count"`
+	}
+	classifyResponse struct {
+		Results []*models.ClassifyResult `json:"results"`
+		Count   int                      `json:"count"`
+	}
+	groupChangeResponse struct {
+		Sources  []string `json:"sources"`
+		Target   string   `json:"target"`
+		Affected int      `json:"affected"`
+	}
+	categoryOverridesResponse struct {
+		Updated   int                        `json:"updated"`
+		Overrides []*models.CategoryOverride `json:"overrides"`
+	}
+	violationsResponse struct {
+		Violations []*models.SchemaViolation `json:"violations"`
+		Count      int                       `json:"count"`
+		TotalCount int                       `json:"totalCount"`
+		Page       int                       `json:"page"`
+		PerPage    int                       `json:"perPage"`
+		TotalPages int                       `json:"totalPages"`
+		HasMore    bool                      `json:"hasMore"`
+	}
+	dedupeReportResponse struct {
+		Report     *models.DedupeReport    `json:"report"`
+		Clusters   []*models.DedupeCluster `json:"clusters"`
+		Count      int                     `json:"count"`
+		Page       int                     `json:"page"`
+		PerPage    int                     `json:"perPage"`
+		TotalPages int                     `json:"totalPages"`
+		HasMore    bool                    `json:"hasMore"`
+	}
+	diffJobResponse struct {
+		Job        *models.DiffJob        `json:"job"`
+		Set        string                 `json:"set"`
+		Entries    []*models.DiffJobEntry `json:"entries"`
+		Count      int                    `json:"count"`
+		Page       int                    `json:"page"`
+		PerPage    int                    `json:"perPage"`
+		TotalPages int                    `json:"totalPages"`
+		HasMore    bool                   `json:"hasMore"`
+	}
+	normalizationsResetResponse struct {
+		Discarded     int `json:"discarded"`
+		DeletedStored int `json:"deletedStored"`
+	}
+	sheetsResponse struct {
+		Sheets    []string            `json:"sheets"`
+		SheetInfo []*models.SheetInfo `json:"sheetInfo"`
+	}
+	healthResponse struct {
+		Status   string                 `json:"status"` // ok, or degraded while the database circuit is not closed
+		Database *database.CircuitStats `json:"database"`
+	}
+	metricsResponse struct {
+		HeavyQueries      *models.QueryLimiterStats `json:"heavyQueries"`
+		ProcessingRetries *models.RetryStats        `json:"processingRetries"`
+		GoroutineCount    int64                     `json:"goroutineCount"` // processing goroutines alive
+		GroupCache        *models.CacheStats        `json:"groupCache"`
+	}
+)
+
+// uploadFormFields are the multipart fields of an upload
+var uploadFormFields = []apiParam{
+	{Name: "file", Type: "binary", Description: "CSV or XLSX file, or a zip archive of CSV files", Required: true},
+	{Name: "sheet", Type: "string", Description: "Sheet of an XLSX workbook to import, by name or zero-based index. Required when several sheets have data, unless allSheets is set"},
+	{Name: "allSheets", Type: "boolean", Description: "Create a file per non-empty sheet of an XLSX workbook"},
+	{Name: "searchLanguage", Type: "string", Description: "Text search configuration, e.g. english"},
+	{Name: "tags", Type: "string", Description: "Comma-separated file tags"},
+	{Name: "sync", Type: "boolean", Description: "Process small files before responding"},
+	{Name: "profile", Type: "string", Description: "Processing profile supplying the options not given here"},
+	{Name: "categoryColumns", Type: "string", Description: "Comma-separated columns to group on"},
+	{Name: "nullValues", Type: "string", Description: "Comma-separated values treated as empty"},
+	{Name: "dateFormat", Type: "string", Description: "Output layout of cleaned dates"},
+	{Name: "validation", Type: "string", Description: "JSON object of column rules"},
+	{Name: "rowFilter", Type: "string", Description: `Only ingest rows matching a condition, e.g. status == "active" and date >= "2023-01-01"`},
+	{Name: "computedColumns", Type: "string", Description: `JSON array of {name, expression} columns derived per row, e.g. first_name + " " + last_name`},
+	{Name: "strict", Type: "boolean", Description: "Fail the upload on schema violations"},
+	{Name: "maxViolations", Type: "integer", Description: "Violations tolerated before failing"},
+	{Name: "maskPII", Type: "boolean", Description: "Mask emails, phone numbers and SSNs"},
+	{Name: "fallbackToSelf", Type: "boolean", Description: "Group unmatched records under their own category"},
+	{Name: "naturalKeyColumn", Type: "string", Description: "Column holding each record's own key; later rows repeating a key are dropped"},
+	{Name: "contentSha256", Type: "string", Description: "SHA-256 of the file in hex or base64, also accepted as the X-Content-SHA256 header (or an MD5 as Content-MD5); a mismatch answers 422 CHECKSUM_MISMATCH without storing anything"},
+}
+
+// recordQueryParams are the filters and projection of the record listing
+var recordQueryParams = append([]apiParam{
+	{Name: "fileId", Type: "integer", Description: "File ID; required unless datasetId is given"},
+	{Name: "datasetId", Type: "integer", Description: "Dataset ID, to read the records of all its files; each record carries its sourceFilename"},
+	{Name: "q", Type: "string", Description: services.SearchSyntaxHelp},
+	{Name: "mode", Type: "string", Description: "fulltext (default) or substring"},
+	{Name: "group", Type: "string", Description: "Only records of this group"},
+	{Name: "hasWarnings", Type: "boolean", Description: "Only records with cleaning warnings"},
+	{Name: "hasViolations", Type: "boolean", Description: "Only records with schema violations"},
+	{Name: "createdAfter", Type: "string", Description: "Only records created at or after this RFC 3339 time"},
+	{Name: "createdBefore", Type: "string", Description: "Only records created at or before this RFC 3339 time"},
+	{Name: "field.{column}", Type: "string", Description: "Only records whose cleaned column equals this value, e.g. field.city=Boston"},
+	{Name: "has", Type: "string", Description: "Only records with a value in these columns, repeated or comma-separated", Repeated: true},
+	{Name: "fields", Type: "string", Description: "Comma-separated columns to return"},
+	{Name: "includeOriginal", Type: "boolean", Description: "Set to false to leave out the original data"},
+	{Name: "format", Type: "string", Description: "json (default), csv, or ndjson to stream every matching record; Accept: text/csv or application/x-ndjson also select them"},
+	{Name: "sort", Type: "string", Description: "id (default), lineNumber or -lineNumber, the record's line in the uploaded file"},
+	{Name: "includeLineNumber", Type: "boolean", Description: "Add a line_number column to CSV output"},
+	{Name: "generation", Type: "string", Description: "current (default) or previous, the records replaced by the last reprocess; files only"},
+	{Name: "explain", Type: "boolean", Description: "Add each record's categorizationExplanation under the current rules (JSON only)"},
+	{Name: "cacheControl", Type: "string", Description: "no-cache reads the groups from the database instead of the cache"},
+}, paginationParams(1000)...)
+
+// dataResponseExample is an example page of records
+var dataResponseExample = models.DataResponse{
+	Records: []*models.Record{{
+		ID:                1,
+		CSVFileID:         7,
+		LineNumber:        2,
+		OriginalData:      map[string]string{"name": " jane DOE ", "speciality": "Cardiologist"},
+		CleanedData:       map[string]string{"name": "Jane Doe", "speciality": "Cardiologist"},
+		GroupedCategory:   "doctor",
+		GroupedCategories: []string{"doctor"},
+	}},
+	Groups:     map[string][]int{"doctor": {1}},
+	Count:      1,
+	TotalCount: 250,
+	Page:       1,
+	PerPage:    100,
+	TotalPages: 3,
+	HasMore:    true,
+}
+
+// apiDocs documents every route, keyed by "METHOD path" as registered in main.go
+var apiDocs = map[string]apiOperation{
+	"POST /api/upload": {
+		Summary: "Upload a CSV or XLSX file for processing. Send X-Idempotency-Key to make retries safe. " +
+			"A zip archive creates a file per CSV entry, listed in fileIds, and reports the other entries as skipped. " +
+			"JSON records can be posted as the body instead, with the form fields as query parameters. " +
+			"Answers 202 while the file processes, 201 once a sync upload finished and 200 for dry runs and replayed idempotency keys. " +
+			"Each client address may upload MAX_UPLOADS_PER_IP_PER_DAY times per UTC day (20 by default), then gets 429. " +
+			"Files that are clearly not CSV, such as PDFs and images, are refused with 400; suspicious ones are accepted with warnings.",
+		Status:      http.StatusAccepted,
+		AltStatuses: []int{http.StatusCreated, http.StatusOK},
+		Headers:     map[string]string{"Location": "Status resource of the uploaded file, /api/files/{id}; not sent for archives"},
+		Params: []apiParam{
+			{Name: "dryRun", Type: "boolean", Description: "Clean and categorize without storing anything"},
+			{Name: "filename", Type: "string", Description: "Name of a JSON upload, upload.json by default"},
+		},
+		Form: uploadFormFields,
+		AltBodies: map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "object", "additionalProperties": true},
+			},
+			"application/x-ndjson": map[string]interface{}{
+				"type":        "string",
+				"description": "One JSON object per line",
+			},
+		},
+		FormExample: map[string]interface{}{
+			"file":            "providers.csv",
+			"categoryColumns": "speciality",
+			"tags":            "q3,providers",
+			"sync":            "true",
+		},
+		Response: models.UploadResponse{},
+		Example: models.UploadResponse{
+			Message: "File uploaded and processed",
+			FileID:  7,
+			Mode:    "sync",
+			Data:    &dataResponseExample,
+		},
+	},
+	"GET /api/files": {
+		Summary: "List the caller's files, 50 per page by default",
+		Params: append([]apiParam{
+			{Name: "sort", Type: "string", Description: "uploaded (default) or completeness"},
+			{Name: "status", Type: "string", Description: "Only files that are processing, completed or failed"},
+			{Name: "uploadedAfter", Type: "string", Description: "Only files uploaded at or after this RFC 3339 time"},
+			{Name: "uploadedBefore", Type: "string", Description: "Only files uploaded at or before this RFC 3339 time"},
+			{Name: "filename", Type: "string", Description: "Only files whose name or display name starts with this"},
+			{Name: "tag", Type: "string", Description: "Only files with this tag", Repeated: true},
+			{Name: "tagMode", Type: "string", Description: "any (default) or all of the given tags"},
+			ownerParam,
+		}, paginationParams(maxFilesPerPage)...),
+		Response: models.FilesListResponse{},
+	},
+	"GET /api/files/xlsx-sheets": {
+		Summary:  "List the sheets of a stored or uploaded XLSX workbook with their row counts",
+		Params:   []apiParam{{Name: "fileId", Type: "integer", Description: "Stored file to inspect"}},
+		Response: sheetsResponse{},
+	},
+	"POST /api/files/xlsx-sheets": {
+		Summary:  "List the sheets of an uploaded XLSX workbook with their row counts, without processing it",
+		Form:     []apiParam{{Name: "file", Type: "binary", Description: "XLSX workbook", Required: true}},
+		Response: sheetsResponse{},
+	},
+	"GET /api/files/compare": {
+		Summary: "Compare the records of two files joined on a key column",
+		Params: []apiParam{
+			{Name: "fileA", Type: "integer", Required: true},
+			{Name: "fileB", Type: "integer", Required: true},
+			{Name: "keyColumn", Type: "string", Required: true},
+		},
+		Response: models.FileDiff{},
+	},
+	"POST /api/diff": {
+		Summary:  "Start a field-level diff of two processed files matched on a key column",
+		Body:     diffJobRequest{},
+		Status:   http.StatusAccepted,
+		Response: models.DiffJob{},
+	},
+	"GET /api/diff/{jobId}": {
+		Summary: "Get the status of a diff job with a page of its added, removed, changed or duplicate keys",
+		Params: append([]apiParam{
+			{Name: "set", Type: "string", Description: "added, removed, changed (default) or duplicates"},
+			ownerParam,
+		}, paginationParams(1000)...),
+		Response: diffJobResponse{},
+	},
+	"GET /api/files/{id}": {
+		Summary:  "Get a file",
+		Response: models.CSVFile{},
+	},
+	"PATCH /api/files/{id}": {
+		Summary: "Change the display name, description or tags of a file",
+		Body: struct {
+			DisplayName *string  `json:"displayName"`
+			Description *string  `json:"description"`
+			Tags        []string `json:"tags"`
+		}{},
+		Response: models.CSVFile{},
+	},
+	"DELETE /api/files": {
+		Summary: "Delete several files; nothing is deleted if any of them is processing",
+		Params:  []apiParam{ownerParam},
+		Body: struct {
+			IDs []int `json:"ids"`
+		}{},
+		Response: models.BulkDeleteResponse{},
+	},
+	"DELETE /api/files/{id}": {
+		Summary: "Delete a file and its records",
+		Status:  http.StatusNoContent,
+	},
+	"POST /api/files/{id}/reprocess": {
+		Summary:  "Process a file's raw upload again",
+		Response: models.UploadResponse{},
+	},
+	"GET /api/files/{id}/headers": {
+		Summary:  "List the column names of a file, taken from one of its records",
+		Response: headersResponse{},
+	},
+	"GET /api/files/{id}/events": {
+		Summary:  "Get the timeline of a file: uploads, processing steps and changes, oldest first",
+		Response: eventsResponse{},
+	},
+	"GET /api/files/{id}/diff": {
+		Summary:  "Stream every cell the cleaner changed",
+		Params:   []apiParam{{Name: "field", Type: "string", Description: "Only changes to this column"}},
+		Response: []models.DiffEntry{},
+	},
+	"POST /api/files/{id}/groups/merge": {
+		Summary: "Merge groups of a file into a target group",
+		Body: struct {
+			Source  string   `json:"source"`
+			Sources []string `json:"sources"`
+			Target  string   `json:"target"`
+		}{},
+		Response: groupChangeResponse{},
+	},
+	"PUT /api/files/{id}/groups/{name}": {
+		Summary: "Rename a group of a file",
+		Body: struct {
+			Name string `json:"name"`
+		}{},
+		Response: groupChangeResponse{},
+	},
+	"PATCH /api/files/{id}/records/categories": {
+		Summary: "Set the category of individual records by hand; categories must be defined by the grouping rules",
+		Body: struct {
+			Overrides []*models.CategoryOverride `json:"overrides"`
+		}{},
+		Response: categoryOverridesResponse{},
+	},
+	"GET /api/files/{id}/aggregate": {
+		Summary: "Count records per value of a column, optionally with a metric",
+		Params: []apiParam{
+			{Name: "by", Type: "string", Description: "Column to group by", Required: true},
+			{Name: "metric", Type: "string", Description: "sum, avg, min or max"},
+			{Name: "of", Type: "string", Description: "Numeric column the metric is computed on"},
+			{Name: "limit", Type: "integer", Description: "Maximum number of buckets"},
+		},
+		Response: models.AggregateResponse{},
+	},
+	"POST /api/files/{id}/validate": {
+		Summary:  "Check a file's records against a JSON schema",
+		Body:     map[string]interface{}{},
+		Response: models.ValidationReport{},
+	},
+	"GET /api/files/{id}/violations": {
+		Summary: "List the schema violations of a file",
+		Params: append([]apiParam{
+			{Name: "column", Type: "string"},
+			{Name: "rule", Type: "string"},
+		}, paginationParams(1000)...),
+		Response: violationsResponse{},
+	},
+	"POST /api/files/{id}/preview": {
+		Summary:  "Clean and categorize the first rows of a file without storing them",
+		Params:   []apiParam{{Name: "rows", Type: "integer", Description: "Rows to preview (max 100)"}},
+		Response: models.PreviewResponse{},
+	},
+	"POST /api/files/{id}/enrich": {
+		Summary: "Add columns from a lookup CSV to a file's records, joined on a key column. Reprocessing the file drops them.",
+		Form: []apiParam{
+			{Name: "file", Type: "binary", Description: "Lookup CSV (max 10MB)", Required: true},
+			{Name: "joinColumn", Type: "string", Description: "Column of the file holding the key", Required: true},
+			{Name: "lookupKeyColumn", Type: "string", Description: "Column of the lookup holding the key", Required: true},
+			{Name: "columnsToAdd", Type: "string", Description: "Comma-separated lookup columns to add", Required: true},
+			{Name: "unmatched", Type: "string", Description: "blank (default) or default to fill unmatched records with defaultValue"},
+			{Name: "defaultValue", Type: "string", Description: "Value of the added columns on unmatched records"},
+		},
+		FormExample: map[string]interface{}{
+			"file":            "stores.csv",
+			"joinColumn":      "store_id",
+			"lookupKeyColumn": "id",
+			"columnsToAdd":    "region",
+		},
+		Response: models.EnrichResult{},
+	},
+	"POST /api/files/{id}/dedupe-report": {
+		Summary: "Start building a fuzzy duplicate report",
+		Body: struct {
+			Columns   []string `json:"columns"`
+			Threshold *float64 `json:"threshold"`
+		}{},
+		Status:   http.StatusAccepted,
+		Response: models.DedupeReport{},
+	},
+	"GET /api/files/{id}/dedupe-report": {
+		Summary:  "Get the duplicate report of a file with its clusters",
+		Params:   paginationParams(100),
+		Response: dedupeReportResponse{},
+	},
+	"GET /api/files/{id}/normalization-report": {
+		Summary:  "Get what the cleaner and normalizer changed in a file",
+		Response: models.TermNormalizationReport{},
+	},
+	"GET /api/files/{id}/sample": {
+		Summary: "Get a reproducible random sample of records",
+		Params: []apiParam{
+			{Name: "n", Type: "integer", Description: "Sample size"},
+			{Name: "seed", Type: "integer", Description: "Seed of a previous sample to repeat it"},
+			{Name: "group", Type: "string"},
+			{Name: "fields", Type: "string", Description: "Comma-separated columns to return"},
+		},
+		Response: models.SampleResponse{},
+	},
+	"GET /api/records": {
+		Summary:  "List, search and filter the records of a file or dataset",
+		Params:   recordQueryParams,
+		Response: models.DataResponse{},
+		Example:  dataResponseExample,
+	},
+	"GET /api/groups/records": {
+		Summary: "List the records of one or more groups",
+		Params: append([]apiParam{
+			{Name: "fileId", Type: "integer", Description: "File ID; required unless datasetId is given"},
+			{Name: "datasetId", Type: "integer", Description: "Dataset ID, to read the records of all its files"},
+			{Name: "group", Type: "string", Description: "Group name, repeated or comma-separated", Required: true, Repeated: true},
+			{Name: "fields", Type: "string", Description: "Comma-separated columns to return"},
+		}, paginationParams(100)...),
+		Response: models.DataResponse{},
+		Example:  dataResponseExample,
+	},
+	"GET /api/tags": {
+		Summary:  "List the tags in use with their file counts",
+		Params:   []apiParam{ownerParam},
+		Response: tagsResponse{},
+	},
+	"GET /api/stats/categories": {
+		Summary:  "Get grouped category usage across files",
+		Params:   []apiParam{ownerParam},
+		Response: categoryStatsResponse{},
+	},
+	"GET /api/rules/lint": {
+		Summary:  "Report conflicting and overly generic grouping keywords",
+		Params:   []apiParam{{Name: "maxFraction", Type: "number", Description: "Share of records above which a keyword is generic"}},
+		Response: models.RuleLintReport{},
+	},
+	"GET /api/rules/regex": {
+		Summary:  "List the regex grouping rules",
+		Response: regexRulesResponse{},
+	},
+	"POST /api/rules/regex": {
+		Summary:  "Add a regex grouping rule (admin only)",
+		Body:     services.RegexRuleDefinition{},
+		Status:   http.StatusCreated,
+		Response: services.RegexRuleDefinition{},
+	},
+	"GET /api/profiles": {
+		Summary:  "List the processing profiles",
+		Response: profilesResponse{},
+	},
+	"POST /api/profiles": {
+		Summary:  "Create a named bundle of upload options",
+		Body:     profileRequest{},
+		Status:   http.StatusCreated,
+		Response: models.ProcessingProfile{},
+	},
+	"GET /api/profiles/{name}": {
+		Summary:  "Get a processing profile",
+		Response: models.ProcessingProfile{},
+	},
+	"PUT /api/profiles/{name}": {
+		Summary:  "Replace the options of a processing profile, bumping its version",
+		Body:     profileRequest{},
+		Response: models.ProcessingProfile{},
+	},
+	"DELETE /api/profiles/{name}": {
+		Summary: "Delete a processing profile",
+		Status:  http.StatusNoContent,
+	},
+	"GET /api/schedules": {
+		Summary:  "List the import schedules",
+		Params:   []apiParam{ownerParam},
+		Response: schedulesResponse{},
+	},
+	"POST /api/schedules": {
+		Summary:  "Import the CSV published at a URL on a cron schedule or interval, stored like an upload. URLs of private, loopback and link-local addresses are refused",
+		Body:     scheduleRequest{},
+		Status:   http.StatusCreated,
+		Response: models.ImportSchedule{},
+	},
+	"DELETE /api/schedules/{scheduleId}": {
+		Summary: "Delete an import schedule; imported files stay",
+		Params:  []apiParam{ownerParam},
+		Status:  http.StatusNoContent,
+	},
+	"GET /api/schedules/{scheduleId}/runs": {
+		Summary:  "List the latest runs of an import schedule",
+		Params:   []apiParam{ownerParam},
+		Response: scheduleRunsResponse{},
+	},
+	"GET /api/datasets": {
+		Summary:  "List the datasets",
+		Params:   []apiParam{ownerParam},
+		Response: datasetsResponse{},
+	},
+	"POST /api/datasets": {
+		Summary:  "Create a dataset reading several files as one",
+		Body:     datasetRequest{},
+		Status:   http.StatusCreated,
+		Response: models.Dataset{},
+	},
+	"GET /api/datasets/{datasetId}": {
+		Summary:  "Get a dataset with its current files",
+		Params:   []apiParam{ownerParam},
+		Response: models.Dataset{},
+	},
+	"DELETE /api/datasets/{datasetId}": {
+		Summary: "Delete a dataset; its files stay",
+		Params:  []apiParam{ownerParam},
+		Status:  http.StatusNoContent,
+	},
+	"GET /api/datasets/{datasetId}/aggregate": {
+		Summary: "Count records per value of a column across the files of a dataset",
+		Params: []apiParam{
+			ownerParam,
+			{Name: "by", Type: "string", Description: "Column to group by", Required: true},
+			{Name: "metric", Type: "string", Description: "sum or avg"},
+			{Name: "of", Type: "string", Description: "Numeric column the metric is computed on"},
+			{Name: "limit", Type: "integer", Description: "Maximum number of buckets"},
+		},
+		Response: models.AggregateResponse{},
+	},
+	"GET /api/cleaning/casing-exceptions": {
+		Summary:  "List the terms whose casing the cleaner keeps",
+		Response: termsResponse{},
+	},
+	"POST /api/cleaning/casing-exceptions": {
+		Summary: "Add casing exceptions (admin only)",
+		Body: struct {
+			Terms []string `json:"terms"`
+		}{},
+		Response: termsResponse{},
+	},
+	"POST /api/classify": {
+		Summary: "Explain how values would be cleaned and grouped",
+		Body: struct {
+			Values map[string]string `json:"values"`
+		}{},
+		Response: classifyResponse{},
+	},
+	"POST /api/admin/reload-rules": {
+		Summary:  "Rebuild the grouping rules from their sources, keeping rules added through the API (admin only)",
+		Response: models.RulesReloadReport{},
+	},
+	"DELETE /api/normalizations": {
+		Summary:  "Forget all learned term normalizations (admin only)",
+		Response: normalizationsResetResponse{},
+	},
+	"GET /api/events": {
+		Summary: "Stream status changes and timeline events of the caller's files as server-sent events",
+		Params: []apiParam{
+			ownerParam,
+			{Name: "lastEventId", Type: "integer", Description: "Replay timeline events after this ID first (also read from the Last-Event-ID header)"},
+		},
+		ContentType: "text/event-stream",
+	},
+	"GET /api/health": {
+		Summary:  "Health check, with the state of the database circuit breaker (closed, open or half-open)",
+		Response: healthResponse{},
+	},
+	"GET /api/metrics": {
+		Summary:  "Runtime load figures",
+		Response: metricsResponse{},
+	},
+	"GET /api/openapi.json": {
+		Summary: "Moved to /api/docs/openapi.json",
+		Status:  http.StatusMovedPermanently,
+		Headers: map[string]string{"Location": "/api/docs/openapi.json"},
+	},
+	"GET /api/docs/openapi.json": {
+		Summary:  "This OpenAPI document, cacheable and revalidated by ETag",
+		Response: map[string]interface{}{},
+	},
+	"GET /api/docs": {
+		Summary:     "Swagger UI for this API",
+		ContentType: "text/html",
+	},
+}
+
+// pathParamPattern matches the {name} variables of a route template
+var pathParamPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// BuildOpenAPISpec describes every route registered on router as an OpenAPI 3
+// document. It fails when a route is not documented or a documented route is
+// not registered, so the two cannot drift apart.
+func BuildOpenAPISpec(router *mux.Router) ([]byte, error) {
+	schemas := newSchemaRegistry()
+	paths := make(map[string]map[string]interface{})
+	documented := make(map[string]bool)
+	var missing []string
+
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			key := method + " " + path
+			doc, ok := apiDocs[key]
+			if !ok {
+				missing = append(missing, key)
+				continue
+			}
+			documented[key] = true
+			if paths[path] == nil {
+				paths[path] = make(map[string]interface{})
+			}
+			paths[path][strings.ToLower(method)] = doc.operation(path, schemas)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk routes: %w", err)
+	}
+
+	for key := range apiDocs {
+		if !documented[key] {
+			missing = append(missing, key+" (documented but not registered)")
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("routes without API documentation: %s", strings.Join(missing, ", "))
+	}
+
+	schemas.schema(reflect.TypeOf(APIError{}))
+	return json.Marshal(map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "CSV Data Processor API",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas.components},
+	})
+}
+
+// operation renders an OpenAPI operation object for the route at path
+func (doc apiOperation) operation(path string, schemas *schemaRegistry) map[string]interface{} {
+	var params []map[string]interface{}
+	for _, match := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+		params = append(params, map[string]interface{}{
+			"name":        match[1],
+			"in":          "path",
+			"required":    true,
+			"description": pathParamDescriptions[match[1]],
+			"schema":      map[string]interface{}{"type": "string"},
+		})
+	}
+	for _, param := range doc.Params {
+		schema := map[string]interface{}{"type": param.Type}
+		if param.Repeated {
+			schema = map[string]interface{}{"type": "array", "items": schema}
+		}
+		params = append(params, map[string]interface{}{
+			"name":        param.Name,
+			"in":          "query",
+			"required":    param.Required,
+			"description": param.Description,
+			"schema":      schema,
+		})
+	}
+
+	op := map[string]interface{}{"summary": doc.Summary}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	switch {
+	case doc.Form != nil:
+		properties := make(map[string]interface{})
+		var required []string
+		for _, field := range doc.Form {
+			schema := map[string]interface{}{"type": field.Type, "description": field.Description}
+			if field.Type == "binary" {
+				schema = map[string]interface{}{"type": "string", "format": "binary", "description": field.Description}
+			}
+			properties[field.Name] = schema
+			if field.Required {
+				required = append(required, field.Name)
+			}
+		}
+		media := map[string]interface{}{
+			"schema": map[string]interface{}{"type": "object", "properties": properties, "required": required},
+		}
+		if doc.FormExample != nil {
+			media["example"] = doc.FormExample
+		}
+		content := map[string]interface{}{"multipart/form-data": media}
+		for contentType, schema := range doc.AltBodies {
+			content[contentType] = map[string]interface{}{"schema": schema}
+		}
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  content,
+		}
+	case doc.Body != nil:
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemas.schema(reflect.TypeOf(doc.Body))},
+			},
+		}
+	}
+
+	status := doc.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	switch {
+	case doc.ContentType != "":
+		success["content"] = map[string]interface{}{doc.ContentType: map[string]interface{}{}}
+	case doc.Response != nil:
+		media := map[string]interface{}{"schema": schemas.schema(reflect.TypeOf(doc.Response))}
+		if doc.Example != nil {
+			media["example"] = doc.Example
+		}
+		success["content"] = map[string]interface{}{"application/json": media}
+	}
+	if len(doc.Headers) > 0 {
+		headers := make(map[string]interface{}, len(doc.Headers))
+		for name, description := range doc.Headers {
+			headers[name] = map[string]interface{}{"description": description, "schema": map[string]interface{}{"type": "string"}}
+		}
+		success["headers"] = headers
+	}
+	responses := map[string]interface{}{
+		fmt.Sprint(status): success,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/APIError"}},
+			},
+		},
+	}
+	for _, alt := range doc.AltStatuses {
+		altResponse := make(map[string]interface{}, len(success))
+		for key, value := range success {
+			altResponse[key] = value
+		}
+		altResponse["description"] = http.StatusText(alt)
+		responses[fmt.Sprint(alt)] = altResponse
+	}
+	op["responses"] = responses
+	return op
+}
+
+// schemaRegistry derives JSON schemas from Go types, collecting named structs as
+// reusable components
+type schemaRegistry struct {
+	components map[string]interface{}
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{components: make(map[string]interface{})}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the JSON schema of t, or a reference to its component
+func (s *schemaRegistry) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		if _, ok := s.components[t.Name()]; !ok {
+			s.components[t.Name()] = nil // placeholder for recursive types
+			s.components[t.Name()] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return s.object(t)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// object returns the schema of a struct from its JSON field names
+func (s *schemaRegistry) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			if embedded := s.object(field.Type); embedded["properties"] != nil {
+				for key, value := range embedded["properties"].(map[string]interface{}) {
+					properties[key] = value
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.schema(field.Type)
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// SetOpenAPISpec sets the OpenAPI document served at /api/docs/openapi.json
+func (h *Handler) SetOpenAPISpec(spec []byte) {
+	h.openAPISpec = spec
+	h.openAPIETag = fmt.Sprintf(`"%x"`, sha256.Sum256(spec))
+}
+
+// HandleOpenAPISpec serves the OpenAPI document of the API. It only changes with a
+// new build, so clients may cache it and revalidate with its ETag.
+func (h *Handler) HandleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("ETag", h.openAPIETag)
+	if r.Header.Get("If-None-Match") == h.openAPIETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(h.openAPISpec)
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at the OpenAPI document
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>CSV Data Processor API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: '/api/docs/openapi.json', dom_id: '#swagger-ui' });
+  </script>
+</body>
+</html>
+`
+
+// HandleDocs serves a Swagger UI page for browsing the API
+func (h *Handler) HandleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"csv-processor/services"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// errOwnerNotAllowed is returned when a non-admin asks for another owner's files
+var errOwnerNotAllowed = errors.New("only admins can choose the owner whose files to see")
+
+// SetAdminToken sets the bearer token that lets a request see the files of every owner
+func (h *Handler) SetAdminToken(token string) {
+	h.adminToken = token
+}
+
+// isAdmin reports whether the request carries the admin bearer token
+func (h *Handler) isAdmin(r *http.Request) bool {
+	if h.adminToken == "" {
+		return false
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(h.adminToken)) == 1
+}
+
+// requestOwner returns the owner a request acts as, taken from its X-Owner header
+func requestOwner(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get("X-Owner"))
+}
+
+// ownerScope returns the files a request may see: those of its owner. Admins may
+// pass owner=all to see every file, or owner=<name> to see another owner's.
+func (h *Handler) ownerScope(r *http.Request) (services.OwnerScope, error) {
+	owner := strings.TrimSpace(r.URL.Query().Get("owner"))
+	if owner == "" {
+		return services.OwnerScope{Owner: requestOwner(r)}, nil
+	}
+	if !h.isAdmin(r) {
+		return services.OwnerScope{}, errOwnerNotAllowed
+	}
+	if owner == "all" {
+		return services.OwnerScope{All: true}, nil
+	}
+	return services.OwnerScope{Owner: owner}, nil
+}
+
+// writeOwnerScopeError reports a request for another owner's files
+func writeOwnerScopeError(w http.ResponseWriter, err error) {
+	WriteError(w, APIError{Code: ErrCodeForbidden, Message: err.Error()}, http.StatusForbidden)
+}
+
+// RequireFileOwner answers 404 for requests naming a file of another owner, so
+// the file's existence is not revealed. Files are named by the {id} path variable
+// or the fileId, fileA and fileB query parameters.
+func (h *Handler) RequireFileOwner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids := []string{mux.Vars(r)["id"]}
+		query := r.URL.Query()
+		ids = append(ids, query.Get("fileId"), query.Get("fileA"), query.Get("fileB"))
+
+		var scope services.OwnerScope
+		checked := false
+		for _, idStr := range ids {
+			fileID, err := strconv.Atoi(idStr)
+			if err != nil {
+				continue // missing or malformed IDs are left to the handler
+			}
+			if !checked {
+				if scope, err = h.ownerScope(r); err != nil {
+					writeOwnerScopeError(w, err)
+					return
+				}
+				checked = true
+			}
+			visible, err := h.dbService.FileVisible(fileID, scope)
+			if err != nil {
+				WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error checking file access: " + err.Error()}, http.StatusInternalServerError)
+				return
+			}
+			if !visible {
+				WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found"}, http.StatusNotFound)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
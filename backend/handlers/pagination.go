@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// totalPages returns how many pages of perPage items hold total items
+func totalPages(total, perPage int) int {
+	if perPage <= 0 {
+		return 0
+	}
+	return (total + perPage - 1) / perPage
+}
+
+// setPaginationLinks sets an RFC 5988 Link header with the first, prev, next and last
+// pages of the request, keeping every other query parameter
+func setPaginationLinks(w http.ResponseWriter, r *http.Request, page, pages int) {
+	last := pages
+	if last < 1 {
+		last = 1
+	}
+
+	link := func(p int, rel string) string {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(p))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, query.Encode(), rel)
+	}
+
+	links := []string{link(1, "first")}
+	if page > 1 {
+		prev := page - 1
+		if prev > last {
+			prev = last
+		}
+		links = append(links, link(prev, "prev"))
+	}
+	if page < last {
+		links = append(links, link(page+1, "next"))
+	}
+	links = append(links, link(last, "last"))
+
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// paramError names a query parameter with an invalid value and what it accepts
+type paramError struct {
+	Parameter string `json:"parameter"`
+	Accepted  string `json:"accepted"`
+}
+
+func (e *paramError) Error() string {
+	return fmt.Sprintf("%s must be %s", e.Parameter, e.Accepted)
+}
+
+// writeParamError responds 400 with the parameter and its accepted values as details
+func writeParamError(w http.ResponseWriter, err *paramError) {
+	WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error(), Details: err}, http.StatusBadRequest)
+}
+
+// intParam reads an integer query parameter between min and max (no upper bound when
+// max is 0), or def when it is missing
+func intParam(r *http.Request, name string, def, min, max int) (int, *paramError) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < min || (max > 0 && value > max) {
+		accepted := fmt.Sprintf("an integer of at least %d", min)
+		if max > 0 {
+			accepted = fmt.Sprintf("an integer from %d to %d", min, max)
+		}
+		return 0, &paramError{Parameter: name, Accepted: accepted}
+	}
+	return value, nil
+}
+
+// parsePagination reads the page and perPage parameters, defaulting to the first page
+// of defaultPerPage items
+func parsePagination(r *http.Request, defaultPerPage, maxPerPage int) (page, perPage int, perr *paramError) {
+	if page, perr = intParam(r, "page", 1, 1, 0); perr != nil {
+		return 0, 0, perr
+	}
+	if perPage, perr = intParam(r, "perPage", defaultPerPage, 1, maxPerPage); perr != nil {
+		return 0, 0, perr
+	}
+	return page, perPage, nil
+}
+
+// fileIDParam reads the required fileId parameter, writing an error response when it
+// is missing, malformed or names no file
+func (h *Handler) fileIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	if r.URL.Query().Get("fileId") == "" {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "fileId is required"}, http.StatusBadRequest)
+		return 0, false
+	}
+	fileID, perr := intParam(r, "fileId", 0, 1, 0)
+	if perr != nil {
+		writeParamError(w, perr)
+		return 0, false
+	}
+	exists, err := h.dbService.FileExists(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error checking file: " + err.Error()}, http.StatusInternalServerError)
+		return 0, false
+	}
+	if !exists {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: fmt.Sprintf("File %d not found", fileID)}, http.StatusNotFound)
+		return 0, false
+	}
+	return fileID, true
+}
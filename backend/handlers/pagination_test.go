@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTotalPages(t *testing.T) {
+	tests := []struct {
+		total, perPage, want int
+	}{
+		{0, 10, 0},
+		{1, 10, 1},
+		{10, 10, 1},
+		{11, 10, 2},
+		{250, 100, 3},
+		{5, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := totalPages(tt.total, tt.perPage); got != tt.want {
+			t.Errorf("totalPages(%d, %d) = %d, want %d", tt.total, tt.perPage, got, tt.want)
+		}
+	}
+}
+
+func TestSetPaginationLinks(t *testing.T) {
+	tests := []struct {
+		name  string
+		page  int
+		pages int
+		want  string
+	}{
+		{
+			name: "first page", page: 1, pages: 3,
+			want: `</api/files/7/data?page=1&perPage=10&search=ada>; rel="first", ` +
+				`</api/files/7/data?page=2&perPage=10&search=ada>; rel="next", ` +
+				`</api/files/7/data?page=3&perPage=10&search=ada>; rel="last"`,
+		},
+		{
+			name: "middle page", page: 2, pages: 3,
+			want: `</api/files/7/data?page=1&perPage=10&search=ada>; rel="first", ` +
+				`</api/files/7/data?page=1&perPage=10&search=ada>; rel="prev", ` +
+				`</api/files/7/data?page=3&perPage=10&search=ada>; rel="next", ` +
+				`</api/files/7/data?page=3&perPage=10&search=ada>; rel="last"`,
+		},
+		{
+			name: "last page", page: 3, pages: 3,
+			want: `</api/files/7/data?page=1&perPage=10&search=ada>; rel="first", ` +
+				`</api/files/7/data?page=2&perPage=10&search=ada>; rel="prev", ` +
+				`</api/files/7/data?page=3&perPage=10&search=ada>; rel="last"`,
+		},
+		{
+			name: "only page", page: 1, pages: 1,
+			want: `</api/files/7/data?page=1&perPage=10&search=ada>; rel="first", ` +
+				`</api/files/7/data?page=1&perPage=10&search=ada>; rel="last"`,
+		},
+		{
+			name: "no results", page: 1, pages: 0,
+			want: `</api/files/7/data?page=1&perPage=10&search=ada>; rel="first", ` +
+				`</api/files/7/data?page=1&perPage=10&search=ada>; rel="last"`,
+		},
+		{
+			name: "past the last page", page: 5, pages: 3,
+			want: `</api/files/7/data?page=1&perPage=10&search=ada>; rel="first", ` +
+				`</api/files/7/data?page=3&perPage=10&search=ada>; rel="prev", ` +
+				`</api/files/7/data?page=3&perPage=10&search=ada>; rel="last"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/files/7/data?search=ada&page=9&perPage=10", nil)
+			rec := httptest.NewRecorder()
+			setPaginationLinks(rec, req, tt.page, tt.pages)
+
+			if got := rec.Header().Get("Link"); got != tt.want {
+				t.Errorf("Link =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
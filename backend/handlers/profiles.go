@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"csv-processor/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maxProfileNameLength matches the processing_profiles.name column
+const maxProfileNameLength = 100
+
+// profileRequest is the body of creating or updating a processing profile
+type profileRequest struct {
+	Name    string                  `json:"name"`
+	Options *models.ProcessorConfig `json:"options"`
+}
+
+// decodeProfileRequest reads and validates a profile body, writing an error response
+// when it is invalid
+func decodeProfileRequest(w http.ResponseWriter, r *http.Request) (*profileRequest, bool) {
+	var req profileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid request body"}, http.StatusBadRequest)
+		return nil, false
+	}
+	if req.Options == nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "options is required"}, http.StatusBadRequest)
+		return nil, false
+	}
+	if err := validateProcessorConfig(req.Options); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+		return nil, false
+	}
+	return &req, true
+}
+
+// writeProfileError responds to a failed profile lookup or change
+func writeProfileError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrProfileNotFound):
+		WriteError(w, APIError{Code: ErrCodeNotFound, Message: "Processing profile not found"}, http.StatusNotFound)
+	case errors.Is(err, models.ErrProfileExists):
+		WriteError(w, APIError{Code: ErrCodeDuplicate, Message: "A processing profile with this name already exists"}, http.StatusConflict)
+	default:
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error accessing processing profile: " + err.Error()}, http.StatusInternalServerError)
+	}
+}
+
+// HandleListProfiles lists the processing profiles
+func (h *Handler) HandleListProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := h.dbService.ListProfiles()
+	if err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"profiles": profiles,
+		"count":    len(profiles),
+	})
+}
+
+// HandleGetProfile returns one processing profile
+func (h *Handler) HandleGetProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := h.dbService.GetProfile(mux.Vars(r)["name"])
+	if err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// HandleCreateProfile stores a named bundle of upload options
+func (h *Handler) HandleCreateProfile(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeProfileRequest(w, r)
+	if !ok {
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxProfileNameLength {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "name must be 1 to 100 characters"}, http.StatusBadRequest)
+		return
+	}
+
+	profile, err := h.dbService.CreateProfile(name, req.Options)
+	if err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(profile)
+}
+
+// HandleUpdateProfile replaces the options of a processing profile. Files uploaded
+// with an earlier version keep the options they were processed with.
+func (h *Handler) HandleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeProfileRequest(w, r)
+	if !ok {
+		return
+	}
+
+	profile, err := h.dbService.UpdateProfile(mux.Vars(r)["name"], req.Options)
+	if err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// HandleDeleteProfile removes a processing profile
+func (h *Handler) HandleDeleteProfile(w http.ResponseWriter, r *http.Request) {
+	if err := h.dbService.DeleteProfile(mux.Vars(r)["name"]); err != nil {
+		writeProfileError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"csv-processor/services"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// HandleLintRules reports conflicts and overly generic keywords in the grouping rules
+func (h *Handler) HandleLintRules(w http.ResponseWriter, r *http.Request) {
+	maxFraction := h.lintMaxFraction
+	if fractionStr := r.URL.Query().Get("maxFraction"); fractionStr != "" {
+		f, err := strconv.ParseFloat(fractionStr, 64)
+		if err != nil || f <= 0 || f > 1 {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "maxFraction must be between 0 and 1"}, http.StatusBadRequest)
+			return
+		}
+		maxFraction = f
+	}
+
+	report, err := services.LintRules(h.grouper, h.dbService, maxFraction)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error linting rules: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// HandleGetRegexRules lists the regex grouping rules in evaluation order
+func (h *Handler) HandleGetRegexRules(w http.ResponseWriter, r *http.Request) {
+	rules := h.grouper.RegexRules()
+	definitions := make([]services.RegexRuleDefinition, len(rules))
+	for i, rule := range rules {
+		definitions[i] = rule.Definition()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"patterns": definitions,
+		"count":    len(definitions),
+	})
+}
+
+// HandleAddRegexRule validates and adds a regex grouping rule
+func (h *Handler) HandleAddRegexRule(w http.ResponseWriter, r *http.Request) {
+	var def services.RegexRuleDefinition
+	if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+
+	rule, err := services.CompileRegexRule(def)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	h.grouper.AddRegexRule(rule)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule.Definition())
+}
+
+// HandleReloadRules rebuilds the grouping rules from their sources and reports what changed.
+// Files already processing finish with the rules they started with.
+func (h *Handler) HandleReloadRules(w http.ResponseWriter, r *http.Request) {
+	report, err := h.grouper.Reload()
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Error reloading rules: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Reloaded category rules: generation %d, %d categories, %d keywords, %d regex rules",
+		report.Generation, report.Categories, report.Keywords, report.RegexRules)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"csv-processor/models"
+	"csv-processor/services"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+)
+
+// defaultSampleSize is how many records a sample holds when n is not given
+const defaultSampleSize = 100
+
+// HandleSampleRecords returns a random sample of a file's records. The same seed
+// always returns the same rows; without one a seed is picked and returned so the
+// sample can be shared. Supports the fields= and group= filters of /api/records.
+func (h *Handler) HandleSampleRecords(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.dbService.GetCSVFile(fileID); err != nil {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+		return
+	}
+
+	var warnings []string
+	n := defaultSampleSize
+	if nStr := r.URL.Query().Get("n"); nStr != "" {
+		n, err = strconv.Atoi(nStr)
+		if err != nil || n <= 0 {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "n must be a positive integer"}, http.StatusBadRequest)
+			return
+		}
+	}
+	if n > h.sampleMaxRows {
+		warnings = append(warnings, fmt.Sprintf("n capped at %d", h.sampleMaxRows))
+		n = h.sampleMaxRows
+	}
+
+	seed := rand.Int63n(1 << 31)
+	if seedStr := r.URL.Query().Get("seed"); seedStr != "" {
+		seed, err = strconv.ParseInt(seedStr, 10, 64)
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "seed must be an integer"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	projection, projectionWarnings, err := h.parseProjection(r, []int{fileID})
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching headers: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	warnings = append(warnings, projectionWarnings...)
+
+	filter := &services.RecordFilter{Group: r.URL.Query().Get("group")}
+	records, totalCount, err := h.dbService.SampleRecords(fileID, filter, n, seed, projection)
+	if err != nil {
+		writeQueryError(w, "Error sampling records: ", err)
+		return
+	}
+
+	response := models.SampleResponse{
+		FileID:     fileID,
+		Seed:       seed,
+		Records:    records,
+		Count:      len(records),
+		TotalCount: totalCount,
+		Warnings:   warnings,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
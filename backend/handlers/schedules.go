@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"csv-processor/models"
+	"csv-processor/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// scheduleRunsLimit is how many of its latest runs a schedule's history lists
+const scheduleRunsLimit = 100
+
+// scheduleRequest is the body of creating an import schedule
+type scheduleRequest struct {
+	URL      string `json:"url"`
+	Cron     string `json:"cron,omitempty"`     // five fields, in UTC
+	Interval string `json:"interval,omitempty"` // Go duration, e.g. 24h
+	Profile  string `json:"profile,omitempty"`
+	Enabled  *bool  `json:"enabled,omitempty"` // defaults to true
+}
+
+// loadSchedule returns the schedule named by the path, writing an error response when
+// it doesn't exist or belongs to another owner
+func (h *Handler) loadSchedule(w http.ResponseWriter, r *http.Request) (*models.ImportSchedule, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["scheduleId"])
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid schedule ID"}, http.StatusBadRequest)
+		return nil, false
+	}
+	scope, err := h.ownerScope(r)
+	if err != nil {
+		writeOwnerScopeError(w, err)
+		return nil, false
+	}
+	schedule, err := h.dbService.GetSchedule(id, scope)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeNotFound, Message: "Schedule not found"}, http.StatusNotFound)
+		return nil, false
+	}
+	return schedule, true
+}
+
+// HandleCreateSchedule creates a recurring import of the CSV published at a URL
+func (h *Handler) HandleCreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req scheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+
+	u, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "url must be an http or https URL"}, http.StatusBadRequest)
+		return
+	}
+	// The scheduler refuses to connect to these too; this only reports it up front
+	if !h.allowPrivateURL {
+		if err := services.CheckPublicURL(r.Context(), u); err != nil {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "url can't be imported: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	req.Cron, req.Interval = strings.TrimSpace(req.Cron), strings.TrimSpace(req.Interval)
+	if err := services.ValidateScheduleTiming(req.Cron, req.Interval); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if req.Profile = strings.TrimSpace(req.Profile); req.Profile != "" {
+		if _, err := h.dbService.GetProfile(req.Profile); errors.Is(err, models.ErrProfileNotFound) {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Unknown processing profile " + strconv.Quote(req.Profile)}, http.StatusBadRequest)
+			return
+		} else if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error loading processing profile: " + err.Error()}, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	schedule, err := h.dbService.CreateSchedule(&models.ImportSchedule{
+		URL:      u.String(),
+		Cron:     req.Cron,
+		Interval: req.Interval,
+		Profile:  req.Profile,
+		Owner:    requestOwner(r),
+		Enabled:  req.Enabled == nil || *req.Enabled,
+	})
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error creating schedule: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// HandleListSchedules lists the import schedules of the requesting owner
+func (h *Handler) HandleListSchedules(w http.ResponseWriter, r *http.Request) {
+	scope, err := h.ownerScope(r)
+	if err != nil {
+		writeOwnerScopeError(w, err)
+		return
+	}
+	schedules, err := h.dbService.ListSchedules(scope)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching schedules: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"schedules": schedules,
+		"count":     len(schedules),
+	})
+}
+
+// HandleDeleteSchedule stops and removes an import schedule. Files it imported stay.
+func (h *Handler) HandleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+	if err := h.dbService.DeleteSchedule(schedule.ID); err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error deleting schedule: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetScheduleRuns lists the latest runs of an import schedule, newest first
+func (h *Handler) HandleGetScheduleRuns(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+	runs, err := h.dbService.GetScheduleRuns(schedule.ID, scheduleRunsLimit)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching schedule runs: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"runs":  runs,
+		"count": len(runs),
+	})
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateScheduleRefusesPrivateURLs(t *testing.T) {
+	for _, rawURL := range []string{"http://127.0.0.1:5432/", "http://localhost/data.csv", "http://169.254.169.254/latest/meta-data/", "http://10.1.2.3/export.csv"} {
+		body := `{"url":"` + rawURL + `","interval":"1h"}`
+		rec := httptest.NewRecorder()
+		(&Handler{}).HandleCreateSchedule(rec, httptest.NewRequest(http.MethodPost, "/api/schedules", strings.NewReader(body)))
+
+		var apiErr APIError
+		json.NewDecoder(rec.Body).Decode(&apiErr)
+		if rec.Code != http.StatusBadRequest || apiErr.Code != ErrCodeInvalidInput {
+			t.Errorf("schedule of %s: status %d, code %q, want 400 %s", rawURL, rec.Code, apiErr.Code, ErrCodeInvalidInput)
+		}
+	}
+}
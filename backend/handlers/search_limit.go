@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// minSearchQueryLength is the shortest search query accepted; shorter terms match
+// too much of the index to be worth the scan
+const minSearchQueryLength = 2
+
+// searchLimiter allows each file a number of searches per second, so a single file
+// cannot be hammered with full-text queries. Buckets are created on first use.
+type searchLimiter struct {
+	rate    float64 // searches per second, also the burst size
+	buckets sync.Map
+}
+
+func newSearchLimiter(perSecond int) *searchLimiter {
+	if perSecond < 1 {
+		perSecond = 1
+	}
+	return &searchLimiter{rate: float64(perSecond)}
+}
+
+// tokenBucket holds the searches a file has left, refilled continuously
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token from the file's bucket, reporting false when it is empty
+func (l *searchLimiter) allow(fileID int) bool {
+	value, _ := l.buckets.LoadOrStore(fileID, &tokenBucket{tokens: l.rate, last: time.Now()})
+	bucket := value.(*tokenBucket)
+
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	now := time.Now()
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.rate
+	if bucket.tokens > l.rate {
+		bucket.tokens = l.rate
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// forget drops the bucket of a deleted file
+func (l *searchLimiter) forget(fileID int) {
+	l.buckets.Delete(fileID)
+}
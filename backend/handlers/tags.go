@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HandleGetTags lists every file tag in use with how many of the caller's files
+// carry it
+func (h *Handler) HandleGetTags(w http.ResponseWriter, r *http.Request) {
+	scope, err := h.ownerScope(r)
+	if err != nil {
+		writeOwnerScopeError(w, err)
+		return
+	}
+
+	tags, err := h.dbService.GetTagCounts(scope)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching tags: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tags":  tags,
+		"count": len(tags),
+	})
+}
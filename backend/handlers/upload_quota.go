@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clientIP returns the address a request came from. Behind a reverse proxy, which
+// makes every request come from the proxy, TRUST_PROXY_HEADERS=true takes it from
+// X-Real-IP or the hop the proxy appended to X-Forwarded-For. Only enable it when
+// clients can't reach the server directly, or they can claim any address.
+func (h *Handler) clientIP(r *http.Request) string {
+	if h.trustProxy {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			hops := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// checkUploadQuota counts an upload against the client's daily quota, answering 429
+// and returning false once MAX_UPLOADS_PER_IP_PER_DAY uploads were made today (UTC).
+// A limit of 0 turns the quota off.
+func (h *Handler) checkUploadQuota(w http.ResponseWriter, r *http.Request) bool {
+	if h.uploadQuota <= 0 {
+		return true
+	}
+	now := time.Now().UTC()
+	exceeded, err := h.dbService.CheckAndIncrementUploadQuota(h.clientIP(r), now, h.uploadQuota)
+	if err != nil {
+		writeQueryError(w, "Error checking upload quota: ", err)
+		return false
+	}
+	if exceeded {
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		w.Header().Set("Retry-After", strconv.Itoa(int(tomorrow.Sub(now).Seconds())+1))
+		WriteError(w, APIError{Code: ErrCodeRateLimited, Message: fmt.Sprintf("Daily limit of %d uploads reached for this address", h.uploadQuota)}, http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
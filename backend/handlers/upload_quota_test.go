@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		headers    map[string]string
+		want       string
+	}{
+		{"direct", false, nil, "203.0.113.7"},
+		{"proxy headers ignored by default", false, map[string]string{"X-Real-IP": "198.51.100.1", "X-Forwarded-For": "198.51.100.2"}, "203.0.113.7"},
+		{"real ip", true, map[string]string{"X-Real-IP": " 198.51.100.1 ", "X-Forwarded-For": "198.51.100.2"}, "198.51.100.1"},
+		{"hop appended by the proxy", true, map[string]string{"X-Forwarded-For": "10.0.0.1, 198.51.100.2"}, "198.51.100.2"},
+		{"trusted without headers", true, nil, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/upload", nil)
+			req.RemoteAddr = "203.0.113.7:51234"
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			h := &Handler{trustProxy: tt.trustProxy}
+			if got := h.clientIP(req); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckUploadQuotaDisabled(t *testing.T) {
+	// A limit of 0 never reaches the database
+	h := &Handler{}
+	rec := httptest.NewRecorder()
+	if !h.checkUploadQuota(rec, httptest.NewRequest(http.MethodPost, "/api/upload", nil)) {
+		t.Errorf("checkUploadQuota() refused an upload with the quota off: %d %s", rec.Code, rec.Body)
+	}
+}
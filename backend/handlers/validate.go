@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"csv-processor/models"
+	"csv-processor/services"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// maxValidationViolations caps the violations returned by a validation run
+const maxValidationViolations = 1000
+
+// HandleValidateFile validates every record of a file against a JSON Schema given in
+// the request body. Property names refer to the cleaned column headers.
+func (h *Handler) HandleValidateFile(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Error reading request body"}, http.StatusBadRequest)
+		return
+	}
+	schema, err := services.ParseJSONSchema(body)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.dbService.GetCSVFile(fileID)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+		return
+	}
+	if file.Status == "processing" {
+		WriteError(w, APIError{Code: ErrCodeConflict, Message: "File is still processing"}, http.StatusConflict)
+		return
+	}
+
+	records, err := h.dbService.GetColumnSample(fileID, 0)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching records: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	report := &models.ValidationReport{Violations: make([]*models.SchemaViolation, 0)}
+	for _, record := range records {
+		violations := schema.ValidateRecord(record)
+		if len(violations) == 0 {
+			report.ValidCount++
+			continue
+		}
+		report.InvalidCount++
+		for _, violation := range violations {
+			if len(report.Violations) >= maxValidationViolations {
+				report.Truncated = true
+				break
+			}
+			report.Violations = append(report.Violations, violation)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// HandleGetViolations lists the column rule violations found while processing a file,
+// optionally filtered by column and rule
+func (h *Handler) HandleGetViolations(w http.ResponseWriter, r *http.Request) {
+	fileID, err := fileIDFromPath(r)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+		return
+	}
+
+	page := 1
+	perPage := 100
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if pp, err := strconv.Atoi(r.URL.Query().Get("perPage")); err == nil && pp > 0 && pp <= 1000 {
+		perPage = pp
+	}
+	offset := (page - 1) * perPage
+
+	if _, err := h.dbService.GetCSVFile(fileID); err != nil {
+		WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+		return
+	}
+
+	column := r.URL.Query().Get("column")
+	rule := r.URL.Query().Get("rule")
+	violations, totalCount, err := h.dbService.GetViolations(fileID, column, rule, perPage, offset)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInternal, Message: "Error fetching violations: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	pages := totalPages(totalCount, perPage)
+	setPaginationLinks(w, r, page, pages)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"violations": violations,
+		"count":      len(violations),
+		"totalCount": totalCount,
+		"page":       page,
+		"perPage":    perPage,
+		"totalPages": pages,
+		"hasMore":    page < pages,
+	})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"csv-processor/services"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// HandleListXLSXSheets lists the sheets of an Excel workbook so clients can offer a
+// sheet picker, with the number of rows in each. The workbook is either uploaded in the request (multipart "file" field
+// or raw body) or referenced by ?fileId= of a previous upload.
+func (h *Handler) HandleListXLSXSheets(w http.ResponseWriter, r *http.Request) {
+	var data []byte
+
+	if fileIDStr := r.URL.Query().Get("fileId"); fileIDStr != "" {
+		fileID, err := strconv.Atoi(fileIDStr)
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Invalid file ID"}, http.StatusBadRequest)
+			return
+		}
+		data, err = h.dbService.GetRawContent(fileID)
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeFileNotFound, Message: "File not found: " + err.Error()}, http.StatusNotFound)
+			return
+		}
+	} else if file, _, err := r.FormFile("file"); err == nil {
+		defer file.Close()
+		data, err = io.ReadAll(file)
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Error reading file: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	} else {
+		data, err = io.ReadAll(io.LimitReader(r.Body, 100<<20))
+		if err != nil {
+			WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Error reading body: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !services.IsXLSX(data) {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Not an Excel (.xlsx) workbook"}, http.StatusBadRequest)
+		return
+	}
+
+	info, err := services.InspectXLSXSheets(data)
+	if err != nil {
+		WriteError(w, APIError{Code: ErrCodeInvalidInput, Message: "Error reading workbook: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+	sheets := make([]string, len(info))
+	for i, sheet := range info {
+		sheets[i] = sheet.Name
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"sheets": sheets, "sheetInfo": info})
+}
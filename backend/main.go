@@ -1,17 +1,40 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"csv-processor/config"
 	"csv-processor/database"
 	"csv-processor/handlers"
 	"csv-processor/services"
+	_ "embed"
+	"encoding/json"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// embeddedSpec is the OpenAPI document generated from the routes by go generate
+//
+//go:embed openapi.json
+var embeddedSpec []byte
+
 func main() {
+	// Subcommands run without the database; the HTTP server is the default
+	if len(os.Args) > 1 && os.Args[1] == "process" {
+		os.Exit(runProcess(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		os.Exit(runOpenAPI(os.Args[2:]))
+	}
+
 	// Initialize database
 	err := database.InitDB()
 	if err != nil {
@@ -19,27 +42,148 @@ func main() {
 	}
 	defer database.CloseDB()
 
+	// Cancelled on SIGTERM/SIGINT so in-flight processing stops cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
 	// Initialize services
 	dbService := services.NewDBService()
-	asyncProcessor := services.NewAsyncProcessor(dbService)
+	// Encrypt PII columns at rest when a key is configured
+	if key := config.GetEnv("FIELD_ENCRYPTION_KEY", ""); key != "" {
+		encryptor, err := services.NewFieldEncryptor(key)
+		if err != nil {
+			log.Fatalf("Invalid FIELD_ENCRYPTION_KEY: %v", err)
+		}
+		var piiFields []string
+		if fields := config.GetEnv("PII_FIELDS", ""); fields != "" {
+			piiFields = strings.Split(fields, ",")
+		}
+		dbService.SetFieldEncryption(encryptor, piiFields)
+	}
+	normalizer := services.NewTermNormalizer()
+	grouper := services.NewCategoryGrouper(normalizer)
+	if rulesFile := config.GetEnv("CATEGORY_RULES_FILE", ""); rulesFile != "" {
+		report, err := grouper.LoadRules(rulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load category rules: %v", err)
+		}
+		log.Printf("Loaded category rules from %s: %d categories, %d keywords, %d regex rules",
+			rulesFile, report.Categories, report.Keywords, report.RegexRules)
+	}
+	// Ask an embedding service about terms no rule matches
+	if embeddingURL := config.GetEnv("EMBEDDING_SERVICE_URL", ""); embeddingURL != "" {
+		minScore := config.GetEnvFloat("EMBEDDING_MIN_SCORE", 0.8)
+		grouper.SetSuggester(services.NewEmbeddingCategorySuggester(embeddingURL, dbService.GetCategoryCentroids, minScore))
+	}
+	// Periodically fold similar learned terms together and store the result (0 disables)
+	normalizer.SetPersistFunc(func(mappings map[string]string) error {
+		return dbService.SaveTermNormalizations(context.Background(), mappings)
+	})
+	normalizer.StartAutoMerge(time.Duration(config.GetEnvInt("TERM_MERGE_INTERVAL_MINUTES", 60)) * time.Minute)
+	defer normalizer.StopAutoMerge()
+
+	// Forget upload idempotency keys once they expire, and past days' upload counts
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := dbService.DeleteExpiredIdempotencyKeys(ctx); err != nil {
+					log.Printf("Error deleting expired idempotency keys: %v", err)
+				} else if n > 0 {
+					log.Printf("Deleted %d expired idempotency keys", n)
+				}
+				if n, err := dbService.DeleteOldUploadQuotas(ctx); err != nil {
+					log.Printf("Error deleting old upload quotas: %v", err)
+				} else if n > 0 {
+					log.Printf("Deleted %d old upload quota counts", n)
+				}
+			}
+		}
+	}()
+
+	// Compress raw uploads stored before RAW_CONTENT_ENCODING defaulted to gzip
+	go func() {
+		if n, err := dbService.CompressStoredRawContent(ctx); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Error compressing stored raw content: %v", err)
+			}
+		} else if n > 0 {
+			log.Printf("Compressed the stored raw content of %d files", n)
+		}
+	}()
+
+	csvProcessor := services.NewCSVProcessor(grouper)
+	// Values grouped under themselves keep the casing exceptions added at runtime
+	grouper.SetCleaner(csvProcessor.Cleaner())
+	// Masked values are hashed with PII_HASH_KEY so they can still be joined on
+	if key := config.GetEnv("PII_HASH_KEY", ""); key != "" {
+		csvProcessor.SetPIIHashKey([]byte(key))
+	}
+	events := services.NewEventBus()
+	dbService.SetEventBus(events)
+	groupCache := services.NewGroupCache(dbService)
+	asyncProcessor := services.NewAsyncProcessor(dbService, csvProcessor, events, groupCache)
+	aggregator := services.NewAggregator(dbService)
+	deduplicator := services.NewDeduplicator(dbService)
+	differ := services.NewDiffer(dbService)
+
+	// Catch conflicting or overly generic grouping keywords at boot
+	lintMaxFraction := config.GetEnvFloat("RULES_LINT_MAX_FRACTION", 0.05)
+	services.LogLintWarnings(grouper, dbService, lintMaxFraction)
 
 	// Initialize handlers
-	h := handlers.NewHandler(dbService, asyncProcessor)
+	h := handlers.NewHandler(ctx, dbService, asyncProcessor, aggregator, groupCache, deduplicator, differ, csvProcessor, grouper, events, lintMaxFraction)
+
+	// Admin endpoints require ADMIN_TOKEN as a bearer token, which also
+	// lets a request see every owner's files
+	adminToken := config.GetEnv("ADMIN_TOKEN", "")
+	h.SetAdminToken(adminToken)
+
+	// Recurring URL imports; the scheduler stops with ctx
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		if config.GetEnv("SCHEDULER_ENABLED", "true") != "false" {
+			services.NewScheduler(dbService, asyncProcessor).Run(ctx)
+		}
+	}()
 
 	// Setup router
 	router := mux.NewRouter()
 
 	// API routes
-	router.HandleFunc("/api/upload", h.HandleUpload).Methods("POST")
-	router.HandleFunc("/api/files", h.HandleGetFiles).Methods("GET")
-	router.HandleFunc("/api/files/{id}", h.HandleGetFile).Methods("GET")
-	router.HandleFunc("/api/records", h.HandleGetRecords).Methods("GET")
-	router.HandleFunc("/api/groups/records", h.HandleGetGroupRecords).Methods("GET")
-	router.HandleFunc("/api/health", h.HandleHealth).Methods("GET")
+	registerRoutes(router, h, adminToken)
+
+	// Every route must be documented, so the spec cannot fall behind the route table.
+	// The embedded copy is served; it only differs when go generate wasn't rerun.
+	spec, err := handlers.BuildOpenAPISpec(router)
+	if err != nil {
+		log.Fatalf("Failed to build OpenAPI spec: %v", err)
+	}
+	var embedded bytes.Buffer
+	if err := json.Compact(&embedded, embeddedSpec); err != nil {
+		log.Fatalf("Failed to read embedded OpenAPI spec: %v", err)
+	}
+	if !bytes.Equal(embedded.Bytes(), spec) {
+		log.Println("Warning: openapi.json is out of date with the routes; run go generate")
+	}
+	h.SetOpenAPISpec(embedded.Bytes())
 
 	// CORS middleware
 	router.Use(corsMiddleware)
 
+	// Files are only visible to the owner named in the X-Owner header
+	router.Use(h.RequireFileOwner)
+
+	// Response compression (set GZIP_ENABLED=false to debug raw responses)
+	if config.GetEnv("GZIP_ENABLED", "true") != "false" {
+		router.Use(gzipMiddleware(config.GetEnvInt("GZIP_MIN_SIZE", 1024)))
+	}
+
 	// Start server
 	srv := &http.Server{
 		Handler:      router,
@@ -48,15 +192,59 @@ func main() {
 		ReadTimeout:  60 * time.Second,
 	}
 
-	log.Println("Server starting on port 8080...")
-	log.Fatal(srv.ListenAndServe())
+	go func() {
+		log.Println("Server starting on port 8080...")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	// Profiling endpoints on a separate port (ENABLE_PPROF=true)
+	debugSrv := newDebugServer()
+	if debugSrv != nil {
+		go func() {
+			log.Printf("Debug server (pprof) starting on %s...", debugSrv.Addr)
+			if err := debugSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("Debug server error: %v", err)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	log.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	// The debug server goes first so profiling stops before the API drains
+	if debugSrv != nil {
+		if err := debugSrv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down debug server: %v", err)
+		}
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+
+	// Processing was cancelled with ctx; let it record its outcome before exiting.
+	// The scheduler goes first, as it may still be starting an import.
+	processed := make(chan struct{})
+	go func() {
+		<-schedulerDone
+		asyncProcessor.Wait()
+		close(processed)
+	}()
+	select {
+	case <-processed:
+	case <-shutdownCtx.Done():
+		log.Printf("Gave up waiting for %d processing goroutines", asyncProcessor.Running())
+	}
 }
 
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, OPTIONS, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Idempotency-Key, X-Owner")
+		w.Header().Set("Access-Control-Expose-Headers", "Link, Retry-After, X-Idempotency-Replay")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -66,3 +254,20 @@ func corsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// adminOnly rejects requests without the admin bearer token. Admin endpoints are
+// disabled entirely when no token is configured.
+func adminOnly(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			handlers.WriteError(w, handlers.APIError{Code: handlers.ErrCodeForbidden, Message: "Admin endpoints are disabled: ADMIN_TOKEN is not set"}, http.StatusForbidden)
+			return
+		}
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			handlers.WriteError(w, handlers.APIError{Code: handlers.ErrCodeUnauthorized, Message: "Unauthorized"}, http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"csv-processor/handlers"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// TestEmbeddedOpenAPISpec fails when a route or its documentation changed without
+// rerunning go generate
+func TestEmbeddedOpenAPISpec(t *testing.T) {
+	router := mux.NewRouter()
+	registerRoutes(router, &handlers.Handler{}, "")
+	spec, err := handlers.BuildOpenAPISpec(router)
+	if err != nil {
+		t.Fatalf("BuildOpenAPISpec() error: %v", err)
+	}
+
+	var embedded bytes.Buffer
+	if err := json.Compact(&embedded, embeddedSpec); err != nil {
+		t.Fatalf("embedded openapi.json is not JSON: %v", err)
+	}
+	if !bytes.Equal(embedded.Bytes(), spec) {
+		t.Error("openapi.json is out of date with the routes; run go generate")
+	}
+}
+
+func TestOpenAPISpecRedirect(t *testing.T) {
+	router := mux.NewRouter()
+	registerRoutes(router, &handlers.Handler{}, "")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/api/docs/openapi.json" {
+		t.Errorf("GET /api/openapi.json = %d to %q, want 301 to /api/docs/openapi.json", rec.Code, rec.Header().Get("Location"))
+	}
+}
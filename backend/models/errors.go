@@ -0,0 +1,35 @@
+package models
+
+import "errors"
+
+// ErrVersionConflict is returned when a CSV file was modified by someone else between
+// reading it and writing it back
+var ErrVersionConflict = errors.New("CSV file was modified concurrently")
+
+// ErrTooManyQueries is returned when an expensive query could not start because the
+// database is already running as many of them as allowed
+var ErrTooManyQueries = errors.New("too many expensive queries in flight")
+
+// ErrInvalidSearchQuery is returned when a search query cannot be parsed
+var ErrInvalidSearchQuery = errors.New("invalid search query")
+
+// ErrReportRunning is returned when a report is requested while the previous one
+// for the same file is still being built
+var ErrReportRunning = errors.New("report is still running")
+
+// ErrProfileNotFound is returned when no processing profile has the requested name
+var ErrProfileNotFound = errors.New("processing profile not found")
+
+// ErrProfileExists is returned when creating a processing profile whose name is taken
+var ErrProfileExists = errors.New("processing profile already exists")
+
+// ErrRecordNotFound is returned when a record ID does not belong to the current
+// records of a file
+var ErrRecordNotFound = errors.New("records not found among the file's current records")
+
+// ErrArchiveTooLarge is returned when an uploaded archive expands beyond its limits
+var ErrArchiveTooLarge = errors.New("archive too large")
+
+// ErrFileProcessing is returned when a file cannot be changed because it is being
+// processed
+var ErrFileProcessing = errors.New("file is already processing")
@@ -6,30 +6,290 @@ import "time"
 type CSVFile struct {
 	ID               int        `json:"id"`
 	Filename         string     `json:"filename"`
+	DisplayName      string     `json:"displayName,omitempty"`
+	Description      string     `json:"description,omitempty"`
 	FileSize         int64      `json:"fileSize"`
-	Status           string     `json:"status"` // processing, completed, failed
+	SheetName        string     `json:"sheetName,omitempty"`      // selected worksheet for Excel uploads
+	SearchLanguage   string     `json:"searchLanguage,omitempty"` // text search configuration; empty means simple
+	Status           string     `json:"status"`                   // processing, completed, failed
 	RecordCount      int        `json:"recordCount"`
 	ProcessingTimeMs int64      `json:"processingTimeMs"`
 	ErrorMessage     string     `json:"errorMessage,omitempty"`
 	UploadedAt       time.Time  `json:"uploadedAt"`
 	CompletedAt      *time.Time `json:"completedAt,omitempty"`
+	Version          int        `json:"version"`              // incremented on every status change
+	Generation       int        `json:"generation,omitempty"` // generation of records readers currently see
+	Tags             []string   `json:"tags"`
+	Owner            string     `json:"owner,omitempty"`
+	ContentSHA256    string     `json:"contentSha256,omitempty"` // hex SHA-256 of the upload, set when it matched a client-sent checksum
+
+	CompletenessScore float64                `json:"completenessScore"` // fraction of non-empty cells
+	ColumnStats       map[string]*ColumnStat `json:"columnStats,omitempty"`
+
+	ProcessingConfig *ProcessorConfig `json:"processingConfig,omitempty"`
+
+	ViolationCount   int            `json:"violationCount,omitempty"`
+	ViolationSummary map[string]int `json:"violationSummary,omitempty"` // column -> violations
+
+	Timings *ProcessingTimings `json:"timings,omitempty"`
+
+	// Transient database errors retried while processing the file
+	RetryCount     int    `json:"retryCount,omitempty"`
+	LastRetryError string `json:"lastRetryError,omitempty"`
+
+	// PIIMasked is set when the file was processed with masking, so its cleaned
+	// data may be redacted. MaskedColumns counts the values redacted per column.
+	PIIMasked     bool           `json:"piiMasked"`
+	MaskedColumns map[string]int `json:"maskedColumns,omitempty"`
+
+	// PIIColumns flags the columns likely holding personal data, detected from
+	// their names and raw values: column -> email, phone, name or address
+	PIIColumns map[string]string `json:"piiColumns,omitempty"`
+}
+
+// ProcessingTimings breaks the processing time of a file down by stage
+type ProcessingTimings struct {
+	Parse     *StageTiming `json:"parse"`
+	Transform *StageTiming `json:"transform"` // cleaning and grouping
+	Insert    *StageTiming `json:"insert,omitempty"`
+	TotalMs   int64        `json:"totalMs"`
+
+	// RowsFiltered counts the rows skipped by the upload's row filter
+	RowsFiltered int `json:"rowsFiltered,omitempty"`
+}
+
+// StageTiming is the time one processing stage took and its throughput
+type StageTiming struct {
+	DurationMs int64   `json:"durationMs"`
+	RowsPerSec float64 `json:"rowsPerSec"`
+}
+
+// ProcessorConfig holds the per-upload processing options. It is stored with the
+// file so reprocessing uses the same settings.
+type ProcessorConfig struct {
+	// CategoryColumns are combined, in order, into the value used for grouping.
+	// When empty the category is detected from well-known field names.
+	CategoryColumns []string `json:"categoryColumns,omitempty"`
+	// NullValues are cell values turned into empty cells. nil uses the server
+	// defaults; an empty list keeps every value.
+	NullValues []string `json:"nullValues"`
+	// DateOutputFormat is the Go time layout dates are rewritten in. Empty means
+	// ISO 8601 (2006-01-02).
+	DateOutputFormat string `json:"dateOutputFormat,omitempty"`
+
+	// Validation maps columns to the rules their values are checked against.
+	// Violations are recorded without blocking ingestion unless Strict is set,
+	// in which case more than MaxViolations of them fail the file.
+	Validation    map[string]*ColumnRule `json:"validation,omitempty"`
+	Strict        bool                   `json:"strict,omitempty"`
+	MaxViolations int                    `json:"maxViolations,omitempty"`
+
+	// FallbackToSelf uses the category value itself as the group of records whose
+	// category matches no group, instead of leaving them ungrouped
+	FallbackToSelf bool `json:"fallbackToSelf,omitempty"`
+
+	// MaskPII redacts emails, phone numbers and SSN-like values in every column
+	MaskPII bool `json:"maskPII,omitempty"`
+
+	// NaturalKeyColumn holds the file's own record key. Later rows repeating a
+	// key are dropped.
+	NaturalKeyColumn string `json:"naturalKeyColumn,omitempty"`
+
+	// ComputedColumns are added to every row's cleaned data, in order, after cleaning
+	ComputedColumns []ComputedColumn `json:"computedColumns,omitempty"`
+
+	// RowFilter is a condition on cleaned values, e.g. status == "active"; rows it
+	// doesn't hold for are not ingested
+	RowFilter string `json:"rowFilter,omitempty"`
+
+	// Profile and ProfileVersion name the processing profile the options were taken
+	// from. The options themselves are a snapshot, so editing the profile later
+	// doesn't change how the file is reprocessed.
+	Profile        string `json:"profile,omitempty"`
+	ProfileVersion int    `json:"profileVersion,omitempty"`
+}
+
+// ImportSchedule imports the CSV published at URL every Interval, or whenever Cron
+// fires, with the options of Profile
+type ImportSchedule struct {
+	ID        int        `json:"id"`
+	URL       string     `json:"url"`
+	Cron      string     `json:"cron,omitempty"`     // five fields, in UTC
+	Interval  string     `json:"interval,omitempty"` // Go duration, e.g. 24h
+	Profile   string     `json:"profile,omitempty"`
+	Owner     string     `json:"owner"`
+	Enabled   bool       `json:"enabled"`
+	NextRunAt time.Time  `json:"nextRunAt"`
+	LastRunAt *time.Time `json:"lastRunAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// ScheduleRun is one firing of an import schedule. Status is skipped when the
+// previous import was still processing, failed when the download failed, and
+// otherwise the status of the imported file.
+type ScheduleRun struct {
+	ID           int       `json:"id"`
+	ScheduleID   int       `json:"scheduleId"`
+	FileID       *int      `json:"fileId,omitempty"`
+	Status       string    `json:"status"`
+	ErrorMessage string    `json:"errorMessage,omitempty"`
+	StartedAt    time.Time `json:"startedAt"`
+}
+
+// Dataset reads several files as one. FileIDs lists its current members; deleting
+// a file removes it from every dataset.
+type Dataset struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner"`
+	FileIDs   []int     `json:"fileIds"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BulkDeleteResponse reports the outcome of deleting several files at once
+type BulkDeleteResponse struct {
+	Deleted int      `json:"deleted"`
+	Skipped int      `json:"skipped"`
+	Errors  []string `json:"errors"` // why files were skipped
+}
+
+// ProcessingProfile is a named bundle of upload options. Version is bumped on every
+// update.
+type ProcessingProfile struct {
+	ID        int              `json:"id"`
+	Name      string           `json:"name"`
+	Options   *ProcessorConfig `json:"options"`
+	Version   int              `json:"version"`
+	CreatedAt time.Time        `json:"createdAt"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+}
+
+// ComputedColumn is a column derived from the other values of its row
+type ComputedColumn struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"` // e.g. first_name + " " + last_name
+}
+
+// ColumnRule describes the values allowed in a column
+type ColumnRule struct {
+	Type          string   `json:"type,omitempty"` // string, integer, number, boolean, email, date
+	Required      bool     `json:"required,omitempty"`
+	Pattern       string   `json:"pattern,omitempty"`
+	Min           *float64 `json:"min,omitempty"`
+	Max           *float64 `json:"max,omitempty"`
+	AllowedValues []string `json:"allowedValues,omitempty"`
+	// Mask redacts the column's cleaned values; StoreOriginal=false also drops the
+	// column from the stored original data
+	Mask          bool  `json:"mask,omitempty"`
+	StoreOriginal *bool `json:"storeOriginal,omitempty"`
+}
+
+// Violation is a value that broke one of its column's rules
+type Violation struct {
+	RecordID int    `json:"recordId"` // data row number
+	Column   string `json:"column"`
+	Rule     string `json:"rule"` // type, required, pattern, min, max, allowedValues
+	Value    string `json:"value"`
+}
+
+// ColumnStat holds per-column statistics computed after processing
+type ColumnStat struct {
+	NonEmpty     int     `json:"nonEmpty"`
+	Empty        int     `json:"empty"`
+	Nulled       int     `json:"nulled,omitempty"` // placeholder values (e.g. "N/A") counted as empty
+	Completeness float64 `json:"completeness"`
+}
+
+// FileEvent represents an entry in a file's timeline
+type FileEvent struct {
+	ID        int    `json:"id"`
+	CSVFileID int    `json:"csvFileId"`
+	EventType string `json:"eventType"` // see the FileEvent* constants and status_changed, deleted, groups_changed, tags_changed, details_changed, enriched
+	OldStatus string `json:"oldStatus,omitempty"`
+	NewStatus string `json:"newStatus,omitempty"`
+	Actor     string `json:"actor"`
+	// Detail holds what the event type records, e.g. row counts or the error of a failure
+	Detail     map[string]interface{} `json:"detail,omitempty"`
+	OccurredAt time.Time              `json:"occurredAt"`
+}
+
+// Event types of a file's processing timeline
+const (
+	FileEventUploaded         = "uploaded"
+	FileEventParsingStarted   = "parsing_started"
+	FileEventRowsParsed       = "rows_parsed"
+	FileEventRecordsCommitted = "records_committed"
+	FileEventWarnings         = "warnings_emitted"
+	FileEventCompleted        = "completed"
+	FileEventFailed           = "failed"
+	FileEventCancelled        = "cancelled"
+	FileEventReprocessed      = "reprocessed"
+)
+
+// FileUpdate is pushed to live subscribers when a file's status changes or an event
+// is added to its timeline
+type FileUpdate struct {
+	Type   string     `json:"type"` // file_updated or file_event
+	FileID int        `json:"fileId"`
+	Status string     `json:"status,omitempty"`
+	Event  *FileEvent `json:"event,omitempty"` // for file_event
 }
 
 // Record represents a single row from the CSV file after processing
 type Record struct {
 	ID              int               `json:"id"`
 	CSVFileID       int               `json:"csvFileId"`
-	OriginalData    map[string]string `json:"originalData"`
+	OriginalData    map[string]string `json:"originalData,omitempty"`
 	CleanedData     map[string]string `json:"cleanedData"`
 	GroupedCategory string            `json:"groupedCategory,omitempty"`
-	CreatedAt       time.Time         `json:"createdAt"`
+	// Every group the record matches, GroupedCategory first
+	GroupedCategories []string  `json:"groupedCategories,omitempty"`
+	NaturalKey        string    `json:"naturalKey,omitempty"`     // value of the file's key column
+	SourceFilename    string    `json:"sourceFilename,omitempty"` // name of the file the record came from, in dataset listings
+	CreatedAt         time.Time `json:"createdAt"`
+
+	RowNumber     int          `json:"rowNumber,omitempty"`  // position of the row in the uploaded file
+	LineNumber    int          `json:"lineNumber,omitempty"` // line of the uploaded file the row starts on; the header is line 1
+	Warnings      []string     `json:"warnings,omitempty"`
+	Violations    []*Violation `json:"violations,omitempty"` // column rule violations found during processing
+	NulledColumns []string     `json:"-"`                    // columns whose placeholder value was emptied during processing
+	MaskedColumns []string     `json:"-"`                    // columns whose value was redacted during processing
+
+	// Why the record got its group under the current rules, with ?explain=true
+	CategorizationExplanation *CategorizationExplanation `json:"categorizationExplanation,omitempty"`
+	// PIIHashes holds a keyed hash of each redacted value, so records can still be joined on it
+	PIIHashes map[string]string `json:"piiHashes,omitempty"`
 }
 
 // UploadResponse represents the response after CSV upload
 type UploadResponse struct {
-	Message string   `json:"message"`
-	FileID  int      `json:"fileId"`
-	File    *CSVFile `json:"file"`
+	Message   string        `json:"message"`
+	FileID    int           `json:"fileId,omitempty"`    // not set for dry runs
+	StatusURL string        `json:"statusUrl,omitempty"` // where to poll the file's status, also sent as Location
+	File      *CSVFile      `json:"file,omitempty"`
+	Mode      string        `json:"mode"`           // sync, async, dryRun
+	Data      *DataResponse `json:"data,omitempty"` // first page of records when processed synchronously
+
+	// A zip archive creates a file per CSV entry instead of a single file
+	FileIDs []int           `json:"fileIds,omitempty"`
+	Files   []*CSVFile      `json:"files,omitempty"`
+	Skipped []*SkippedEntry `json:"skipped,omitempty"` // archive entries that were not processed
+
+	// Warnings say why an accepted upload may not be the CSV it was meant to be
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// SheetInfo describes a sheet of an Excel workbook
+type SheetInfo struct {
+	Name  string `json:"name"`
+	Index int    `json:"index"` // zero-based, also accepted as sheet=
+	Rows  int    `json:"rows"`  // non-blank rows, header included
+}
+
+// SkippedEntry is an entry of an uploaded archive that was not processed
+type SkippedEntry struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
 }
 
 // DataResponse represents the response for getting all data
@@ -40,11 +300,331 @@ type DataResponse struct {
 	TotalCount int              `json:"totalCount"`
 	Page       int              `json:"page"`
 	PerPage    int              `json:"perPage"`
+	TotalPages int              `json:"totalPages"`
 	HasMore    bool             `json:"hasMore"`
+	// GroupCounts holds the records per selected group when filtering by groups
+	GroupCounts map[string]int `json:"groupCounts,omitempty"`
+	Warnings    []string       `json:"warnings,omitempty"`
+}
+
+// SampleResponse is a reproducible random sample of a file's records
+type SampleResponse struct {
+	FileID     int       `json:"fileId"`
+	Seed       int64     `json:"seed"` // pass back to get the same rows again
+	Records    []*Record `json:"records"`
+	Count      int       `json:"count"`
+	TotalCount int       `json:"totalCount"` // records the sample was drawn from
+	Warnings   []string  `json:"warnings,omitempty"`
+}
+
+// PreviewResponse represents the cleaned first rows of a file before full processing
+type PreviewResponse struct {
+	FileID         int       `json:"fileId"`
+	Headers        []string  `json:"headers"`
+	CategoryColumn string    `json:"categoryColumn,omitempty"`
+	Records        []*Record `json:"records"`
+	Count          int       `json:"count"`
+}
+
+// GroupOverride represents a manual merge or rename of a group within a file
+type GroupOverride struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// CategoryOverride sets the grouped category of a single record by hand.
+// PreviousCategory is filled in with the category it replaced.
+type CategoryOverride struct {
+	RecordID         int    `json:"recordId"`
+	Category         string `json:"category"`
+	PreviousCategory string `json:"previousCategory,omitempty"`
+}
+
+// CategoryStat represents how a grouped category is used across all files
+type CategoryStat struct {
+	Category      string `json:"category"`
+	TotalRecords  int    `json:"totalRecords"`
+	FilesCount    int    `json:"filesCount"`
+	RecordsLast7d int    `json:"recordsLast7d"` // records added in the last 7 days
 }
 
 // FilesListResponse represents the list of all CSV files
 type FilesListResponse struct {
-	Files []*CSVFile `json:"files"`
-	Count int        `json:"count"`
+	Files      []*CSVFile  `json:"files"`
+	Count      int         `json:"count"`
+	TotalCount int         `json:"totalCount"`
+	Page       int         `json:"page"`
+	PerPage    int         `json:"perPage"`
+	TotalPages int         `json:"totalPages"`
+	HasMore    bool        `json:"hasMore"`
+	Filters    *FileFilter `json:"filters"` // the filters applied to the listing
+}
+
+// FileFilter narrows the files list. Zero values don't filter.
+type FileFilter struct {
+	Status         string     `json:"status,omitempty"`
+	UploadedAfter  *time.Time `json:"uploadedAfter,omitempty"` // inclusive bounds on uploaded_at
+	UploadedBefore *time.Time `json:"uploadedBefore,omitempty"`
+	Filename       string     `json:"filename,omitempty"` // prefix of the filename or display name
+	Tags           []string   `json:"tags,omitempty"`
+	MatchAllTags   bool       `json:"matchAllTags,omitempty"` // require every tag instead of any
+}
+
+// AggregateBucket represents the record count (and optional metric) for one column value
+type AggregateBucket struct {
+	Value        string   `json:"value"`
+	Count        int      `json:"count"`
+	NumericCount int      `json:"numericCount,omitempty"`
+	Sum          *float64 `json:"sum,omitempty"`
+	Avg          *float64 `json:"avg,omitempty"`
+}
+
+// AggregateResponse represents a group-by breakdown of a file on a single column
+type AggregateResponse struct {
+	FileID        int                `json:"fileId,omitempty"`
+	DatasetID     int                `json:"datasetId,omitempty"`
+	By            string             `json:"by"`
+	Metric        string             `json:"metric,omitempty"` // sum, avg
+	Of            string             `json:"of,omitempty"`
+	Limit         int                `json:"limit"`
+	Buckets       []*AggregateBucket `json:"buckets"`
+	Other         *AggregateBucket   `json:"other,omitempty"`
+	TotalCount    int                `json:"totalCount"`
+	ExcludedCount int                `json:"excludedCount,omitempty"` // non-numeric values skipped by the metric
+}
+
+// RuleLintReport describes problems found in the category grouping rules
+type RuleLintReport struct {
+	DuplicateKeywords []*KeywordConflict `json:"duplicateKeywords"`
+	ShadowedKeywords  []*KeywordShadow   `json:"shadowedKeywords"`
+	GenericKeywords   []*GenericKeyword  `json:"genericKeywords"`
+	CorpusSize        int                `json:"corpusSize"`
+	MaxFraction       float64            `json:"maxFraction"`
+}
+
+// KeywordConflict is a keyword that belongs to more than one category
+type KeywordConflict struct {
+	Keyword    string   `json:"keyword"`
+	Categories []string `json:"categories"`
+}
+
+// KeywordShadow is a keyword containing another category's keyword as a word
+type KeywordShadow struct {
+	Keyword           string `json:"keyword"`
+	Category          string `json:"category"`
+	ShadowedBy        string `json:"shadowedBy"`
+	ShadowingCategory string `json:"shadowingCategory"`
+}
+
+// GenericKeyword is a single-word keyword that matches too much of the corpus
+type GenericKeyword struct {
+	Keyword       string   `json:"keyword"`
+	Categories    []string `json:"categories"`
+	MatchFraction float64  `json:"matchFraction"`
+}
+
+// RulesReloadReport describes the grouping rules that became active after a reload
+type RulesReloadReport struct {
+	Generation         int      `json:"generation"`
+	PreviousGeneration int      `json:"previousGeneration"`
+	Categories         int      `json:"categories"`
+	Keywords           int      `json:"keywords"`
+	RegexRules         int      `json:"regexRules"`
+	RuntimeRules       int      `json:"runtimeRules"` // keyword and regex rules added through the API, kept across reloads
+	AddedCategories    []string `json:"addedCategories"`
+	RemovedCategories  []string `json:"removedCategories"`
+	AddedKeywords      []string `json:"addedKeywords"`
+	RemovedKeywords    []string `json:"removedKeywords"`
+	ChangedKeywords    []string `json:"changedKeywords"` // keywords now mapped to a different group
+}
+
+// GroupMatch explains which grouping rule decided the group of a value
+type GroupMatch struct {
+	Group      string  `json:"group"`
+	MatchType  string  `json:"matchType"`            // exact, word, regex, fuzzy, suggested, none
+	Rule       string  `json:"rule,omitempty"`       // keyword or pattern that matched
+	Distance   int     `json:"distance,omitempty"`   // edit distance of a fuzzy match
+	Normalized string  `json:"normalized,omitempty"` // canonical term the match was made on
+	Score      float64 `json:"score,omitempty"`      // similarity of a suggested group
+}
+
+// CategorizationExplanation explains why a term got its category
+type CategorizationExplanation struct {
+	Term          string  `json:"term"`
+	Category      string  `json:"category"`
+	MatchedRule   string  `json:"matchedRule,omitempty"`   // keyword or pattern that matched
+	MatchType     string  `json:"matchType"`               // exact, partial, regex, fuzzy, suggested, none
+	Normalized    string  `json:"normalized,omitempty"`    // canonical term the match was made on
+	FuzzyScore    float64 `json:"fuzzyScore,omitempty"`    // similarity of a fuzzy or suggested match, 0-1
+	FuzzyDistance int     `json:"fuzzyDistance,omitempty"` // edit distance of a fuzzy match
+}
+
+// TermNormalization explains how a term maps onto its canonical form
+type TermNormalization struct {
+	Canonical  string  `json:"canonical"`
+	MatchType  string  `json:"matchType"` // known, fuzzy, new
+	Similarity float64 `json:"similarity,omitempty"`
+}
+
+// TermNormalizationReport describes how the values of a processed file were normalized
+type TermNormalizationReport struct {
+	DistinctTerms     int                   `json:"distinctTerms"`   // distinct values in the file
+	NormalizedTerms   int                   `json:"normalizedTerms"` // distinct values that were changed
+	Merges            map[string][]string   `json:"merges"`          // canonical term -> file terms merged into it
+	TopNormalizations []*NormalizationCount `json:"topNormalizations"`
+	GeneratedAt       time.Time             `json:"generatedAt"`
+}
+
+// NormalizationCount is how often a value of a column was changed into another
+type NormalizationCount struct {
+	Column     string `json:"column"`
+	Original   string `json:"original"`
+	Normalized string `json:"normalized"`
+	Count      int    `json:"count"`
+}
+
+// ClassifyResult shows every step of categorizing a single value
+type ClassifyResult struct {
+	Field         string             `json:"field"`
+	Input         string             `json:"input"`
+	Cleaned       string             `json:"cleaned"`
+	Normalization *TermNormalization `json:"normalization,omitempty"`
+	Group         string             `json:"group"`
+	Match         *GroupMatch        `json:"match"`
+}
+
+// SchemaViolation is a single field of a record that failed schema validation
+type SchemaViolation struct {
+	RecordID int    `json:"recordId"`
+	Field    string `json:"field"`
+	Error    string `json:"error"`
+}
+
+// ValidationReport summarizes validating a file's records against a schema
+type ValidationReport struct {
+	ValidCount   int                `json:"validCount"`
+	InvalidCount int                `json:"invalidCount"`
+	Violations   []*SchemaViolation `json:"violations"`
+	Truncated    bool               `json:"truncated,omitempty"` // more violations than were returned
+}
+
+// QueryLimiterStats describes the load on the expensive query limiter
+type QueryLimiterStats struct {
+	Limit          int   `json:"limit"`
+	InFlight       int   `json:"inFlight"`
+	Waiting        int   `json:"waiting"`
+	Rejected       int64 `json:"rejected"` // queries turned away since startup
+	QueueTimeoutMs int64 `json:"queueTimeoutMs"`
+}
+
+// EnrichResult reports how a lookup table was joined onto a file's records
+type EnrichResult struct {
+	FileID              int      `json:"fileId"`
+	JoinColumn          string   `json:"joinColumn"`
+	ColumnsAdded        []string `json:"columnsAdded"`
+	Matched             int      `json:"matched"`
+	Unmatched           int      `json:"unmatched"`
+	DuplicateLookupKeys int      `json:"duplicateLookupKeys,omitempty"` // lookup rows ignored for repeating a key
+}
+
+// CacheStats describes an in-memory cache
+type CacheStats struct {
+	Entries int   `json:"entries"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+// RetryStats counts the retries of database writes while processing files
+type RetryStats struct {
+	MaxAttempts int   `json:"maxAttempts"` // retries allowed per write
+	Retries     int64 `json:"retries"`     // retries made since startup
+	Exhausted   int64 `json:"exhausted"`   // writes that failed after the last retry
+}
+
+// DiffEntry is a cell whose cleaned value differs from the uploaded one
+type DiffEntry struct {
+	RecordID int    `json:"recordId"`
+	Field    string `json:"field"`
+	Original string `json:"original"`
+	Cleaned  string `json:"cleaned"`
+}
+
+// FileDiff describes how the records of file B differ from file A, matched on a key column
+type FileDiff struct {
+	FileA        int                 `json:"fileA"`
+	FileB        int                 `json:"fileB"`
+	KeyColumn    string              `json:"keyColumn"`
+	Added        []map[string]string `json:"added"`   // in B, not in A
+	Removed      []map[string]string `json:"removed"` // in A, not in B
+	Changed      []*ChangedRecord    `json:"changed"`
+	AddedCount   int                 `json:"addedCount"`
+	RemovedCount int                 `json:"removedCount"`
+	ChangedCount int                 `json:"changedCount"`
+	Truncated    bool                `json:"truncated,omitempty"` // some sets hold fewer records than their count
+}
+
+// ChangedRecord is a key present in both files with different values
+type ChangedRecord struct {
+	Key           string            `json:"key"`
+	Before        map[string]string `json:"before"`
+	After         map[string]string `json:"after"`
+	ChangedFields []string          `json:"changedFields"`
+}
+
+// DiffJob is a background field-level comparison of two files, matching their
+// records on the cleaned value of a key column
+type DiffJob struct {
+	ID             int        `json:"id"`
+	FileIDA        int        `json:"fileIdA"`
+	FileIDB        int        `json:"fileIdB"`
+	KeyColumn      string     `json:"keyColumn"`
+	Status         string     `json:"status"` // running, completed, failed
+	AddedCount     int        `json:"addedCount"`
+	RemovedCount   int        `json:"removedCount"`
+	ChangedCount   int        `json:"changedCount"`
+	DuplicateCount int        `json:"duplicateCount"` // keys repeated within either file, left out of the other sets
+	ErrorMessage   string     `json:"errorMessage,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	CompletedAt    *time.Time `json:"completedAt,omitempty"`
+}
+
+// DiffJobEntry is one key of a diff job's added, removed, changed or duplicate set
+type DiffJobEntry struct {
+	Key     string                  `json:"key"`
+	Data    map[string]string       `json:"data,omitempty"`    // the record, for added and removed keys
+	Changes map[string]*ValueChange `json:"changes,omitempty"` // the changed columns, for changed keys
+	CountA  int                     `json:"countA,omitempty"`  // records with the key in each file, for duplicate keys
+	CountB  int                     `json:"countB,omitempty"`
+}
+
+// ValueChange is a column's cleaned value in the older and newer file
+type ValueChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// DedupeReport is the state of a file's likely-duplicate search
+type DedupeReport struct {
+	FileID       int        `json:"fileId"`
+	Status       string     `json:"status"` // running, completed, failed
+	Columns      []string   `json:"columns"`
+	Threshold    float64    `json:"threshold"`
+	ClusterCount int        `json:"clusterCount"`
+	ErrorMessage string     `json:"errorMessage,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	CompletedAt  *time.Time `json:"completedAt,omitempty"`
+}
+
+// DedupeCluster is a set of records that are likely duplicates of each other
+type DedupeCluster struct {
+	ID         int       `json:"id"`
+	Confidence float64   `json:"confidence"` // mean similarity of the pairs that linked the cluster
+	RecordIDs  []int     `json:"recordIds"`
+	Records    []*Record `json:"records,omitempty"`
+}
+
+// TagCount is a file tag and how many files carry it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
 }
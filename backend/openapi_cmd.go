@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"csv-processor/handlers"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gorilla/mux"
+)
+
+//go:generate go run . openapi -out openapi.json
+
+// runOpenAPI writes the OpenAPI document of the routes, which is how the embedded
+// openapi.json is regenerated:
+//
+//	csv-processor openapi --out openapi.json
+func runOpenAPI(args []string) int {
+	fs := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	out := fs.String("out", "-", "where to write the document (- for stdout)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	spec, err := buildOpenAPISpec()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "openapi: %v\n", err)
+		return exitFailure
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, spec, "", "  "); err != nil {
+		fmt.Fprintf(os.Stderr, "openapi: %v\n", err)
+		return exitFailure
+	}
+	indented.WriteByte('\n')
+
+	if *out == "-" {
+		_, err = os.Stdout.Write(indented.Bytes())
+	} else {
+		err = os.WriteFile(*out, indented.Bytes(), 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "openapi: failed to write document: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// buildOpenAPISpec documents the routes registered by registerRoutes. The handler is
+// never called, so it needs no services.
+func buildOpenAPISpec() ([]byte, error) {
+	router := mux.NewRouter()
+	registerRoutes(router, &handlers.Handler{}, "")
+	return handlers.BuildOpenAPISpec(router)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"csv-processor/models"
+	"csv-processor/services"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit codes of the process subcommand
+const (
+	exitOK           = 0
+	exitFailure      = 1 // the input could not be read or parsed
+	exitUsage        = 2
+	exitWithWarnings = 3 // processed, but some records have warnings or violations
+)
+
+// groupedCategoryColumn is the column the process subcommand adds to the output
+const groupedCategoryColumn = "grouped_category"
+
+// processSummary is the JSON report the process subcommand writes
+type processSummary struct {
+	Records             int            `json:"records"`
+	Groups              map[string]int `json:"groups"` // group -> records
+	Ungrouped           int            `json:"ungrouped"`
+	RecordsWithWarnings int            `json:"recordsWithWarnings"`
+	Violations          int            `json:"violations"`
+}
+
+// runProcess cleans and groups a CSV file on disk without the database or the
+// HTTP server, e.g.
+//
+//	csv-processor process --in data.csv --out cleaned.csv --groups groups.json
+func runProcess(args []string) int {
+	fs := flag.NewFlagSet("process", flag.ContinueOnError)
+	in := fs.String("in", "", "CSV file to process (- for stdin)")
+	out := fs.String("out", "-", "where to write the cleaned CSV (- for stdout)")
+	groups := fs.String("groups", "-", "where to write the JSON summary (- for stdout)")
+	rulesFile := fs.String("rules", os.Getenv("CATEGORY_RULES_FILE"), "JSON grouping rules file")
+	categoryColumns := fs.String("category-columns", "", "comma-separated columns to group on")
+	nullValues := fs.String("null-values", "", "comma-separated values treated as empty")
+	dateFormat := fs.String("date-format", "", "output layout of cleaned dates")
+	maskPII := fs.Bool("mask-pii", false, "mask emails, phone numbers and SSNs")
+	fallbackToSelf := fs.Bool("fallback-to-self", false, "group unmatched records under their own category")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *in == "" {
+		fmt.Fprintln(os.Stderr, "process: --in is required")
+		fs.Usage()
+		return exitUsage
+	}
+	if *out == "-" && *groups == "-" {
+		fmt.Fprintln(os.Stderr, "process: --out and --groups cannot both be stdout")
+		return exitUsage
+	}
+
+	cfg := &models.ProcessorConfig{
+		CategoryColumns:  splitFlagList(*categoryColumns),
+		NullValues:       splitFlagList(*nullValues),
+		DateOutputFormat: *dateFormat,
+		MaskPII:          *maskPII,
+		FallbackToSelf:   *fallbackToSelf,
+	}
+	if cfg.DateOutputFormat != "" {
+		if err := services.ValidateDateFormat(cfg.DateOutputFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "process: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	grouper := services.NewCategoryGrouper(services.NewTermNormalizer())
+	if *rulesFile != "" {
+		if _, err := grouper.LoadRules(*rulesFile); err != nil {
+			fmt.Fprintf(os.Stderr, "process: failed to load category rules: %v\n", err)
+			return exitFailure
+		}
+	}
+	processor := services.NewCSVProcessor(grouper)
+
+	input, closeInput, err := openInput(*in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "process: %v\n", err)
+		return exitFailure
+	}
+	defer closeInput()
+	output, closeOutput, err := createOutput(*out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "process: %v\n", err)
+		return exitFailure
+	}
+
+	summary, err := processToCSV(processor, input, output, cfg)
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "process: %v\n", err)
+		return exitFailure
+	}
+
+	summaryOut, closeSummary, err := createOutput(*groups)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "process: %v\n", err)
+		return exitFailure
+	}
+	encoder := json.NewEncoder(summaryOut)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(summary)
+	if closeErr := closeSummary(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "process: failed to write summary: %v\n", err)
+		return exitFailure
+	}
+
+	if summary.RecordsWithWarnings > 0 || summary.Violations > 0 {
+		return exitWithWarnings
+	}
+	return exitOK
+}
+
+// processToCSV streams input through the processor, writing the cleaned rows with
+// their group to output
+func processToCSV(processor *services.CSVProcessor, input io.Reader, output io.Writer, cfg *models.ProcessorConfig) (*processSummary, error) {
+	summary := &processSummary{Groups: make(map[string]int)}
+	writer := csv.NewWriter(output)
+	var columns []string
+
+	err := processor.StreamCSV(context.Background(), input, cfg, func(headers []string, batch []*models.Record) error {
+		if columns == nil {
+			columns = headers
+			if err := writer.Write(append(append([]string{}, headers...), groupedCategoryColumn)); err != nil {
+				return err
+			}
+		}
+		row := make([]string, len(columns)+1)
+		for _, record := range batch {
+			for i, column := range columns {
+				row[i] = record.CleanedData[column]
+			}
+			row[len(columns)] = record.GroupedCategory
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+
+			summary.Records++
+			if record.GroupedCategory == "" {
+				summary.Ungrouped++
+			} else {
+				summary.Groups[record.GroupedCategory]++
+			}
+			if len(record.Warnings) > 0 {
+				summary.RecordsWithWarnings++
+			}
+			summary.Violations += len(record.Violations)
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, fmt.Errorf("failed to parse input: %w", err)
+		}
+		return nil, fmt.Errorf("failed to process input: %w", err)
+	}
+	return summary, nil
+}
+
+// openInput opens path for reading, or stdin for "-"
+func openInput(path string) (io.Reader, func() error, error) {
+	if path == "-" {
+		return os.Stdin, func() error { return nil }, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open input: %w", err)
+	}
+	return file, file.Close, nil
+}
+
+// createOutput creates path for writing, or returns stdout for "-"
+func createOutput(path string) (io.Writer, func() error, error) {
+	if path == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	return file, file.Close, nil
+}
+
+// splitFlagList splits a comma-separated flag value, dropping blank entries
+func splitFlagList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
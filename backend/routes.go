@@ -0,0 +1,71 @@
+package main
+
+import (
+	"csv-processor/handlers"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// registerRoutes adds the API routes to router. The openapi subcommand registers them
+// too, to document them without a running server.
+func registerRoutes(router *mux.Router, h *handlers.Handler, adminToken string) {
+	router.HandleFunc("/api/upload", h.HandleUpload).Methods("POST")
+	router.HandleFunc("/api/files", h.HandleGetFiles).Methods("GET")
+	router.HandleFunc("/api/files", h.HandleBulkDeleteFiles).Methods("DELETE")
+	router.HandleFunc("/api/files/xlsx-sheets", h.HandleListXLSXSheets).Methods("GET", "POST")
+	router.HandleFunc("/api/files/compare", h.HandleCompareFiles).Methods("GET")
+	router.HandleFunc("/api/diff", h.HandleStartDiff).Methods("POST")
+	router.HandleFunc("/api/diff/{jobId}", h.HandleGetDiff).Methods("GET")
+	router.HandleFunc("/api/files/{id}", h.HandleGetFile).Methods("GET")
+	router.HandleFunc("/api/files/{id}", h.HandleUpdateFile).Methods("PATCH")
+	router.HandleFunc("/api/files/{id}", h.HandleDeleteFile).Methods("DELETE")
+	router.HandleFunc("/api/files/{id}/reprocess", h.HandleReprocessFile).Methods("POST")
+	router.HandleFunc("/api/files/{id}/headers", h.HandleGetHeaders).Methods("GET")
+	router.HandleFunc("/api/files/{id}/events", h.HandleGetFileEvents).Methods("GET")
+	router.HandleFunc("/api/files/{id}/diff", h.HandleGetFileDiff).Methods("GET")
+	router.HandleFunc("/api/files/{id}/groups/merge", h.HandleMergeGroups).Methods("POST")
+	router.HandleFunc("/api/files/{id}/groups/{name}", h.HandleRenameGroup).Methods("PUT")
+	router.HandleFunc("/api/files/{id}/records/categories", h.HandleOverrideCategories).Methods("PATCH")
+	router.HandleFunc("/api/files/{id}/aggregate", h.HandleAggregate).Methods("GET")
+	router.HandleFunc("/api/files/{id}/validate", h.HandleValidateFile).Methods("POST")
+	router.HandleFunc("/api/files/{id}/violations", h.HandleGetViolations).Methods("GET")
+	router.HandleFunc("/api/files/{id}/preview", h.HandlePreviewFile).Methods("POST")
+	router.HandleFunc("/api/files/{id}/enrich", h.HandleEnrichFile).Methods("POST")
+	router.HandleFunc("/api/files/{id}/dedupe-report", h.HandleStartDedupeReport).Methods("POST")
+	router.HandleFunc("/api/files/{id}/dedupe-report", h.HandleGetDedupeReport).Methods("GET")
+	router.HandleFunc("/api/files/{id}/sample", h.HandleSampleRecords).Methods("GET")
+	router.HandleFunc("/api/files/{id}/normalization-report", h.HandleGetNormalizationReport).Methods("GET")
+	router.HandleFunc("/api/records", h.HandleGetRecords).Methods("GET")
+	router.HandleFunc("/api/groups/records", h.HandleGetGroupRecords).Methods("GET")
+	router.HandleFunc("/api/tags", h.HandleGetTags).Methods("GET")
+	router.HandleFunc("/api/stats/categories", h.HandleGetCategoryStats).Methods("GET")
+	router.HandleFunc("/api/rules/lint", h.HandleLintRules).Methods("GET")
+	router.HandleFunc("/api/rules/regex", h.HandleGetRegexRules).Methods("GET")
+	router.HandleFunc("/api/rules/regex", adminOnly(adminToken, h.HandleAddRegexRule)).Methods("POST")
+	router.HandleFunc("/api/profiles", h.HandleListProfiles).Methods("GET")
+	router.HandleFunc("/api/profiles", h.HandleCreateProfile).Methods("POST")
+	router.HandleFunc("/api/profiles/{name}", h.HandleGetProfile).Methods("GET")
+	router.HandleFunc("/api/profiles/{name}", h.HandleUpdateProfile).Methods("PUT")
+	router.HandleFunc("/api/profiles/{name}", h.HandleDeleteProfile).Methods("DELETE")
+	router.HandleFunc("/api/schedules", h.HandleListSchedules).Methods("GET")
+	router.HandleFunc("/api/schedules", h.HandleCreateSchedule).Methods("POST")
+	router.HandleFunc("/api/schedules/{scheduleId}", h.HandleDeleteSchedule).Methods("DELETE")
+	router.HandleFunc("/api/schedules/{scheduleId}/runs", h.HandleGetScheduleRuns).Methods("GET")
+	router.HandleFunc("/api/datasets", h.HandleListDatasets).Methods("GET")
+	router.HandleFunc("/api/datasets", h.HandleCreateDataset).Methods("POST")
+	router.HandleFunc("/api/datasets/{datasetId}", h.HandleGetDataset).Methods("GET")
+	router.HandleFunc("/api/datasets/{datasetId}", h.HandleDeleteDataset).Methods("DELETE")
+	router.HandleFunc("/api/datasets/{datasetId}/aggregate", h.HandleDatasetAggregate).Methods("GET")
+	router.HandleFunc("/api/cleaning/casing-exceptions", h.HandleGetCasingExceptions).Methods("GET")
+	router.HandleFunc("/api/cleaning/casing-exceptions", adminOnly(adminToken, h.HandleAddCasingExceptions)).Methods("POST")
+	router.HandleFunc("/api/classify", h.HandleClassify).Methods("POST")
+	router.HandleFunc("/api/admin/reload-rules", adminOnly(adminToken, h.HandleReloadRules)).Methods("POST")
+	router.HandleFunc("/api/normalizations", adminOnly(adminToken, h.HandleResetNormalizations)).Methods("DELETE")
+	router.HandleFunc("/api/events", h.HandleStreamEvents).Methods("GET")
+	router.HandleFunc("/api/health", h.HandleHealth).Methods("GET")
+	router.HandleFunc("/api/metrics", h.HandleMetrics).Methods("GET")
+	router.Handle("/api/openapi.json", http.RedirectHandler("/api/docs/openapi.json", http.StatusMovedPermanently)).Methods("GET")
+	router.HandleFunc("/api/docs/openapi.json", h.HandleOpenAPISpec).Methods("GET")
+	router.HandleFunc("/api/docs", h.HandleDocs).Methods("GET")
+}
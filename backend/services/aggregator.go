@@ -0,0 +1,113 @@
+package services
+
+import (
+	"csv-processor/models"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type Aggregator struct {
+	dbService *DBService
+	cache     map[string]*models.AggregateResponse
+	mu        sync.RWMutex
+}
+
+func NewAggregator(dbService *DBService) *Aggregator {
+	return &Aggregator{
+		dbService: dbService,
+		cache:     make(map[string]*models.AggregateResponse),
+	}
+}
+
+// Aggregate builds a group-by breakdown of a file on the given column.
+// Results for completed files are cached since their records never change.
+func (a *Aggregator) Aggregate(file *models.CSVFile, by, metric, of string, limit int) (*models.AggregateResponse, error) {
+	cacheKey := fmt.Sprintf("%d|%s|%s|%s|%d", file.ID, by, metric, of, limit)
+
+	a.mu.RLock()
+	cached, ok := a.cache[cacheKey]
+	a.mu.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	buckets, other, err := a.dbService.AggregateByColumn([]int{file.ID}, by, of, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	response := summarizeAggregate(buckets, other, metric)
+	response.FileID = file.ID
+	response.By = by
+	response.Of = of
+	response.Limit = limit
+
+	if file.Status == "completed" {
+		a.mu.Lock()
+		a.cache[cacheKey] = response
+		a.mu.Unlock()
+	}
+
+	return response, nil
+}
+
+// AggregateDataset builds a group-by breakdown across the files of a dataset. It is
+// not cached, as files can leave the dataset at any time.
+func (a *Aggregator) AggregateDataset(dataset *models.Dataset, by, metric, of string, limit int) (*models.AggregateResponse, error) {
+	buckets, other, err := a.dbService.AggregateByColumn(dataset.FileIDs, by, of, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	response := summarizeAggregate(buckets, other, metric)
+	response.DatasetID = dataset.ID
+	response.By = by
+	response.Of = of
+	response.Limit = limit
+	return response, nil
+}
+
+// summarizeAggregate totals the buckets of an aggregate and fills in the metric
+func summarizeAggregate(buckets []*models.AggregateBucket, other *models.AggregateBucket, metric string) *models.AggregateResponse {
+	response := &models.AggregateResponse{
+		Metric:  metric,
+		Buckets: buckets,
+		Other:   other,
+	}
+
+	all := buckets
+	if other != nil {
+		all = append(append([]*models.AggregateBucket{}, buckets...), other)
+	}
+	for _, bucket := range all {
+		response.TotalCount += bucket.Count
+		if metric == "" {
+			bucket.NumericCount = 0
+			bucket.Sum = nil
+			continue
+		}
+		response.ExcludedCount += bucket.Count - bucket.NumericCount
+		if metric == "avg" {
+			if bucket.Sum != nil && bucket.NumericCount > 0 {
+				avg := *bucket.Sum / float64(bucket.NumericCount)
+				bucket.Avg = &avg
+			}
+			bucket.Sum = nil
+		}
+	}
+	return response
+}
+
+// Invalidate drops all cached aggregates for a file
+func (a *Aggregator) Invalidate(fileID int) {
+	prefix := fmt.Sprintf("%d|", fileID)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key := range a.cache {
+		if strings.HasPrefix(key, prefix) {
+			delete(a.cache, key)
+		}
+	}
+}
@@ -1,56 +1,352 @@
 package services
 
 import (
+	"context"
+	"csv-processor/config"
+	"csv-processor/models"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type AsyncProcessor struct {
-	csvProcessor *CSVProcessor
-	dbService    *DBService
+	csvProcessor      *CSVProcessor
+	dbService         *DBService
+	events            *EventBus
+	groups            *GroupCache
+	piiDetector       *PIIDetector
+	maxRecordsPerFile int
+	maxTotalRecords   int
+	processingTimeout time.Duration // per file; 0 disables the limit
+	retry             *retryPolicy
+
+	// wg tracks processing goroutines so shutdown can wait for them; running
+	// counts them for metrics
+	wg      sync.WaitGroup
+	running int64
 }
 
-func NewAsyncProcessor(dbService *DBService) *AsyncProcessor {
+func NewAsyncProcessor(dbService *DBService, csvProcessor *CSVProcessor, events *EventBus, groups *GroupCache) *AsyncProcessor {
 	return &AsyncProcessor{
-		csvProcessor: NewCSVProcessor(),
-		dbService:    dbService,
+		csvProcessor:      csvProcessor,
+		dbService:         dbService,
+		events:            events,
+		groups:            groups,
+		piiDetector:       NewPIIDetector(),
+		maxRecordsPerFile: config.GetEnvInt("MAX_RECORDS_PER_FILE", 500000),
+		maxTotalRecords:   config.GetEnvInt("MAX_TOTAL_RECORDS", 10000000),
+		processingTimeout: time.Duration(config.GetEnvInt("MAX_PROCESSING_TIMEOUT_SECONDS", 600)) * time.Second,
+		retry: &retryPolicy{
+			attempts:  config.GetEnvInt("DB_RETRY_ATTEMPTS", 5),
+			baseDelay: time.Duration(config.GetEnvInt("DB_RETRY_BASE_DELAY_MS", 500)) * time.Millisecond,
+			maxDelay:  time.Duration(config.GetEnvInt("DB_RETRY_MAX_DELAY_MS", 10000)) * time.Millisecond,
+		},
+	}
+}
+
+// ProcessCSVAsync processes CSV file in the background. Processing stops when ctx is
+// cancelled (e.g. on shutdown) or the per-file timeout passes.
+func (p *AsyncProcessor) ProcessCSVAsync(ctx context.Context, fileID int, file io.Reader, cfg *models.ProcessorConfig) {
+	p.start(func() {
+		p.processFile(ctx, fileID, file, cfg)
+	})
+}
+
+// ProcessCSVSync processes a CSV file within the given deadline. It reports whether
+// processing finished in time; if not, processing carries on in the background.
+func (p *AsyncProcessor) ProcessCSVSync(ctx context.Context, fileID int, file io.Reader, cfg *models.ProcessorConfig, timeout time.Duration) (bool, error) {
+	done := make(chan error, 1)
+	p.start(func() {
+		done <- p.processFile(ctx, fileID, file, cfg)
+	})
+
+	select {
+	case err := <-done:
+		return true, err
+	case <-time.After(timeout):
+		return false, nil
 	}
 }
 
-// ProcessCSVAsync processes CSV file in the background
-func (p *AsyncProcessor) ProcessCSVAsync(fileID int, file io.Reader) {
+// start runs fn in a goroutine that Wait accounts for
+func (p *AsyncProcessor) start(fn func()) {
+	p.wg.Add(1)
+	atomic.AddInt64(&p.running, 1)
 	go func() {
-		startTime := time.Now()
-
-		// Process CSV
-		records, processingTime, err := p.csvProcessor.ProcessCSV(file)
-		if err != nil {
-			log.Printf("Error processing CSV file %d: %v", fileID, err)
-			p.dbService.UpdateCSVFileStatus(fileID, "failed", 0, 0, err.Error())
-			return
+		defer p.wg.Done()
+		defer atomic.AddInt64(&p.running, -1)
+		fn()
+	}()
+}
+
+// Wait blocks until every processing goroutine has finished. Cancelling the context
+// processing was started with makes them finish early.
+func (p *AsyncProcessor) Wait() {
+	p.wg.Wait()
+}
+
+// Running reports how many processing goroutines are alive
+func (p *AsyncProcessor) Running() int64 {
+	return atomic.LoadInt64(&p.running)
+}
+
+// processFile runs the full processing pipeline for a file and records the outcome
+// on its status. Both the sync and async paths go through here.
+func (p *AsyncProcessor) processFile(ctx context.Context, fileID int, file io.Reader, cfg *models.ProcessorConfig) error {
+	startTime := time.Now()
+
+	if p.processingTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.processingTimeout)
+		defer cancel()
+	}
+
+	// Status updates only apply if nobody else changed the file since we started
+	csvFile, err := p.dbService.GetCSVFile(fileID)
+	if err != nil {
+		log.Printf("Error loading CSV file %d: %v", fileID, err)
+		return err
+	}
+	version := csvFile.Version
+	p.events.publishStatus(fileID, csvFile.Status)
+	p.recordEvent(ctx, fileID, models.FileEventParsingStarted, map[string]interface{}{"generation": csvFile.Generation + 1})
+
+	// Process CSV
+	records, timings, err := p.csvProcessor.ProcessCSV(ctx, file, cfg)
+	if err != nil {
+		log.Printf("Error processing CSV file %d: %v", fileID, err)
+		p.updateStatus(ctx, fileID, version, "failed", 0, 0, err.Error())
+		return err
+	}
+
+	if timings.RowsFiltered > 0 {
+		log.Printf("Row filter skipped %d rows of file %d", timings.RowsFiltered, fileID)
+	}
+	p.recordEvent(ctx, fileID, models.FileEventRowsParsed, map[string]interface{}{
+		"rows":         len(records) + timings.RowsFiltered,
+		"rowsFiltered": timings.RowsFiltered,
+		"parseMs":      timings.Parse.DurationMs,
+		"transformMs":  timings.Transform.DurationMs,
+	})
+
+	// Enforce record quotas before touching the records table
+	if err := p.checkRecordLimits(ctx, fileID, len(records)); err != nil {
+		log.Printf("Rejecting CSV file %d: %v", fileID, err)
+		p.updateStatus(ctx, fileID, version, "failed", 0, 0, err.Error())
+		return err
+	}
+
+	// Values breaking the upload's column rules are recorded; in strict mode too
+	// many of them fail the file
+	violationCount, violationSummary := summarizeViolations(records)
+	if warned := countWarnedRecords(records); warned > 0 || violationCount > 0 {
+		p.recordEvent(ctx, fileID, models.FileEventWarnings, map[string]interface{}{
+			"rowsWithWarnings": warned,
+			"violations":       violationCount,
+		})
+	}
+	if cfg != nil && cfg.Strict && violationCount > cfg.MaxViolations {
+		err := fmt.Errorf("validation failed: %d violations (max %d)", violationCount, cfg.MaxViolations)
+		log.Printf("Rejecting CSV file %d: %v", fileID, err)
+		p.storeViolations(ctx, fileID, records, violationCount, violationSummary)
+		p.updateStatus(ctx, fileID, version, "failed", 0, 0, err.Error())
+		return err
+	}
+
+	// Add file ID to all records
+	for _, record := range records {
+		record.CSVFileID = fileID
+	}
+
+	// Respect groups that were manually merged or renamed before a regroup
+	overrides, err := p.dbService.GetGroupOverrides(ctx, fileID)
+	if err != nil {
+		log.Printf("Error loading group overrides for file %d: %v", fileID, err)
+	} else {
+		applyGroupOverrides(records, overrides)
+	}
+
+	// Store the records as a new generation; readers keep seeing the current one
+	// until it is complete
+	insertStart := time.Now()
+	var inserted int
+	err = p.withRetry(ctx, fileID, "storing records", func() error {
+		var err error
+		inserted, err = p.dbService.ReplaceRecords(ctx, fileID, csvFile.Generation+1, records)
+		return err
+	})
+	timings.Insert = newStageTiming(time.Since(insertStart), len(records))
+	if err != nil {
+		log.Printf("Error inserting records for file %d: %v", fileID, err)
+		p.updateStatus(ctx, fileID, version, "failed", 0, 0, err.Error())
+		return err
+	}
+	if skipped := len(records) - inserted; skipped > 0 {
+		log.Printf("Skipped %d records of file %d repeating a natural key", skipped, fileID)
+	}
+	p.recordEvent(ctx, fileID, models.FileEventRecordsCommitted, map[string]interface{}{
+		"generation": csvFile.Generation + 1,
+		"inserted":   inserted,
+		"skipped":    len(records) - inserted,
+		"insertMs":   timings.Insert.DurationMs,
+	})
+
+	p.storeViolations(ctx, fileID, records, violationCount, violationSummary)
+
+	// Let consumers know the cleaned data is redacted
+	if maskingEnabled(cfg) {
+		if err := p.dbService.UpdateCSVFileMasking(ctx, fileID, summarizeMasking(records)); err != nil {
+			log.Printf("Error storing masking summary for file %d: %v", fileID, err)
 		}
+	}
+
+	// Flag the columns holding personal data, judged from their raw values
+	if err := p.dbService.UpdateCSVFilePIIColumns(ctx, fileID, detectPIIColumns(p.piiDetector, records)); err != nil {
+		log.Printf("Error storing PII columns for file %d: %v", fileID, err)
+	}
 
-		// Add file ID to all records
-		for _, record := range records {
-			record.CSVFileID = fileID
+	// Record what the cleaner and normalizer changed
+	report := buildNormalizationReport(records, p.csvProcessor.grouper.normalizer)
+	if err := p.dbService.UpdateCSVFileNormalizationReport(ctx, fileID, report); err != nil {
+		log.Printf("Error storing normalization report for file %d: %v", fileID, err)
+	}
+
+	// Record how complete the data is
+	completeness, columnStats := computeColumnStats(records)
+	if err := p.dbService.UpdateCSVFileStats(ctx, fileID, completeness, columnStats); err != nil {
+		log.Printf("Error storing column stats for file %d: %v", fileID, err)
+	}
+
+	// Record where the time went
+	totalTime := time.Since(startTime).Milliseconds()
+	timings.TotalMs = totalTime
+	if err := p.dbService.UpdateCSVFileTimings(ctx, fileID, timings); err != nil {
+		log.Printf("Error storing timings for file %d: %v", fileID, err)
+	}
+
+	// Update file status
+	if err := p.updateStatus(ctx, fileID, version, "completed", inserted, totalTime, ""); err != nil {
+		return err
+	}
+
+	// The first page of records shows the groups, so have them ready
+	if err := p.groups.Warm(fileID); err != nil {
+		log.Printf("Error warming group cache for file %d: %v", fileID, err)
+	}
+
+	log.Printf("Successfully processed file %d: %d records in %dms (parse %dms, transform %dms, insert %dms)",
+		fileID, inserted, totalTime, timings.Parse.DurationMs, timings.Transform.DurationMs, timings.Insert.DurationMs)
+	return nil
+}
+
+// updateStatus records the outcome of processing and announces it to live
+// subscribers, logging when the file was changed by someone else in the meantime.
+// The update still goes through when ctx was cancelled, so a stopped file is
+// marked failed rather than left processing; its timeline says it was cancelled.
+func (p *AsyncProcessor) updateStatus(ctx context.Context, fileID, version int, status string, recordCount int, processingTimeMs int64, errorMsg string) error {
+	outcome, detail := models.FileEventCompleted, map[string]interface{}{"records": recordCount, "durationMs": processingTimeMs}
+	if status != "completed" {
+		outcome, detail = models.FileEventFailed, map[string]interface{}{"error": errorMsg}
+		if errors.Is(ctx.Err(), context.Canceled) {
+			outcome = models.FileEventCancelled
 		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+
+	err := p.withRetry(ctx, fileID, "updating status", func() error {
+		return p.dbService.UpdateCSVFileStatus(ctx, fileID, version, status, recordCount, processingTimeMs, errorMsg)
+	})
+	if errors.Is(err, models.ErrVersionConflict) {
+		log.Printf("File %d changed while processing, discarding %s status", fileID, status)
+	} else if err != nil {
+		log.Printf("Error updating file status for %d: %v", fileID, err)
+	} else {
+		p.events.publishStatus(fileID, status)
+		p.recordEvent(ctx, fileID, outcome, detail)
+	}
+	return err
+}
 
-		// Insert records into database
-		err = p.dbService.InsertRecords(records)
-		if err != nil {
-			log.Printf("Error inserting records for file %d: %v", fileID, err)
-			p.dbService.UpdateCSVFileStatus(fileID, "failed", 0, 0, err.Error())
-			return
+// recordEvent adds a processing step to a file's timeline, even once ctx was cancelled
+func (p *AsyncProcessor) recordEvent(ctx context.Context, fileID int, eventType string, detail map[string]interface{}) {
+	p.dbService.RecordEvent(context.WithoutCancel(ctx), &models.FileEvent{CSVFileID: fileID, EventType: eventType, Detail: detail})
+}
+
+// countWarnedRecords returns how many records got cleaning warnings
+func countWarnedRecords(records []*models.Record) int {
+	warned := 0
+	for _, record := range records {
+		if len(record.Warnings) > 0 {
+			warned++
 		}
+	}
+	return warned
+}
+
+// withRetry runs a database write for a file, retrying transient errors. Retries are
+// logged and recorded on the file once the write went through or was given up on.
+func (p *AsyncProcessor) withRetry(ctx context.Context, fileID int, what string, fn func() error) error {
+	retries := 0
+	var lastErr error
+	err := p.retry.do(ctx, fn, func(err error, delay time.Duration) {
+		retries++
+		lastErr = err
+		log.Printf("Transient error %s for file %d, retrying in %v: %v", what, fileID, delay, err)
+	})
 
-		// Update file status
-		totalTime := time.Since(startTime).Milliseconds()
-		err = p.dbService.UpdateCSVFileStatus(fileID, "completed", len(records), totalTime, "")
-		if err != nil {
-			log.Printf("Error updating file status for %d: %v", fileID, err)
+	if retries > 0 {
+		if err := p.dbService.RecordProcessingRetries(ctx, fileID, retries, lastErr.Error()); err != nil {
+			log.Printf("Error recording retries for file %d: %v", fileID, err)
 		}
+	}
+	return err
+}
 
-		log.Printf("Successfully processed file %d: %d records in %dms", fileID, len(records), processingTime)
-	}()
+// RetryStats reports how often processing had to retry database writes
+func (p *AsyncProcessor) RetryStats() *models.RetryStats {
+	return p.retry.stats()
+}
+
+// storeViolations saves the violations of a file's records and their summary
+func (p *AsyncProcessor) storeViolations(ctx context.Context, fileID int, records []*models.Record, count int, summary map[string]int) {
+	if count == 0 {
+		return
+	}
+
+	violations := make([]*models.Violation, 0, count)
+	for _, record := range records {
+		violations = append(violations, record.Violations...)
+	}
+	if err := p.dbService.InsertViolations(ctx, fileID, violations); err != nil {
+		log.Printf("Error storing violations for file %d: %v", fileID, err)
+		return
+	}
+	if err := p.dbService.UpdateCSVFileViolations(ctx, fileID, count, summary); err != nil {
+		log.Printf("Error storing violation summary for file %d: %v", fileID, err)
+	}
+}
+
+// checkRecordLimits verifies a file with recordCount records fits within the configured
+// quotas. The records the file already has don't count, as processing replaces them.
+func (p *AsyncProcessor) checkRecordLimits(ctx context.Context, fileID, recordCount int) error {
+	if recordCount > p.maxRecordsPerFile {
+		return fmt.Errorf("file exceeds record limit: %d records (max %d per file)", recordCount, p.maxRecordsPerFile)
+	}
+
+	totalRecords, err := p.dbService.CountActiveRecords(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	if totalRecords+recordCount > p.maxTotalRecords {
+		return fmt.Errorf("file exceeds record limit: storing %d records would exceed the total quota of %d (%d already stored)",
+			recordCount, p.maxTotalRecords, totalRecords)
+	}
+
+	return nil
 }
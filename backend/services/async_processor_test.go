@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// endlessCSV is a CSV file that never ends, so processing it lasts until cancelled
+type endlessCSV struct {
+	header bool
+}
+
+func (r *endlessCSV) Read(p []byte) (int, error) {
+	if !r.header {
+		r.header = true
+		return copy(p, "name,title\n"), nil
+	}
+	return copy(p, "Ada Lovelace,Software Engineer\n"), nil
+}
+
+func TestAsyncProcessorWait(t *testing.T) {
+	p := &AsyncProcessor{csvProcessor: NewCSVProcessor(NewCategoryGrouper(nil))}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	result := make(chan error, 1)
+	p.start(func() {
+		_, _, err := p.csvProcessor.ProcessCSV(ctx, &endlessCSV{}, nil)
+		result <- err
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	if got := p.Running(); got != 1 {
+		t.Fatalf("Running() = %d while the file is processing, want 1", got)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Wait() returned while the file was still processing")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Shutdown cancels the processing context, after which Wait returns
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait() did not return within 5s of cancelling processing")
+	}
+
+	if err := <-result; err != context.Canceled {
+		t.Errorf("processing error = %v, want %v", err, context.Canceled)
+	}
+	if got := p.Running(); got != 0 {
+		t.Errorf("Running() = %d after Wait, want 0", got)
+	}
+}
+
+func TestAsyncProcessorWaitIdle(t *testing.T) {
+	p := &AsyncProcessor{}
+	done := make(chan struct{})
+	go func() {
+		p.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait() blocked with nothing processing")
+	}
+}
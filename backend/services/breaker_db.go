@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"csv-processor/database"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"syscall"
+
+	"github.com/lib/pq"
+)
+
+// breakerDB runs every statement DBService starts through a circuit breaker.
+// Statements inside a transaction are covered by the breaker guarding its Begin.
+type breakerDB struct {
+	*sql.DB
+	breaker *database.CircuitBreaker
+}
+
+// breakerRow is a *sql.Row that may not have run because the circuit was open
+type breakerRow struct {
+	row *sql.Row
+	err error
+}
+
+// Scan copies the row's columns into dest, as sql.Row.Scan
+func (r *breakerRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.row.Scan(dest...)
+}
+
+// Err returns the error that kept the query from running, if any
+func (r *breakerRow) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.row.Err()
+}
+
+// isDatabaseUnavailable reports whether err shows the database failing to serve
+// requests at all: lost connections, exhausted resources or an operator shutdown.
+// These are the errors that trip the circuit breaker.
+func isDatabaseUnavailable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", "53", "57": // connection exception, insufficient resources, operator intervention
+			return true
+		}
+		return false
+	}
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// record reports a call's outcome. Calls given up by their caller prove nothing
+// about the database, so they count as answered.
+func (d *breakerDB) record(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		err = nil
+	}
+	d.breaker.Record(err)
+}
+
+func (d *breakerDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return d.ExecContext(context.Background(), query, args...)
+}
+
+func (d *breakerDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if err := d.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	result, err := d.DB.ExecContext(ctx, query, args...)
+	d.record(ctx, err)
+	return result, err
+}
+
+func (d *breakerDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return d.QueryContext(context.Background(), query, args...)
+}
+
+func (d *breakerDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if err := d.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	rows, err := d.DB.QueryContext(ctx, query, args...)
+	d.record(ctx, err)
+	return rows, err
+}
+
+func (d *breakerDB) QueryRow(query string, args ...interface{}) *breakerRow {
+	return d.QueryRowContext(context.Background(), query, args...)
+}
+
+func (d *breakerDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *breakerRow {
+	if err := d.breaker.Allow(); err != nil {
+		return &breakerRow{err: err}
+	}
+	row := d.DB.QueryRowContext(ctx, query, args...)
+	d.record(ctx, row.Err())
+	return &breakerRow{row: row}
+}
+
+func (d *breakerDB) Begin() (*sql.Tx, error) {
+	return d.BeginTx(context.Background(), nil)
+}
+
+func (d *breakerDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if err := d.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	tx, err := d.DB.BeginTx(ctx, opts)
+	d.record(ctx, err)
+	return tx, err
+}
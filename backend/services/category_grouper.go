@@ -1,11 +1,43 @@
 package services
 
 import (
+	"context"
+	"csv-processor/models"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
+// CategoryGrouper maps category values onto unified groups. Its rules live in an
+// immutable ruleSet that is swapped as a whole on reload, so a lookup never sees a
+// half-built generation.
 type CategoryGrouper struct {
-	rules       map[string]string   // specific term -> group
+	current    *ruleSet
+	mu         sync.RWMutex
+	normalizer *TermNormalizer   // optional fallback for unknown terms
+	rulesFile  string            // optional JSON rules file read on reload
+	suggester  CategorySuggester // optional last resort for terms no rule matches
+	cleaner    *DataCleaner      // title cases the values GetGroupOrSelf falls back to
+
+	cacheMu          sync.RWMutex
+	levenshteinCache map[string]int // "term1|term2" (sorted) -> edit distance
+}
+
+// maxCachedDistances bounds the Levenshtein cache; it is cleared when full
+const maxCachedDistances = 100000
+
+// ruleSet is one generation of grouping rules. It is never modified once built.
+type ruleSet struct {
+	generation int
+	categories map[string][]string // category -> keywords from definitions and the rules file
+	extraRules map[string]string   // keyword -> group added at runtime
+	rules      map[string]string   // specific term -> group
+	ngramIndex map[string][]string // trigram -> keywords whose rarest trigram it is
+	shortRules []string            // keywords too short to have trigrams
+	regexRules []*RegexRule        // pattern rules, kept in evaluation order
+	addedRegex []*RegexRule        // pattern rules added at runtime, kept on reload
+	distance   func(s1, s2 string) int
 }
 
 // categoryDefinitions - Simple map of category -> keywords
@@ -139,24 +171,187 @@ var categoryDefinitions = map[string][]string{
 	},
 }
 
-func NewCategoryGrouper() *CategoryGrouper {
-	grouper := &CategoryGrouper{
+// NewCategoryGrouper creates a grouper. When normalizer is not nil, the keywords are
+// registered as canonical terms and terms that match no rule are retried with their
+// normalized form.
+func NewCategoryGrouper(normalizer *TermNormalizer) *CategoryGrouper {
+	grouper := &CategoryGrouper{normalizer: normalizer, cleaner: NewDataCleaner(), levenshteinCache: make(map[string]int)}
+	grouper.current = grouper.buildRuleSet(1, copyCategories(categoryDefinitions), nil, nil)
+	return grouper
+}
+
+// copyCategories returns a deep copy of a category -> keywords map
+func copyCategories(categories map[string][]string) map[string][]string {
+	result := make(map[string][]string, len(categories))
+	for category, keywords := range categories {
+		result[category] = append([]string{}, keywords...)
+	}
+	return result
+}
+
+// buildRuleSet builds the lookup structures for a generation of rules
+func (g *CategoryGrouper) buildRuleSet(generation int, categories map[string][]string, extraRules map[string]string, regexRules []*RegexRule) *ruleSet {
+	rs := &ruleSet{
+		generation: generation,
+		categories: categories,
+		extraRules: make(map[string]string),
 		rules:      make(map[string]string),
+		ngramIndex: make(map[string][]string),
+		regexRules: append([]*RegexRule{}, regexRules...),
+		distance:   g.cachedLevenshteinDistance,
 	}
-	grouper.initializeRules()
-	return grouper
+
+	// Sorted so keywords shared by several categories resolve the same way every build
+	names := make([]string, 0, len(categories))
+	for category := range categories {
+		names = append(names, category)
+	}
+	sort.Strings(names)
+	for _, category := range names {
+		for _, keyword := range categories[category] {
+			rs.addRule(strings.ToLower(keyword), category)
+		}
+	}
+	for keyword, group := range extraRules {
+		rs.extraRules[keyword] = group
+		rs.addRule(keyword, group)
+	}
+	rs.indexKeywords()
+	sortRegexRules(rs.regexRules)
+
+	if g.normalizer != nil {
+		for keyword := range rs.rules {
+			g.normalizer.AddCanonicalTerm(keyword)
+		}
+	}
+	return rs
 }
 
-// initializeRules builds the rules map from categoryDefinitions
-func (g *CategoryGrouper) initializeRules() {
-	for category, keywords := range categoryDefinitions {
-		for _, keyword := range keywords {
-			g.rules[strings.ToLower(keyword)] = category
+// addRule stores a keyword rule
+func (rs *ruleSet) addRule(keyword, group string) {
+	rs.rules[keyword] = group
+}
+
+// indexKeywords files each keyword under its rarest trigram. A keyword only appears
+// in text containing all of its trigrams, so the text's trigrams still find it, and
+// common trigrams like "eng" don't bring in thousands of keywords to check.
+func (rs *ruleSet) indexKeywords() {
+	keywordGrams := make(map[string]map[string]struct{}, len(rs.rules))
+	frequency := make(map[string]int)
+	for keyword := range rs.rules {
+		grams := trigrams(keyword)
+		keywordGrams[keyword] = grams
+		for gram := range grams {
+			frequency[gram]++
+		}
+	}
+
+	for keyword, grams := range keywordGrams {
+		if len(grams) == 0 {
+			rs.shortRules = append(rs.shortRules, keyword)
+			continue
 		}
+		rarest := ""
+		for gram := range grams {
+			if rarest == "" || frequency[gram] < frequency[rarest] || (frequency[gram] == frequency[rarest] && gram < rarest) {
+				rarest = gram
+			}
+		}
+		rs.ngramIndex[rarest] = append(rs.ngramIndex[rarest], keyword)
+	}
+}
+
+// snapshot returns the current generation of rules. Callers processing a whole file
+// hold on to it so the file is grouped consistently even if the rules are reloaded.
+func (g *CategoryGrouper) snapshot() *ruleSet {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.current
+}
+
+// swap installs a new generation built from the current one by build
+func (g *CategoryGrouper) swap(build func(current *ruleSet) *ruleSet) (previous, next *ruleSet) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	previous = g.current
+	g.current = build(previous)
+	return previous, g.current
+}
+
+// trigrams returns the set of distinct 3-character substrings of s
+func trigrams(s string) map[string]struct{} {
+	grams := make(map[string]struct{})
+	for i := 0; i+3 <= len(s); i++ {
+		grams[s[i:i+3]] = struct{}{}
+	}
+	return grams
+}
+
+// partialMatchCandidates returns the keywords that could appear inside text, i.e.
+// those whose rarest trigram is present in text. Callers still check the keyword
+// occurs. Longer keywords come first so the most specific rule wins.
+func (rs *ruleSet) partialMatchCandidates(text string) []string {
+	candidates := append([]string{}, rs.shortRules...)
+	// Each keyword is filed under a single trigram, so none is returned twice
+	for gram := range trigrams(text) {
+		candidates = append(candidates, rs.ngramIndex[gram]...)
 	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if len(candidates[i]) != len(candidates[j]) {
+			return len(candidates[i]) > len(candidates[j])
+		}
+		return candidates[i] < candidates[j]
+	})
+	return candidates
 }
 
-// levenshteinDistance calculates the minimum edits needed between two strings
+// cachedLevenshteinDistance returns the edit distance between two terms, reusing
+// earlier results since large files repeat the same values many times
+func (g *CategoryGrouper) cachedLevenshteinDistance(s1, s2 string) int {
+	key := s1 + "|" + s2
+	if s2 < s1 {
+		key = s2 + "|" + s1
+	}
+
+	g.cacheMu.RLock()
+	distance, ok := g.levenshteinCache[key]
+	g.cacheMu.RUnlock()
+	if ok {
+		return distance
+	}
+
+	distance = levenshteinDistance(s1, s2)
+	g.cacheMu.Lock()
+	if len(g.levenshteinCache) >= maxCachedDistances {
+		g.levenshteinCache = make(map[string]int)
+	}
+	g.levenshteinCache[key] = distance
+	g.cacheMu.Unlock()
+	return distance
+}
+
+// ClearCache forgets all cached edit distances
+func (g *CategoryGrouper) ClearCache() {
+	g.cacheMu.Lock()
+	g.levenshteinCache = make(map[string]int)
+	g.cacheMu.Unlock()
+}
+
+// dpStackRows is how many ints of the two rows used by levenshteinDistance and
+// longestCommonSubsequence live on the stack; longer strings allocate them
+const dpStackRows = 128
+
+// dpRows returns two zeroed rows of n ints, backed by buf when it is large enough
+func dpRows(buf []int, n int) (prev, curr []int) {
+	if 2*n > len(buf) {
+		buf = make([]int, 2*n)
+	}
+	return buf[:n], buf[n : 2*n]
+}
+
+// levenshteinDistance calculates the minimum edits needed between two strings. Only
+// two rows of the edit matrix are kept, swapped after each row.
 func levenshteinDistance(s1, s2 string) int {
 	if len(s1) == 0 {
 		return len(s2)
@@ -165,33 +360,30 @@ func levenshteinDistance(s1, s2 string) int {
 		return len(s1)
 	}
 
-	// Create matrix
-	matrix := make([][]int, len(s1)+1)
-	for i := range matrix {
-		matrix[i] = make([]int, len(s2)+1)
-		matrix[i][0] = i
-	}
-	for j := range matrix[0] {
-		matrix[0][j] = j
+	var buf [dpStackRows]int
+	prev, curr := dpRows(buf[:], len(s2)+1)
+	for j := range prev {
+		prev[j] = j
 	}
 
-	// Fill matrix
 	for i := 1; i <= len(s1); i++ {
+		curr[0] = i
 		for j := 1; j <= len(s2); j++ {
 			cost := 0
 			if s1[i-1] != s2[j-1] {
 				cost = 1
 			}
 
-			matrix[i][j] = min(
-				matrix[i-1][j]+1,      // deletion
-				matrix[i][j-1]+1,      // insertion
-				matrix[i-1][j-1]+cost, // substitution
+			curr[j] = min(
+				prev[j]+1,      // deletion
+				curr[j-1]+1,    // insertion
+				prev[j-1]+cost, // substitution
 			)
 		}
+		prev, curr = curr, prev
 	}
 
-	return matrix[len(s1)][len(s2)]
+	return prev[len(s2)]
 }
 
 func min(a, b, c int) int {
@@ -207,49 +399,167 @@ func min(a, b, c int) int {
 	return c
 }
 
-// GetGroup returns the unified group for a given category with intelligent matching
+// GetGroup returns the unified group for a given category with intelligent matching.
+// Unknown terms fall back to their canonical form from the TermNormalizer, so a typo
+// of a known term lands in the same group. Nothing is learned from the lookup, so
+// unmatched values don't pile up in the normalizer.
 func (g *CategoryGrouper) GetGroup(category string) string {
+	return g.groupWith(context.Background(), g.snapshot(), category)
+}
+
+// GetGroupOrSelf returns GetGroup(category), or the category itself with its spacing
+// cleaned up and title-cased like cleaned values, casing exceptions included, when
+// no group matches
+func (g *CategoryGrouper) GetGroupOrSelf(category string) string {
+	if group := g.GetGroup(category); group != "" {
+		return group
+	}
+
+	g.mu.RLock()
+	cleaner := g.cleaner
+	g.mu.RUnlock()
+	return cleaner.toTitleCase(category)
+}
+
+// GetAllGroups returns every group a term matches, starting with the one GetGroup
+// picks. A term naming several keywords, like "senior software engineer turned
+// manager", belongs to the group of each.
+func (g *CategoryGrouper) GetAllGroups(term string) []string {
+	return g.groupsWith(context.Background(), g.snapshot(), term)
+}
+
+// groupsWith is GetAllGroups against a specific generation of rules, asking the
+// suggester under ctx
+func (g *CategoryGrouper) groupsWith(ctx context.Context, rs *ruleSet, term string) []string {
+	primary := g.groupWith(ctx, rs, term)
+	if primary == "" {
+		return nil
+	}
+
+	groups := []string{primary}
+	for _, group := range rs.matchAllGroups(strings.ToLower(strings.TrimSpace(term))) {
+		if !containsString(groups, group) {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// groupWith is GetGroup against a specific generation of rules, asking the
+// suggester under ctx
+func (g *CategoryGrouper) groupWith(ctx context.Context, rs *ruleSet, category string) string {
 	cleaned := strings.ToLower(strings.TrimSpace(category))
-	
+
 	// Empty check
 	if cleaned == "" {
 		return ""
 	}
 
-	// 1. Direct match
-	if group, ok := g.rules[cleaned]; ok {
+	if group := rs.matchGroup(cleaned); group != "" {
 		return group
 	}
 
-	// 2. Partial match - check if any keyword is a complete word in the category
-	for key, group := range g.rules {
+	if g.normalizer != nil {
+		if canonical := g.normalizer.ExplainTerm(cleaned).Canonical; canonical != "" && canonical != cleaned {
+			if group := rs.matchGroup(canonical); group != "" {
+				return group
+			}
+		}
+	}
+
+	if suggestion, ok := g.suggestGroup(ctx, cleaned); ok {
+		return suggestion.Category
+	}
+
+	return ""
+}
+
+// SetSuggester installs a suggester asked for the group of terms that no rule
+// matches, even after normalization
+func (g *CategoryGrouper) SetSuggester(suggester CategorySuggester) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.suggester = suggester
+}
+
+// SetCleaner makes GetGroupOrSelf title case with the casing exceptions of cleaner,
+// such as those added at runtime to a CSVProcessor's
+func (g *CategoryGrouper) SetCleaner(cleaner *DataCleaner) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.cleaner = cleaner
+}
+
+// matchGroup runs the rule passes against an already lowercased term
+func (rs *ruleSet) matchGroup(cleaned string) string {
+	return rs.explainMatch(cleaned).Group
+}
+
+// matchAllGroups returns the groups of every keyword found as whole words in an
+// already lowercased term, most specific first, then those of every matching regex
+// rule. Groups may repeat.
+func (rs *ruleSet) matchAllGroups(cleaned string) []string {
+	var groups []string
+	if group, ok := rs.rules[cleaned]; ok {
+		groups = append(groups, group)
+	}
+	for _, key := range rs.partialMatchCandidates(cleaned) {
+		if strings.Contains(" "+cleaned+" ", " "+key+" ") {
+			groups = append(groups, rs.rules[key])
+		}
+	}
+	rs.eachRegexMatch(cleaned, func(rule *RegexRule) bool {
+		groups = append(groups, rule.Category)
+		return true
+	})
+	return groups
+}
+
+// explainMatch runs the rule passes against an already lowercased term and reports
+// which rule decided the group
+func (rs *ruleSet) explainMatch(cleaned string) *models.GroupMatch {
+	// 1. Direct match
+	if group, ok := rs.rules[cleaned]; ok {
+		return &models.GroupMatch{Group: group, MatchType: "exact", Rule: cleaned}
+	}
+
+	// 2. Partial match - check if any keyword is a complete word in the category.
+	// The trigram index narrows the keywords down to those that can possibly match.
+	for _, key := range rs.partialMatchCandidates(cleaned) {
 		if strings.Contains(" "+cleaned+" ", " "+key+" ") {
-			return group
+			return &models.GroupMatch{Group: rs.rules[key], MatchType: "word", Rule: key}
 		}
 	}
 
-	// 3. Limited fuzzy match - only for very close matches (1 character difference, typos only)
+	// 3. Regex rules, in priority order
+	if rule := rs.matchRegexRules(cleaned); rule != nil {
+		return &models.GroupMatch{Group: rule.Category, MatchType: "regex", Rule: rule.Pattern.String()}
+	}
+
+	// 4. Limited fuzzy match - only for very close matches (1 character difference, typos only)
 	bestMatch := ""
+	bestKey := ""
 	bestDistance := 999
 	maxDistance := 1 // Only allow 1 character difference
 
-	for key, group := range g.rules {
+	for key, group := range rs.rules {
 		// Only fuzzy match if lengths are very similar and string is reasonably long
 		if abs(len(cleaned)-len(key)) <= 1 && len(cleaned) >= 5 {
-			distance := levenshteinDistance(cleaned, key)
+			distance := rs.distance(cleaned, key)
 			if distance < bestDistance && distance <= maxDistance {
 				bestDistance = distance
 				bestMatch = group
+				bestKey = key
 			}
 		}
 	}
 
 	if bestMatch != "" {
-		return bestMatch
+		return &models.GroupMatch{Group: bestMatch, MatchType: "fuzzy", Rule: bestKey, Distance: bestDistance}
 	}
 
 	// No match found
-	return ""
+	return &models.GroupMatch{MatchType: "none"}
 }
 
 func abs(x int) int {
@@ -259,17 +569,229 @@ func abs(x int) int {
 	return x
 }
 
+// ExplainGroup reports how GetGroup would group a category
+func (g *CategoryGrouper) ExplainGroup(category string) *models.GroupMatch {
+	rs := g.snapshot()
+	cleaned := strings.ToLower(strings.TrimSpace(category))
+	if cleaned == "" {
+		return &models.GroupMatch{MatchType: "none"}
+	}
+
+	match := rs.explainMatch(cleaned)
+	if match.Group != "" {
+		return match
+	}
+
+	if g.normalizer != nil {
+		normalized := g.normalizer.ExplainTerm(cleaned)
+		if normalized.Canonical != "" && normalized.Canonical != cleaned {
+			if viaCanonical := rs.explainMatch(normalized.Canonical); viaCanonical.Group != "" {
+				viaCanonical.Normalized = normalized.Canonical
+				return viaCanonical
+			}
+		}
+	}
+
+	if suggestion, ok := g.suggestGroup(context.Background(), cleaned); ok {
+		return &models.GroupMatch{Group: suggestion.Category, MatchType: "suggested", Score: suggestion.Score}
+	}
+	return match
+}
+
+// Explain reports why a term is categorized the way it is under the current rules,
+// without teaching the normalizer anything new
+func (g *CategoryGrouper) Explain(term string) *models.CategorizationExplanation {
+	match := g.ExplainGroup(term)
+	explanation := &models.CategorizationExplanation{
+		Term:          term,
+		Category:      match.Group,
+		MatchedRule:   match.Rule,
+		MatchType:     match.MatchType,
+		Normalized:    match.Normalized,
+		FuzzyDistance: match.Distance,
+	}
+
+	switch match.MatchType {
+	case "word":
+		explanation.MatchType = "partial"
+	case "fuzzy":
+		matched := match.Normalized
+		if matched == "" {
+			matched = strings.ToLower(strings.TrimSpace(term))
+		}
+		longest := len(matched)
+		if len(match.Rule) > longest {
+			longest = len(match.Rule)
+		}
+		explanation.FuzzyScore = 1 - float64(match.Distance)/float64(longest)
+	case "suggested":
+		explanation.FuzzyScore = match.Score
+	}
+	return explanation
+}
+
 // AddRule allows dynamic addition of grouping rules
 func (g *CategoryGrouper) AddRule(term string, group string) {
-	g.rules[strings.ToLower(term)] = group
+	g.swap(func(current *ruleSet) *ruleSet {
+		extra := make(map[string]string, len(current.extraRules)+1)
+		for keyword, existing := range current.extraRules {
+			extra[keyword] = existing
+		}
+		extra[strings.ToLower(term)] = group
+		next := g.buildRuleSet(current.generation+1, current.categories, extra, current.regexRules)
+		next.addedRegex = current.addedRegex
+		return next
+	})
 }
 
-// GetAllGroups returns all defined groups with their keywords
-func (g *CategoryGrouper) GetAllGroups() map[string][]string {
-	// Return a copy of categoryDefinitions
-	result := make(map[string][]string)
-	for category, keywords := range categoryDefinitions {
-		result[category] = append([]string{}, keywords...)
+// AddRegexRule adds a compiled pattern rule, keeping rules in evaluation order
+func (g *CategoryGrouper) AddRegexRule(rule *RegexRule) {
+	g.swap(func(current *ruleSet) *ruleSet {
+		regexRules := append(append([]*RegexRule{}, current.regexRules...), rule)
+		next := g.buildRuleSet(current.generation+1, current.categories, current.extraRules, regexRules)
+		next.addedRegex = append(append([]*RegexRule{}, current.addedRegex...), rule)
+		return next
+	})
+}
+
+// RegexRules returns the pattern rules in evaluation order
+func (g *CategoryGrouper) RegexRules() []*RegexRule {
+	return append([]*RegexRule{}, g.snapshot().regexRules...)
+}
+
+// matchRegexRules returns the first pattern rule matching text
+func (rs *ruleSet) matchRegexRules(text string) *RegexRule {
+	var first *RegexRule
+	rs.eachRegexMatch(text, func(rule *RegexRule) bool {
+		first = rule
+		return false
+	})
+	return first
+}
+
+// eachRegexMatch calls fn with the pattern rules matching text in evaluation order,
+// until fn returns false. Long values are truncated and evaluation stops once the
+// per-value time budget is spent.
+func (rs *ruleSet) eachRegexMatch(text string, fn func(rule *RegexRule) bool) {
+	if len(rs.regexRules) == 0 {
+		return
 	}
-	return result
+	if len(text) > maxRegexInputLength {
+		text = text[:maxRegexInputLength]
+	}
+
+	deadline := time.Now().Add(regexMatchBudget)
+	for _, rule := range rs.regexRules {
+		if rule.Pattern.MatchString(text) && !fn(rule) {
+			return
+		}
+		if time.Now().After(deadline) {
+			return
+		}
+	}
+}
+
+// ResetNormalizer wipes the terms learned by the normalizer and registers the
+// current keywords again. It returns how many entries were discarded.
+func (g *CategoryGrouper) ResetNormalizer() int {
+	if g.normalizer == nil {
+		return 0
+	}
+
+	discarded := g.normalizer.Reset()
+	for keyword := range g.snapshot().rules {
+		g.normalizer.AddCanonicalTerm(keyword)
+	}
+	return discarded
+}
+
+// GroupDefinitions returns all defined groups with their keywords
+func (g *CategoryGrouper) GroupDefinitions() map[string][]string {
+	return copyCategories(g.snapshot().categories)
+}
+
+// LoadRules reads keyword categories and regex rules from a JSON rules file and makes
+// it the source that Reload reads from
+func (g *CategoryGrouper) LoadRules(path string) (*models.RulesReloadReport, error) {
+	g.mu.Lock()
+	g.rulesFile = path
+	g.mu.Unlock()
+	return g.Reload()
+}
+
+// Reload rebuilds the rules from the built-in definitions and the rules file, then
+// swaps them in. Rules added at runtime are kept on top of them. Lookups in progress
+// keep using the generation they started with.
+func (g *CategoryGrouper) Reload() (*models.RulesReloadReport, error) {
+	g.mu.RLock()
+	path := g.rulesFile
+	g.mu.RUnlock()
+
+	categories := copyCategories(categoryDefinitions)
+	var regexRules []*RegexRule
+	if path != "" {
+		file, err := loadRulesFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for category, keywords := range file.Categories {
+			categories[strings.ToLower(strings.TrimSpace(category))] = keywords
+		}
+		regexRules = file.RegexRules
+	}
+
+	previous, next := g.swap(func(current *ruleSet) *ruleSet {
+		next := g.buildRuleSet(current.generation+1, categories, current.extraRules, append(regexRules, current.addedRegex...))
+		next.addedRegex = current.addedRegex
+		return next
+	})
+	return diffRuleSets(previous, next), nil
+}
+
+// diffRuleSets summarizes what changed between two generations of rules
+func diffRuleSets(previous, next *ruleSet) *models.RulesReloadReport {
+	report := &models.RulesReloadReport{
+		Generation:         next.generation,
+		PreviousGeneration: previous.generation,
+		Categories:         len(next.categories),
+		Keywords:           len(next.rules),
+		RegexRules:         len(next.regexRules),
+		RuntimeRules:       len(next.extraRules) + len(next.addedRegex),
+		AddedCategories:    make([]string, 0),
+		RemovedCategories:  make([]string, 0),
+		AddedKeywords:      make([]string, 0),
+		RemovedKeywords:    make([]string, 0),
+		ChangedKeywords:    make([]string, 0),
+	}
+
+	for category := range next.categories {
+		if _, ok := previous.categories[category]; !ok {
+			report.AddedCategories = append(report.AddedCategories, category)
+		}
+	}
+	for category := range previous.categories {
+		if _, ok := next.categories[category]; !ok {
+			report.RemovedCategories = append(report.RemovedCategories, category)
+		}
+	}
+	for keyword, group := range next.rules {
+		old, ok := previous.rules[keyword]
+		if !ok {
+			report.AddedKeywords = append(report.AddedKeywords, keyword)
+		} else if old != group {
+			report.ChangedKeywords = append(report.ChangedKeywords, keyword)
+		}
+	}
+	for keyword := range previous.rules {
+		if _, ok := next.rules[keyword]; !ok {
+			report.RemovedKeywords = append(report.RemovedKeywords, keyword)
+		}
+	}
+
+	sort.Strings(report.AddedCategories)
+	sort.Strings(report.RemovedCategories)
+	sort.Strings(report.AddedKeywords)
+	sort.Strings(report.RemovedKeywords)
+	sort.Strings(report.ChangedKeywords)
+	return report
 }
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+// benchmarkPairs pairs each term with the next one
+func benchmarkPairs(terms []string) [][2]string {
+	pairs := make([][2]string, len(terms))
+	for i := range terms {
+		pairs[i] = [2]string{terms[i], terms[(i+1)%len(terms)]}
+	}
+	return pairs
+}
+
+func benchmarkLevenshtein(b *testing.B, pairs [][2]string) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pair := pairs[i%len(pairs)]
+		levenshteinDistance(pair[0], pair[1])
+	}
+}
+
+// BenchmarkLevenshteinDistance_ShortStrings compares job titles, whose rows fit the
+// stack buffer
+func BenchmarkLevenshteinDistance_ShortStrings(b *testing.B) {
+	benchmarkLevenshtein(b, benchmarkPairs(occupationCorpus(1000)))
+}
+
+// BenchmarkLevenshteinDistance_LongStrings compares values of a few hundred
+// characters, such as job descriptions, whose rows are allocated
+func BenchmarkLevenshteinDistance_LongStrings(b *testing.B) {
+	corpus := occupationCorpus(1000)
+	long := make([]string, 100)
+	for i := range long {
+		long[i] = strings.Join(corpus[i*10:i*10+10], ", ")
+	}
+	benchmarkLevenshtein(b, benchmarkPairs(long))
+}
+
+// benchmarkRuleSet returns rules with 10,000 keywords spread over 100 groups, and
+// values to group: titles with extra words around a keyword, and titles matching none
+func benchmarkRuleSet() (*ruleSet, []string) {
+	keywords := occupationCorpus(10000)
+	categories := make(map[string][]string, 100)
+	for i, keyword := range keywords {
+		category := benchmarkTitles[i%len(benchmarkTitles)] + " group " + string(rune('a'+i%100/26)) + string(rune('a'+i%26))
+		categories[category] = append(categories[category], keyword)
+	}
+	rs := NewCategoryGrouper(nil).buildRuleSet(1, categories, nil, nil)
+
+	values := make([]string, 0, 1000)
+	for i, keyword := range keywords[:1000] {
+		if i%2 == 0 {
+			values = append(values, "experienced "+keyword+" at acme")
+		} else {
+			values = append(values, "volunteer number "+keyword[:len(keyword)/2])
+		}
+	}
+	return rs, values
+}
+
+// BenchmarkWordMatch_TrigramIndex_10000 looks for keywords within values using only
+// the candidates the trigram index returns
+func BenchmarkWordMatch_TrigramIndex_10000(b *testing.B) {
+	rs, values := benchmarkRuleSet()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		value := values[i%len(values)]
+		for _, key := range rs.partialMatchCandidates(value) {
+			if strings.Contains(" "+value+" ", " "+key+" ") {
+				break
+			}
+		}
+	}
+}
+
+// BenchmarkWordMatch_LinearScan_10000 looks for keywords within values by checking
+// every keyword, as grouping did before the trigram index
+func BenchmarkWordMatch_LinearScan_10000(b *testing.B) {
+	rs, values := benchmarkRuleSet()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		value := values[i%len(values)]
+		for key := range rs.rules {
+			if strings.Contains(" "+value+" ", " "+key+" ") {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLevenshteinDistance(t *testing.T) {
+	tests := []struct {
+		s1, s2 string
+		want   int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"developer", "developer", 0},
+		{"developer", "develper", 1},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{strings.Repeat("a", 200), strings.Repeat("a", 199) + "b", 1},
+		{strings.Repeat("ab", 100), strings.Repeat("ba", 100), 2},
+	}
+	for _, tt := range tests {
+		if got := levenshteinDistance(tt.s1, tt.s2); got != tt.want {
+			t.Errorf("levenshteinDistance(%q, %q) = %d, want %d", tt.s1, tt.s2, got, tt.want)
+		}
+		if got := levenshteinDistance(tt.s2, tt.s1); got != tt.want {
+			t.Errorf("levenshteinDistance(%q, %q) = %d, want %d", tt.s2, tt.s1, got, tt.want)
+		}
+	}
+}
+
+func TestPartialMatchCandidates(t *testing.T) {
+	rs := NewCategoryGrouper(nil).snapshot()
+	values := []string{
+		"senior software engineer", "lead frontend developer", "registered rn",
+		"vp of sales", "ux and ui designer", "chief technology officer",
+		"hotel manager at the beach", "machine learning researcher", "nothing relevant",
+	}
+	for _, value := range values {
+		candidates := make(map[string]bool)
+		for _, key := range rs.partialMatchCandidates(value) {
+			candidates[key] = true
+		}
+		// Every keyword a linear scan finds must be among the candidates
+		for key := range rs.rules {
+			if strings.Contains(" "+value+" ", " "+key+" ") && !candidates[key] {
+				t.Errorf("partialMatchCandidates(%q) misses keyword %q", value, key)
+			}
+		}
+	}
+
+	got := rs.explainMatch("senior software engineer")
+	if got.MatchType != "word" || got.Rule != "software engineer" {
+		t.Errorf("explainMatch() = %s match on %q, want the longest keyword %q", got.MatchType, got.Rule, "software engineer")
+	}
+}
+
+func TestGetGroupOrSelf(t *testing.T) {
+	grouper := NewCategoryGrouper(nil)
+	cleaner := NewDataCleaner()
+	cleaner.AddCasingExceptions("McDonald")
+	grouper.SetCleaner(cleaner)
+
+	tests := []struct {
+		category string
+		want     string
+	}{
+		{"software engineer", "software engineer"},
+		{"  head of   IT ", "Head Of IT"},
+		{"mcdonald franchise owner", "McDonald Franchise Owner"},
+		{"ios wizard", "iOS Wizard"},
+		{"glass-blowing artisan", "Glass-Blowing Artisan"},
+	}
+	for _, tt := range tests {
+		if got := grouper.GetGroupOrSelf(tt.category); got != tt.want {
+			t.Errorf("GetGroupOrSelf(%q) = %q, want %q", tt.category, got, tt.want)
+		}
+	}
+}
+
+func TestGetGroupDoesNotLearnUnmatchedValues(t *testing.T) {
+	normalizer := NewTermNormalizer()
+	grouper := NewCategoryGrouper(normalizer)
+	known := len(normalizer.GetCanonicalTerms())
+
+	// A typo of a keyword still finds its group through the normalizer
+	if got := grouper.GetGroup("sofware enginer"); got != "software engineer" {
+		t.Errorf("GetGroup(%q) = %q, want software engineer", "sofware enginer", got)
+	}
+	for i := 0; i < 100; i++ {
+		grouper.GetGroup(fmt.Sprintf("unmatched value %d", i))
+	}
+	if got := len(normalizer.GetCanonicalTerms()); got != known {
+		t.Errorf("normalizer has %d canonical terms after grouping, want the %d keywords", got, known)
+	}
+}
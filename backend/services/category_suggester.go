@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"csv-processor/database"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Suggestion is a candidate group for a term, scored between 0 and 1
+type Suggestion struct {
+	Category string  `json:"category"`
+	Score    float64 `json:"score"`
+}
+
+// CategorySuggester proposes groups for terms, best suggestion first. The grouper
+// only asks about terms its keyword and regex rules don't match.
+type CategorySuggester interface {
+	Suggest(ctx context.Context, term string) ([]Suggestion, error)
+}
+
+// centroidCacheTTL is how long category centroids are reused before reloading them
+const centroidCacheTTL = 5 * time.Minute
+
+// maxCachedSuggestions bounds the per-term cache of an EmbeddingCategorySuggester
+const maxCachedSuggestions = 10000
+
+const (
+	// embeddingFailureThreshold is how many calls in a row may fail before the
+	// embedding service is left alone
+	embeddingFailureThreshold = 3
+	// embeddingCooldown is how long terms go without suggestions once the embedding
+	// service keeps failing
+	embeddingCooldown = time.Minute
+)
+
+// EmbeddingCategorySuggester embeds terms with an external HTTP service and
+// suggests the categories whose stored centroid vectors are most similar. After
+// repeated failures it stops calling the service for a cooldown, so a file full of
+// unknown terms isn't slowed down by one timeout per row.
+type EmbeddingCategorySuggester struct {
+	url           string
+	client        *http.Client
+	loadCentroids func() (map[string][]float64, error)
+	minScore      float64
+	breaker       *database.CircuitBreaker
+
+	mu        sync.Mutex
+	centroids map[string][]float64
+	loadedAt  time.Time
+	cache     map[string][]Suggestion // term -> suggestions, as embeddings are slow
+}
+
+// NewEmbeddingCategorySuggester creates a suggester for the embedding service at
+// url. Categories scoring below minScore are not suggested.
+func NewEmbeddingCategorySuggester(url string, loadCentroids func() (map[string][]float64, error), minScore float64) *EmbeddingCategorySuggester {
+	// A cancelled file says nothing about the service
+	breaker := database.NewCircuitBreaker(embeddingFailureThreshold, embeddingCooldown, func(err error) bool {
+		return !errors.Is(err, context.Canceled)
+	})
+	return &EmbeddingCategorySuggester{
+		url:           url,
+		client:        &http.Client{Timeout: 5 * time.Second},
+		loadCentroids: loadCentroids,
+		minScore:      minScore,
+		breaker:       breaker,
+		cache:         make(map[string][]Suggestion),
+	}
+}
+
+// Suggest embeds term and ranks the categories by cosine similarity. It suggests
+// nothing while the service is in its failure cooldown.
+func (s *EmbeddingCategorySuggester) Suggest(ctx context.Context, term string) ([]Suggestion, error) {
+	cleaned := strings.ToLower(strings.TrimSpace(term))
+	if cleaned == "" {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	cached, ok := s.cache[cleaned]
+	s.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	var centroids map[string][]float64
+	var vector []float64
+	err := s.breaker.Do(func() error {
+		var err error
+		if centroids, err = s.currentCentroids(); err != nil || len(centroids) == 0 {
+			return err
+		}
+		vector, err = s.embed(ctx, cleaned)
+		return err
+	})
+	if errors.Is(err, database.ErrCircuitOpen) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(centroids) == 0 {
+		return nil, nil
+	}
+
+	suggestions := make([]Suggestion, 0)
+	for category, centroid := range centroids {
+		if score := cosineSimilarity(vector, centroid); score >= s.minScore {
+			suggestions = append(suggestions, Suggestion{Category: category, Score: score})
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Category < suggestions[j].Category
+	})
+
+	s.mu.Lock()
+	if len(s.cache) >= maxCachedSuggestions {
+		s.cache = make(map[string][]Suggestion)
+	}
+	s.cache[cleaned] = suggestions
+	s.mu.Unlock()
+	return suggestions, nil
+}
+
+// currentCentroids returns the category centroids, reloading them once stale
+func (s *EmbeddingCategorySuggester) currentCentroids() (map[string][]float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.centroids != nil && time.Since(s.loadedAt) < centroidCacheTTL {
+		return s.centroids, nil
+	}
+	centroids, err := s.loadCentroids()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load category centroids: %w", err)
+	}
+	s.centroids = centroids
+	s.loadedAt = time.Now()
+	// Suggestions made against the old centroids may no longer hold
+	s.cache = make(map[string][]Suggestion)
+	return centroids, nil
+}
+
+// embed asks the embedding service for the vector of a term. The service takes
+// {"input": "..."} and answers {"embedding": [...]}.
+func (s *EmbeddingCategorySuggester) embed(ctx context.Context, term string) ([]float64, error) {
+	body, err := json.Marshal(map[string]string{"input": term})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode embedding request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedding request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call embedding service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding service returned %s", resp.Status)
+	}
+
+	var result struct {
+		Embedding []float64 `json:"embedding"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding response: %w", err)
+	}
+	if len(result.Embedding) == 0 {
+		return nil, fmt.Errorf("embedding service returned an empty vector")
+	}
+	return result.Embedding, nil
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors, or 0 when
+// their dimensions differ or either is zero
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// suggestGroup returns the best suggestion for a term that no rule matched
+func (g *CategoryGrouper) suggestGroup(ctx context.Context, cleaned string) (Suggestion, bool) {
+	g.mu.RLock()
+	suggester := g.suggester
+	g.mu.RUnlock()
+	if suggester == nil || ctx.Err() != nil {
+		return Suggestion{}, false
+	}
+
+	suggestions, err := suggester.Suggest(ctx, cleaned)
+	if err != nil {
+		log.Printf("Error suggesting a group for %q: %v", cleaned, err)
+		return Suggestion{}, false
+	}
+	if len(suggestions) == 0 {
+		return Suggestion{}, false
+	}
+	return suggestions[0], true
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// ContentChecksum is a digest of some content its sender computed before sending it
+type ContentChecksum struct {
+	Source   string // where the sender gave it, for error messages
+	Expected []byte
+	sum      func([]byte) []byte
+}
+
+// ChecksumMismatchError reports content that doesn't match a checksum its sender gave
+type ChecksumMismatchError struct {
+	Source   string
+	Expected []byte
+	Actual   []byte
+	Size     int // bytes received
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch: the %d bytes received don't match %s", e.Size, e.Source)
+}
+
+// decodeDigest reads a digest given in hex or base64, returning nil unless it has
+// size bytes
+func decodeDigest(value string, size int) []byte {
+	if digest, err := hex.DecodeString(value); err == nil && len(digest) == size {
+		return digest
+	}
+	if digest, err := base64.StdEncoding.DecodeString(value); err == nil && len(digest) == size {
+		return digest
+	}
+	return nil
+}
+
+// ParseContentChecksums reads the digests sent along with some content: a SHA-256
+// given in sha256Source and an MD5 given in a Content-MD5 header, each in hex or
+// base64. Empty values are skipped.
+func ParseContentChecksums(sha256Value, sha256Source, md5Value string) ([]*ContentChecksum, error) {
+	var checksums []*ContentChecksum
+	if sha256Value != "" {
+		expected := decodeDigest(sha256Value, sha256.Size)
+		if expected == nil {
+			return nil, fmt.Errorf("%s must be a SHA-256 digest in hex or base64", sha256Source)
+		}
+		checksums = append(checksums, &ContentChecksum{Source: sha256Source, Expected: expected, sum: func(b []byte) []byte {
+			sum := sha256.Sum256(b)
+			return sum[:]
+		}})
+	}
+	if md5Value != "" {
+		expected := decodeDigest(md5Value, md5.Size)
+		if expected == nil {
+			return nil, fmt.Errorf("Content-MD5 must be an MD5 digest in base64 or hex")
+		}
+		checksums = append(checksums, &ContentChecksum{Source: "Content-MD5", Expected: expected, sum: func(b []byte) []byte {
+			sum := md5.Sum(b)
+			return sum[:]
+		}})
+	}
+	return checksums, nil
+}
+
+// VerifyContentChecksums checks content against the digests its sender gave, so
+// truncated or corrupted content is refused before any file is created. It returns
+// the hex SHA-256 of the content once the digests matched, "" when there were none,
+// and a *ChecksumMismatchError for the first digest that doesn't match.
+func VerifyContentChecksums(checksums []*ContentChecksum, content []byte) (string, error) {
+	if len(checksums) == 0 {
+		return "", nil
+	}
+	for _, checksum := range checksums {
+		if actual := checksum.sum(content); string(actual) != string(checksum.Expected) {
+			return "", &ChecksumMismatchError{Source: checksum.Source, Expected: checksum.Expected, Actual: actual, Size: len(content)}
+		}
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
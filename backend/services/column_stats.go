@@ -0,0 +1,52 @@
+package services
+
+import (
+	"csv-processor/models"
+	"strings"
+)
+
+// computeColumnStats measures how many cells of each column hold a value. It returns the
+// overall completeness (non-empty cells / total cells) along with per-column stats.
+func computeColumnStats(records []*models.Record) (float64, map[string]*models.ColumnStat) {
+	stats := make(map[string]*models.ColumnStat)
+	for _, record := range records {
+		for column := range record.CleanedData {
+			// Synthetic columns aren't part of the uploaded data
+			if column == categoryInputKey {
+				continue
+			}
+			if _, ok := stats[column]; !ok {
+				stats[column] = &models.ColumnStat{}
+			}
+		}
+	}
+
+	for _, record := range records {
+		for _, column := range record.NulledColumns {
+			if stat, ok := stats[column]; ok {
+				stat.Nulled++
+			}
+		}
+	}
+
+	totalCells, nonEmptyCells := 0, 0
+	for column, stat := range stats {
+		for _, record := range records {
+			if strings.TrimSpace(record.CleanedData[column]) != "" {
+				stat.NonEmpty++
+			} else {
+				stat.Empty++
+			}
+		}
+		if len(records) > 0 {
+			stat.Completeness = float64(stat.NonEmpty) / float64(len(records))
+		}
+		totalCells += len(records)
+		nonEmptyCells += stat.NonEmpty
+	}
+
+	if totalCells == 0 {
+		return 0, stats
+	}
+	return float64(nonEmptyCells) / float64(totalCells), stats
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"csv-processor/models"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var supportedColumnTypes = map[string]bool{
+	"": true, "string": true, "integer": true, "number": true, "boolean": true, "email": true, "date": true,
+}
+
+// columnValidator checks the values of one column against its rule
+type columnValidator struct {
+	column  string // cleaned header
+	rule    *models.ColumnRule
+	pattern *regexp.Regexp
+	allowed map[string]struct{} // lower-cased allowed values
+}
+
+// ValidateColumnRules checks that a validation schema is well-formed
+func ValidateColumnRules(rules map[string]*models.ColumnRule) error {
+	_, err := compileColumnRules(rules)
+	return err
+}
+
+// compileColumnRules compiles the rules of a validation schema, sorted by column
+func compileColumnRules(rules map[string]*models.ColumnRule) ([]*columnValidator, error) {
+	validators := make([]*columnValidator, 0, len(rules))
+	for column, rule := range rules {
+		if rule == nil {
+			return nil, fmt.Errorf("validation column %q: rule is null", column)
+		}
+		if !supportedColumnTypes[rule.Type] {
+			return nil, fmt.Errorf("validation column %q: unsupported type %q", column, rule.Type)
+		}
+		if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+			return nil, fmt.Errorf("validation column %q: min is greater than max", column)
+		}
+
+		validator := &columnValidator{column: column, rule: rule}
+		if rule.Pattern != "" {
+			compiled, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("validation column %q: %w", column, err)
+			}
+			validator.pattern = compiled
+		}
+		if len(rule.AllowedValues) > 0 {
+			validator.allowed = make(map[string]struct{}, len(rule.AllowedValues))
+			for _, value := range rule.AllowedValues {
+				validator.allowed[strings.ToLower(strings.TrimSpace(value))] = struct{}{}
+			}
+		}
+		validators = append(validators, validator)
+	}
+
+	sort.Slice(validators, func(i, j int) bool { return validators[i].column < validators[j].column })
+	return validators, nil
+}
+
+// resolveValidation compiles the configured column rules and maps them onto the
+// cleaned headers, matching case-insensitively
+func (p *CSVProcessor) resolveValidation(headers []string, cfg *models.ProcessorConfig) ([]*columnValidator, error) {
+	if cfg == nil || len(cfg.Validation) == 0 {
+		return nil, nil
+	}
+
+	validators, err := compileColumnRules(cfg.Validation)
+	if err != nil {
+		return nil, err
+	}
+	for _, validator := range validators {
+		cleaned := p.cleaner.CleanText(validator.column)
+		found := ""
+		for _, header := range headers {
+			if strings.EqualFold(header, cleaned) {
+				found = header
+				break
+			}
+		}
+		if found == "" {
+			return nil, fmt.Errorf("validation column %q not found in headers", validator.column)
+		}
+		validator.column = found
+	}
+	return validators, nil
+}
+
+// validate checks a trimmed raw value and returns the rule it breaks, if any.
+// Empty values only fail "required"; every other rule applies to non-empty values.
+func (v *columnValidator) validate(value string) string {
+	if value == "" {
+		if v.rule.Required {
+			return "required"
+		}
+		return ""
+	}
+
+	if !columnValueHasType(value, v.rule.Type) {
+		return "type"
+	}
+	if v.pattern != nil && !v.pattern.MatchString(value) {
+		return "pattern"
+	}
+	if v.allowed != nil {
+		if _, ok := v.allowed[strings.ToLower(value)]; !ok {
+			return "allowedValues"
+		}
+	}
+
+	// min and max bound numbers by value and everything else by length
+	measure := float64(len([]rune(value)))
+	if v.rule.Type == "integer" || v.rule.Type == "number" {
+		measure, _ = strconv.ParseFloat(value, 64)
+	}
+	if v.rule.Min != nil && measure < *v.rule.Min {
+		return "min"
+	}
+	if v.rule.Max != nil && measure > *v.rule.Max {
+		return "max"
+	}
+	return ""
+}
+
+// columnValueHasType reports whether a value can be read as a column rule type
+func columnValueHasType(value, columnType string) bool {
+	switch columnType {
+	case "", "string":
+		return true
+	case "boolean":
+		switch strings.ToLower(value) {
+		case "true", "false", "yes", "no", "1", "0":
+			return true
+		}
+		return false
+	case "email":
+		address, err := mail.ParseAddress(value)
+		return err == nil && address.Address == value
+	case "date":
+		_, ok := parseDate(value)
+		return ok
+	}
+	return valueHasType(value, columnType)
+}
+
+// validateRow checks a row's raw values against the run's column rules
+func (run *processingRun) validateRow(id int, values map[string]string) []*models.Violation {
+	var violations []*models.Violation
+	for _, validator := range run.validators {
+		value := strings.TrimSpace(values[validator.column])
+		if run.nullValues.matches(value) {
+			value = ""
+		}
+		if rule := validator.validate(value); rule != "" {
+			// Violations are stored, so they must not leak what masking hides
+			if run.masked[validator.column] != nil {
+				value, _ = maskPII(value, true)
+			}
+			violations = append(violations, &models.Violation{
+				RecordID: id,
+				Column:   validator.column,
+				Rule:     rule,
+				Value:    value,
+			})
+		}
+	}
+	return violations
+}
+
+// summarizeViolations counts violations per column
+func summarizeViolations(records []*models.Record) (int, map[string]int) {
+	total := 0
+	summary := make(map[string]int)
+	for _, record := range records {
+		for _, violation := range record.Violations {
+			summary[violation.Column]++
+			total++
+		}
+	}
+	return total, summary
+}
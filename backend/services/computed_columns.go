@@ -0,0 +1,68 @@
+package services
+
+import (
+	"csv-processor/models"
+	"fmt"
+	"strings"
+)
+
+// computedColumn is a computed column compiled for one processing run
+type computedColumn struct {
+	name string // cleaned column name
+	expr exprNode
+}
+
+// ValidateComputedColumns checks that computed column definitions are well-formed.
+// Column references are only resolved once the file's headers are known.
+func ValidateComputedColumns(columns []models.ComputedColumn) error {
+	seen := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		name := strings.TrimSpace(column.Name)
+		if name == "" {
+			return fmt.Errorf("computed column name is required")
+		}
+		if seen[strings.ToLower(name)] {
+			return fmt.Errorf("computed column %q is defined twice", name)
+		}
+		seen[strings.ToLower(name)] = true
+		if _, err := parseExpression(column.Expression); err != nil {
+			return fmt.Errorf("computed column %q, expression %q: %w", name, column.Expression, err)
+		}
+	}
+	return nil
+}
+
+// resolveComputedColumns compiles the configured computed columns against the cleaned
+// headers. A computed column may refer to the ones defined before it.
+func (p *CSVProcessor) resolveComputedColumns(headers []string, cfg *models.ProcessorConfig) ([]*computedColumn, []string, error) {
+	if cfg == nil || len(cfg.ComputedColumns) == 0 {
+		return nil, headers, nil
+	}
+
+	columns := append([]string{}, headers...)
+	computed := make([]*computedColumn, 0, len(cfg.ComputedColumns))
+	for _, definition := range cfg.ComputedColumns {
+		name := p.cleaner.CleanText(definition.Name)
+		if name == "" {
+			return nil, nil, fmt.Errorf("computed column %q has no usable name", definition.Name)
+		}
+		if p.findHeader(columns, name) != "" {
+			return nil, nil, fmt.Errorf("computed column %q conflicts with an existing column", definition.Name)
+		}
+
+		expr, err := parseExpression(definition.Expression)
+		if err != nil {
+			return nil, nil, fmt.Errorf("computed column %q: %w", definition.Name, err)
+		}
+		err = bindColumns(expr, func(reference string) string {
+			return p.findHeader(columns, reference)
+		}, runDateFormat(cfg))
+		if err != nil {
+			return nil, nil, fmt.Errorf("computed column %q: %w", definition.Name, err)
+		}
+
+		computed = append(computed, &computedColumn{name: name, expr: expr})
+		columns = append(columns, name)
+	}
+	return computed, columns, nil
+}
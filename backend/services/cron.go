@@ -0,0 +1,136 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression: minute, hour, day of month,
+// month and day of week. Fields take *, numbers, ranges (1-5), lists (1,15) and
+// steps (*/15, 0-30/10).
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays []bool
+	// As in cron, a day matches either restricted day field when both are restricted
+	anyDay, anyWeekday bool
+}
+
+// cronField describes the values one field of a cron expression takes
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// parseCron parses a five-field cron expression
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d", len(fields))
+	}
+
+	sets := make([][]bool, len(fields))
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	schedule := &cronSchedule{
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekdays:   sets[4],
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never fires", expr)
+	}
+	return schedule, nil
+}
+
+// parseCronField returns the values of field as a set indexed by value
+func parseCronField(field string, spec cronField) ([]bool, error) {
+	set := make([]bool, spec.max+1)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			rangePart = part[:i]
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step in %s field %q", spec.name, part)
+			}
+			step = n
+		}
+
+		low, high := spec.min, spec.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid %s field %q", spec.name, part)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid %s field %q", spec.name, part)
+				}
+			} else if step > 1 {
+				high = spec.max // 5/15 means from 5 on, every 15
+			}
+		}
+		if low < spec.min || high > spec.max || low > high {
+			return nil, fmt.Errorf("%s field %q is out of range %d-%d", spec.name, part, spec.min, spec.max)
+		}
+		for value := low; value <= high; value += step {
+			set[value] = true
+		}
+	}
+	return set, nil
+}
+
+// Next returns the first time after t the schedule fires, in t's location, or the
+// zero time if it doesn't fire within five years
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !c.months[t.Month()]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !c.hours[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.minutes[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	day, weekday := c.days[t.Day()], c.weekdays[t.Weekday()]
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
@@ -1,12 +1,15 @@
 package services
 
 import (
+	"context"
 	"csv-processor/models"
 	"encoding/csv"
+	"fmt"
 	"io"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 type CSVProcessor struct {
@@ -15,41 +18,143 @@ type CSVProcessor struct {
 	mu      sync.RWMutex
 	grouper *CategoryGrouper
 	cleaner *DataCleaner
+	piiKey  []byte // keys the hashes of masked values; nil skips hashing
 }
 
-func NewCSVProcessor() *CSVProcessor {
+func NewCSVProcessor(grouper *CategoryGrouper) *CSVProcessor {
 	return &CSVProcessor{
 		records: make([]*models.Record, 0),
 		groups:  make(map[string][]int),
-		grouper: NewCategoryGrouper(),
+		grouper: grouper,
 		cleaner: NewDataCleaner(),
 	}
 }
 
-// ProcessCSV reads and processes a CSV file
-func (p *CSVProcessor) ProcessCSV(file io.Reader) ([]*models.Record, int64, error) {
-	startTime := time.Now()
+// categoryInputKey is the synthetic cleaned_data key holding the combined value
+// that was grouped when category columns are configured
+const categoryInputKey = "_category_input"
 
-	reader := csv.NewReader(file)
-	reader.LazyQuotes = true
-	reader.TrimLeadingSpace = true
+// IsSyntheticColumn reports whether a cleaned_data key was added by processing rather
+// than uploaded
+func IsSyntheticColumn(column string) bool {
+	return column == categoryInputKey
+}
 
-	// Read header
-	headers, err := reader.Read()
+// maxNaturalKeyLength is the longest natural key the records table stores
+const maxNaturalKeyLength = 255
+
+// processingRun holds the settings one file is processed with
+type processingRun struct {
+	ctx             context.Context // cancels the category suggestions of the file
+	rules           *ruleSet        // grouping rules active when processing started
+	headers         []string
+	columns         []string // headers followed by the computed columns
+	computed        []*computedColumn
+	rowFilter       exprNode // rows it doesn't hold for are skipped; nil keeps every row
+	categoryColumns []string
+	nullValues      nullValueSet
+	validators      []*columnValidator
+	dateFormat      string
+	masked          map[string]*maskedColumn // cleaned header -> masking; nil masks nothing
+	fallbackToSelf  bool                     // unmatched category values become their own group
+	naturalKey      string                   // cleaned header holding each record's own key
+}
+
+// newRun prepares processing of a file with the given cleaned headers
+func (p *CSVProcessor) newRun(ctx context.Context, headers []string, cfg *models.ProcessorConfig) (*processingRun, error) {
+	computed, columns, err := p.resolveComputedColumns(headers, cfg)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	// Clean headers
-	for i, header := range headers {
-		headers[i] = p.cleaner.CleanText(header)
+	// Computed columns can be grouped on like uploaded ones
+	categoryColumns, err := p.resolveCategoryColumns(columns, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	rowFilter, err := p.resolveRowFilter(columns, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	validators, err := p.resolveValidation(headers, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var naturalKey string
+	if cfg != nil && cfg.NaturalKeyColumn != "" {
+		if naturalKey = p.findHeader(columns, cfg.NaturalKeyColumn); naturalKey == "" {
+			return nil, fmt.Errorf("natural key column %q not found in headers", cfg.NaturalKeyColumn)
+		}
+	}
+
+	var nullValues []string
+	if cfg != nil {
+		nullValues = cfg.NullValues
+	}
+
+	return &processingRun{
+		ctx:             ctx,
+		rules:           p.grouper.snapshot(),
+		headers:         headers,
+		columns:         columns,
+		computed:        computed,
+		rowFilter:       rowFilter,
+		categoryColumns: categoryColumns,
+		nullValues:      p.cleaner.nullValueSet(nullValues),
+		validators:      validators,
+		dateFormat:      runDateFormat(cfg),
+		masked:          resolveMasking(headers, validators, cfg),
+		fallbackToSelf:  cfg != nil && cfg.FallbackToSelf,
+		naturalKey:      naturalKey,
+	}, nil
+}
+
+// runDateFormat is the layout dates are cleaned into by a run with cfg
+func runDateFormat(cfg *models.ProcessorConfig) string {
+	if cfg != nil && cfg.DateOutputFormat != "" {
+		return cfg.DateOutputFormat
+	}
+	return DefaultDateFormat
+}
+
+// SetPIIHashKey makes masking store a keyed hash of every redacted value
+func (p *CSVProcessor) SetPIIHashKey(key []byte) {
+	p.piiKey = key
+}
+
+// Cleaner returns the DataCleaner used for every value
+func (p *CSVProcessor) Cleaner() *DataCleaner {
+	return p.cleaner
+}
+
+// ctxCheckInterval is how many rows are read between cancellation checks
+const ctxCheckInterval = 1000
+
+// ProcessCSV reads and processes a CSV file. cfg may be nil. It stops with ctx.Err()
+// once ctx is cancelled. The returned timings cover parsing and transforming.
+func (p *CSVProcessor) ProcessCSV(ctx context.Context, file io.Reader, cfg *models.ProcessorConfig) ([]*models.Record, *models.ProcessingTimings, error) {
+	startTime := time.Now()
+
+	reader, headers, err := p.readHeaders(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The whole file is grouped with the rules active when processing started
+	run, err := p.newRun(ctx, headers, cfg)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Auto-detect category column
 	_ = p.detectCategoryColumn(headers)
 
-	// Read all rows first
+	// Read all rows first, remembering the line each starts on
 	allRows := make([][]string, 0, 1000) // Pre-allocate with reasonable capacity
+	allLines := make([]int, 0, 1000)
 	recordID := 1
 	for {
 		row, err := reader.Read()
@@ -57,11 +162,18 @@ func (p *CSVProcessor) ProcessCSV(file io.Reader) ([]*models.Record, int64, erro
 			break
 		}
 		if err != nil {
-			return nil, 0, err
+			return nil, nil, err
 		}
 		allRows = append(allRows, append([]string{string(rune(recordID))}, row...))
+		allLines = append(allLines, rowLine(reader))
 		recordID++
+
+		if recordID%ctxCheckInterval == 0 && ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
 	}
+	parseTime := time.Since(startTime)
+	transformStart := time.Now()
 
 	// Process rows in batches for better performance
 	batchSize := 1000
@@ -73,9 +185,13 @@ func (p *CSVProcessor) ProcessCSV(file io.Reader) ([]*models.Record, int64, erro
 			end = len(allRows)
 		}
 		
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
 		// Process batch concurrently
 		batch := allRows[i:end]
-		batchRecords := p.processBatch(headers, batch, i+1)
+		batchRecords := p.processBatch(run, batch, allLines[i:end], i+1)
 		records = append(records, batchRecords...)
 	}
 
@@ -85,12 +201,172 @@ func (p *CSVProcessor) ProcessCSV(file io.Reader) ([]*models.Record, int64, erro
 	p.buildGroups()
 	p.mu.Unlock()
 
-	processingTime := time.Since(startTime).Milliseconds()
-	return records, processingTime, nil
+	timings := &models.ProcessingTimings{
+		Parse:        newStageTiming(parseTime, len(allRows)),
+		Transform:    newStageTiming(time.Since(transformStart), len(allRows)),
+		RowsFiltered: len(allRows) - len(records),
+		TotalMs:      time.Since(startTime).Milliseconds(),
+	}
+	return records, timings, nil
+}
+
+// streamBatchSize is how many rows StreamCSV processes at a time
+const streamBatchSize = 1000
+
+// StreamCSV processes a CSV file batch by batch, handing each batch of records to
+// emit along with the cleaned headers instead of keeping the whole file in memory.
+// cfg may be nil.
+func (p *CSVProcessor) StreamCSV(ctx context.Context, file io.Reader, cfg *models.ProcessorConfig, emit func(headers []string, batch []*models.Record) error) error {
+	reader, headers, err := p.readHeaders(file)
+	if err != nil {
+		return err
+	}
+	run, err := p.newRun(ctx, headers, cfg)
+	if err != nil {
+		return err
+	}
+
+	batch := make([][]string, 0, streamBatchSize)
+	lines := make([]int, 0, streamBatchSize)
+	nextID := 1
+	flush := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		records := p.processBatch(run, batch, lines, nextID)
+		nextID += len(batch)
+		batch, lines = batch[:0], lines[:0]
+		return emit(run.columns, records)
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// processRow expects the ID column in front, as ProcessCSV builds it
+		batch = append(batch, append([]string{""}, row...))
+		lines = append(lines, rowLine(reader))
+		if len(batch) == streamBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	// A file without rows still reports its headers
+	if len(batch) > 0 || nextID == 1 {
+		return flush()
+	}
+	return nil
+}
+
+// newStageTiming describes a stage that handled rows in d
+func newStageTiming(d time.Duration, rows int) *models.StageTiming {
+	timing := &models.StageTiming{DurationMs: d.Milliseconds()}
+	if d > 0 {
+		timing.RowsPerSec = float64(rows) / d.Seconds()
+	}
+	return timing
+}
+
+// PreviewCSV cleans and categorizes only the first maxRows rows of a CSV file.
+// It returns the cleaned headers, the detected category column and the records.
+func (p *CSVProcessor) PreviewCSV(ctx context.Context, file io.Reader, maxRows int, cfg *models.ProcessorConfig) ([]string, string, []*models.Record, error) {
+	reader, headers, err := p.readHeaders(file)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	run, err := p.newRun(ctx, headers, cfg)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	records := make([]*models.Record, 0, maxRows)
+	for id := 1; len(records) < maxRows; id++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if record := p.processRow(run, append([]string{string(rune(id))}, row...), id, rowLine(reader)); record != nil {
+			records = append(records, record)
+		}
+	}
+
+	categoryColumn := p.detectCategoryColumn(headers)
+	if len(run.categoryColumns) > 0 {
+		categoryColumn = strings.Join(run.categoryColumns, ",")
+	}
+	return run.columns, categoryColumn, records, nil
+}
+
+// resolveCategoryColumns maps the configured category columns onto the cleaned
+// headers, matching case-insensitively
+func (p *CSVProcessor) resolveCategoryColumns(headers []string, cfg *models.ProcessorConfig) ([]string, error) {
+	if cfg == nil || len(cfg.CategoryColumns) == 0 {
+		return nil, nil
+	}
+
+	columns := make([]string, 0, len(cfg.CategoryColumns))
+	for _, column := range cfg.CategoryColumns {
+		found := p.findHeader(headers, column)
+		if found == "" {
+			return nil, fmt.Errorf("category column %q not found in headers", column)
+		}
+		columns = append(columns, found)
+	}
+	return columns, nil
+}
+
+// findHeader returns the cleaned header matching column, or "" if there is none
+func (p *CSVProcessor) findHeader(headers []string, column string) string {
+	cleaned := p.cleaner.CleanText(column)
+	for _, header := range headers {
+		if strings.EqualFold(header, cleaned) {
+			return header
+		}
+	}
+	return ""
+}
+
+// readHeaders creates a CSV reader for file and reads the cleaned header row
+func (p *CSVProcessor) readHeaders(file io.Reader) (*csv.Reader, []string, error) {
+	reader := csv.NewReader(file)
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	// Read header
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Clean headers
+	for i, header := range headers {
+		headers[i] = p.cleaner.CleanText(header)
+	}
+
+	return reader, headers, nil
+}
+
+// rowLine returns the line of the file the row just read starts on. Lines count from
+// 1, which holds the header, and include blank lines and the extra lines of quoted
+// values spanning several, so the number points into the uploaded file.
+func rowLine(reader *csv.Reader) int {
+	line, _ := reader.FieldPos(0)
+	return line
 }
 
-// processBatch processes a batch of rows concurrently with thread-safe normalization
-func (p *CSVProcessor) processBatch(headers []string, batch [][]string, startID int) []*models.Record {
+// processBatch processes a batch of rows concurrently with thread-safe normalization.
+// lines holds the line each row starts on. Rows skipped by the run's row filter are
+// left out.
+func (p *CSVProcessor) processBatch(run *processingRun, batch [][]string, lines []int, startID int) []*models.Record {
 	records := make([]*models.Record, len(batch))
 	
 	var wg sync.WaitGroup
@@ -103,17 +379,29 @@ func (p *CSVProcessor) processBatch(headers []string, batch [][]string, startID
 			semaphore <- struct{}{}        // Acquire
 			defer func() { <-semaphore }() // Release
 			
-			records[idx] = p.processRow(headers, rowData, startID+idx)
+			records[idx] = p.processRow(run, rowData, startID+idx, lines[idx])
 		}(i, row)
 	}
 	
 	wg.Wait()
-	return records
+
+	kept := records[:0]
+	for _, record := range records {
+		if record != nil {
+			kept = append(kept, record)
+		}
+	}
+	return kept
 }
 
-func (p *CSVProcessor) processRow(headers []string, row []string, id int) *models.Record {
+// processRow cleans and groups one row starting on the given line of the file. It
+// returns nil for rows the run's row filter skips.
+func (p *CSVProcessor) processRow(run *processingRun, row []string, id, line int) *models.Record {
+	headers := run.headers
 	originalData := make(map[string]string)
 	cleanedData := make(map[string]string)
+	var nulledColumns, maskedColumns, warnings []string
+	var piiHashes map[string]string
 
 	// Process each column
 	for i, value := range row {
@@ -124,39 +412,135 @@ func (p *CSVProcessor) processRow(headers []string, row []string, id int) *model
 			header := headers[i-1]
 			originalData[header] = value
 			
-			// Clean the text
+			// Placeholders like "N/A" become empty, everything else is cleaned
+			if run.nullValues.matches(value) {
+				cleanedData[header] = ""
+				nulledColumns = append(nulledColumns, header)
+				warnings = append(warnings, fmt.Sprintf("%s: placeholder %q treated as empty", header, strings.TrimSpace(value)))
+				continue
+			}
+			// PII is redacted from the raw value, as cleaning would mangle it
+			if masking := run.masked[header]; masking != nil {
+				if masked, ok := maskPII(value, masking.force); ok {
+					cleanedData[header] = masked
+					maskedColumns = append(maskedColumns, header)
+					if p.piiKey != nil {
+						if piiHashes == nil {
+							piiHashes = make(map[string]string)
+						}
+						piiHashes[header] = hashPII(p.piiKey, value)
+					}
+					continue
+				}
+			}
+			// Dates are rewritten in the configured format rather than stripped of separators
+			if date, ok := p.cleaner.CleanDate(value, run.dateFormat); ok {
+				cleanedData[header] = date
+				continue
+			}
 			cleaned := p.cleaner.CleanText(value)
 			cleanedData[header] = cleaned
 		}
 	}
 
-	// Detect category grouping from any available field
-	groupedCategory := p.detectCategory(cleanedData)
+	// A computed value that can't be evaluated is left empty
+	for _, column := range run.computed {
+		value, err := column.expr.eval(cleanedData)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", column.name, err))
+		}
+		cleanedData[column.name] = value.text
+	}
+	if !run.keepRow(cleanedData) {
+		return nil
+	}
+
+	// Group on the configured columns combined, or detect the category from any available field.
+	// The first group is the record's primary one.
+	var groupedCategories []string
+	if len(run.categoryColumns) > 0 {
+		parts := make([]string, 0, len(run.categoryColumns))
+		for _, column := range run.categoryColumns {
+			if value := cleanedData[column]; value != "" {
+				parts = append(parts, value)
+			}
+		}
+		combined := strings.Join(parts, " ")
+		cleanedData[categoryInputKey] = combined
+		groupedCategories = p.grouper.groupsWith(run.ctx, run.rules, combined)
+		if len(groupedCategories) == 0 && run.fallbackToSelf && combined != "" {
+			groupedCategories = []string{combined}
+		}
+	} else {
+		var term string
+		groupedCategories, term = p.detectCategory(run.ctx, run.rules, cleanedData)
+		if len(groupedCategories) == 0 && run.fallbackToSelf && term != "" {
+			groupedCategories = []string{term}
+		}
+	}
+	var groupedCategory string
+	if len(groupedCategories) > 0 {
+		groupedCategory = groupedCategories[0]
+	}
+
+	var naturalKey string
+	if run.naturalKey != "" {
+		naturalKey = cleanedData[run.naturalKey]
+		if utf8.RuneCountInString(naturalKey) > maxNaturalKeyLength {
+			warnings = append(warnings, fmt.Sprintf("%s: key longer than %d characters ignored", run.naturalKey, maxNaturalKeyLength))
+			naturalKey = ""
+		}
+	}
+
+	violations := run.validateRow(id, originalData)
+	for header, masking := range run.masked {
+		if !masking.storeOriginal {
+			delete(originalData, header)
+		}
+	}
 
 	return &models.Record{
-		ID:              id,
-		OriginalData:    originalData,
-		CleanedData:     cleanedData,
-		GroupedCategory: groupedCategory,
+		ID:                id,
+		OriginalData:      originalData,
+		CleanedData:       cleanedData,
+		GroupedCategory:   groupedCategory,
+		GroupedCategories: groupedCategories,
+		NaturalKey:        naturalKey,
+		RowNumber:         id,
+		LineNumber:        line,
+		Warnings:          warnings,
+		Violations:        violations,
+		NulledColumns:     nulledColumns,
+		MaskedColumns:     maskedColumns,
+		PIIHashes:         piiHashes,
 	}
 }
 
-func (p *CSVProcessor) detectCategory(data map[string]string) string {
-	// Priority-ordered list of category-like field names
-	categoryFields := []string{
-		"category", "type", "specialty", "profession", "occupation",
-		"role", "title", "job", "position", "designation",
-		"department", "field", "industry", "sector", "skill",
-	}
-	
+// categoryFieldNames are the category-like field names detectCategory groups on, by
+// priority
+var categoryFieldNames = []string{
+	"category", "type", "specialty", "profession", "occupation",
+	"role", "title", "job", "position", "designation",
+	"department", "field", "industry", "sector", "skill",
+}
+
+// detectCategory returns the groups of the first category-like field that maps to a
+// group. When none does it returns no groups and the value of the first non-empty
+// category-like field, which callers may use as the category itself.
+func (p *CSVProcessor) detectCategory(ctx context.Context, rules *ruleSet, data map[string]string) ([]string, string) {
+	firstTerm := ""
+
 	// First, try priority fields (case-insensitive lookup)
-	for _, field := range categoryFields {
+	for _, field := range categoryFieldNames {
 		// Try both lowercase and title case versions
 		for key, value := range data {
 			if strings.EqualFold(key, field) && value != "" {
-				groupedCategory := p.grouper.GetGroup(value)
-				if groupedCategory != "" {
-					return groupedCategory
+				groupedCategories := p.grouper.groupsWith(ctx, rules, value)
+				if len(groupedCategories) > 0 {
+					return groupedCategories, value
+				}
+				if firstTerm == "" {
+					firstTerm = value
 				}
 				break
 			}
@@ -168,16 +552,16 @@ func (p *CSVProcessor) detectCategory(data map[string]string) string {
 	// Allow shorter names (>= 2 chars) to catch abbreviations like SEO, CRM, HR, IT
 	for key, value := range data {
 		if strings.EqualFold(key, "name") && value != "" && len(value) >= 2 {
-			groupedCategory := p.grouper.GetGroup(value)
+			groupedCategories := p.grouper.groupsWith(ctx, rules, value)
 			// Only use if it actually mapped to a recognized group
-			if groupedCategory != "" {
-				return groupedCategory
+			if len(groupedCategories) > 0 {
+				return groupedCategories, value
 			}
 			break
 		}
 	}
 
-	return ""
+	return nil, firstTerm
 }
 
 // detectCategoryColumn finds the most likely category column from headers
@@ -216,8 +600,8 @@ func (p *CSVProcessor) buildGroups() {
 	p.groups = make(map[string][]int)
 	
 	for _, record := range p.records {
-		if record.GroupedCategory != "" {
-			p.groups[record.GroupedCategory] = append(p.groups[record.GroupedCategory], record.ID)
+		for _, category := range record.GroupedCategories {
+			p.groups[category] = append(p.groups[category], record.ID)
 		}
 	}
 }
@@ -233,3 +617,59 @@ func (p *CSVProcessor) GetGroups() map[string][]int {
 	defer p.mu.RUnlock()
 	return p.groups
 }
+
+// ExplainCategorization explains the group of a processed row under the current
+// rules. The term explained is the combined category columns, or else the field
+// detectCategory would have grouped on. It returns nil when the row has no term.
+func (p *CSVProcessor) ExplainCategorization(cleanedData map[string]string) *models.CategorizationExplanation {
+	if combined, ok := cleanedData[categoryInputKey]; ok {
+		if combined == "" {
+			return nil
+		}
+		return p.grouper.Explain(combined)
+	}
+
+	var first *models.CategorizationExplanation
+	for _, field := range categoryFieldNames {
+		for key, value := range cleanedData {
+			if strings.EqualFold(key, field) && value != "" {
+				explanation := p.grouper.Explain(value)
+				if explanation.Category != "" {
+					return explanation
+				}
+				if first == nil {
+					first = explanation
+				}
+				break
+			}
+		}
+	}
+	for key, value := range cleanedData {
+		if strings.EqualFold(key, "name") && len(value) >= 2 {
+			if explanation := p.grouper.Explain(value); explanation.Category != "" {
+				return explanation
+			}
+			break
+		}
+	}
+	return first
+}
+
+// Classify shows how a single value is cleaned, normalized and grouped, without
+// storing anything or teaching the normalizer
+func (p *CSVProcessor) Classify(field, value string) *models.ClassifyResult {
+	cleaned := p.cleaner.CleanText(value)
+	match := p.grouper.ExplainGroup(cleaned)
+
+	result := &models.ClassifyResult{
+		Field:   field,
+		Input:   value,
+		Cleaned: cleaned,
+		Group:   match.Group,
+		Match:   match,
+	}
+	if p.grouper.normalizer != nil {
+		result.Normalization = p.grouper.normalizer.ExplainTerm(cleaned)
+	}
+	return result
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"csv-processor/models"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessCSVLineNumbers(t *testing.T) {
+	tests := []struct {
+		name  string
+		csv   string
+		cfg   *models.ProcessorConfig
+		names []string
+		lines []int
+	}{
+		{
+			name:  "consecutive rows",
+			csv:   "name,title\nAda,Engineer\nGrace,Admiral\n",
+			names: []string{"Ada", "Grace"},
+			lines: []int{2, 3},
+		},
+		{
+			name:  "blank lines skipped",
+			csv:   "name,title\n\nAda,Engineer\n\n\nGrace,Admiral\n",
+			names: []string{"Ada", "Grace"},
+			lines: []int{3, 6},
+		},
+		{
+			name:  "quoted value spanning lines",
+			csv:   "name,title\n\"Ada\",\"Chief\nEngineer\"\nGrace,Admiral\n",
+			names: []string{"Ada", "Grace"},
+			lines: []int{2, 4},
+		},
+		{
+			name:  "rows dropped by the row filter",
+			csv:   "name,status\nAda,active\nCharles,retired\nGrace,active\n",
+			cfg:   &models.ProcessorConfig{RowFilter: `status == "Active"`},
+			names: []string{"Ada", "Grace"},
+			lines: []int{2, 4},
+		},
+		{
+			name:  "dates filtered in the output date format",
+			csv:   "name,hired\nAda,2024-01-10\nCharles,2024-03-05\nGrace,2024-02-20\n",
+			cfg:   &models.ProcessorConfig{DateOutputFormat: "02/01/2006", RowFilter: `hired >= "01/02/2024"`},
+			names: []string{"Charles", "Grace"},
+			lines: []int{3, 4},
+		},
+		{
+			name:  "dates filtered against an ISO date",
+			csv:   "name,hired\nAda,2024-01-10\nCharles,2024-03-05\nGrace,2024-02-20\n",
+			cfg:   &models.ProcessorConfig{DateOutputFormat: "02/01/2006", RowFilter: `hired < "2024-02-01"`},
+			names: []string{"Ada"},
+			lines: []int{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := NewCSVProcessor(NewCategoryGrouper(nil))
+			records, _, err := processor.ProcessCSV(context.Background(), strings.NewReader(tt.csv), tt.cfg)
+			if err != nil {
+				t.Fatalf("ProcessCSV() error: %v", err)
+			}
+
+			var names []string
+			var lines []int
+			for _, record := range records {
+				names = append(names, record.CleanedData["Name"])
+				lines = append(lines, record.LineNumber)
+			}
+			if !reflect.DeepEqual(names, tt.names) {
+				t.Errorf("records = %v, want %v", names, tt.names)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("line numbers = %v, want %v", lines, tt.lines)
+			}
+		})
+	}
+}
+
+func TestStreamCSVLineNumbers(t *testing.T) {
+	csv := "name,title\n\nAda,\"Chief\nEngineer\"\n\nGrace,Admiral\n"
+	processor := NewCSVProcessor(NewCategoryGrouper(nil))
+
+	var lines []int
+	err := processor.StreamCSV(context.Background(), strings.NewReader(csv), nil, func(headers []string, batch []*models.Record) error {
+		for _, record := range batch {
+			lines = append(lines, record.LineNumber)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamCSV() error: %v", err)
+	}
+	if want := []int{3, 6}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("line numbers = %v, want %v", lines, want)
+	}
+}
+
+func TestProcessCSVCategoryColumns(t *testing.T) {
+	// Neither "night" nor "nurse" is a keyword on its own
+	grouper := NewCategoryGrouper(nil)
+	grouper.current = grouper.buildRuleSet(1, map[string][]string{"night shift nursing": {"night nurse"}}, nil, nil)
+	csv := "name,shift,role\nFlorence,night,nurse\n"
+
+	tests := []struct {
+		name      string
+		columns   []string
+		wantGroup string
+		wantInput string
+	}{
+		{"combined columns", []string{"shift", "role"}, "night shift nursing", "Night Nurse"},
+		{"combined columns, case-insensitive", []string{"SHIFT", "Role"}, "night shift nursing", "Night Nurse"},
+		{"columns in the other order", []string{"role", "shift"}, "", "Nurse Night"},
+		{"first column alone", []string{"shift"}, "", "Night"},
+		{"second column alone", []string{"role"}, "", "Nurse"},
+		{"detected category field", nil, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg *models.ProcessorConfig
+			if tt.columns != nil {
+				cfg = &models.ProcessorConfig{CategoryColumns: tt.columns}
+			}
+			records, _, err := NewCSVProcessor(grouper).ProcessCSV(context.Background(), strings.NewReader(csv), cfg)
+			if err != nil {
+				t.Fatalf("ProcessCSV() error: %v", err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("ProcessCSV() returned %d records, want 1", len(records))
+			}
+
+			record := records[0]
+			if record.GroupedCategory != tt.wantGroup {
+				t.Errorf("group = %q, want %q", record.GroupedCategory, tt.wantGroup)
+			}
+			input, ok := record.CleanedData[categoryInputKey]
+			if tt.columns == nil {
+				if ok {
+					t.Errorf("%s = %q without category columns, want it absent", categoryInputKey, input)
+				}
+			} else if input != tt.wantInput {
+				t.Errorf("%s = %q, want %q", categoryInputKey, input, tt.wantInput)
+			}
+		})
+	}
+}
+
+func TestProcessCSVCategoryColumnNotFound(t *testing.T) {
+	cfg := &models.ProcessorConfig{CategoryColumns: []string{"shift", "team"}}
+	_, _, err := NewCSVProcessor(NewCategoryGrouper(nil)).ProcessCSV(context.Background(), strings.NewReader("shift,role\nnight,nurse\n"), cfg)
+	if err == nil || !strings.Contains(err.Error(), `"team"`) {
+		t.Errorf("ProcessCSV() error = %v, want one naming the missing column", err)
+	}
+}
+
+func TestNewStageTiming(t *testing.T) {
+	tests := []struct {
+		d              time.Duration
+		rows           int
+		wantMs         int64
+		wantRowsPerSec float64
+	}{
+		{2 * time.Second, 1000, 2000, 500},
+		{250 * time.Millisecond, 1000, 250, 4000},
+		{1500 * time.Microsecond, 3, 1, 2000},
+		{0, 1000, 0, 0},
+	}
+	for _, tt := range tests {
+		timing := newStageTiming(tt.d, tt.rows)
+		if timing.DurationMs != tt.wantMs || timing.RowsPerSec != tt.wantRowsPerSec {
+			t.Errorf("newStageTiming(%v, %d) = %+v, want %dms at %v rows/s", tt.d, tt.rows, timing, tt.wantMs, tt.wantRowsPerSec)
+		}
+	}
+}
+
+func TestProcessCSVTimings(t *testing.T) {
+	var csv strings.Builder
+	csv.WriteString("name,title,email\n")
+	titles := occupationCorpus(1000)
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&csv, "Person %d,%s,person%d@example.com\n", i, titles[i%len(titles)], i)
+	}
+
+	records, timings, err := NewCSVProcessor(NewCategoryGrouper(nil)).ProcessCSV(context.Background(), strings.NewReader(csv.String()), nil)
+	if err != nil {
+		t.Fatalf("ProcessCSV() error: %v", err)
+	}
+	if len(records) != 5000 {
+		t.Fatalf("ProcessCSV() returned %d records, want 5000", len(records))
+	}
+
+	for name, stage := range map[string]*models.StageTiming{"parse": timings.Parse, "transform": timings.Transform} {
+		if stage == nil {
+			t.Fatalf("%s timing missing", name)
+		}
+		if stage.DurationMs > 0 && stage.RowsPerSec <= 0 {
+			t.Errorf("%s took %dms but reports %v rows/s", name, stage.DurationMs, stage.RowsPerSec)
+		}
+	}
+	if timings.Insert != nil {
+		t.Errorf("insert timing = %+v before anything was stored", timings.Insert)
+	}
+	if timings.TotalMs <= 0 {
+		t.Fatalf("total = %dms for 5000 rows", timings.TotalMs)
+	}
+
+	// Stages are truncated to whole milliseconds, and reading the header is only in the total
+	stages := timings.Parse.DurationMs + timings.Transform.DurationMs
+	slack := timings.TotalMs / 10
+	if slack < 5 {
+		slack = 5
+	}
+	if stages > timings.TotalMs || timings.TotalMs-stages > slack {
+		t.Errorf("parse %dms + transform %dms = %dms, want roughly the total of %dms",
+			timings.Parse.DurationMs, timings.Transform.DurationMs, stages, timings.TotalMs)
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+)
+
+// sniffSize is how much of an upload SniffCSV inspects
+const sniffSize = 8 << 10
+
+// knownFileTypes are the magic numbers of files commonly uploaded instead of a CSV
+var knownFileTypes = []struct {
+	magic string
+	name  string
+}{
+	{"%PDF", "a PDF document"},
+	{"\x89PNG\r\n\x1a\n", "a PNG image"},
+	{"\xff\xd8\xff", "a JPEG image"},
+	{"GIF87a", "a GIF image"},
+	{"GIF89a", "a GIF image"},
+	{"II*\x00", "a TIFF image"},
+	{"MM\x00*", "a TIFF image"},
+	{"PK\x03\x04", "a zip archive"},
+	{"\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", "a legacy Office document (.xls or .doc)"},
+	{"\x1f\x8b", "a gzip archive"},
+	{"Rar!\x1a\x07", "a RAR archive"},
+	{"7z\xbc\xaf\x27\x1c", "a 7-Zip archive"},
+	{"{\\rtf", "an RTF document"},
+	{"SQLite format 3\x00", "an SQLite database"},
+}
+
+// SniffCSV checks the start of an upload's content, as it will be parsed, before it
+// is accepted. Content that is clearly not CSV, such as a PDF, an image or other
+// binary data, is refused with an error naming what it looks like. Content that
+// parses but looks wrong, such as a single column, is accepted with warnings.
+// Content marked as UTF-16 is sniffed as the text it decodes to.
+func SniffCSV(content []byte) ([]string, error) {
+	head := content
+	if len(head) > sniffSize {
+		head = head[:sniffSize]
+	}
+	head = DecodeUTF16(head)
+
+	for _, fileType := range knownFileTypes {
+		if bytes.HasPrefix(head, []byte(fileType.magic)) {
+			return nil, fmt.Errorf("file looks like %s, not CSV", fileType.name)
+		}
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, fmt.Errorf("file contains binary data (detected as %s), not CSV", http.DetectContentType(head))
+	}
+
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	if len(bytes.TrimSpace(head)) == 0 {
+		return nil, nil // empty files fail processing with their own error
+	}
+	// The last line may be cut off by the sniff, so it is only read when the whole
+	// content fits
+	if len(content) > sniffSize {
+		if end := bytes.LastIndexByte(head, '\n'); end > 0 {
+			head = head[:end+1]
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(head))
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	var rows [][]string
+	for {
+		row, err := reader.Read()
+		if err != nil {
+			break // io.EOF, or a malformed row processing will report
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	var warnings []string
+	columns := len(rows[0])
+	if columns == 1 {
+		warning := "the header has a single column and no commas"
+		switch {
+		case bytes.IndexByte(head, ';') >= 0:
+			warning += "; the file may be delimited by semicolons, which are not supported"
+		case bytes.IndexByte(head, '\t') >= 0:
+			warning += "; the file may be delimited by tabs, which are not supported"
+		}
+		return append(warnings, warning), nil
+	}
+	if len(rows) > 1 {
+		consistent := 0
+		for _, row := range rows[1:] {
+			if len(row) == columns {
+				consistent++
+			}
+		}
+		if consistent == 0 {
+			warnings = append(warnings, fmt.Sprintf("none of the first %d rows has the %d columns of the header", len(rows)-1, columns))
+		}
+	}
+	return warnings, nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16 encodes s as UTF-16 with a byte order mark
+func encodeUTF16(s string, order binary.ByteOrder) []byte {
+	units := append([]uint16{0xfeff}, utf16.Encode([]rune(s))...)
+	encoded := make([]byte, 2*len(units))
+	for i, unit := range units {
+		order.PutUint16(encoded[2*i:], unit)
+	}
+	return encoded
+}
+
+func TestDecodeUTF16(t *testing.T) {
+	text := "name,title\nJürgen,Entwickler 😀\n"
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"little endian", encodeUTF16(text, binary.LittleEndian), text},
+		{"big endian", encodeUTF16(text, binary.BigEndian), text},
+		{"utf-8 unchanged", []byte(text), text},
+		{"utf-8 bom unchanged", []byte("\xef\xbb\xbf" + text), "\xef\xbb\xbf" + text},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(DecodeUTF16(tt.content)); got != tt.want {
+				t.Errorf("DecodeUTF16() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniffCSV(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     []byte
+		wantErr     string
+		wantWarning string
+	}{
+		{"csv", []byte("name,title\nAda,Engineer\n"), "", ""},
+		{"utf-16le csv", encodeUTF16("name,title\nAda,Engineer\n", binary.LittleEndian), "", ""},
+		{"utf-16be csv", encodeUTF16("name,title\nAda,Engineer\n", binary.BigEndian), "", ""},
+		{"empty", []byte(""), "", ""},
+		{"pdf", []byte("%PDF-1.7\n..."), "PDF document", ""},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00"), "PNG image", ""},
+		{"binary", []byte("a,b\n\x00\x01\x02"), "binary data", ""},
+		{"semicolons", []byte("name;title\nAda;Engineer\n"), "", "semicolons"},
+		{"utf-16 semicolons", encodeUTF16("name;title\nAda;Engineer\n", binary.LittleEndian), "", "semicolons"},
+		{"ragged rows", []byte("a,b,c\n1\n2\n"), "", "columns of the header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := SniffCSV(tt.content)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SniffCSV() error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SniffCSV() unexpected error: %v", err)
+			}
+			if tt.wantWarning == "" {
+				if len(warnings) != 0 {
+					t.Errorf("SniffCSV() warnings = %v, want none", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 || !strings.Contains(warnings[0], tt.wantWarning) {
+				t.Errorf("SniffCSV() warnings = %v, want one mentioning %q", warnings, tt.wantWarning)
+			}
+		})
+	}
+}
@@ -1,18 +1,63 @@
 package services
 
 import (
+	"csv-processor/config"
+	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 type DataCleaner struct {
-	multiSpaceRegex *regexp.Regexp
+	multiSpaceRegex  *regexp.Regexp
+	casingExceptions map[string]string // lowercased term -> preserved casing
+	casingMu         sync.RWMutex
+	nullValues       []string // placeholders treated as empty unless an upload overrides them
 }
 
 func NewDataCleaner() *DataCleaner {
-	return &DataCleaner{
-		multiSpaceRegex: regexp.MustCompile(`\s+`),
+	cleaner := &DataCleaner{
+		multiSpaceRegex:  regexp.MustCompile(`\s+`),
+		casingExceptions: make(map[string]string),
 	}
+	cleaner.AddCasingExceptions(defaultCasingExceptions...)
+	// Extra exceptions, comma separated (e.g. CASING_EXCEPTIONS=GmbH,SaaS)
+	cleaner.AddCasingExceptions(strings.Split(config.GetEnv("CASING_EXCEPTIONS", ""), ",")...)
+	cleaner.nullValues = defaultNullValues
+	if values := config.GetEnv("NULL_VALUES", ""); values != "" {
+		cleaner.nullValues = strings.Split(values, ",")
+	}
+	return cleaner
+}
+
+// defaultNullValues are placeholder cells that mean "no value"
+var defaultNullValues = []string{"n/a", "null", "-", "--", "none", "(blank)"}
+
+// nullValueSet holds lowercased placeholder values
+type nullValueSet map[string]struct{}
+
+// nullValueSet builds the placeholders for a file. A nil override uses the defaults;
+// an empty one disables placeholder handling.
+func (c *DataCleaner) nullValueSet(override []string) nullValueSet {
+	values := c.nullValues
+	if override != nil {
+		values = override
+	}
+	set := make(nullValueSet, len(values))
+	for _, value := range values {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			set[value] = struct{}{}
+		}
+	}
+	return set
+}
+
+// matches reports whether a raw cell is one of the placeholders (case-insensitive, after trim)
+func (s nullValueSet) matches(value string) bool {
+	_, ok := s[strings.ToLower(strings.TrimSpace(value))]
+	return ok
 }
 
 // CleanText normalizes text by removing extra spaces, special characters, and standardizing casing
@@ -40,17 +85,135 @@ func (c *DataCleaner) CleanText(text string) string {
 	text = strings.TrimSpace(text)
 
 	// Convert to title case for consistency
-	text = toTitleCase(text)
+	text = c.toTitleCase(text)
 
 	return text
 }
 
-func toTitleCase(s string) string {
-    words := strings.Fields(s)
-    for i, word := range words {
-        if len(word) > 0 {
-            words[i] = strings.ToUpper(string(word[0])) + strings.ToLower(word[1:])
-        }
-    }
+// DefaultDateFormat is the layout dates are written in unless an upload picks another
+const DefaultDateFormat = "2006-01-02"
+
+// dateInputLayouts are the date formats recognized in cells. Slash-separated dates
+// are read month first.
+var dateInputLayouts = []string{
+	"2006-01-02", "2006/01/02", "01/02/2006", "1/2/2006", "02.01.2006",
+	"Jan 2, 2006", "January 2, 2006", "2 Jan 2006", "2 January 2006", time.RFC3339,
+}
+
+// parseDate reads value with any of the recognized date layouts
+func parseDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateInputLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// CleanDate rewrites a recognized date in the given layout (DefaultDateFormat when
+// empty). It reports false when value is not a date.
+func (c *DataCleaner) CleanDate(value, layout string) (string, bool) {
+	t, ok := parseDate(value)
+	if !ok {
+		return "", false
+	}
+	if layout == "" {
+		layout = DefaultDateFormat
+	}
+	return t.Format(layout), true
+}
+
+// ValidateDateFormat checks that layout is a Go time layout holding a full date
+func ValidateDateFormat(layout string) error {
+	reference := time.Date(2006, time.January, 2, 0, 0, 0, 0, time.UTC)
+	parsed, err := time.Parse(layout, reference.Format(layout))
+	if err != nil || parsed.Year() != 2006 || parsed.Month() != time.January || parsed.Day() != 2 {
+		return fmt.Errorf("date format %q must be a Go time layout with year, month and day (e.g. 01/02/2006)", layout)
+	}
+	return nil
+}
+
+// defaultCasingExceptions keep their casing through title casing
+var defaultCasingExceptions = []string{
+	"SEO", "CRM", "HR", "IT", "CEO", "CFO", "CTO", "COO", "VP", "PR", "QA",
+	"UI", "UX", "API", "SQL", "AWS", "ERP", "B2B", "B2C", "USA", "UK", "EU",
+	"iOS", "macOS", "iPhone", "iPad", "PhD", "DevOps",
+}
+
+// maxPreservedUpperLength is the longest all-uppercase token kept as typed
+const maxPreservedUpperLength = 4
+
+// AddCasingExceptions registers terms whose casing title casing must keep
+func (c *DataCleaner) AddCasingExceptions(terms ...string) {
+	c.casingMu.Lock()
+	defer c.casingMu.Unlock()
+	for _, term := range terms {
+		if term = strings.TrimSpace(term); term != "" {
+			c.casingExceptions[strings.ToLower(term)] = term
+		}
+	}
+}
+
+// CasingExceptions returns the registered casing exceptions, sorted
+func (c *DataCleaner) CasingExceptions() []string {
+	c.casingMu.RLock()
+	defer c.casingMu.RUnlock()
+	terms := make([]string, 0, len(c.casingExceptions))
+	for _, term := range c.casingExceptions {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+// toTitleCase capitalizes each word, keeping casing exceptions and short acronyms
+// that were typed in uppercase. Hyphenated parts are cased on their own.
+func (c *DataCleaner) toTitleCase(s string) string {
+	c.casingMu.RLock()
+	defer c.casingMu.RUnlock()
+
+	words := strings.Fields(s)
+	for i, word := range words {
+		parts := strings.Split(word, "-")
+		for j, part := range parts {
+			parts[j] = c.casePart(part)
+		}
+		words[i] = strings.Join(parts, "-")
+	}
 	return strings.Join(words, " ")
-}
\ No newline at end of file
+}
+
+// casePart title cases a single token, treating a trailing possessive separately
+func (c *DataCleaner) casePart(part string) string {
+	if part == "" {
+		return part
+	}
+
+	base, suffix := part, ""
+	if len(part) > 2 && strings.HasSuffix(strings.ToLower(part), "'s") {
+		base, suffix = part[:len(part)-2], "'s"
+	}
+
+	if exception, ok := c.casingExceptions[strings.ToLower(base)]; ok {
+		return exception + suffix
+	}
+	if len(base) <= maxPreservedUpperLength && isUpperToken(base) {
+		return base + suffix
+	}
+	return strings.ToUpper(base[:1]) + strings.ToLower(base[1:]) + suffix
+}
+
+// isUpperToken reports whether s has letters and all of them are uppercase
+func isUpperToken(s string) bool {
+	hasLetter := false
+	for _, ch := range s {
+		if ch >= 'a' && ch <= 'z' {
+			return false
+		}
+		if ch >= 'A' && ch <= 'Z' {
+			hasLetter = true
+		}
+	}
+	return hasLetter
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestCleanTextCasingExceptions(t *testing.T) {
+	cleaner := NewDataCleaner()
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain words", "senior developer", "Senior Developer"},
+		{"lowercase acronym", "seo specialist", "SEO Specialist"},
+		{"uppercase acronym", "SEO Specialist", "SEO Specialist"},
+		{"two letter acronym", "it manager", "IT Manager"},
+		{"shouted title", "IT MANAGER", "IT Manager"},
+		{"mixed case exception", "ios developer", "iOS Developer"},
+		{"digits in exception", "b2b sales", "B2B Sales"},
+		{"hyphenated words", "e-commerce manager", "E-Commerce Manager"},
+		{"hyphenated acronyms", "hr-it liaison", "HR-IT Liaison"},
+		{"possessive exception", "ceo's office", "CEO's Office"},
+		{"possessive word", "john's team", "John's Team"},
+		{"short uppercase token kept", "NASA engineer", "NASA Engineer"},
+		{"long uppercase token cased", "ACME CORPORATION", "ACME Corporation"},
+		{"extra spaces", "  vp   of  sales ", "VP Of Sales"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleaner.CleanText(tt.input); got != tt.want {
+				t.Errorf("CleanText(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddCasingExceptions(t *testing.T) {
+	cleaner := NewDataCleaner()
+	cleaner.AddCasingExceptions("GmbH", " SaaS ", "")
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"acme gmbh", "Acme GmbH"},
+		{"saas sales", "SaaS Sales"},
+		{"SAAS-GMBH", "SaaS-GmbH"},
+	}
+	for _, tt := range tests {
+		if got := cleaner.CleanText(tt.input); got != tt.want {
+			t.Errorf("CleanText(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// Registering a term again replaces its casing instead of adding a duplicate
+	cleaner.AddCasingExceptions("Gmbh")
+	count := 0
+	for _, term := range cleaner.CasingExceptions() {
+		if term == "GmbH" || term == "Gmbh" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected one casing of gmbh, got %d", count)
+	}
+	if got := cleaner.CleanText("acme gmbh"); got != "Acme Gmbh" {
+		t.Errorf("CleanText after replacing exception = %q, want %q", got, "Acme Gmbh")
+	}
+}
+
+func TestCasingExceptionsSorted(t *testing.T) {
+	terms := NewDataCleaner().CasingExceptions()
+	if !sort.StringsAreSorted(terms) {
+		t.Errorf("casing exceptions not sorted: %v", terms)
+	}
+}
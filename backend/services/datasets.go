@@ -0,0 +1,119 @@
+package services
+
+import (
+	"csv-processor/models"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// datasetColumns are the columns scanned by scanDataset. Members are read with the
+// dataset, so files deleted since are already gone from it.
+const datasetColumns = `d.id, d.name, d.owner,
+	ARRAY(SELECT csv_file_id FROM dataset_files WHERE dataset_id = d.id ORDER BY csv_file_id), d.created_at`
+
+// scanDataset reads a dataset selected with datasetColumns
+func scanDataset(row rowScanner) (*models.Dataset, error) {
+	dataset := &models.Dataset{}
+	var fileIDs pq.Int64Array
+	if err := row.Scan(&dataset.ID, &dataset.Name, &dataset.Owner, &fileIDs, &dataset.CreatedAt); err != nil {
+		return nil, err
+	}
+	dataset.FileIDs = make([]int, len(fileIDs))
+	for i, id := range fileIDs {
+		dataset.FileIDs[i] = int(id)
+	}
+	return dataset, nil
+}
+
+// CreateDataset stores a dataset of the given files. Callers must check the files
+// are visible to its owner.
+func (s *DBService) CreateDataset(name, owner string, fileIDs []int) (*models.Dataset, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.QueryRow(`INSERT INTO datasets (name, owner) VALUES ($1, $2) RETURNING id`, name, owner).Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to create dataset: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO dataset_files (dataset_id, csv_file_id)
+		SELECT $1, unnest($2::int[])
+		ON CONFLICT DO NOTHING
+	`, id, pq.Array(fileIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to add dataset files: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.GetDataset(id, OwnerScope{All: true})
+}
+
+// ListDatasets returns the datasets visible in scope, oldest first
+func (s *DBService) ListDatasets(scope OwnerScope) ([]*models.Dataset, error) {
+	rows, err := s.db.Query(`SELECT `+datasetColumns+` FROM datasets d WHERE $1 OR d.owner = $2 ORDER BY d.id`,
+		scope.All, scope.Owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query datasets: %w", err)
+	}
+	defer rows.Close()
+
+	datasets := make([]*models.Dataset, 0)
+	for rows.Next() {
+		dataset, err := scanDataset(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan dataset: %w", err)
+		}
+		datasets = append(datasets, dataset)
+	}
+	return datasets, rows.Err()
+}
+
+// GetDataset returns a dataset with its current members, or an error if it isn't
+// visible in scope
+func (s *DBService) GetDataset(id int, scope OwnerScope) (*models.Dataset, error) {
+	row := s.db.QueryRow(`SELECT `+datasetColumns+` FROM datasets d WHERE d.id = $1 AND ($2 OR d.owner = $3)`,
+		id, scope.All, scope.Owner)
+	dataset, err := scanDataset(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("dataset not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dataset: %w", err)
+	}
+	return dataset, nil
+}
+
+// DeleteDataset removes a dataset. Its files stay.
+func (s *DBService) DeleteDataset(id int) error {
+	if _, err := s.db.Exec(`DELETE FROM datasets WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete dataset: %w", err)
+	}
+	return nil
+}
+
+// GetFilenames returns the filename of each of the given files that still exists
+func (s *DBService) GetFilenames(fileIDs []int) (map[int]string, error) {
+	rows, err := s.db.Query(`SELECT id, filename FROM csv_files WHERE id = ANY($1)`, pq.Array(fileIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query filenames: %w", err)
+	}
+	defer rows.Close()
+
+	names := make(map[int]string, len(fileIDs))
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan filename: %w", err)
+		}
+		names[id] = name
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDatasetRecords(t *testing.T) {
+	db := testDBService(t)
+	people := storeFixture(t, db, "people.csv", "english")
+	german := storeFixture(t, db, "german.csv", "german")
+
+	dataset, err := db.CreateDataset("dataset-test", "", []int{german, people})
+	if err != nil {
+		t.Fatalf("CreateDataset() error: %v", err)
+	}
+	t.Cleanup(func() { db.DeleteDataset(dataset.ID) })
+
+	records, total, err := db.FilterRecords(dataset.FileIDs, &RecordFilter{}, 100, 0, nil)
+	if err != nil {
+		t.Fatalf("FilterRecords() error: %v", err)
+	}
+	counts := map[int]int{}
+	for _, record := range records {
+		counts[record.CSVFileID]++
+	}
+	if want := map[int]int{people: 5, german: 3}; total != 8 || !reflect.DeepEqual(counts, want) {
+		t.Errorf("FilterRecords() = %v records per file of %d, want %v of 8", counts, total, want)
+	}
+
+	// Deleting a file takes it out of the dataset at once
+	if err := db.DeleteCSVFile(german, "test"); err != nil {
+		t.Fatalf("DeleteCSVFile() error: %v", err)
+	}
+	dataset, err = db.GetDataset(dataset.ID, OwnerScope{All: true})
+	if err != nil {
+		t.Fatalf("GetDataset() error: %v", err)
+	}
+	if want := []int{people}; !reflect.DeepEqual(dataset.FileIDs, want) {
+		t.Errorf("dataset files = %v after deleting file %d, want %v", dataset.FileIDs, german, want)
+	}
+}
@@ -1,81 +1,408 @@
 package services
 
 import (
+	"context"
+	"csv-processor/config"
 	"csv-processor/database"
 	"csv-processor/models"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/lib/pq"
 )
 
 type DBService struct {
-	db *sql.DB
+	db         *breakerDB       // database.DB behind a circuit breaker
+	heavy      *QueryLimiter    // guards queries that scan many records
+	encryption *fieldEncryption // nil stores every value in plain text
+
+	replaceTxMaxRows int  // larger files are stored and switched over in separate transactions
+	compressRaw      bool // gzip raw uploads before storing them
+
+	events *EventBus // live subscribers of recorded file events; nil publishes nothing
+
+	tsqueryOnce sync.Once
+	tsquery     string // tsquery constructor for search queries, see tsqueryFunc
 }
 
 func NewDBService() *DBService {
 	return &DBService{
-		db: database.DB,
+		db: &breakerDB{
+			DB: database.DB,
+			breaker: database.NewCircuitBreaker(
+				config.GetEnvInt("DB_CIRCUIT_FAILURE_THRESHOLD", 5),
+				time.Duration(config.GetEnvInt("DB_CIRCUIT_COOLDOWN_SECONDS", 30))*time.Second,
+				isDatabaseUnavailable,
+			),
+		},
+		heavy: NewQueryLimiter(
+			config.GetEnvInt("HEAVY_QUERY_LIMIT", 8),
+			time.Duration(config.GetEnvInt("HEAVY_QUERY_QUEUE_TIMEOUT_MS", 2000))*time.Millisecond,
+		),
+		replaceTxMaxRows: config.GetEnvInt("REPLACE_SINGLE_TX_MAX_ROWS", 50000),
+		compressRaw:      config.GetEnv("RAW_CONTENT_ENCODING", rawEncodingGzip) == rawEncodingGzip,
 	}
 }
 
-// CreateCSVFile creates a new CSV file record
-func (s *DBService) CreateCSVFile(filename string, fileSize int64) (*models.CSVFile, error) {
+// CircuitStats reports the state of the circuit breaker in front of the database
+func (s *DBService) CircuitStats() *database.CircuitStats {
+	return s.db.breaker.Stats()
+}
+
+// SetFieldEncryption encrypts the given PII columns (the defaults when empty) of
+// stored records and decrypts them again when reading
+func (s *DBService) SetFieldEncryption(encryptor *FieldEncryptor, fields []string) {
+	s.encryption = newFieldEncryption(encryptor, fields)
+}
+
+// IsEncryptedColumn reports whether values of column are stored encrypted
+func (s *DBService) IsEncryptedColumn(column string) bool {
+	return s.encryption != nil && s.encryption.isPII(column)
+}
+
+// HeavyQueryStats reports the load on the expensive query limiter
+func (s *DBService) HeavyQueryStats() *models.QueryLimiterStats {
+	return s.heavy.Stats()
+}
+
+// CreateCSVFile creates a new CSV file record, keeping the raw upload for later use
+func (s *DBService) CreateCSVFile(filename string, fileSize int64, rawContent []byte, sheetName, searchLanguage, owner string, tags []string, cfg *models.ProcessorConfig, contentSHA256 string) (*models.CSVFile, error) {
+	var configJSON []byte
+	if cfg != nil {
+		var err error
+		configJSON, err = json.Marshal(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal processing config: %w", err)
+		}
+	}
+
+	stored, encoding, err := s.encodeRawContent(rawContent)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		INSERT INTO csv_files (filename, file_size, status, uploaded_at)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, filename, file_size, status, record_count, processing_time_ms, uploaded_at
+		INSERT INTO csv_files (filename, file_size, status, uploaded_at, raw_content, raw_content_encoding, sheet_name, processing_config, search_language, tags, owner, active_generation, content_sha256)
+		VALUES ($1, $2, $3, $4, $5, $11, NULLIF($6, ''), $7, NULLIF($8, ''), $9, $10, 0, NULLIF($12, ''))
+		RETURNING id, filename, file_size, COALESCE(sheet_name, ''), COALESCE(search_language, ''), status, record_count,
+		          processing_time_ms, uploaded_at, version, active_generation
 	`
 
-	file := &models.CSVFile{}
-	err := s.db.QueryRow(query, filename, fileSize, "processing", time.Now()).Scan(
+	file := &models.CSVFile{ProcessingConfig: cfg, Tags: NormalizeTags(tags), Owner: owner, ContentSHA256: contentSHA256}
+	err = s.db.QueryRow(query, filename, fileSize, "processing", time.Now(), stored, sheetName, configJSON, searchLanguage, pq.Array(file.Tags), owner, encoding, contentSHA256).Scan(
 		&file.ID,
 		&file.Filename,
 		&file.FileSize,
+		&file.SheetName,
+		&file.SearchLanguage,
 		&file.Status,
 		&file.RecordCount,
 		&file.ProcessingTimeMs,
 		&file.UploadedAt,
+		&file.Version,
+		&file.Generation,
 	)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create CSV file record: %w", err)
 	}
+	if encoding == rawEncodingGzip {
+		logCompression(file.ID, rawContent, stored)
+	}
 
 	return file, nil
 }
 
-// UpdateCSVFileStatus updates the status of a CSV file
-func (s *DBService) UpdateCSVFileStatus(fileID int, status string, recordCount int, processingTimeMs int64, errorMsg string) error {
+// GetRawContent returns the raw bytes that were uploaded for a CSV file
+func (s *DBService) GetRawContent(fileID int) ([]byte, error) {
+	var rawContent []byte
+	var encoding string
+	err := s.db.QueryRow(`SELECT raw_content, raw_content_encoding FROM csv_files WHERE id = $1`, fileID).Scan(&rawContent, &encoding)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("CSV file not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get raw content: %w", err)
+	}
+	if rawContent == nil {
+		return nil, fmt.Errorf("raw content not available for this file")
+	}
+
+	return decodeRawContent(rawContent, encoding)
+}
+
+// UpdateCSVFileStatus updates the status of a CSV file if it is still at expectedVersion,
+// bumping the version. It returns models.ErrVersionConflict when the file changed since
+// the caller read it.
+func (s *DBService) UpdateCSVFileStatus(ctx context.Context, fileID int, expectedVersion int, status string, recordCount int, processingTimeMs int64, errorMsg string) error {
 	completedAt := time.Now()
 	query := `
+		WITH old AS (SELECT status FROM csv_files WHERE id = $6 FOR UPDATE)
 		UPDATE csv_files
-		SET status = $1, record_count = $2, processing_time_ms = $3, error_message = $4, completed_at = $5
-		WHERE id = $6
+		SET status = $1, record_count = $2, processing_time_ms = $3, error_message = $4, completed_at = $5,
+		    version = version + 1
+		WHERE id = $6 AND version = $7
+		RETURNING (SELECT status FROM old)
 	`
 
-	_, err := s.db.Exec(query, status, recordCount, processingTimeMs, errorMsg, completedAt, fileID)
+	var oldStatus string
+	err := s.db.QueryRowContext(ctx, query, status, recordCount, processingTimeMs, errorMsg, completedAt, fileID, expectedVersion).Scan(&oldStatus)
+	if err == sql.ErrNoRows {
+		return models.ErrVersionConflict
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update CSV file status: %w", err)
 	}
 
+	s.RecordEvent(ctx, &models.FileEvent{CSVFileID: fileID, EventType: "status_changed", OldStatus: oldStatus, NewStatus: status})
 	return nil
 }
 
-// InsertRecords inserts multiple records in batches for better performance
-func (s *DBService) InsertRecords(records []*models.Record) error {
-	if len(records) == 0 {
-		return nil
+// ResetCSVFileForReprocess marks a file as processing again. Its records stay readable
+// until ReplaceRecords swaps in the new ones. It returns the status the file had
+// before the reset, or models.ErrFileProcessing when it is already processing.
+func (s *DBService) ResetCSVFileForReprocess(fileID int) (string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var oldStatus string
+	err = tx.QueryRow(`SELECT status FROM csv_files WHERE id = $1 FOR UPDATE`, fileID).Scan(&oldStatus)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("CSV file not found")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get CSV file: %w", err)
+	}
+
+	query := `
+		UPDATE csv_files
+		SET status = 'processing', processing_time_ms = 0,
+		    error_message = NULL, completed_at = NULL, version = version + 1,
+		    timings = NULL, normalization_report = NULL, retry_count = 0, last_retry_error = NULL
+		WHERE id = $1 AND status <> 'processing'
+	`
+	result, err := tx.Exec(query, fileID)
+	if err != nil {
+		return "", fmt.Errorf("failed to reset CSV file: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("failed to reset CSV file: %w", err)
+	}
+	if rows == 0 {
+		return "", models.ErrFileProcessing
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return oldStatus, nil
+}
+
+// DeleteCSVFile deletes a CSV file and (via cascade) all of its records
+func (s *DBService) DeleteCSVFile(fileID int, actor string) error {
+	var oldStatus string
+	err := s.db.QueryRow(`DELETE FROM csv_files WHERE id = $1 RETURNING status`, fileID).Scan(&oldStatus)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("CSV file not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete CSV file: %w", err)
 	}
 
+	s.RecordEvent(context.Background(), &models.FileEvent{CSVFileID: fileID, EventType: "deleted", OldStatus: oldStatus, Actor: actor})
+	return nil
+}
+
+// DeleteCSVFiles deletes several files and their records in one transaction. Files that
+// are gone or started processing in the meantime are left out. It returns how many
+// files were deleted.
+func (s *DBService) DeleteCSVFiles(fileIDs []int, actor string) (int, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
+	rows, err := tx.Query(`DELETE FROM csv_files WHERE id = ANY($1) AND status <> 'processing' RETURNING id, status`, pq.Array(fileIDs))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete CSV files: %w", err)
+	}
+	var deleted []int
+	var oldStatuses []string
+	for rows.Next() {
+		var id int
+		var status string
+		if err := rows.Scan(&id, &status); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan deleted file: %w", err)
+		}
+		deleted = append(deleted, id)
+		oldStatuses = append(oldStatuses, status)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to delete CSV files: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM records WHERE csv_file_id = ANY($1)`, pq.Array(deleted)); err != nil {
+		return 0, fmt.Errorf("failed to delete records: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	for i, id := range deleted {
+		s.RecordEvent(context.Background(), &models.FileEvent{CSVFileID: id, EventType: "deleted", OldStatus: oldStatuses[i], Actor: actor})
+	}
+	return len(deleted), nil
+}
+
+// RecordProcessingRetries adds to the number of transient errors retried while
+// processing a file and remembers the last of them
+func (s *DBService) RecordProcessingRetries(ctx context.Context, fileID, retries int, lastError string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE csv_files
+		SET retry_count = retry_count + $2, last_retry_error = $3
+		WHERE id = $1
+	`, fileID, retries, lastError)
+	if err != nil {
+		return fmt.Errorf("failed to record retries: %w", err)
+	}
+	return nil
+}
+
+// UpdateCSVFileStats stores the completeness score and per-column statistics of a file
+func (s *DBService) UpdateCSVFileStats(ctx context.Context, fileID int, completeness float64, columnStats map[string]*models.ColumnStat) error {
+	statsJSON, err := json.Marshal(columnStats)
+	if err != nil {
+		return fmt.Errorf("failed to marshal column stats: %w", err)
+	}
+
+	query := `UPDATE csv_files SET completeness_score = $1, column_stats = $2 WHERE id = $3`
+	_, err = s.db.ExecContext(ctx, query, completeness, string(statsJSON), fileID)
+	if err != nil {
+		return fmt.Errorf("failed to update CSV file stats: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateCSVFileTimings stores the per-stage processing time breakdown of a file
+func (s *DBService) UpdateCSVFileTimings(ctx context.Context, fileID int, timings *models.ProcessingTimings) error {
+	timingsJSON, err := json.Marshal(timings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal timings: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `UPDATE csv_files SET timings = $1 WHERE id = $2`, string(timingsJSON), fileID)
+	if err != nil {
+		return fmt.Errorf("failed to update CSV file timings: %w", err)
+	}
+
+	return nil
+}
+
+// ReplaceRecords stores records as the given generation of a file and makes it the
+// active one, so readers switch from the old records to the new ones at once. The
+// generation before it is kept; older ones are removed. It returns the number of
+// records stored.
+func (s *DBService) ReplaceRecords(ctx context.Context, fileID, generation int, records []*models.Record) (int, error) {
+	// Leftovers of an earlier attempt that never became active
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM records WHERE csv_file_id = $1 AND generation >= $2`, fileID, generation); err != nil {
+		return 0, fmt.Errorf("failed to delete stale records: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	inserted, err := s.copyRecords(ctx, tx, generation, records)
+	if err != nil {
+		return 0, err
+	}
+
+	// Small files switch over in the same transaction. Large ones commit their
+	// records first so the switch itself holds its locks only briefly.
+	if len(records) > s.replaceTxMaxRows {
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("failed to commit records: %w", err)
+		}
+		tx, err = s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+	}
+
+	if err := activateGeneration(ctx, tx, fileID, generation); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return inserted, nil
+}
+
+// activateGeneration points readers of a file at generation and drops what belonged
+// to older records: generations before the previous one, violations and dedupe
+// reports (both refer to record IDs), the masking summary and the PII columns
+func activateGeneration(ctx context.Context, tx *sql.Tx, fileID, generation int) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE csv_files
+		SET active_generation = $2, violation_count = 0, violation_summary = NULL,
+		    pii_masked = FALSE, masked_columns = NULL, pii_columns = NULL
+		WHERE id = $1
+	`, fileID, generation)
+	if err != nil {
+		return fmt.Errorf("failed to activate generation: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM records WHERE csv_file_id = $1 AND generation < $2`, fileID, generation-1); err != nil {
+		return fmt.Errorf("failed to delete old records: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM record_violations WHERE csv_file_id = $1`, fileID); err != nil {
+		return fmt.Errorf("failed to delete violations: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM dedupe_clusters WHERE csv_file_id = $1`, fileID); err != nil {
+		return fmt.Errorf("failed to delete dedupe clusters: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM dedupe_reports WHERE csv_file_id = $1`, fileID); err != nil {
+		return fmt.Errorf("failed to delete dedupe report: %w", err)
+	}
+	return nil
+}
+
+// copyRecords bulk inserts records as the given generation, returning how many were
+// stored
+func (s *DBService) copyRecords(ctx context.Context, tx *sql.Tx, generation int, records []*models.Record) (int, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	// COPY cannot skip rows repeating a natural key, so records with keys are
+	// staged first and moved over with ON CONFLICT DO NOTHING
+	table := "records"
+	if hasNaturalKeys(records) {
+		if _, err := tx.ExecContext(ctx, `CREATE TEMP TABLE records_staging (LIKE records INCLUDING DEFAULTS) ON COMMIT DROP`); err != nil {
+			return 0, fmt.Errorf("failed to create staging table: %w", err)
+		}
+		table = "records_staging"
+	}
+
 	// Process in batches of 2000 records
 	batchSize := 2000
 	for i := 0; i < len(records); i += batchSize {
@@ -87,65 +414,465 @@ func (s *DBService) InsertRecords(records []*models.Record) error {
 		batch := records[i:end]
 		
 		// Use COPY for PostgreSQL bulk insert (much faster)
-		stmt, err := tx.Prepare(pq.CopyIn("records", "csv_file_id", "original_data", "cleaned_data", "grouped_category", "created_at"))
+		stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, recordCopyColumns...))
 		if err != nil {
-			return fmt.Errorf("failed to prepare copy statement: %w", err)
+			return 0, fmt.Errorf("failed to prepare copy statement: %w", err)
 		}
 
 		for _, record := range batch {
-			originalJSON, err := json.Marshal(record.OriginalData)
+			// PII columns are encrypted at rest
+			originalData, err := s.encryption.encrypt(record.OriginalData)
 			if err != nil {
 				stmt.Close()
-				return fmt.Errorf("failed to marshal original data: %w", err)
+				return 0, fmt.Errorf("failed to encrypt original data: %w", err)
+			}
+			cleanedData, err := s.encryption.encrypt(record.CleanedData)
+			if err != nil {
+				stmt.Close()
+				return 0, fmt.Errorf("failed to encrypt cleaned data: %w", err)
+			}
+
+			originalJSON, err := json.Marshal(originalData)
+			if err != nil {
+				stmt.Close()
+				return 0, fmt.Errorf("failed to marshal original data: %w", err)
 			}
 			
-			cleanedJSON, err := json.Marshal(record.CleanedData)
+			cleanedJSON, err := json.Marshal(cleanedData)
 			if err != nil {
 				stmt.Close()
-				return fmt.Errorf("failed to marshal cleaned data: %w", err)
+				return 0, fmt.Errorf("failed to marshal cleaned data: %w", err)
 			}
 
-			_, err = stmt.Exec(
+			var warningsJSON interface{}
+			if len(record.Warnings) > 0 {
+				encoded, err := json.Marshal(record.Warnings)
+				if err != nil {
+					stmt.Close()
+					return 0, fmt.Errorf("failed to marshal warnings: %w", err)
+				}
+				warningsJSON = string(encoded)
+			}
+
+			var hashesJSON interface{}
+			if len(record.PIIHashes) > 0 {
+				encoded, err := json.Marshal(record.PIIHashes)
+				if err != nil {
+					stmt.Close()
+					return 0, fmt.Errorf("failed to marshal PII hashes: %w", err)
+				}
+				hashesJSON = string(encoded)
+			}
+
+			_, err = stmt.ExecContext(ctx,
 				record.CSVFileID,
 				string(originalJSON),
 				string(cleanedJSON),
 				record.GroupedCategory,
+				pq.Array(record.GroupedCategories),
 				time.Now(),
+				record.RowNumber,
+				len(record.Warnings),
+				len(record.Violations),
+				warningsJSON,
+				hashesJSON,
+				nullIfEmpty(record.NaturalKey),
+				generation,
+				nullIfZero(record.LineNumber),
 			)
 			if err != nil {
 				stmt.Close()
-				return fmt.Errorf("failed to exec copy: %w", err)
+				return 0, fmt.Errorf("failed to exec copy: %w", err)
 			}
 		}
 
-		_, err = stmt.Exec()
+		_, err = stmt.ExecContext(ctx)
 		if err != nil {
 			stmt.Close()
-			return fmt.Errorf("failed to flush copy: %w", err)
+			return 0, fmt.Errorf("failed to flush copy: %w", err)
 		}
 		
 		stmt.Close()
 	}
 
-	if err = tx.Commit(); err != nil {
+	inserted := len(records)
+	if table != "records" {
+		columns := strings.Join(recordCopyColumns, ", ")
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO records (`+columns+`)
+			SELECT `+columns+` FROM records_staging ORDER BY id
+			ON CONFLICT (csv_file_id, generation, natural_key) DO NOTHING
+		`)
+		if err != nil {
+			return 0, fmt.Errorf("failed to move staged records: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to count inserted records: %w", err)
+		}
+		inserted = int(affected)
+	}
+
+	return inserted, nil
+}
+
+// recordCopyColumns are the records columns copyRecords fills
+var recordCopyColumns = []string{
+	"csv_file_id", "original_data", "cleaned_data", "grouped_category", "grouped_categories", "created_at",
+	"row_number", "warning_count", "violation_count", "warnings", "pii_hashes", "natural_key",
+	"generation", "line_number",
+}
+
+// hasNaturalKeys reports whether any record carries a natural key
+func hasNaturalKeys(records []*models.Record) bool {
+	for _, record := range records {
+		if record.NaturalKey != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// nullIfZero stores zero as NULL
+func nullIfZero(n int) interface{} {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
+
+// nullIfEmpty stores empty strings as NULL
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// InsertViolations stores the column rule violations found while processing a file
+func (s *DBService) InsertViolations(ctx context.Context, fileID int, violations []*models.Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("record_violations", "csv_file_id", "record_id", "column_name", "rule", "value"))
+	if err != nil {
+		return fmt.Errorf("failed to prepare copy statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, violation := range violations {
+		if _, err := stmt.ExecContext(ctx, fileID, violation.RecordID, violation.Column, violation.Rule, violation.Value); err != nil {
+			return fmt.Errorf("failed to exec copy: %w", err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to flush copy: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// UpdateCSVFileViolations stores the number of violations of a file and their count per column
+func (s *DBService) UpdateCSVFileViolations(ctx context.Context, fileID int, count int, summary map[string]int) error {
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to marshal violation summary: %w", err)
+	}
+
+	query := `UPDATE csv_files SET violation_count = $1, violation_summary = $2 WHERE id = $3`
+	if _, err := s.db.ExecContext(ctx, query, count, string(summaryJSON), fileID); err != nil {
+		return fmt.Errorf("failed to update CSV file violations: %w", err)
+	}
+	return nil
+}
+
+// UpdateCSVFileMasking marks a file as processed with PII masking and stores how
+// many values were redacted per column
+func (s *DBService) UpdateCSVFileMasking(ctx context.Context, fileID int, maskedColumns map[string]int) error {
+	columnsJSON, err := json.Marshal(maskedColumns)
+	if err != nil {
+		return fmt.Errorf("failed to marshal masked columns: %w", err)
+	}
+
+	query := `UPDATE csv_files SET pii_masked = TRUE, masked_columns = $1 WHERE id = $2`
+	if _, err := s.db.ExecContext(ctx, query, string(columnsJSON), fileID); err != nil {
+		return fmt.Errorf("failed to update CSV file masking: %w", err)
+	}
+	return nil
+}
+
+// UpdateCSVFilePIIColumns stores the columns of a file flagged as holding personal
+// data, with the kind of data each holds
+func (s *DBService) UpdateCSVFilePIIColumns(ctx context.Context, fileID int, piiColumns map[string]PIIType) error {
+	columnsJSON, err := json.Marshal(piiColumns)
+	if err != nil {
+		return fmt.Errorf("failed to marshal PII columns: %w", err)
+	}
+
+	query := `UPDATE csv_files SET pii_columns = $1 WHERE id = $2`
+	if _, err := s.db.ExecContext(ctx, query, string(columnsJSON), fileID); err != nil {
+		return fmt.Errorf("failed to update CSV file PII columns: %w", err)
+	}
+	return nil
+}
+
+// GetViolations retrieves a page of a file's violations, optionally limited to one
+// column and/or rule, along with the total number matching
+func (s *DBService) GetViolations(fileID int, column, rule string, limit, offset int) ([]*models.Violation, int, error) {
+	where := `WHERE csv_file_id = $1`
+	args := []interface{}{fileID}
+	if column != "" {
+		args = append(args, column)
+		where += fmt.Sprintf(" AND column_name = $%d", len(args))
+	}
+	if rule != "" {
+		args = append(args, rule)
+		where += fmt.Sprintf(" AND rule = $%d", len(args))
+	}
+
+	var totalCount int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM record_violations `+where, args...).Scan(&totalCount); err != nil {
+		return nil, 0, fmt.Errorf("failed to count violations: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT record_id, column_name, rule, COALESCE(value, '')
+		FROM record_violations
+		%s
+		ORDER BY record_id, column_name
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
+	rows, err := s.db.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query violations: %w", err)
+	}
+	defer rows.Close()
+
+	violations := make([]*models.Violation, 0)
+	for rows.Next() {
+		violation := &models.Violation{}
+		if err := rows.Scan(&violation.RecordID, &violation.Column, &violation.Rule, &violation.Value); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan violation: %w", err)
+		}
+		violations = append(violations, violation)
+	}
+
+	return violations, totalCount, nil
+}
+
+// DeleteTermNormalizations removes every stored term normalization and returns how many were removed
+func (s *DBService) DeleteTermNormalizations(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM term_normalizations`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete term normalizations: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// SaveTermNormalizations replaces the stored term normalizations with mappings
+// (variation -> canonical term)
+func (s *DBService) SaveTermNormalizations(ctx context.Context, mappings map[string]string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM term_normalizations`); err != nil {
+		return fmt.Errorf("failed to clear term normalizations: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("term_normalizations", "variation", "canonical_term", "updated_at"))
+	if err != nil {
+		return fmt.Errorf("failed to prepare copy statement: %w", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	for variation, canonical := range mappings {
+		if _, err := stmt.ExecContext(ctx, variation, canonical, now); err != nil {
+			return fmt.Errorf("failed to exec copy: %w", err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to flush copy: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	return nil
+}
+
+// GetCategoryCentroids returns the stored embedding centroid of each category
+func (s *DBService) GetCategoryCentroids() (map[string][]float64, error) {
+	rows, err := s.db.Query(`SELECT category, centroid FROM category_centroids`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query category centroids: %w", err)
+	}
+	defer rows.Close()
+
+	centroids := make(map[string][]float64)
+	for rows.Next() {
+		var category string
+		var centroid pq.Float64Array
+		if err := rows.Scan(&category, &centroid); err != nil {
+			return nil, fmt.Errorf("failed to scan category centroid: %w", err)
+		}
+		centroids[category] = centroid
+	}
+	return centroids, rows.Err()
+}
+
+// IdempotencyKeyTTL is how long an upload idempotency key is remembered
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyClaimLease is how long a claimed key without a stored response blocks
+// retries, so a request that died before completing or releasing its key doesn't
+// hold it for the whole TTL
+const IdempotencyClaimLease = 10 * time.Minute
+
+// ClaimIdempotencyKey reserves an unexpired idempotency key for a new request. When the
+// key is already taken it returns false with the stored response, which is nil while
+// the original request is still in flight. Expired keys and claims past their lease
+// are taken over.
+func (s *DBService) ClaimIdempotencyKey(key string) (bool, []byte, error) {
+	query := `
+		INSERT INTO idempotency_keys (key, created_at)
+		VALUES ($1, NOW())
+		ON CONFLICT (key) DO UPDATE
+		SET file_id = NULL, response = NULL, created_at = NOW()
+		WHERE idempotency_keys.created_at < NOW() - $2 * INTERVAL '1 second'
+		   OR (idempotency_keys.response IS NULL AND idempotency_keys.created_at < NOW() - $3 * INTERVAL '1 second')
+		RETURNING key
+	`
+	var claimed string
+	err := s.db.QueryRow(query, key, IdempotencyKeyTTL.Seconds(), IdempotencyClaimLease.Seconds()).Scan(&claimed)
+	if err == nil {
+		return true, nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+
+	var response []byte
+	err = s.db.QueryRow(`SELECT response FROM idempotency_keys WHERE key = $1`, key).Scan(&response)
+	if err != nil && err != sql.ErrNoRows {
+		return false, nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	return false, response, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request that claimed key
+func (s *DBService) CompleteIdempotencyKey(key string, fileID int, response []byte) error {
+	var fileIDArg interface{}
+	if fileID > 0 {
+		fileIDArg = fileID
+	}
+	_, err := s.db.Exec(`UPDATE idempotency_keys SET file_id = $2, response = $3 WHERE key = $1`, key, fileIDArg, string(response))
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets a claimed key so the request can be retried
+func (s *DBService) ReleaseIdempotencyKey(key string) error {
+	if _, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE key = $1 AND response IS NULL`, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes idempotency keys older than IdempotencyKeyTTL
+func (s *DBService) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at < NOW() - $1 * INTERVAL '1 second'`,
+		IdempotencyKeyTTL.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
 
+// CountActiveRecords returns the number of current records across all files other
+// than excludeFileID. The previous generation kept after a reprocess is left out.
+func (s *DBService) CountActiveRecords(ctx context.Context, excludeFileID int) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM records WHERE `+activeRecords+` AND csv_file_id <> $1`, excludeFileID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count records: %w", err)
+	}
+	return count, nil
+}
+
+// UpdateCSVFileDetails sets the display name and/or description of a file. A nil
+// value is left unchanged and an empty one is cleared.
+func (s *DBService) UpdateCSVFileDetails(fileID int, displayName, description *string) error {
+	query := `
+		UPDATE csv_files
+		SET display_name = CASE WHEN $1 THEN NULLIF($2, '') ELSE display_name END,
+		    description = CASE WHEN $3 THEN NULLIF($4, '') ELSE description END
+		WHERE id = $5
+	`
+	var name, desc string
+	if displayName != nil {
+		name = *displayName
+	}
+	if description != nil {
+		desc = *description
+	}
+	if _, err := s.db.Exec(query, displayName != nil, name, description != nil, desc, fileID); err != nil {
+		return fmt.Errorf("failed to update CSV file details: %w", err)
+	}
 	return nil
 }
 
-// GetAllCSVFiles retrieves all CSV files
-func (s *DBService) GetAllCSVFiles() ([]*models.CSVFile, error) {
+// fileSortOrders maps the accepted sort keys for file listings to ORDER BY clauses
+var fileSortOrders = map[string]string{
+	"":             "uploaded_at DESC",
+	"uploaded":     "uploaded_at DESC",
+	"completeness": "completeness_score DESC NULLS LAST, uploaded_at DESC",
+}
+
+// GetAllCSVFiles retrieves a page of the CSV files visible in scope that match filter,
+// in the given sort order, along with how many files match in total
+func (s *DBService) GetAllCSVFiles(scope OwnerScope, sortBy string, filter *models.FileFilter, limit, offset int) ([]*models.CSVFile, int, error) {
+	orderBy, ok := fileSortOrders[sortBy]
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported sort: %s", sortBy)
+	}
+
+	where, args := fileWhereClause(scope, filter)
+
+	var totalCount int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM csv_files `+where, args...).Scan(&totalCount); err != nil {
+		return nil, 0, fmt.Errorf("failed to count CSV files: %w", err)
+	}
+
+	args = append(args, limit, offset)
 	query := `
-		SELECT id, filename, file_size, status, record_count, processing_time_ms, 
-		       COALESCE(error_message, ''), uploaded_at, completed_at
+		SELECT id, filename, COALESCE(display_name, ''), COALESCE(description, ''), file_size, COALESCE(sheet_name, ''),
+		       COALESCE(search_language, ''), status, record_count,
+		       processing_time_ms, COALESCE(error_message, ''), uploaded_at, completed_at,
+		       COALESCE(completeness_score, 0), version, violation_count, timings, pii_masked, tags, owner
 		FROM csv_files
-		ORDER BY uploaded_at DESC
-	`
+		` + where + `
+		ORDER BY ` + orderBy + `, id DESC
+		` + fmt.Sprintf("LIMIT $%d OFFSET $%d", len(args)-1, len(args))
 
-	rows, err := s.db.Query(query)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query CSV files: %w", err)
+		return nil, 0, fmt.Errorf("failed to query CSV files: %w", err)
 	}
 	defer rows.Close()
 
@@ -153,54 +880,149 @@ func (s *DBService) GetAllCSVFiles() ([]*models.CSVFile, error) {
 	for rows.Next() {
 		file := &models.CSVFile{}
 		var completedAt sql.NullTime
+		var timingsJSON []byte
 
 		err := rows.Scan(
 			&file.ID,
 			&file.Filename,
+			&file.DisplayName,
+			&file.Description,
 			&file.FileSize,
+			&file.SheetName,
+			&file.SearchLanguage,
 			&file.Status,
 			&file.RecordCount,
 			&file.ProcessingTimeMs,
 			&file.ErrorMessage,
 			&file.UploadedAt,
 			&completedAt,
+			&file.CompletenessScore,
+			&file.Version,
+			&file.ViolationCount,
+			&timingsJSON,
+			&file.PIIMasked,
+			(*pq.StringArray)(&file.Tags),
+			&file.Owner,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan CSV file: %w", err)
+			return nil, 0, fmt.Errorf("failed to scan CSV file: %w", err)
 		}
 
 		if completedAt.Valid {
 			file.CompletedAt = &completedAt.Time
 		}
 
+		if timingsJSON != nil {
+			json.Unmarshal(timingsJSON, &file.Timings)
+		}
+
 		files = append(files, file)
 	}
 
-	return files, nil
+	return files, totalCount, rows.Err()
+}
+
+// fileWhereClause builds the WHERE clause selecting the files in scope matching filter.
+// Every value is passed as a parameter.
+func fileWhereClause(scope OwnerScope, filter *models.FileFilter) (string, []interface{}) {
+	conditions := make([]string, 0)
+	var args []interface{}
+	if condition := scope.condition("owner", &args); condition != "" {
+		conditions = append(conditions, condition)
+	}
+	if filter != nil {
+		if filter.Status != "" {
+			args = append(args, filter.Status)
+			conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+		}
+		if filter.UploadedAfter != nil {
+			args = append(args, *filter.UploadedAfter)
+			conditions = append(conditions, fmt.Sprintf("uploaded_at >= $%d", len(args)))
+		}
+		if filter.UploadedBefore != nil {
+			args = append(args, *filter.UploadedBefore)
+			conditions = append(conditions, fmt.Sprintf("uploaded_at <= $%d", len(args)))
+		}
+		if filter.Filename != "" {
+			args = append(args, escapeLike(filter.Filename)+"%")
+			conditions = append(conditions, fmt.Sprintf("(filename ILIKE $%d OR display_name ILIKE $%d)", len(args), len(args)))
+		}
+		if len(filter.Tags) > 0 {
+			args = append(args, pq.Array(filter.Tags))
+			operator := "&&"
+			if filter.MatchAllTags {
+				operator = "@>"
+			}
+			conditions = append(conditions, fmt.Sprintf("tags %s $%d", operator, len(args)))
+		}
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// GetCSVFileStatus returns the processing status of a file
+func (s *DBService) GetCSVFileStatus(fileID int) (string, error) {
+	var status string
+	err := s.db.QueryRow(`SELECT status FROM csv_files WHERE id = $1`, fileID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("CSV file not found")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get CSV file status: %w", err)
+	}
+	return status, nil
 }
 
 // GetCSVFile retrieves a single CSV file by ID
 func (s *DBService) GetCSVFile(fileID int) (*models.CSVFile, error) {
 	query := `
-		SELECT id, filename, file_size, status, record_count, processing_time_ms,
-		       COALESCE(error_message, ''), uploaded_at, completed_at
+		SELECT id, filename, COALESCE(display_name, ''), COALESCE(description, ''), file_size, COALESCE(sheet_name, ''),
+		       COALESCE(search_language, ''), status, record_count,
+		       processing_time_ms, COALESCE(error_message, ''), uploaded_at, completed_at,
+		       COALESCE(completeness_score, 0), column_stats, processing_config, version,
+		       violation_count, violation_summary, timings, pii_masked, masked_columns, tags, owner,
+		       active_generation, retry_count, COALESCE(last_retry_error, ''), COALESCE(content_sha256, ''), pii_columns
 		FROM csv_files
 		WHERE id = $1
 	`
 
 	file := &models.CSVFile{}
 	var completedAt sql.NullTime
+	var columnStatsJSON, configJSON, violationSummaryJSON, timingsJSON, maskedColumnsJSON, piiColumnsJSON []byte
 
 	err := s.db.QueryRow(query, fileID).Scan(
 		&file.ID,
 		&file.Filename,
+		&file.DisplayName,
+		&file.Description,
 		&file.FileSize,
+		&file.SheetName,
+		&file.SearchLanguage,
 		&file.Status,
 		&file.RecordCount,
 		&file.ProcessingTimeMs,
 		&file.ErrorMessage,
 		&file.UploadedAt,
 		&completedAt,
+		&file.CompletenessScore,
+		&columnStatsJSON,
+		&configJSON,
+		&file.Version,
+		&file.ViolationCount,
+		&violationSummaryJSON,
+		&timingsJSON,
+		&file.PIIMasked,
+		&maskedColumnsJSON,
+		(*pq.StringArray)(&file.Tags),
+		&file.Owner,
+		&file.Generation,
+		&file.RetryCount,
+		&file.LastRetryError,
+		&file.ContentSHA256,
+		&piiColumnsJSON,
 	)
 
 	if err == sql.ErrNoRows {
@@ -210,36 +1032,341 @@ func (s *DBService) GetCSVFile(fileID int) (*models.CSVFile, error) {
 		return nil, fmt.Errorf("failed to get CSV file: %w", err)
 	}
 
-	if completedAt.Valid {
-		file.CompletedAt = &completedAt.Time
+	if completedAt.Valid {
+		file.CompletedAt = &completedAt.Time
+	}
+
+	if columnStatsJSON != nil {
+		json.Unmarshal(columnStatsJSON, &file.ColumnStats)
+	}
+
+	if configJSON != nil {
+		json.Unmarshal(configJSON, &file.ProcessingConfig)
+	}
+
+	if violationSummaryJSON != nil {
+		json.Unmarshal(violationSummaryJSON, &file.ViolationSummary)
+	}
+
+	if timingsJSON != nil {
+		json.Unmarshal(timingsJSON, &file.Timings)
+	}
+
+	if maskedColumnsJSON != nil {
+		json.Unmarshal(maskedColumnsJSON, &file.MaskedColumns)
+	}
+
+	if piiColumnsJSON != nil {
+		json.Unmarshal(piiColumnsJSON, &file.PIIColumns)
+	}
+
+	return file, nil
+}
+
+// activeGeneration limits a records query to the generation readers currently see of
+// the file fileRef, a parameter placeholder or column
+func activeGeneration(fileRef string) string {
+	return "generation = (SELECT active_generation FROM csv_files WHERE id = " + fileRef + ")"
+}
+
+// activeGenerations limits a records query to the generations readers currently see
+// of the files in filesRef, an int array parameter
+func activeGenerations(filesRef string) string {
+	return "csv_file_id = ANY(" + filesRef + ") AND (csv_file_id, generation) IN (SELECT id, active_generation FROM csv_files WHERE id = ANY(" + filesRef + "))"
+}
+
+// activeRecords limits a records query spanning files to each file's active generation
+const activeRecords = "(csv_file_id, generation) IN (SELECT id, active_generation FROM csv_files)"
+
+// GetRecordsByFileID retrieves all records for a specific CSV file with pagination
+func (s *DBService) GetRecordsByFileID(fileID int, limit, offset int, createdAfter, createdBefore *time.Time, projection *RecordProjection) ([]*models.Record, int, error) {
+	where := "WHERE csv_file_id = $1 AND " + activeGeneration("$1")
+	args := []interface{}{fileID}
+	where, args = createdAtBounds(where, args, createdAfter, createdBefore)
+
+	// Get total count
+	var totalCount int
+	countQuery := `SELECT COUNT(*) FROM records ` + where
+	err := s.db.QueryRow(countQuery, args...).Scan(&totalCount)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get record count: %w", err)
+	}
+
+	// Get paginated records
+	args = append(args, limit, offset)
+	limitArg, offsetArg := len(args)-1, len(args)
+	columns, args := projection.selectColumns(args)
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM records
+		%s
+		ORDER BY id
+		LIMIT $%d OFFSET $%d
+	`, columns, where, limitArg, offsetArg)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query records: %w", err)
+	}
+	defer rows.Close()
+
+	records, err := s.scanRecords(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return records, totalCount, nil
+}
+
+// fileSearchConfig is the text search configuration of the file whose ID is $1
+const fileSearchConfig = "COALESCE((SELECT search_language FROM csv_files WHERE id = $1), 'simple')::regconfig"
+
+// recordSearchConfig is the text search configuration of each record's own file, for
+// searches spanning files
+const recordSearchConfig = "COALESCE((SELECT search_language FROM csv_files WHERE id = csv_file_id), 'simple')::regconfig"
+
+// IsSearchLanguageSupported reports whether PostgreSQL has a text search configuration named language
+func (s *DBService) IsSearchLanguageSupported(language string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = $1)`, language).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check search language: %w", err)
+	}
+	return exists, nil
+}
+
+// SearchRecords performs full-text search on records for a specific file with pagination
+func (s *DBService) SearchRecords(fileID int, query string, limit, offset int, createdAfter, createdBefore *time.Time, projection *RecordProjection) ([]*models.Record, int, error) {
+	filter := &RecordFilter{Query: query, CreatedAfter: createdAfter, CreatedBefore: createdBefore}
+	return s.FilterRecords([]int{fileID}, filter, limit, offset, projection)
+}
+
+// RecordFilter narrows a record listing. Zero values don't filter.
+type RecordFilter struct {
+	Query         string // full-text search, matched like SearchRecords
+	Substring     bool   // match Query as a literal substring instead of full-text
+	Group         string
+	HasWarnings   bool
+	HasViolations bool
+	CreatedAfter  *time.Time // inclusive bounds on created_at
+	CreatedBefore *time.Time
+	Previous      bool // read the generation replaced by the last reprocess
+	// Equals matches cleaned values exactly (column -> value) and HasValue requires
+	// the columns to be non-empty. Callers must check the columns against the
+	// file's headers.
+	Equals   map[string]string
+	HasValue []string
+	Sort     string // key of recordSortOrders; "" lists records in ID order
+}
+
+// recordSortOrders maps the accepted sort keys for record listings to ORDER BY clauses.
+// Records stored before line numbers were kept sort last.
+var recordSortOrders = map[string]string{
+	"":            "id",
+	"id":          "id",
+	"lineNumber":  "line_number NULLS LAST, id",
+	"-lineNumber": "line_number DESC NULLS LAST, id DESC",
+}
+
+// ValidRecordSort reports whether sort is an accepted sort key for record listings
+func ValidRecordSort(sort string) bool {
+	_, ok := recordSortOrders[sort]
+	return ok
+}
+
+// orderBy returns the ORDER BY clause of the filter's sort
+func (f *RecordFilter) orderBy() string {
+	if order, ok := recordSortOrders[f.Sort]; ok {
+		return order
+	}
+	return "id"
+}
+
+// Empty reports whether the filter keeps every record of the active generation
+func (f *RecordFilter) Empty() bool {
+	return f.Query == "" && f.Group == "" && !f.HasWarnings && !f.HasViolations &&
+		f.CreatedAfter == nil && f.CreatedBefore == nil && !f.Previous && !f.FiltersFields()
+}
+
+// FiltersFields reports whether the filter matches on cleaned column values
+func (f *RecordFilter) FiltersFields() bool {
+	return len(f.Equals) > 0 || len(f.HasValue) > 0
+}
+
+// recordWhere builds the WHERE clause of filter over the given files, looking up the
+// columns its search matches complete values against
+func (s *DBService) recordWhere(fileIDs []int, filter *RecordFilter) (string, []interface{}, error) {
+	valueColumns, err := s.searchValueColumns(fileIDs, filter)
+	if err != nil {
+		return "", nil, err
+	}
+	where, args, err := filter.whereClause(fileIDs, s.tsqueryFunc(), valueColumns)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", models.ErrInvalidSearchQuery, err)
+	}
+	return where, args, nil
+}
+
+// searchValueColumns returns the unencrypted columns of the given files when the
+// filter's full-text search has a term that looks like a complete value, or nil when
+// it has none. Encrypted values never equal the term, so they are left out.
+func (s *DBService) searchValueColumns(fileIDs []int, filter *RecordFilter) ([]string, error) {
+	if filter.Query == "" || filter.Substring || filter.Previous {
+		return nil, nil
+	}
+	parsed, err := ParseSearchQuery(filter.Query)
+	if err != nil || !parsed.hasValueTerms() {
+		return nil, nil // whereClause reports the syntax error
+	}
+
+	var columns []string
+	seen := make(map[string]bool)
+	for _, fileID := range fileIDs {
+		headers, err := s.GetFileHeaders(fileID)
+		if err != nil {
+			return nil, err
+		}
+		for _, header := range headers {
+			if !seen[header] && !s.IsEncryptedColumn(header) {
+				seen[header] = true
+				columns = append(columns, header)
+			}
+		}
+	}
+	return columns, nil
+}
+
+// whereClause builds the WHERE clause selecting the records of one file, or of the
+// files of a dataset, under this filter. Previous only applies to a single file.
+// valueColumns are the columns search terms that look like complete values are
+// matched against; without them every term is matched as a substring.
+func (f *RecordFilter) whereClause(fileIDs []int, tsqueryFunc string, valueColumns []string) (string, []interface{}, error) {
+	if len(fileIDs) != 1 && f.Previous {
+		return "", nil, fmt.Errorf("the previous generation can only be read for a single file")
+	}
+	where := "WHERE csv_file_id = $1 AND " + activeGeneration("$1")
+	if f.Previous {
+		where = "WHERE csv_file_id = $1 AND generation = (SELECT active_generation - 1 FROM csv_files WHERE id = $1)"
+	}
+	var args []interface{}
+	searchConfig := fileSearchConfig
+	if len(fileIDs) == 1 {
+		args = append(args, fileIDs[0])
+	} else {
+		where = "WHERE " + activeGenerations("$1")
+		args = append(args, pq.Array(fileIDs))
+		searchConfig = recordSearchConfig
+	}
+
+	if f.Query != "" && f.Substring {
+		// Served by the trigram index on cleaned_data::text when pg_trgm is installed
+		args = append(args, "%"+escapeLike(f.Query)+"%")
+		where += fmt.Sprintf(" AND (cleaned_data::text ILIKE $%d OR grouped_category ILIKE $%d)", len(args), len(args))
+	} else if f.Query != "" {
+		parsed, err := ParseSearchQuery(f.Query)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, f.Query)
+		var like string
+		like, args = parsed.likePredicate(args, valueColumns)
+		where += " AND (search_vector @@ " + tsqueryFunc + "(" + searchConfig + ", $2) OR " + like + ")"
+	}
+	if f.Group != "" {
+		args = append(args, f.Group)
+		where += fmt.Sprintf(" AND $%d = ANY(%s)", len(args), groupedCategoriesColumn)
+	}
+	if f.HasWarnings {
+		where += " AND warning_count > 0"
+	}
+	if f.HasViolations {
+		where += " AND violation_count > 0"
+	}
+	where, args = createdAtBounds(where, args, f.CreatedAfter, f.CreatedBefore)
+	if len(f.Equals) > 0 {
+		// A single containment test lets the jsonb_path_ops index serve every equality
+		contained, err := json.Marshal(f.Equals)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to encode field filters: %w", err)
+		}
+		args = append(args, string(contained))
+		where += fmt.Sprintf(" AND cleaned_data @> $%d::jsonb", len(args))
+	}
+	for _, column := range f.HasValue {
+		args = append(args, column)
+		where += fmt.Sprintf(" AND cleaned_data ? $%d AND NOT cleaned_data @> jsonb_build_object($%d::text, '')", len(args), len(args))
+	}
+	return where, args, nil
+}
+
+// createdAtBounds adds the optional inclusive created_at bounds to a WHERE clause
+func createdAtBounds(where string, args []interface{}, after, before *time.Time) (string, []interface{}) {
+	if after != nil {
+		args = append(args, *after)
+		where += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if before != nil {
+		args = append(args, *before)
+		where += fmt.Sprintf(" AND created_at <= $%d", len(args))
+	}
+	return where, args
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// tsqueryFunc returns websearch_to_tsquery when the server has it (PostgreSQL 11+),
+// falling back to plainto_tsquery, which ignores quotes, OR and negation
+func (s *DBService) tsqueryFunc() string {
+	s.tsqueryOnce.Do(func() {
+		s.tsquery = "plainto_tsquery"
+		var available bool
+		err := s.db.QueryRow(`SELECT to_regproc('websearch_to_tsquery') IS NOT NULL`).Scan(&available)
+		if err != nil {
+			log.Printf("Error checking for websearch_to_tsquery: %v", err)
+		} else if available {
+			s.tsquery = "websearch_to_tsquery"
+		}
+	})
+	return s.tsquery
+}
+
+// SampleRecords draws up to n of a file's records matching filter in an order fixed
+// by seed, so the same seed always yields the same sample. It also returns how many
+// records matched.
+func (s *DBService) SampleRecords(fileID int, filter *RecordFilter, n int, seed int64, projection *RecordProjection) ([]*models.Record, int, error) {
+	release, err := s.heavy.Acquire()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+
+	where, args, err := s.recordWhere([]int{fileID}, filter)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return file, nil
-}
-
-// GetRecordsByFileID retrieves all records for a specific CSV file with pagination
-func (s *DBService) GetRecordsByFileID(fileID int, limit, offset int) ([]*models.Record, int, error) {
-	// Get total count
 	var totalCount int
-	countQuery := `SELECT COUNT(*) FROM records WHERE csv_file_id = $1`
-	err := s.db.QueryRow(countQuery, fileID).Scan(&totalCount)
-	if err != nil {
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM records `+where, args...).Scan(&totalCount); err != nil {
 		return nil, 0, fmt.Errorf("failed to get record count: %w", err)
 	}
 
-	// Get paginated records
-	query := `
-		SELECT id, csv_file_id, original_data, cleaned_data, 
-		       COALESCE(grouped_category, ''), created_at
+	args = append(args, seed, n)
+	seedArg, limitArg := len(args)-1, len(args)
+	columns, args := projection.selectColumns(args)
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM records
-		WHERE csv_file_id = $1
-		ORDER BY id
-		LIMIT $2 OFFSET $3
-	`
+		%s
+		ORDER BY md5(id::text || ':' || $%d::text), id
+		LIMIT $%d
+	`, columns, where, seedArg, limitArg)
 
-	rows, err := s.db.Query(query, fileID, limit, offset)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to query records: %w", err)
+		return nil, 0, fmt.Errorf("failed to sample records: %w", err)
 	}
 	defer rows.Close()
 
@@ -251,45 +1378,49 @@ func (s *DBService) GetRecordsByFileID(fileID int, limit, offset int) ([]*models
 	return records, totalCount, nil
 }
 
-// SearchRecords performs full-text search on records for a specific file with pagination
-func (s *DBService) SearchRecords(fileID int, query string, limit, offset int) ([]*models.Record, int, error) {
-	likePattern := "%" + query + "%"
+// HasTrigramSupport reports whether the pg_trgm extension is installed
+func (s *DBService) HasTrigramSupport() (bool, error) {
+	var installed bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')`).Scan(&installed)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for pg_trgm: %w", err)
+	}
+	return installed, nil
+}
 
-	// Get total count of matching records
-	var totalCount int
-	countQuery := `
-		SELECT COUNT(*)
-		FROM records
-		WHERE csv_file_id = $1 
-		  AND (
-		    search_vector @@ plainto_tsquery('english', $2)
-		    OR cleaned_data::text ILIKE $3
-		    OR grouped_category ILIKE $3
-		  )
-	`
-	err := s.db.QueryRow(countQuery, fileID, query, likePattern).Scan(&totalCount)
+// FilterRecords retrieves a page of the records of the given files matching filter,
+// along with the total number matching
+func (s *DBService) FilterRecords(fileIDs []int, filter *RecordFilter, limit, offset int, projection *RecordProjection) ([]*models.Record, int, error) {
+	release, err := s.heavy.Acquire()
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get search count: %w", err)
+		return nil, 0, err
+	}
+	defer release()
+
+	where, args, err := s.recordWhere(fileIDs, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var totalCount int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM records `+where, args...).Scan(&totalCount); err != nil {
+		return nil, 0, fmt.Errorf("failed to get record count: %w", err)
 	}
 
-	// Get paginated search results
-	sqlQuery := `
-		SELECT id, csv_file_id, original_data, cleaned_data, 
-		       COALESCE(grouped_category, ''), created_at
+	args = append(args, limit, offset)
+	limitArg, offsetArg := len(args)-1, len(args)
+	columns, args := projection.selectColumns(args)
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM records
-		WHERE csv_file_id = $1 
-		  AND (
-		    search_vector @@ plainto_tsquery('english', $2)
-		    OR cleaned_data::text ILIKE $3
-		    OR grouped_category ILIKE $3
-		  )
-		ORDER BY id
-		LIMIT $4 OFFSET $5
-	`
+		%s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, columns, where, filter.orderBy(), limitArg, offsetArg)
 
-	rows, err := s.db.Query(sqlQuery, fileID, query, likePattern, limit, offset)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to search records: %w", err)
+		return nil, 0, fmt.Errorf("failed to query records: %w", err)
 	}
 	defer rows.Close()
 
@@ -301,13 +1432,91 @@ func (s *DBService) SearchRecords(fileID int, query string, limit, offset int) (
 	return records, totalCount, nil
 }
 
+// AttachViolations loads the column rule violations of the given records of a file
+func (s *DBService) AttachViolations(fileID int, records []*models.Record) error {
+	byRow := make(map[int]*models.Record, len(records))
+	rowNumbers := make([]int64, 0, len(records))
+	for _, record := range records {
+		if record.RowNumber > 0 {
+			byRow[record.RowNumber] = record
+			rowNumbers = append(rowNumbers, int64(record.RowNumber))
+		}
+	}
+	if len(rowNumbers) == 0 {
+		return nil
+	}
+
+	query := `
+		SELECT record_id, column_name, rule, COALESCE(value, '')
+		FROM record_violations
+		WHERE csv_file_id = $1 AND record_id = ANY($2)
+		ORDER BY record_id, column_name
+	`
+	rows, err := s.db.Query(query, fileID, pq.Int64Array(rowNumbers))
+	if err != nil {
+		return fmt.Errorf("failed to query violations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		violation := &models.Violation{}
+		if err := rows.Scan(&violation.RecordID, &violation.Column, &violation.Rule, &violation.Value); err != nil {
+			return fmt.Errorf("failed to scan violation: %w", err)
+		}
+		if record, ok := byRow[violation.RecordID]; ok {
+			record.Violations = append(record.Violations, violation)
+		}
+	}
+	return nil
+}
+
+// RecordProjection limits which record fields are loaded from the database.
+// A nil projection loads everything.
+type RecordProjection struct {
+	Fields          []string // cleaned/original data keys to keep; nil keeps all
+	IncludeOriginal bool
+}
+
+// selectColumns returns the SELECT list for records under this projection, appending
+// any parameters it references to args. Filtering happens in SQL so unwanted keys
+// never leave the database.
+func (p *RecordProjection) selectColumns(args []interface{}) (string, []interface{}) {
+	originalColumn := "original_data"
+	cleanedColumn := "cleaned_data"
+
+	if p != nil {
+		if p.Fields != nil {
+			args = append(args, pq.Array(p.Fields))
+			placeholder := len(args)
+			originalColumn = fmt.Sprintf(
+				"(SELECT COALESCE(jsonb_object_agg(key, value), '{}'::jsonb) FROM jsonb_each(original_data) WHERE key = ANY($%d))",
+				placeholder)
+			cleanedColumn = fmt.Sprintf(
+				"(SELECT COALESCE(jsonb_object_agg(key, value), '{}'::jsonb) FROM jsonb_each(cleaned_data) WHERE key = ANY($%d))",
+				placeholder)
+		}
+		if !p.IncludeOriginal {
+			originalColumn = "NULL::jsonb"
+		}
+	}
+
+	columns := fmt.Sprintf("id, csv_file_id, %s, %s, COALESCE(grouped_category, ''), "+groupedCategoriesColumn+", created_at, COALESCE(row_number, 0), COALESCE(line_number, 0), warnings, pii_hashes, COALESCE(natural_key, '')",
+		originalColumn, cleanedColumn)
+	return columns, args
+}
+
+// groupedCategoriesColumn reads every group of a record, falling back to its primary
+// group for records stored before grouped_categories existed
+const groupedCategoriesColumn = "COALESCE(grouped_categories, ARRAY_REMOVE(ARRAY[NULLIF(grouped_category, '')], NULL))"
+
 // scanRecords is a helper function to scan rows into Record structs
 func (s *DBService) scanRecords(rows *sql.Rows) ([]*models.Record, error) {
 	records := make([]*models.Record, 0)
 
 	for rows.Next() {
 		record := &models.Record{}
-		var originalJSON, cleanedJSON []byte
+		var originalJSON, cleanedJSON, warningsJSON, hashesJSON []byte
+		var groupedCategories pq.StringArray
 
 		err := rows.Scan(
 			&record.ID,
@@ -315,15 +1524,38 @@ func (s *DBService) scanRecords(rows *sql.Rows) ([]*models.Record, error) {
 			&originalJSON,
 			&cleanedJSON,
 			&record.GroupedCategory,
+			&groupedCategories,
 			&record.CreatedAt,
+			&record.RowNumber,
+			&record.LineNumber,
+			&warningsJSON,
+			&hashesJSON,
+			&record.NaturalKey,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan record: %w", err)
 		}
+		if len(groupedCategories) > 0 {
+			record.GroupedCategories = groupedCategories
+		}
 
-		// Parse JSON
-		json.Unmarshal(originalJSON, &record.OriginalData)
+		// Parse JSON (original data is NULL when excluded by a projection)
+		if originalJSON != nil {
+			json.Unmarshal(originalJSON, &record.OriginalData)
+		}
 		json.Unmarshal(cleanedJSON, &record.CleanedData)
+		if err := s.encryption.decrypt(record.OriginalData); err != nil {
+			return nil, fmt.Errorf("failed to decrypt record %d: %w", record.ID, err)
+		}
+		if err := s.encryption.decrypt(record.CleanedData); err != nil {
+			return nil, fmt.Errorf("failed to decrypt record %d: %w", record.ID, err)
+		}
+		if warningsJSON != nil {
+			json.Unmarshal(warningsJSON, &record.Warnings)
+		}
+		if hashesJSON != nil {
+			json.Unmarshal(hashesJSON, &record.PIIHashes)
+		}
 
 		records = append(records, record)
 	}
@@ -331,13 +1563,250 @@ func (s *DBService) scanRecords(rows *sql.Rows) ([]*models.Record, error) {
 	return records, nil
 }
 
-// GetGroupsByFileID retrieves grouped categories for a specific file
+// recordCursorBatchSize is how many records fetchRecords reads from its cursor at a time
+const recordCursorBatchSize = 1000
+
+// StreamRecords calls fn with every record of the given files matching filter, in batches and
+// in the filter's sort order. Records are read through a server-side cursor so memory use does not
+// grow with the file. Cancelling ctx stops the query.
+func (s *DBService) StreamRecords(ctx context.Context, fileIDs []int, filter *RecordFilter, projection *RecordProjection, fn func([]*models.Record) error) error {
+	release, err := s.heavy.Acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	where, args, err := s.recordWhere(fileIDs, filter)
+	if err != nil {
+		return err
+	}
+	columns, args := projection.selectColumns(args)
+
+	// Cursors only live inside a transaction
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`SELECT %s FROM records %s ORDER BY %s`, columns, where, filter.orderBy())
+	return s.fetchRecords(ctx, tx, query, args, fn)
+}
+
+// fetchRecords runs a records query through a cursor within tx, calling fn with each
+// batch of records it yields
+func (s *DBService) fetchRecords(ctx context.Context, tx *sql.Tx, query string, args []interface{}, fn func([]*models.Record) error) error {
+	if _, err := tx.ExecContext(ctx, `DECLARE records_cursor NO SCROLL CURSOR FOR `+query, args...); err != nil {
+		return fmt.Errorf("failed to open cursor: %w", err)
+	}
+
+	for {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf(`FETCH %d FROM records_cursor`, recordCursorBatchSize))
+		if err != nil {
+			return fmt.Errorf("failed to fetch records: %w", err)
+		}
+		records, err := s.scanRecords(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		if err := fn(records); err != nil {
+			return err
+		}
+	}
+}
+
+// StreamDiff calls fn for every cell of a file whose cleaned value differs from the
+// original, in record order. An empty field compares every column. The comparison
+// runs in the database so only changed cells are read.
+func (s *DBService) StreamDiff(fileID int, field string, fn func(models.DiffEntry) error) error {
+	release, err := s.heavy.Acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	query := `
+		SELECT r.id, o.key, o.value, COALESCE(r.cleaned_data ->> o.key, '')
+		FROM records r
+		CROSS JOIN LATERAL jsonb_each_text(r.original_data) AS o
+		WHERE r.csv_file_id = $1 AND r.` + activeGeneration("$1") + `
+		  AND ($2 = '' OR o.key = $2)
+		  AND o.value IS DISTINCT FROM r.cleaned_data ->> o.key
+		ORDER BY r.id, o.key
+	`
+	rows, err := s.db.Query(query, fileID, field)
+	if err != nil {
+		return fmt.Errorf("failed to query diff: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.DiffEntry
+		if err := rows.Scan(&entry.RecordID, &entry.Field, &entry.Original, &entry.Cleaned); err != nil {
+			return fmt.Errorf("failed to scan diff entry: %w", err)
+		}
+
+		// Encrypted cells always differ in the database; compare their plain text
+		if s.encryption != nil && s.encryption.isPII(entry.Field) {
+			original := map[string]string{entry.Field: entry.Original}
+			cleaned := map[string]string{entry.Field: entry.Cleaned}
+			if err := s.encryption.decrypt(original); err != nil {
+				return fmt.Errorf("failed to decrypt record %d: %w", entry.RecordID, err)
+			}
+			if err := s.encryption.decrypt(cleaned); err != nil {
+				return fmt.Errorf("failed to decrypt record %d: %w", entry.RecordID, err)
+			}
+			if original[entry.Field] == cleaned[entry.Field] {
+				continue
+			}
+			entry.Original, entry.Cleaned = original[entry.Field], cleaned[entry.Field]
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// maxCompareResults caps how many records each set of a file comparison holds
+const maxCompareResults = 1000
+
+// CompareFiles matches the records of two files on keyColumn and reports which keys
+// were added, removed or changed in fileB. Records without the key are ignored and
+// only the first record of a duplicated key is compared. The join runs in the database.
+func (s *DBService) CompareFiles(fileA, fileB int, keyColumn string) (*models.FileDiff, error) {
+	release, err := s.heavy.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	query := `
+		WITH a AS (
+			SELECT DISTINCT ON (cleaned_data ->> $3) cleaned_data ->> $3 AS key, cleaned_data - $4 AS data
+			FROM records
+			WHERE csv_file_id = $1 AND ` + activeGeneration("$1") + ` AND COALESCE(cleaned_data ->> $3, '') != ''
+			ORDER BY cleaned_data ->> $3, id
+		), b AS (
+			SELECT DISTINCT ON (cleaned_data ->> $3) cleaned_data ->> $3 AS key, cleaned_data - $4 AS data
+			FROM records
+			WHERE csv_file_id = $2 AND ` + activeGeneration("$2") + ` AND COALESCE(cleaned_data ->> $3, '') != ''
+			ORDER BY cleaned_data ->> $3, id
+		)
+		SELECT COALESCE(a.key, b.key), a.data, b.data
+		FROM a
+		FULL OUTER JOIN b ON a.key = b.key
+		WHERE a.key IS NULL OR b.key IS NULL OR a.data IS DISTINCT FROM b.data
+		ORDER BY 1
+	`
+	rows, err := s.db.Query(query, fileA, fileB, keyColumn, categoryInputKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare files: %w", err)
+	}
+	defer rows.Close()
+
+	diff := &models.FileDiff{
+		FileA:     fileA,
+		FileB:     fileB,
+		KeyColumn: keyColumn,
+		Added:     make([]map[string]string, 0),
+		Removed:   make([]map[string]string, 0),
+		Changed:   make([]*models.ChangedRecord, 0),
+	}
+	for rows.Next() {
+		var key string
+		var beforeJSON, afterJSON []byte
+		if err := rows.Scan(&key, &beforeJSON, &afterJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan comparison: %w", err)
+		}
+
+		var before, after map[string]string
+		if beforeJSON != nil {
+			json.Unmarshal(beforeJSON, &before)
+			if err := s.encryption.decrypt(before); err != nil {
+				return nil, fmt.Errorf("failed to decrypt key %s: %w", key, err)
+			}
+		}
+		if afterJSON != nil {
+			json.Unmarshal(afterJSON, &after)
+			if err := s.encryption.decrypt(after); err != nil {
+				return nil, fmt.Errorf("failed to decrypt key %s: %w", key, err)
+			}
+		}
+
+		switch {
+		case before == nil:
+			diff.AddedCount++
+			if len(diff.Added) < maxCompareResults {
+				diff.Added = append(diff.Added, after)
+			}
+		case after == nil:
+			diff.RemovedCount++
+			if len(diff.Removed) < maxCompareResults {
+				diff.Removed = append(diff.Removed, before)
+			}
+		default:
+			changedFields := changedColumns(before, after)
+			// Encrypted values always differ in the database
+			if len(changedFields) == 0 {
+				continue
+			}
+			diff.ChangedCount++
+			if len(diff.Changed) < maxCompareResults {
+				diff.Changed = append(diff.Changed, &models.ChangedRecord{
+					Key:           key,
+					Before:        before,
+					After:         after,
+					ChangedFields: changedFields,
+				})
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to compare files: %w", err)
+	}
+
+	diff.Truncated = diff.AddedCount > len(diff.Added) || diff.RemovedCount > len(diff.Removed) ||
+		diff.ChangedCount > len(diff.Changed)
+	return diff, nil
+}
+
+// changedColumns returns the sorted columns whose values differ between two records
+func changedColumns(before, after map[string]string) []string {
+	columns := make([]string, 0)
+	for column, value := range before {
+		if other, ok := after[column]; !ok || other != value {
+			columns = append(columns, column)
+		}
+	}
+	for column := range after {
+		if _, ok := before[column]; !ok {
+			columns = append(columns, column)
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// GetGroupsByFileID retrieves grouped categories for a specific file. A record
+// matching several groups is listed under each.
 func (s *DBService) GetGroupsByFileID(fileID int) (map[string][]int, error) {
+	release, err := s.heavy.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	query := `
-		SELECT grouped_category, array_agg(id ORDER BY id) as record_ids
-		FROM records
-		WHERE csv_file_id = $1 AND grouped_category IS NOT NULL AND grouped_category != ''
-		GROUP BY grouped_category
+		SELECT category, array_agg(id ORDER BY id) as record_ids
+		FROM records, UNNEST(` + groupedCategoriesColumn + `) AS category
+		WHERE csv_file_id = $1 AND ` + activeGeneration("$1") + ` AND category != ''
+		GROUP BY category
 	`
 
 	rows, err := s.db.Query(query, fileID)
@@ -368,67 +1837,292 @@ func (s *DBService) GetGroupsByFileID(fileID int) (map[string][]int, error) {
 	return groups, nil
 }
 
-// GetRecordsByGroup retrieves records for a specific group category with pagination
-func (s *DBService) GetRecordsByGroup(fileID int, groupCategory string, limit, offset int) ([]*models.Record, int, error) {
-	// First get total count for this group
+// GetGlobalCategoryStats aggregates grouped categories across all files, most used
+// first. A record matching several groups counts toward each.
+func (s *DBService) GetGlobalCategoryStats(scope OwnerScope) ([]*models.CategoryStat, error) {
+	release, err := s.heavy.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var args []interface{}
+	ownerFilter := ""
+	if condition := scope.condition("owner", &args); condition != "" {
+		ownerFilter = "AND csv_file_id IN (SELECT id FROM csv_files WHERE " + condition + ")"
+	}
+	query := `
+		SELECT category,
+		       COUNT(*),
+		       COUNT(DISTINCT csv_file_id),
+		       COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '7 days')
+		FROM records, UNNEST(` + groupedCategoriesColumn + `) AS category
+		WHERE category != '' AND ` + activeRecords + ` ` + ownerFilter + `
+		GROUP BY category
+		ORDER BY COUNT(*) DESC, category
+	`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query category stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make([]*models.CategoryStat, 0)
+	for rows.Next() {
+		stat := &models.CategoryStat{}
+		err := rows.Scan(&stat.Category, &stat.TotalRecords, &stat.FilesCount, &stat.RecordsLast7d)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan category stat: %w", err)
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, nil
+}
+
+// GetRecordsByGroup retrieves the records of the given files belonging to any of the
+// given group categories with pagination, along with how many records each group
+// holds across the files and the total number of matching records. Groups without
+// records are left out of the counts. A record matching several of the groups is
+// counted in each but returned, and counted in the total, once.
+func (s *DBService) GetRecordsByGroup(fileIDs []int, groupCategories []string, limit, offset int, projection *RecordProjection) ([]*models.Record, map[string]int, int, error) {
+	release, err := s.heavy.Acquire()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer release()
+
+	// First count each selected group
 	countQuery := `
+		SELECT category, COUNT(*)
+		FROM records, UNNEST(` + groupedCategoriesColumn + `) AS category
+		WHERE ` + activeGenerations("$1") + ` AND category = ANY($2)
+		GROUP BY category
+	`
+	countRows, err := s.db.Query(countQuery, pq.Array(fileIDs), pq.Array(groupCategories))
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to count group records: %w", err)
+	}
+	defer countRows.Close()
+
+	groupCounts := make(map[string]int)
+	for countRows.Next() {
+		var group string
+		var count int
+		if err := countRows.Scan(&group, &count); err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to scan group count: %w", err)
+		}
+		groupCounts[group] = count
+	}
+	if err := countRows.Err(); err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to count group records: %w", err)
+	}
+
+	var total int
+	err = s.db.QueryRow(`
 		SELECT COUNT(*)
 		FROM records
-		WHERE csv_file_id = $1 AND grouped_category = $2
-	`
-	var totalCount int
-	err := s.db.QueryRow(countQuery, fileID, groupCategory).Scan(&totalCount)
+		WHERE `+activeGenerations("$1")+` AND `+groupedCategoriesColumn+` && $2::text[]
+	`, pq.Array(fileIDs), pq.Array(groupCategories)).Scan(&total)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to count group records: %w", err)
+		return nil, nil, 0, fmt.Errorf("failed to count group records: %w", err)
 	}
 
 	// Then get paginated records
-	query := `
-		SELECT id, csv_file_id, original_data, cleaned_data, grouped_category, created_at
+	args := []interface{}{pq.Array(fileIDs), pq.Array(groupCategories), limit, offset}
+	columns, args := projection.selectColumns(args)
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM records
-		WHERE csv_file_id = $1 AND grouped_category = $2
+		WHERE `+activeGenerations("$1")+` AND `+groupedCategoriesColumn+` && $2::text[]
 		ORDER BY id
 		LIMIT $3 OFFSET $4
+	`, columns)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to query group records: %w", err)
+	}
+	defer rows.Close()
+
+	records, err := s.scanRecords(rows)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	return records, groupCounts, total, nil
+}
+
+// GetGroupNames returns the distinct group categories of the records of the given
+// files, sorted
+func (s *DBService) GetGroupNames(fileIDs []int) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT DISTINCT category
+		FROM records, UNNEST(`+groupedCategoriesColumn+`) AS category
+		WHERE `+activeGenerations("$1")+` AND category != ''
+		ORDER BY category
+	`, pq.Array(fileIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group names: %w", err)
+	}
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan group name: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// GetFileHeaders returns the column names of a file, taken from its first record
+func (s *DBService) GetFileHeaders(fileID int) ([]string, error) {
+	query := `
+		SELECT jsonb_object_keys(cleaned_data)
+		FROM (
+			SELECT cleaned_data FROM records WHERE csv_file_id = $1 AND ` + activeGeneration("$1") + ` ORDER BY id LIMIT 1
+		) first_record
 	`
 
-	rows, err := s.db.Query(query, fileID, groupCategory, limit, offset)
+	rows, err := s.db.Query(query, fileID)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to query group records: %w", err)
+		return nil, fmt.Errorf("failed to query headers: %w", err)
 	}
 	defer rows.Close()
 
-	records := make([]*models.Record, 0)
+	headers := make([]string, 0)
 	for rows.Next() {
-		record := &models.Record{}
-		var originalDataJSON, cleanedDataJSON []byte
-		var groupedCategory sql.NullString
+		var header string
+		if err := rows.Scan(&header); err != nil {
+			return nil, fmt.Errorf("failed to scan header: %w", err)
+		}
+		headers = append(headers, header)
+	}
 
-		err := rows.Scan(
-			&record.ID,
-			&record.CSVFileID,
-			&originalDataJSON,
-			&cleanedDataJSON,
-			&groupedCategory,
-			&record.CreatedAt,
+	return headers, nil
+}
+
+// numericPattern matches cleaned values that can be safely cast to numeric
+const numericPattern = `^-?[0-9]+(\.[0-9]+)?$`
+
+// AggregateByColumn counts the records of the given files per distinct value of a
+// column, keeping the top `limit` buckets and folding the rest into a single "other"
+// bucket. When `of` is set, the sum of that column is computed over its numeric values
+// only.
+func (s *DBService) AggregateByColumn(fileIDs []int, by, of string, limit int) ([]*models.AggregateBucket, *models.AggregateBucket, error) {
+	release, err := s.heavy.Acquire()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+
+	query := `
+		WITH buckets AS (
+			SELECT COALESCE(cleaned_data->>$2, '') AS bucket,
+			       COUNT(*) AS record_count,
+			       SUM(CASE WHEN cleaned_data->>$3 ~ $4 THEN (cleaned_data->>$3)::numeric END) AS metric_sum,
+			       COUNT(*) FILTER (WHERE cleaned_data->>$3 ~ $4) AS numeric_count
+			FROM records
+			WHERE ` + activeGenerations("$1") + `
+			GROUP BY 1
+		), ranked AS (
+			SELECT *, ROW_NUMBER() OVER (ORDER BY record_count DESC, bucket) AS rank
+			FROM buckets
 		)
+		SELECT rank > $5 AS is_other,
+		       CASE WHEN rank > $5 THEN '' ELSE bucket END AS value,
+		       SUM(record_count), SUM(metric_sum), SUM(numeric_count)
+		FROM ranked
+		GROUP BY 1, 2
+		ORDER BY 1, 3 DESC, 2
+	`
+
+	rows, err := s.db.Query(query, pq.Array(fileIDs), by, of, numericPattern, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to aggregate records: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := make([]*models.AggregateBucket, 0)
+	var other *models.AggregateBucket
+	for rows.Next() {
+		bucket := &models.AggregateBucket{}
+		var isOther bool
+		var metricSum sql.NullFloat64
+
+		err := rows.Scan(&isOther, &bucket.Value, &bucket.Count, &metricSum, &bucket.NumericCount)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to scan record: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan aggregate bucket: %w", err)
 		}
 
-		// Parse JSON data
-		if err := json.Unmarshal(originalDataJSON, &record.OriginalData); err != nil {
-			return nil, 0, fmt.Errorf("failed to unmarshal original data: %w", err)
+		if metricSum.Valid {
+			bucket.Sum = &metricSum.Float64
 		}
-		if err := json.Unmarshal(cleanedDataJSON, &record.CleanedData); err != nil {
-			return nil, 0, fmt.Errorf("failed to unmarshal cleaned data: %w", err)
+
+		if isOther {
+			bucket.Value = "other"
+			other = bucket
+			continue
 		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, other, nil
+}
+
+// SampleCleanedValues returns up to limit distinct non-empty cleaned values across all files
+func (s *DBService) SampleCleanedValues(limit int) ([]string, error) {
+	query := `
+		SELECT DISTINCT value
+		FROM (SELECT cleaned_data FROM records WHERE ` + activeRecords + ` ORDER BY id DESC LIMIT $1) recent,
+		     jsonb_each_text(recent.cleaned_data)
+		WHERE value <> ''
+		LIMIT $1
+	`
+
+	rows, err := s.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample values: %w", err)
+	}
+	defer rows.Close()
 
-		if groupedCategory.Valid {
-			record.GroupedCategory = groupedCategory.String
+	values := make([]string, 0)
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, fmt.Errorf("failed to scan value: %w", err)
 		}
+		values = append(values, value)
+	}
 
-		records = append(records, record)
+	return values, nil
+}
+
+// GetColumnSample returns the cleaned data of up to limit records of a file in row
+// order. A limit of 0 returns every record.
+func (s *DBService) GetColumnSample(fileID int, limit int) ([]*models.Record, error) {
+	var limitArg interface{}
+	if limit > 0 {
+		limitArg = limit
 	}
 
-	return records, totalCount, nil
+	query := `
+		SELECT id, csv_file_id, NULL::jsonb, cleaned_data, COALESCE(grouped_category, ''), ` + groupedCategoriesColumn + `, created_at,
+		       COALESCE(row_number, 0), COALESCE(line_number, 0), warnings, pii_hashes, COALESCE(natural_key, '')
+		FROM records
+		WHERE csv_file_id = $1 AND ` + activeGeneration("$1") + `
+		ORDER BY id
+		LIMIT $2
+	`
+	rows, err := s.db.Query(query, fileID, limitArg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample records: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanRecords(rows)
 }
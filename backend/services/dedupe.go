@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"csv-processor/config"
+	"csv-processor/models"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxDedupeBlockSize skips blocking tokens shared by more records than this. Such
+// tokens ("manager", "inc") say little about duplicates and would make the pairwise
+// comparison within the block quadratic in the file size.
+const maxDedupeBlockSize = 500
+
+// Deduplicator finds clusters of likely duplicate records in the background
+type Deduplicator struct {
+	dbService  *DBService
+	maxRecords int
+}
+
+// NewDeduplicator creates a deduplicator storing its reports through dbService
+func NewDeduplicator(dbService *DBService) *Deduplicator {
+	return &Deduplicator{
+		dbService:  dbService,
+		maxRecords: config.GetEnvInt("DEDUPE_MAX_RECORDS", 200000),
+	}
+}
+
+// StartReport replaces a file's dedupe report with a running one and builds it in
+// the background. It fails if a report for the file is already running.
+func (d *Deduplicator) StartReport(ctx context.Context, fileID int, columns []string, threshold float64) (*models.DedupeReport, error) {
+	report, err := d.dbService.StartDedupeReport(fileID, columns, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	go d.buildReport(ctx, fileID, columns, threshold)
+	return report, nil
+}
+
+// buildReport clusters a file's records and stores the clusters on its report
+func (d *Deduplicator) buildReport(ctx context.Context, fileID int, columns []string, threshold float64) {
+	startTime := time.Now()
+	// The outcome is recorded even when the server is stopping
+	finishCtx := context.WithoutCancel(ctx)
+
+	records, err := d.dbService.GetColumnSample(fileID, d.maxRecords+1)
+	if err == nil && len(records) > d.maxRecords {
+		err = fmt.Errorf("file has more than %d records", d.maxRecords)
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		log.Printf("Error building dedupe report for file %d: %v", fileID, err)
+		d.dbService.FailDedupeReport(finishCtx, fileID, err.Error())
+		return
+	}
+
+	clusters := findDuplicateClusters(records, columns, threshold)
+	if err := d.dbService.CompleteDedupeReport(finishCtx, fileID, clusters); err != nil {
+		log.Printf("Error storing dedupe report for file %d: %v", fileID, err)
+		d.dbService.FailDedupeReport(finishCtx, fileID, err.Error())
+		return
+	}
+
+	log.Printf("Built dedupe report for file %d: %d clusters from %d records in %dms",
+		fileID, len(clusters), len(records), time.Since(startTime).Milliseconds())
+}
+
+// dedupeKey builds the lowercased similarity key of a record from the given columns
+func dedupeKey(record *models.Record, columns []string) string {
+	parts := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if value := strings.TrimSpace(record.CleanedData[column]); value != "" {
+			parts = append(parts, strings.ToLower(value))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// blockingKeys returns the blocks a key falls into: the first three letters of each
+// of its words. Only records sharing a block are compared.
+func blockingKeys(key string) []string {
+	seen := make(map[string]bool)
+	blocks := make([]string, 0)
+	for _, word := range strings.Fields(key) {
+		runes := []rune(word)
+		if len(runes) < 2 {
+			continue
+		}
+		if len(runes) > 3 {
+			runes = runes[:3]
+		}
+		if block := string(runes); !seen[block] {
+			seen[block] = true
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// findDuplicateClusters links records whose keys are at least threshold similar and
+// returns the groups of linked records, most confident first
+func findDuplicateClusters(records []*models.Record, columns []string, threshold float64) []*models.DedupeCluster {
+	keys := make([]string, len(records))
+	blocks := make(map[string][]int)
+	for i, record := range records {
+		keys[i] = dedupeKey(record, columns)
+		for _, block := range blockingKeys(keys[i]) {
+			blocks[block] = append(blocks[block], i)
+		}
+	}
+
+	// Union-find over record indexes, tracking the similarity of the linking pairs
+	parent := make([]int, len(records))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	type pair struct{ a, b int }
+	compared := make(map[pair]bool)
+	scoreSum := make(map[int]float64)
+	scoreCount := make(map[int]int)
+	for _, members := range blocks {
+		if len(members) < 2 || len(members) > maxDedupeBlockSize {
+			continue
+		}
+		for x := 0; x < len(members); x++ {
+			for y := x + 1; y < len(members); y++ {
+				a, b := members[x], members[y]
+				if compared[pair{a, b}] || keys[a] == "" || keys[b] == "" {
+					continue
+				}
+				compared[pair{a, b}] = true
+
+				score := calculateSimilarity(keys[a], keys[b])
+				if score < threshold {
+					continue
+				}
+				rootA, rootB := find(a), find(b)
+				if rootA != rootB {
+					parent[rootB] = rootA
+					scoreSum[rootA] += scoreSum[rootB]
+					scoreCount[rootA] += scoreCount[rootB]
+				}
+				scoreSum[rootA] += score
+				scoreCount[rootA]++
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	for i := range records {
+		root := find(i)
+		members[root] = append(members[root], records[i].ID)
+	}
+
+	clusters := make([]*models.DedupeCluster, 0)
+	for root, recordIDs := range members {
+		if len(recordIDs) < 2 {
+			continue
+		}
+		sort.Ints(recordIDs)
+		clusters = append(clusters, &models.DedupeCluster{
+			Confidence: scoreSum[root] / float64(scoreCount[root]),
+			RecordIDs:  recordIDs,
+		})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Confidence != clusters[j].Confidence {
+			return clusters[i].Confidence > clusters[j].Confidence
+		}
+		return clusters[i].RecordIDs[0] < clusters[j].RecordIDs[0]
+	})
+	return clusters
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"csv-processor/models"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// StartDedupeReport replaces a file's dedupe report and its clusters with a running
+// report. A report left running for over an hour (e.g. by a restart) is replaced too.
+func (s *DBService) StartDedupeReport(fileID int, columns []string, threshold float64) (*models.DedupeReport, error) {
+	columnsJSON, err := json.Marshal(columns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal dedupe columns: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	report := &models.DedupeReport{FileID: fileID, Status: "running", Columns: columns, Threshold: threshold}
+	query := `
+		INSERT INTO dedupe_reports (csv_file_id, status, columns, threshold)
+		VALUES ($1, 'running', $2, $3)
+		ON CONFLICT (csv_file_id) DO UPDATE
+		SET status = 'running', columns = EXCLUDED.columns, threshold = EXCLUDED.threshold,
+		    cluster_count = 0, error_message = NULL, created_at = CURRENT_TIMESTAMP, completed_at = NULL
+		WHERE dedupe_reports.status <> 'running' OR dedupe_reports.created_at < NOW() - INTERVAL '1 hour'
+		RETURNING created_at
+	`
+	err = tx.QueryRow(query, fileID, string(columnsJSON), threshold).Scan(&report.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrReportRunning
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start dedupe report: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM dedupe_clusters WHERE csv_file_id = $1`, fileID); err != nil {
+		return nil, fmt.Errorf("failed to delete dedupe clusters: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return report, nil
+}
+
+// CompleteDedupeReport stores the clusters of a file's running report. It does
+// nothing if the report no longer exists.
+func (s *DBService) CompleteDedupeReport(ctx context.Context, fileID int, clusters []*models.DedupeCluster) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The report is gone if the file was reprocessed in the meantime
+	query := `
+		UPDATE dedupe_reports
+		SET status = 'completed', cluster_count = $1, completed_at = CURRENT_TIMESTAMP
+		WHERE csv_file_id = $2 AND status = 'running'
+	`
+	result, err := tx.ExecContext(ctx, query, len(clusters), fileID)
+	if err != nil {
+		return fmt.Errorf("failed to complete dedupe report: %w", err)
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("dedupe_clusters", "csv_file_id", "confidence", "record_ids"))
+	if err != nil {
+		return fmt.Errorf("failed to prepare copy statement: %w", err)
+	}
+	for _, cluster := range clusters {
+		if _, err := stmt.ExecContext(ctx, fileID, cluster.Confidence, pq.Array(cluster.RecordIDs)); err != nil {
+			stmt.Close()
+			return fmt.Errorf("failed to copy dedupe cluster: %w", err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return fmt.Errorf("failed to flush dedupe clusters: %w", err)
+	}
+	stmt.Close()
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// FailDedupeReport marks a file's running report as failed
+func (s *DBService) FailDedupeReport(ctx context.Context, fileID int, errorMsg string) {
+	query := `
+		UPDATE dedupe_reports
+		SET status = 'failed', error_message = $1, completed_at = CURRENT_TIMESTAMP
+		WHERE csv_file_id = $2 AND status = 'running'
+	`
+	if _, err := s.db.ExecContext(ctx, query, errorMsg, fileID); err != nil {
+		log.Printf("Error marking dedupe report of file %d failed: %v", fileID, err)
+	}
+}
+
+// GetDedupeReport returns a file's dedupe report, or nil if none was requested
+func (s *DBService) GetDedupeReport(fileID int) (*models.DedupeReport, error) {
+	query := `
+		SELECT status, columns, threshold, cluster_count, COALESCE(error_message, ''), created_at, completed_at
+		FROM dedupe_reports
+		WHERE csv_file_id = $1
+	`
+	report := &models.DedupeReport{FileID: fileID}
+	var columnsJSON []byte
+	var completedAt sql.NullTime
+	err := s.db.QueryRow(query, fileID).Scan(
+		&report.Status,
+		&columnsJSON,
+		&report.Threshold,
+		&report.ClusterCount,
+		&report.ErrorMessage,
+		&report.CreatedAt,
+		&completedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dedupe report: %w", err)
+	}
+
+	json.Unmarshal(columnsJSON, &report.Columns)
+	if completedAt.Valid {
+		report.CompletedAt = &completedAt.Time
+	}
+	return report, nil
+}
+
+// GetDedupeClusters retrieves a page of a file's dedupe clusters, most confident first
+func (s *DBService) GetDedupeClusters(fileID int, limit, offset int) ([]*models.DedupeCluster, error) {
+	query := `
+		SELECT id, confidence, record_ids
+		FROM dedupe_clusters
+		WHERE csv_file_id = $1
+		ORDER BY confidence DESC, id
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := s.db.Query(query, fileID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dedupe clusters: %w", err)
+	}
+	defer rows.Close()
+
+	clusters := make([]*models.DedupeCluster, 0)
+	for rows.Next() {
+		cluster := &models.DedupeCluster{}
+		var recordIDs pq.Int64Array
+		if err := rows.Scan(&cluster.ID, &cluster.Confidence, &recordIDs); err != nil {
+			return nil, fmt.Errorf("failed to scan dedupe cluster: %w", err)
+		}
+		for _, id := range recordIDs {
+			cluster.RecordIDs = append(cluster.RecordIDs, int(id))
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, rows.Err()
+}
+
+// GetRecordsByIDs retrieves the given records of a file in ID order
+func (s *DBService) GetRecordsByIDs(fileID int, ids []int) ([]*models.Record, error) {
+	args := []interface{}{fileID, pq.Array(ids)}
+	var projection *RecordProjection
+	columns, args := projection.selectColumns(args)
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM records
+		WHERE csv_file_id = $1 AND `+activeGeneration("$1")+` AND id = ANY($2)
+		ORDER BY id
+	`, columns)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query records: %w", err)
+	}
+	defer rows.Close()
+
+	return s.scanRecords(rows)
+}
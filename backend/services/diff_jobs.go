@@ -0,0 +1,351 @@
+package services
+
+import (
+	"context"
+	"csv-processor/models"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// diffKinds are the sets a diff job sorts keys into, as stored in diff_entries.kind
+var diffKinds = []string{"added", "removed", "changed", "duplicates"}
+
+// ValidDiffKind reports whether kind names one of the sets of a diff job
+func ValidDiffKind(kind string) bool {
+	return containsString(diffKinds, kind)
+}
+
+// storedDiffEntry is a diff entry as stored in diff_entries
+type storedDiffEntry struct {
+	kind   string
+	key    string
+	detail *diffEntryDetail
+}
+
+// diffEntryDetail is the detail column of diff_entries. Values are copied from the
+// records as stored, so encrypted columns stay encrypted until read.
+type diffEntryDetail struct {
+	Data   map[string]string `json:"data,omitempty"`   // added and removed keys
+	Before map[string]string `json:"before,omitempty"` // changed columns of changed keys
+	After  map[string]string `json:"after,omitempty"`
+	CountA int               `json:"countA,omitempty"` // duplicate keys
+	CountB int               `json:"countB,omitempty"`
+}
+
+// Differ compares pairs of files in the background, storing each comparison as a
+// diff job
+type Differ struct {
+	dbService *DBService
+}
+
+// NewDiffer creates a differ storing its jobs through dbService
+func NewDiffer(dbService *DBService) *Differ {
+	return &Differ{dbService: dbService}
+}
+
+// StartJob records a running diff job of two files and computes it in the
+// background. Callers must check the key column exists in both files.
+func (d *Differ) StartJob(ctx context.Context, fileA, fileB int, keyColumn, owner string) (*models.DiffJob, error) {
+	job, err := d.dbService.CreateDiffJob(fileA, fileB, keyColumn, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	go d.runJob(ctx, job)
+	return job, nil
+}
+
+// runJob computes a diff job and stores its entries
+func (d *Differ) runJob(ctx context.Context, job *models.DiffJob) {
+	startTime := time.Now()
+	// The outcome is recorded even when the server is stopping
+	finishCtx := context.WithoutCancel(ctx)
+
+	entries, err := d.dbService.diffFiles(ctx, job.FileIDA, job.FileIDB, job.KeyColumn)
+	if err == nil {
+		err = d.dbService.CompleteDiffJob(finishCtx, job.ID, entries)
+	}
+	if err != nil {
+		log.Printf("Error building diff job %d: %v", job.ID, err)
+		d.dbService.FailDiffJob(finishCtx, job.ID, err.Error())
+		return
+	}
+
+	log.Printf("Built diff job %d of files %d and %d: %d differing keys in %dms",
+		job.ID, job.FileIDA, job.FileIDB, len(entries), time.Since(startTime).Milliseconds())
+}
+
+// diffFiles matches the records of two files on the cleaned value of keyColumn and
+// returns every key that was added, removed or changed from fileA to fileB. Keys
+// repeated within either file can't be matched reliably, so they are reported as
+// duplicates instead.
+func (s *DBService) diffFiles(ctx context.Context, fileA, fileB int, keyColumn string) ([]*storedDiffEntry, error) {
+	release, err := s.heavy.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	query := `
+		WITH a AS (
+			SELECT cleaned_data ->> $3 AS key, (array_agg(cleaned_data - $4 ORDER BY id))[1] AS data, COUNT(*) AS n
+			FROM records
+			WHERE csv_file_id = $1 AND ` + activeGeneration("$1") + ` AND COALESCE(cleaned_data ->> $3, '') != ''
+			GROUP BY 1
+		), b AS (
+			SELECT cleaned_data ->> $3 AS key, (array_agg(cleaned_data - $4 ORDER BY id))[1] AS data, COUNT(*) AS n
+			FROM records
+			WHERE csv_file_id = $2 AND ` + activeGeneration("$2") + ` AND COALESCE(cleaned_data ->> $3, '') != ''
+			GROUP BY 1
+		)
+		SELECT COALESCE(a.key, b.key), a.data, b.data, COALESCE(a.n, 0), COALESCE(b.n, 0)
+		FROM a
+		FULL OUTER JOIN b ON a.key = b.key
+		WHERE a.key IS NULL OR b.key IS NULL OR a.n > 1 OR b.n > 1 OR a.data IS DISTINCT FROM b.data
+		ORDER BY 1
+	`
+	rows, err := s.db.QueryContext(ctx, query, fileA, fileB, keyColumn, categoryInputKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff files: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]*storedDiffEntry, 0)
+	for rows.Next() {
+		var key string
+		var beforeJSON, afterJSON []byte
+		var countA, countB int
+		if err := rows.Scan(&key, &beforeJSON, &afterJSON, &countA, &countB); err != nil {
+			return nil, fmt.Errorf("failed to scan diff: %w", err)
+		}
+
+		if countA > 1 || countB > 1 {
+			entries = append(entries, &storedDiffEntry{kind: "duplicates", key: key, detail: &diffEntryDetail{CountA: countA, CountB: countB}})
+			continue
+		}
+
+		var before, after map[string]string
+		if beforeJSON != nil {
+			json.Unmarshal(beforeJSON, &before)
+		}
+		if afterJSON != nil {
+			json.Unmarshal(afterJSON, &after)
+		}
+
+		switch {
+		case before == nil:
+			entries = append(entries, &storedDiffEntry{kind: "added", key: key, detail: &diffEntryDetail{Data: after}})
+		case after == nil:
+			entries = append(entries, &storedDiffEntry{kind: "removed", key: key, detail: &diffEntryDetail{Data: before}})
+		default:
+			// Encrypted values always differ in the database, so compare them decrypted
+			plainBefore, plainAfter := copyData(before), copyData(after)
+			if err := s.encryption.decrypt(plainBefore); err != nil {
+				return nil, fmt.Errorf("failed to decrypt key %s: %w", key, err)
+			}
+			if err := s.encryption.decrypt(plainAfter); err != nil {
+				return nil, fmt.Errorf("failed to decrypt key %s: %w", key, err)
+			}
+			columns := changedColumns(plainBefore, plainAfter)
+			if len(columns) == 0 {
+				continue
+			}
+			detail := &diffEntryDetail{Before: make(map[string]string), After: make(map[string]string)}
+			for _, column := range columns {
+				if value, ok := before[column]; ok {
+					detail.Before[column] = value
+				}
+				if value, ok := after[column]; ok {
+					detail.After[column] = value
+				}
+			}
+			entries = append(entries, &storedDiffEntry{kind: "changed", key: key, detail: detail})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to diff files: %w", err)
+	}
+	return entries, nil
+}
+
+// copyData returns a copy of a record's data
+func copyData(data map[string]string) map[string]string {
+	copied := make(map[string]string, len(data))
+	for column, value := range data {
+		copied[column] = value
+	}
+	return copied
+}
+
+// diffJobColumns are the columns scanned by scanDiffJob
+const diffJobColumns = `id, file_a, file_b, key_column, status, added_count, removed_count, changed_count,
+	duplicate_count, COALESCE(error_message, ''), created_at, completed_at`
+
+// scanDiffJob reads a diff job selected with diffJobColumns
+func scanDiffJob(row rowScanner) (*models.DiffJob, error) {
+	job := &models.DiffJob{}
+	var completedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.FileIDA, &job.FileIDB, &job.KeyColumn, &job.Status,
+		&job.AddedCount, &job.RemovedCount, &job.ChangedCount, &job.DuplicateCount,
+		&job.ErrorMessage, &job.CreatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	return job, nil
+}
+
+// CreateDiffJob records a running diff job of two files
+func (s *DBService) CreateDiffJob(fileA, fileB int, keyColumn, owner string) (*models.DiffJob, error) {
+	row := s.db.QueryRow(`
+		INSERT INTO diff_jobs (file_a, file_b, key_column, owner, status)
+		VALUES ($1, $2, $3, $4, 'running')
+		RETURNING `+diffJobColumns, fileA, fileB, keyColumn, owner)
+	job, err := scanDiffJob(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create diff job: %w", err)
+	}
+	return job, nil
+}
+
+// CompleteDiffJob stores the entries of a running diff job and its counts. It does
+// nothing if the job no longer exists.
+func (s *DBService) CompleteDiffJob(ctx context.Context, jobID int, entries []*storedDiffEntry) error {
+	counts := make(map[string]int, len(diffKinds))
+	for _, entry := range entries {
+		counts[entry.kind]++
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The job is gone if one of its files was deleted in the meantime
+	query := `
+		UPDATE diff_jobs
+		SET status = 'completed', added_count = $1, removed_count = $2, changed_count = $3,
+		    duplicate_count = $4, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $5 AND status = 'running'
+	`
+	result, err := tx.ExecContext(ctx, query, counts["added"], counts["removed"], counts["changed"], counts["duplicates"], jobID)
+	if err != nil {
+		return fmt.Errorf("failed to complete diff job: %w", err)
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("diff_entries", "job_id", "kind", "key", "detail"))
+	if err != nil {
+		return fmt.Errorf("failed to prepare copy statement: %w", err)
+	}
+	for _, entry := range entries {
+		detail, err := json.Marshal(entry.detail)
+		if err != nil {
+			stmt.Close()
+			return fmt.Errorf("failed to marshal diff entry: %w", err)
+		}
+		if _, err := stmt.ExecContext(ctx, jobID, entry.kind, entry.key, string(detail)); err != nil {
+			stmt.Close()
+			return fmt.Errorf("failed to copy diff entry: %w", err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return fmt.Errorf("failed to flush diff entries: %w", err)
+	}
+	stmt.Close()
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// FailDiffJob marks a running diff job as failed
+func (s *DBService) FailDiffJob(ctx context.Context, jobID int, errorMsg string) {
+	query := `
+		UPDATE diff_jobs
+		SET status = 'failed', error_message = $1, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status = 'running'
+	`
+	if _, err := s.db.ExecContext(ctx, query, errorMsg, jobID); err != nil {
+		log.Printf("Error marking diff job %d failed: %v", jobID, err)
+	}
+}
+
+// GetDiffJob returns a diff job, or an error if it isn't visible in scope
+func (s *DBService) GetDiffJob(id int, scope OwnerScope) (*models.DiffJob, error) {
+	row := s.db.QueryRow(`SELECT `+diffJobColumns+` FROM diff_jobs WHERE id = $1 AND ($2 OR owner = $3)`,
+		id, scope.All, scope.Owner)
+	job, err := scanDiffJob(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("diff job not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diff job: %w", err)
+	}
+	return job, nil
+}
+
+// GetDiffEntries retrieves a page of one set of a diff job, ordered by key
+func (s *DBService) GetDiffEntries(jobID int, kind string, limit, offset int) ([]*models.DiffJobEntry, error) {
+	query := `
+		SELECT key, detail
+		FROM diff_entries
+		WHERE job_id = $1 AND kind = $2
+		ORDER BY key
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := s.db.Query(query, jobID, kind, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query diff entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]*models.DiffJobEntry, 0)
+	for rows.Next() {
+		entry := &models.DiffJobEntry{}
+		var detailJSON []byte
+		if err := rows.Scan(&entry.Key, &detailJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan diff entry: %w", err)
+		}
+
+		var detail diffEntryDetail
+		if err := json.Unmarshal(detailJSON, &detail); err != nil {
+			return nil, fmt.Errorf("failed to read diff entry %s: %w", entry.Key, err)
+		}
+		for _, data := range []map[string]string{detail.Data, detail.Before, detail.After} {
+			if err := s.encryption.decrypt(data); err != nil {
+				return nil, fmt.Errorf("failed to decrypt diff entry %s: %w", entry.Key, err)
+			}
+		}
+
+		entry.Data = detail.Data
+		entry.CountA, entry.CountB = detail.CountA, detail.CountB
+		if kind == "changed" {
+			entry.Changes = make(map[string]*models.ValueChange)
+			for column, value := range detail.Before {
+				entry.Changes[column] = &models.ValueChange{Old: value}
+			}
+			for column, value := range detail.After {
+				if change, ok := entry.Changes[column]; ok {
+					change.New = value
+				} else {
+					entry.Changes[column] = &models.ValueChange{New: value}
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDiffFiles(t *testing.T) {
+	db := testDBService(t)
+	before := storeFixture(t, db, "people.csv", "english")
+	after := storeFixture(t, db, "people_v2.csv", "english")
+
+	entries, err := db.diffFiles(context.Background(), before, after, "Name")
+	if err != nil {
+		t.Fatalf("diffFiles() error: %v", err)
+	}
+
+	// Margaret and Linus are unchanged
+	want := []struct{ kind, key string }{
+		{"changed", "Ada"},
+		{"duplicates", "Alan"},
+		{"added", "Barbara"},
+		{"removed", "Grace"},
+	}
+	if len(entries) != len(want) {
+		for _, entry := range entries {
+			t.Logf("%s %s %+v", entry.kind, entry.key, entry.detail)
+		}
+		t.Fatalf("diffFiles() returned %d entries, want %d", len(entries), len(want))
+	}
+	for i, entry := range entries {
+		if entry.kind != want[i].kind || entry.key != want[i].key {
+			t.Errorf("entry %d = %s %s, want %s %s", i, entry.kind, entry.key, want[i].kind, want[i].key)
+		}
+	}
+
+	changed := entries[0].detail
+	if len(changed.Before) != 1 || changed.Before["Title"] != "Project Manager" || changed.After["Title"] != "Engineering Manager" {
+		t.Errorf("changed Ada = %+v -> %+v, want only the title changed", changed.Before, changed.After)
+	}
+	if dup := entries[1].detail; dup.CountA != 1 || dup.CountB != 2 {
+		t.Errorf("duplicate Alan counted %d and %d times, want 1 and 2", dup.CountA, dup.CountB)
+	}
+	if added := entries[2].detail.Data; added["Title"] != "Systems Analyst" {
+		t.Errorf("added Barbara = %v, want her record", added)
+	}
+}
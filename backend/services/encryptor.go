@@ -0,0 +1,138 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// encryptedPrefix marks stored values produced by FieldEncryptor, so values written
+// before encryption was enabled are still read as plain text
+const encryptedPrefix = "enc:v1:"
+
+// defaultPIIFields are the columns encrypted at rest unless PII_FIELDS says otherwise
+var defaultPIIFields = []string{"name", "email", "phone", "address"}
+
+// FieldEncryptor encrypts individual cell values with AES-256-GCM
+type FieldEncryptor struct {
+	aead cipher.AEAD
+}
+
+// NewFieldEncryptor creates an encryptor from a base64-encoded 32-byte key
+func NewFieldEncryptor(encodedKey string) (*FieldEncryptor, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return &FieldEncryptor{aead: aead}, nil
+}
+
+// Encrypt seals plaintext with a random nonce and returns it base64-encoded
+func (e *FieldEncryptor) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := e.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt
+func (e *FieldEncryptor) Decrypt(ciphertext string) (string, error) {
+	if !strings.HasPrefix(ciphertext, encryptedPrefix) {
+		return "", fmt.Errorf("value is not encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+	if len(sealed) < e.aead.NonceSize() {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, sealed := sealed[:e.aead.NonceSize()], sealed[e.aead.NonceSize():]
+	plaintext, err := e.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// fieldEncryption applies a FieldEncryptor to the PII columns of records
+type fieldEncryption struct {
+	encryptor *FieldEncryptor
+	fields    map[string]struct{} // lowercased column names
+}
+
+func newFieldEncryption(encryptor *FieldEncryptor, fields []string) *fieldEncryption {
+	if len(fields) == 0 {
+		fields = defaultPIIFields
+	}
+	set := make(map[string]struct{}, len(fields))
+	for _, field := range fields {
+		if field = strings.ToLower(strings.TrimSpace(field)); field != "" {
+			set[field] = struct{}{}
+		}
+	}
+	return &fieldEncryption{encryptor: encryptor, fields: set}
+}
+
+// isPII reports whether column holds personal data
+func (f *fieldEncryption) isPII(column string) bool {
+	_, ok := f.fields[strings.ToLower(column)]
+	return ok
+}
+
+// encrypt returns a copy of data with its non-empty PII values encrypted
+func (f *fieldEncryption) encrypt(data map[string]string) (map[string]string, error) {
+	if f == nil || data == nil {
+		return data, nil
+	}
+
+	encrypted := make(map[string]string, len(data))
+	for column, value := range data {
+		if value != "" && f.isPII(column) {
+			sealed, err := f.encryptor.Encrypt(value)
+			if err != nil {
+				return nil, err
+			}
+			value = sealed
+		}
+		encrypted[column] = value
+	}
+	return encrypted, nil
+}
+
+// decrypt replaces the encrypted PII values of data with their plain text in place
+func (f *fieldEncryption) decrypt(data map[string]string) error {
+	if f == nil {
+		return nil
+	}
+	for column, value := range data {
+		if !f.isPII(column) || !strings.HasPrefix(value, encryptedPrefix) {
+			continue
+		}
+		plaintext, err := f.encryptor.Decrypt(value)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", column, err)
+		}
+		data[column] = plaintext
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"csv-processor/models"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// LookupTable holds the rows of a small lookup CSV by key, for joining onto records
+type LookupTable struct {
+	Columns    []string // lookup columns added to matching records
+	Duplicates int      // rows ignored because an earlier row had the same key
+	rows       map[string]map[string]string
+}
+
+// LoadLookupTable reads a lookup CSV keyed on keyColumn, keeping the given columns.
+// Column names match the lookup's header case-insensitively. The first row of a
+// repeated key wins. It fails when the table has more than maxRows rows.
+func LoadLookupTable(r io.Reader, keyColumn string, columns []string, maxRows int) (*LookupTable, error) {
+	reader := csv.NewReader(r)
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	headers, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("lookup table is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lookup header: %w", err)
+	}
+	index := func(column string) int {
+		for i, header := range headers {
+			if strings.EqualFold(strings.TrimSpace(header), strings.TrimSpace(column)) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	keyIndex := index(keyColumn)
+	if keyIndex < 0 {
+		return nil, fmt.Errorf("lookup table has no column %q", keyColumn)
+	}
+	table := &LookupTable{rows: make(map[string]map[string]string)}
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		if indexes[i] = index(column); indexes[i] < 0 {
+			return nil, fmt.Errorf("lookup table has no column %q", column)
+		}
+		table.Columns = append(table.Columns, strings.TrimSpace(headers[indexes[i]]))
+	}
+
+	for rowCount := 0; ; rowCount++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lookup row %d: %w", rowCount+2, err)
+		}
+		if rowCount >= maxRows {
+			return nil, fmt.Errorf("lookup table has more than %d rows", maxRows)
+		}
+
+		key := strings.TrimSpace(cell(row, keyIndex))
+		if key == "" {
+			continue
+		}
+		if _, ok := table.rows[key]; ok {
+			table.Duplicates++
+			continue
+		}
+		values := make(map[string]string, len(indexes))
+		for i, column := range table.Columns {
+			values[column] = strings.TrimSpace(cell(row, indexes[i]))
+		}
+		table.rows[key] = values
+	}
+	return table, nil
+}
+
+// cell returns field i of row, or "" for short rows
+func cell(row []string, i int) string {
+	if i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+// EnrichOptions describes how a lookup table is joined onto a file's records
+type EnrichOptions struct {
+	JoinColumn string  // record column holding the lookup key
+	Default    *string // value of the added columns on unmatched records; nil leaves them blank
+}
+
+// EnrichRecords adds the lookup table's columns to the cleaned data of every current
+// record of a file, matched on the join column. All records are updated in one
+// transaction, and the column stats of the file are extended to the new columns.
+func (s *DBService) EnrichRecords(ctx context.Context, fileID int, lookup *LookupTable, opts EnrichOptions) (*models.EnrichResult, error) {
+	release, err := s.heavy.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Reprocessing waits for this lock, so the records can't be replaced underneath us
+	var status string
+	var statsJSON []byte
+	err = tx.QueryRowContext(ctx, `SELECT status, column_stats FROM csv_files WHERE id = $1 FOR UPDATE`, fileID).Scan(&status, &statsJSON)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("CSV file not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CSV file: %w", err)
+	}
+	if status != "completed" {
+		return nil, fmt.Errorf("file is %s, only completed files can be enriched", status)
+	}
+
+	result := &models.EnrichResult{
+		FileID:              fileID,
+		JoinColumn:          opts.JoinColumn,
+		ColumnsAdded:        lookup.Columns,
+		DuplicateLookupKeys: lookup.Duplicates,
+	}
+	added := make(map[string]*models.ColumnStat, len(lookup.Columns))
+	for _, column := range lookup.Columns {
+		added[column] = &models.ColumnStat{}
+	}
+
+	unmatched := make(map[string]string, len(lookup.Columns))
+	for _, column := range lookup.Columns {
+		if opts.Default != nil {
+			unmatched[column] = *opts.Default
+		} else {
+			unmatched[column] = ""
+		}
+	}
+
+	// Only the join column needs to be read
+	projection := &RecordProjection{Fields: []string{opts.JoinColumn}}
+	columns, args := projection.selectColumns([]interface{}{fileID})
+	query := fmt.Sprintf(`SELECT %s FROM records WHERE csv_file_id = $1 AND %s ORDER BY id`, columns, activeGeneration("$1"))
+
+	err = s.fetchRecords(ctx, tx, query, args, func(records []*models.Record) error {
+		ids := make([]int, 0, len(records))
+		data := make([]string, 0, len(records))
+		for _, record := range records {
+			values, ok := lookup.rows[strings.TrimSpace(record.CleanedData[opts.JoinColumn])]
+			if ok {
+				result.Matched++
+			} else {
+				result.Unmatched++
+				values = unmatched
+			}
+			for column, value := range values {
+				if strings.TrimSpace(value) != "" {
+					added[column].NonEmpty++
+				} else {
+					added[column].Empty++
+				}
+			}
+
+			encrypted, err := s.encryption.encrypt(values)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt record %d: %w", record.ID, err)
+			}
+			encoded, err := json.Marshal(encrypted)
+			if err != nil {
+				return fmt.Errorf("failed to marshal record %d: %w", record.ID, err)
+			}
+			ids = append(ids, record.ID)
+			data = append(data, string(encoded))
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			UPDATE records r
+			SET cleaned_data = r.cleaned_data || u.data::jsonb
+			FROM unnest($1::int[], $2::text[]) AS u(id, data)
+			WHERE r.id = u.id
+		`, pq.Array(ids), pq.Array(data))
+		if err != nil {
+			return fmt.Errorf("failed to update records: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The new columns count towards the file's completeness like uploaded ones
+	stats := make(map[string]*models.ColumnStat)
+	if statsJSON != nil {
+		json.Unmarshal(statsJSON, &stats)
+	}
+	total := result.Matched + result.Unmatched
+	for column, stat := range added {
+		if total > 0 {
+			stat.Completeness = float64(stat.NonEmpty) / float64(total)
+		}
+		stats[column] = stat
+	}
+	completeness := 0.0
+	if total > 0 && len(stats) > 0 {
+		nonEmpty := 0
+		for _, stat := range stats {
+			nonEmpty += stat.NonEmpty
+		}
+		completeness = float64(nonEmpty) / float64(total*len(stats))
+	}
+	encodedStats, err := json.Marshal(stats)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal column stats: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE csv_files SET completeness_score = $1, column_stats = $2 WHERE id = $3`,
+		completeness, string(encodedStats), fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update CSV file stats: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"csv-processor/models"
+	"sync"
+	"sync/atomic"
+)
+
+// subscriberBuffer is how many updates a subscriber can fall behind before
+// further updates to it are dropped
+const subscriberBuffer = 32
+
+// EventBus fans file updates out to live subscribers such as SSE connections
+type EventBus struct {
+	subscribers sync.Map // subscription ID -> chan models.FileUpdate
+	nextID      atomic.Int64
+}
+
+// NewEventBus creates an event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe returns a channel receiving every update published from now on and a
+// function that ends the subscription
+func (b *EventBus) Subscribe() (<-chan models.FileUpdate, func()) {
+	id := b.nextID.Add(1)
+	updates := make(chan models.FileUpdate, subscriberBuffer)
+	b.subscribers.Store(id, updates)
+	return updates, func() {
+		b.subscribers.Delete(id)
+	}
+}
+
+// Publish sends an update to every subscriber without waiting on slow ones
+func (b *EventBus) Publish(update models.FileUpdate) {
+	b.subscribers.Range(func(_, value interface{}) bool {
+		select {
+		case value.(chan models.FileUpdate) <- update:
+		default:
+		}
+		return true
+	})
+}
+
+// publishStatus announces that a file now has the given status
+func (b *EventBus) publishStatus(fileID int, status string) {
+	if b == nil {
+		return
+	}
+	b.Publish(models.FileUpdate{Type: "file_updated", FileID: fileID, Status: status})
+}
+
+// publishEvent announces an event added to a file's timeline
+func (b *EventBus) publishEvent(event *models.FileEvent) {
+	if b == nil {
+		return
+	}
+	b.Publish(models.FileUpdate{Type: "file_event", FileID: event.CSVFileID, Event: event})
+}
@@ -0,0 +1,534 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Expressions are small formulas over a row's cleaned values, used by computed
+// columns and row filters:
+//
+//	first_name + " " + last_name
+//	upper(trim(city))
+//	if(revenue < 1000, "Small", if(revenue < 10000, "Medium", "Large"))
+//	status == "active" and (date >= "2023-01-01" or notes contains "keep")
+//
+// Bare names and [bracketed names] refer to columns, matched like other configured
+// columns. + concatenates, trim/upper/lower transform text, and if picks a value by
+// a condition. Conditions compare values (<, <=, >, >=, ==, !=, contains) and
+// combine with and/or. Ordering comparisons are numeric, or between dates in the
+// run's date output format or ISO format; equality compares numbers numerically and text case-insensitively, and contains
+// matches text case-insensitively.
+
+// exprValue is the result of evaluating an expression: text, or the truth of a
+// comparison
+type exprValue struct {
+	text  string
+	truth bool
+}
+
+// exprNode is a node of a parsed expression
+type exprNode interface {
+	eval(row map[string]string) (exprValue, error)
+	isCondition() bool
+}
+
+type literalNode struct{ text string }
+
+func (n *literalNode) eval(map[string]string) (exprValue, error) { return exprValue{text: n.text}, nil }
+func (n *literalNode) isCondition() bool                         { return false }
+
+type columnNode struct {
+	reference string // name as written
+	key       string // cleaned header it resolved to
+}
+
+func (n *columnNode) eval(row map[string]string) (exprValue, error) {
+	return exprValue{text: row[n.key]}, nil
+}
+func (n *columnNode) isCondition() bool { return false }
+
+type concatNode struct{ parts []exprNode }
+
+func (n *concatNode) eval(row map[string]string) (exprValue, error) {
+	var builder strings.Builder
+	for _, part := range n.parts {
+		value, err := part.eval(row)
+		if err != nil {
+			return exprValue{}, err
+		}
+		builder.WriteString(value.text)
+	}
+	return exprValue{text: builder.String()}, nil
+}
+func (n *concatNode) isCondition() bool { return false }
+
+type transformNode struct {
+	fn  func(string) string
+	arg exprNode
+}
+
+func (n *transformNode) eval(row map[string]string) (exprValue, error) {
+	value, err := n.arg.eval(row)
+	if err != nil {
+		return exprValue{}, err
+	}
+	return exprValue{text: n.fn(value.text)}, nil
+}
+func (n *transformNode) isCondition() bool { return false }
+
+type ifNode struct{ cond, then, otherwise exprNode }
+
+func (n *ifNode) eval(row map[string]string) (exprValue, error) {
+	cond, err := n.cond.eval(row)
+	if err != nil {
+		return exprValue{}, err
+	}
+	if cond.truth {
+		return n.then.eval(row)
+	}
+	return n.otherwise.eval(row)
+}
+func (n *ifNode) isCondition() bool { return false }
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+	dateLayout  string // of the run's cleaned dates, set by bindColumns
+}
+
+func (n *compareNode) eval(row map[string]string) (exprValue, error) {
+	left, err := n.left.eval(row)
+	if err != nil {
+		return exprValue{}, err
+	}
+	right, err := n.right.eval(row)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	leftNum, leftErr := strconv.ParseFloat(strings.TrimSpace(left.text), 64)
+	rightNum, rightErr := strconv.ParseFloat(strings.TrimSpace(right.text), 64)
+	numeric := leftErr == nil && rightErr == nil
+	switch n.op {
+	case "==":
+		return exprValue{truth: numeric && leftNum == rightNum || !numeric && strings.EqualFold(left.text, right.text)}, nil
+	case "!=":
+		return exprValue{truth: !(numeric && leftNum == rightNum || !numeric && strings.EqualFold(left.text, right.text))}, nil
+	case "contains":
+		return exprValue{truth: strings.Contains(strings.ToLower(left.text), strings.ToLower(right.text))}, nil
+	}
+
+	// Values that aren't both numbers are ordered as dates
+	var order int
+	switch {
+	case numeric:
+		order = compareFloats(leftNum, rightNum)
+	default:
+		leftDate, ok := n.parseDate(left.text)
+		if !ok {
+			return exprValue{}, fmt.Errorf("%q is not a number or date", left.text)
+		}
+		rightDate, ok := n.parseDate(right.text)
+		if !ok {
+			return exprValue{}, fmt.Errorf("%q is not a number or date", right.text)
+		}
+		order = leftDate.Compare(rightDate)
+	}
+	switch n.op {
+	case "<":
+		return exprValue{truth: order < 0}, nil
+	case "<=":
+		return exprValue{truth: order <= 0}, nil
+	case ">":
+		return exprValue{truth: order > 0}, nil
+	default:
+		return exprValue{truth: order >= 0}, nil
+	}
+}
+func (n *compareNode) isCondition() bool { return true }
+
+// parseDate reads a date written like the run's cleaned dates, or in ISO format as
+// literals usually are
+func (n *compareNode) parseDate(text string) (time.Time, bool) {
+	text = strings.TrimSpace(text)
+	for _, layout := range []string{n.dateLayout, DefaultDateFormat} {
+		if layout == "" {
+			continue
+		}
+		if date, err := time.Parse(layout, text); err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// compareFloats returns -1, 0 or 1 as a is less than, equal to or greater than b
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// logicNode combines two conditions with and/or
+type logicNode struct {
+	and         bool
+	left, right exprNode
+}
+
+func (n *logicNode) eval(row map[string]string) (exprValue, error) {
+	left, err := n.left.eval(row)
+	if err != nil {
+		return exprValue{}, err
+	}
+	if left.truth != n.and {
+		return left, nil
+	}
+	return n.right.eval(row)
+}
+func (n *logicNode) isCondition() bool { return true }
+
+// bindColumns resolves every column reference of expr, failing on unknown columns,
+// and makes its comparisons order dates written in dateLayout
+func bindColumns(expr exprNode, resolve func(reference string) string, dateLayout string) error {
+	switch n := expr.(type) {
+	case *columnNode:
+		if n.key = resolve(n.reference); n.key == "" {
+			return fmt.Errorf("unknown column %q", n.reference)
+		}
+	case *concatNode:
+		for _, part := range n.parts {
+			if err := bindColumns(part, resolve, dateLayout); err != nil {
+				return err
+			}
+		}
+	case *transformNode:
+		return bindColumns(n.arg, resolve, dateLayout)
+	case *ifNode:
+		for _, child := range []exprNode{n.cond, n.then, n.otherwise} {
+			if err := bindColumns(child, resolve, dateLayout); err != nil {
+				return err
+			}
+		}
+	case *compareNode:
+		n.dateLayout = dateLayout
+		if err := bindColumns(n.left, resolve, dateLayout); err != nil {
+			return err
+		}
+		return bindColumns(n.right, resolve, dateLayout)
+	case *logicNode:
+		if err := bindColumns(n.left, resolve, dateLayout); err != nil {
+			return err
+		}
+		return bindColumns(n.right, resolve, dateLayout)
+	}
+	return nil
+}
+
+// exprTransforms are the one-argument text functions of the expression language
+var exprTransforms = map[string]func(string) string{
+	"trim":  strings.TrimSpace,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// exprParser is a recursive descent parser over the source of one expression
+type exprParser struct {
+	src []rune
+	pos int
+}
+
+// parseExpression parses the source of a computed column, which yields a value. Its
+// errors name the position of the problem.
+func parseExpression(src string) (exprNode, error) {
+	node, err := parseSource(src)
+	if err != nil {
+		return nil, err
+	}
+	if node.isCondition() {
+		return nil, fmt.Errorf("expression is a condition; wrap it in if(...)")
+	}
+	return node, nil
+}
+
+// parseCondition parses the source of a row filter, which yields true or false
+func parseCondition(src string) (exprNode, error) {
+	node, err := parseSource(src)
+	if err != nil {
+		return nil, err
+	}
+	if !node.isCondition() {
+		return nil, fmt.Errorf("expression is not a condition")
+	}
+	return node, nil
+}
+
+func parseSource(src string) (exprNode, error) {
+	p := &exprParser{src: []rune(src)}
+	if strings.TrimSpace(src) == "" {
+		return nil, fmt.Errorf("expression is empty")
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", string(p.src[p.pos]))
+	}
+	return node, nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at position %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+// consume skips over token if it comes next
+func (p *exprParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(string(p.src[p.pos:]), token) {
+		p.pos += len([]rune(token))
+		return true
+	}
+	return false
+}
+
+// consumeKeyword skips over a case-insensitive word if it comes next
+func (p *exprParser) consumeKeyword(word string) bool {
+	p.skipSpace()
+	end := p.pos + len(word)
+	if end > len(p.src) || !strings.EqualFold(string(p.src[p.pos:end]), word) {
+		return false
+	}
+	if end < len(p.src) && (unicode.IsLetter(p.src[end]) || unicode.IsDigit(p.src[end]) || p.src[end] == '_') {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseLogic(false, p.parseAnd)
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseLogic(true, p.parseCompare)
+}
+
+// parseLogic parses operands joined by and (or or), which must all be conditions
+func (p *exprParser) parseLogic(and bool, operand func() (exprNode, error)) (exprNode, error) {
+	word, symbol := "or", "||"
+	if and {
+		word, symbol = "and", "&&"
+	}
+
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		start := p.pos
+		if !p.consumeKeyword(word) && !p.consume(symbol) {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if !left.isCondition() || !right.isCondition() {
+			p.pos = start
+			return nil, p.errorf("%s joins conditions, not values", word)
+		}
+		left = &logicNode{and: and, left: left, right: right}
+	}
+}
+
+// parseCompare parses a concatenation, optionally compared with another
+func (p *exprParser) parseCompare() (exprNode, error) {
+	left, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	start := p.pos
+	for _, op := range []string{"<=", ">=", "==", "!=", "<", ">", "contains"} {
+		if op == "contains" && !p.consumeKeyword(op) || op != "contains" && !p.consume(op) {
+			continue
+		}
+		right, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		if left.isCondition() || right.isCondition() {
+			p.pos = start
+			return nil, p.errorf("%s compares values, not conditions", op)
+		}
+		return &compareNode{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseConcat() (exprNode, error) {
+	first, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	parts := []exprNode{first}
+	for p.consume("+") {
+		part, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 1 {
+		return first, nil
+	}
+	for _, part := range parts {
+		if part.isCondition() {
+			return nil, p.errorf("a comparison can't be concatenated")
+		}
+	}
+	return &concatNode{parts: parts}, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("expected a value")
+	}
+
+	ch := p.src[p.pos]
+	switch {
+	case ch == '"':
+		return p.parseString()
+	case ch == '[':
+		start := p.pos
+		end := start + 1
+		for end < len(p.src) && p.src[end] != ']' {
+			end++
+		}
+		if end == len(p.src) {
+			return nil, p.errorf("unterminated column name")
+		}
+		name := string(p.src[start+1 : end])
+		if strings.TrimSpace(name) == "" {
+			return nil, p.errorf("empty column name")
+		}
+		p.pos = end + 1
+		return &columnNode{reference: name}, nil
+	case ch == '(':
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, p.errorf("expected )")
+		}
+		return node, nil
+	case ch == '-' || ch == '.' || unicode.IsDigit(ch):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && (unicode.IsDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		number := string(p.src[start:p.pos])
+		if _, err := strconv.ParseFloat(number, 64); err != nil {
+			p.pos = start
+			return nil, p.errorf("invalid number %q", number)
+		}
+		return &literalNode{text: number}, nil
+	case unicode.IsLetter(ch) || ch == '_':
+		start := p.pos
+		for p.pos < len(p.src) && (unicode.IsLetter(p.src[p.pos]) || unicode.IsDigit(p.src[p.pos]) || p.src[p.pos] == '_') {
+			p.pos++
+		}
+		name := string(p.src[start:p.pos])
+		p.skipSpace()
+		if p.pos < len(p.src) && p.src[p.pos] == '(' {
+			p.pos = start
+			return p.parseCall(name)
+		}
+		return &columnNode{reference: name}, nil
+	}
+	return nil, p.errorf("unexpected %q", string(ch))
+}
+
+// parseString parses a double-quoted literal, where \" and \\ are escapes
+func (p *exprParser) parseString() (exprNode, error) {
+	start := p.pos
+	p.pos++
+	var builder strings.Builder
+	for p.pos < len(p.src) {
+		ch := p.src[p.pos]
+		p.pos++
+		switch {
+		case ch == '"':
+			return &literalNode{text: builder.String()}, nil
+		case ch == '\\' && p.pos < len(p.src):
+			builder.WriteRune(p.src[p.pos])
+			p.pos++
+		default:
+			builder.WriteRune(ch)
+		}
+	}
+	p.pos = start
+	return nil, p.errorf("unterminated string")
+}
+
+// parseCall parses a function call whose name starts at the current position
+func (p *exprParser) parseCall(name string) (exprNode, error) {
+	start := p.pos
+	p.pos += len([]rune(name))
+	p.consume("(")
+
+	var args []exprNode
+	if !p.consume(")") {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.consume(")") {
+				break
+			}
+			if !p.consume(",") {
+				return nil, p.errorf("expected , or )")
+			}
+		}
+	}
+
+	lower := strings.ToLower(name)
+	if fn, ok := exprTransforms[lower]; ok {
+		if len(args) != 1 || args[0].isCondition() {
+			p.pos = start
+			return nil, p.errorf("%s takes one text argument", lower)
+		}
+		return &transformNode{fn: fn, arg: args[0]}, nil
+	}
+	if lower == "if" {
+		if len(args) != 3 || !args[0].isCondition() || args[1].isCondition() || args[2].isCondition() {
+			p.pos = start
+			return nil, p.errorf("if takes a comparison and two values")
+		}
+		return &ifNode{cond: args[0], then: args[1], otherwise: args[2]}, nil
+	}
+	p.pos = start
+	return nil, p.errorf("unknown function %q", name)
+}
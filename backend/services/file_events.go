@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"csv-processor/models"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// fileEventColumns are the columns scanned by scanFileEvent
+const fileEventColumns = `e.id, e.csv_file_id, e.event_type, COALESCE(e.old_status, ''), COALESCE(e.new_status, ''),
+	e.actor, e.detail, e.occurred_at`
+
+// SetEventBus publishes every recorded file event to the subscribers of bus
+func (s *DBService) SetEventBus(bus *EventBus) {
+	s.events = bus
+}
+
+// RecordEvent appends an event to a file's timeline and publishes it. Failing to
+// store it is only logged, so the timeline never fails the operation it describes.
+// The event's ID and time are filled in once stored.
+func (s *DBService) RecordEvent(ctx context.Context, event *models.FileEvent) {
+	if event.Actor == "" {
+		event.Actor = "system"
+	}
+	if err := s.insertEvent(ctx, event); err != nil {
+		log.Printf("Error recording %s event of file %d: %v", event.EventType, event.CSVFileID, err)
+		return
+	}
+	s.events.publishEvent(event)
+}
+
+func (s *DBService) insertEvent(ctx context.Context, event *models.FileEvent) error {
+	var detailJSON []byte
+	if len(event.Detail) > 0 {
+		var err error
+		if detailJSON, err = json.Marshal(event.Detail); err != nil {
+			return fmt.Errorf("failed to marshal event detail: %w", err)
+		}
+	}
+
+	query := `
+		INSERT INTO csv_file_events (csv_file_id, event_type, old_status, new_status, actor, detail)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6)
+		RETURNING id, occurred_at
+	`
+	err := s.db.QueryRowContext(ctx, query, event.CSVFileID, event.EventType, event.OldStatus, event.NewStatus,
+		event.Actor, detailJSON).Scan(&event.ID, &event.OccurredAt)
+	if err != nil {
+		return fmt.Errorf("failed to log file event: %w", err)
+	}
+	return nil
+}
+
+// GetFileEvents returns the timeline of a file, oldest first
+func (s *DBService) GetFileEvents(fileID int) ([]*models.FileEvent, error) {
+	query := `SELECT ` + fileEventColumns + `
+		FROM csv_file_events e
+		WHERE e.csv_file_id = $1
+		ORDER BY e.occurred_at, e.id`
+	return s.queryFileEvents(query, fileID)
+}
+
+// GetFileEventsSince returns up to limit events recorded after the event with ID
+// afterID on files visible in scope, oldest first. Event streams replay them for
+// clients that reconnect.
+func (s *DBService) GetFileEventsSince(afterID int, scope OwnerScope, limit int) ([]*models.FileEvent, error) {
+	args := []interface{}{afterID, limit}
+	where := "e.id > $1"
+	if cond := scope.condition("f.owner", &args); cond != "" {
+		where += " AND " + cond
+	}
+	query := `SELECT ` + fileEventColumns + `
+		FROM csv_file_events e
+		JOIN csv_files f ON f.id = e.csv_file_id
+		WHERE ` + where + `
+		ORDER BY e.id
+		LIMIT $2`
+	return s.queryFileEvents(query, args...)
+}
+
+func (s *DBService) queryFileEvents(query string, args ...interface{}) ([]*models.FileEvent, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query file events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]*models.FileEvent, 0)
+	for rows.Next() {
+		event := &models.FileEvent{}
+		var detailJSON []byte
+		err := rows.Scan(&event.ID, &event.CSVFileID, &event.EventType, &event.OldStatus, &event.NewStatus,
+			&event.Actor, &detailJSON, &event.OccurredAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file event: %w", err)
+		}
+		if detailJSON != nil {
+			if err := json.Unmarshal(detailJSON, &event.Detail); err != nil {
+				return nil, fmt.Errorf("failed to decode event detail: %w", err)
+			}
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"csv-processor/models"
+	"sync"
+	"sync/atomic"
+)
+
+// GroupCache keeps the group summaries of completed files in memory, since their
+// records don't change until the file is reprocessed or its groups are edited.
+// Concurrent misses for a file share a single query.
+type GroupCache struct {
+	dbService *DBService
+
+	mu       sync.Mutex
+	groups   map[int]map[string][]int
+	inflight map[int]*groupLoad
+
+	hits   int64
+	misses int64
+}
+
+// groupLoad is a query for a file's groups that other callers can wait on
+type groupLoad struct {
+	done   chan struct{}
+	groups map[string][]int
+	err    error
+}
+
+func NewGroupCache(dbService *DBService) *GroupCache {
+	return &GroupCache{
+		dbService: dbService,
+		groups:    make(map[int]map[string][]int),
+		inflight:  make(map[int]*groupLoad),
+	}
+}
+
+// Get returns the groups of a file, from the cache when possible. The result is
+// shared and must not be modified.
+func (c *GroupCache) Get(fileID int) (map[string][]int, error) {
+	c.mu.Lock()
+	if groups, ok := c.groups[fileID]; ok {
+		c.mu.Unlock()
+		atomic.AddInt64(&c.hits, 1)
+		return groups, nil
+	}
+	atomic.AddInt64(&c.misses, 1)
+	if load, ok := c.inflight[fileID]; ok {
+		c.mu.Unlock()
+		<-load.done
+		return load.groups, load.err
+	}
+	load := &groupLoad{done: make(chan struct{})}
+	c.inflight[fileID] = load
+	c.mu.Unlock()
+
+	c.load(fileID, load)
+	return load.groups, load.err
+}
+
+// Warm replaces the cached groups of a file that just finished processing
+func (c *GroupCache) Warm(fileID int) error {
+	load := &groupLoad{done: make(chan struct{})}
+	c.mu.Lock()
+	delete(c.groups, fileID)
+	c.inflight[fileID] = load
+	c.mu.Unlock()
+
+	c.load(fileID, load)
+	return load.err
+}
+
+// load runs the query of load and caches the result, unless the file is not
+// completed or was invalidated in the meantime
+func (c *GroupCache) load(fileID int, load *groupLoad) {
+	defer close(load.done)
+
+	load.groups, load.err = c.dbService.GetGroupsByFileID(fileID)
+	cacheable := false
+	if load.err == nil {
+		status, err := c.dbService.GetCSVFileStatus(fileID)
+		cacheable = err == nil && status == "completed"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inflight[fileID] != load {
+		return
+	}
+	delete(c.inflight, fileID)
+	if cacheable {
+		c.groups[fileID] = load.groups
+	}
+}
+
+// Invalidate drops the cached groups of a file, including any query still running
+func (c *GroupCache) Invalidate(fileID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.groups, fileID)
+	delete(c.inflight, fileID)
+}
+
+// Stats reports how well the cache is doing
+func (c *GroupCache) Stats() *models.CacheStats {
+	c.mu.Lock()
+	entries := len(c.groups)
+	c.mu.Unlock()
+
+	return &models.CacheStats{
+		Entries: entries,
+		Hits:    atomic.LoadInt64(&c.hits),
+		Misses:  atomic.LoadInt64(&c.misses),
+	}
+}
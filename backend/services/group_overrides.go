@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"csv-processor/models"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// MergeGroups moves every record of the source groups into target and records the
+// change so it survives regrouping. Records belonging to a source group besides their
+// primary one are moved too. It returns the number of records updated.
+func (s *DBService) MergeGroups(fileID int, sources []string, target string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Sources are replaced in place, keeping the first occurrence of target
+	query := `
+		UPDATE records
+		SET grouped_category = CASE WHEN grouped_category = ANY($3) THEN $1 ELSE grouped_category END,
+		    grouped_categories = ARRAY(
+		        SELECT merged.category
+		        FROM UNNEST(` + groupedCategoriesColumn + `) WITH ORDINALITY AS g(category, position),
+		             LATERAL (SELECT CASE WHEN g.category = ANY($3) THEN $1 ELSE g.category END AS category) merged
+		        GROUP BY merged.category
+		        ORDER BY MIN(g.position))
+		WHERE csv_file_id = $2 AND ` + activeGeneration("$2") + `
+		  AND (grouped_category = ANY($3) OR grouped_categories && $3::text[])
+	`
+	result, err := tx.Exec(query, target, fileID, pq.Array(sources))
+	if err != nil {
+		return 0, fmt.Errorf("failed to merge groups: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count merged records: %w", err)
+	}
+
+	for _, source := range sources {
+		_, err := tx.Exec(
+			`INSERT INTO group_overrides (csv_file_id, source_category, target_category) VALUES ($1, $2, $3)`,
+			fileID, source, target,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record group override: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return int(affected), nil
+}
+
+// BatchUpdateCategories sets the grouped category of individual records of a file in
+// one statement, filling in the category each replaced. The new category becomes the
+// record's only group. Nothing is changed when any record is not one of the file's
+// current records.
+func (s *DBService) BatchUpdateCategories(fileID int, updates []*models.CategoryOverride) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	args := []interface{}{fileID}
+	values := make([]string, len(updates))
+	byID := make(map[int]*models.CategoryOverride, len(updates))
+	for i, update := range updates {
+		args = append(args, update.RecordID, update.Category)
+		values[i] = fmt.Sprintf("($%d::int, $%d::text)", len(args)-1, len(args))
+		byID[update.RecordID] = update
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The second reference to records still sees the row as it was before the update
+	query := `
+		UPDATE records r
+		SET grouped_category = v.category, grouped_categories = ARRAY[v.category]
+		FROM (VALUES ` + strings.Join(values, ", ") + `) AS v(id, category), records old
+		WHERE r.id = v.id AND old.id = r.id AND r.csv_file_id = $1 AND r.` + activeGeneration("$1") + `
+		RETURNING r.id, COALESCE(old.grouped_category, '')
+	`
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update categories: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var previous string
+		if err := rows.Scan(&id, &previous); err != nil {
+			return fmt.Errorf("failed to scan updated record: %w", err)
+		}
+		byID[id].PreviousCategory = previous
+		delete(byID, id)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to update categories: %w", err)
+	}
+	if len(byID) > 0 {
+		missing := make([]int, 0, len(byID))
+		for id := range byID {
+			missing = append(missing, id)
+		}
+		sort.Ints(missing)
+		return fmt.Errorf("%w: %v", models.ErrRecordNotFound, missing)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetGroupOverrides returns the manual group changes of a file in the order they were made
+func (s *DBService) GetGroupOverrides(ctx context.Context, fileID int) ([]*models.GroupOverride, error) {
+	query := `
+		SELECT source_category, target_category
+		FROM group_overrides
+		WHERE csv_file_id = $1
+		ORDER BY id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group overrides: %w", err)
+	}
+	defer rows.Close()
+
+	overrides := make([]*models.GroupOverride, 0)
+	for rows.Next() {
+		override := &models.GroupOverride{}
+		if err := rows.Scan(&override.Source, &override.Target); err != nil {
+			return nil, fmt.Errorf("failed to scan group override: %w", err)
+		}
+		overrides = append(overrides, override)
+	}
+
+	return overrides, nil
+}
+
+// applyGroupOverrides replays manual group changes, in order, on freshly grouped
+// records, as MergeGroups made them
+func applyGroupOverrides(records []*models.Record, overrides []*models.GroupOverride) {
+	for _, override := range overrides {
+		for _, record := range records {
+			if record.GroupedCategory == override.Source {
+				record.GroupedCategory = override.Target
+			}
+			if !containsString(record.GroupedCategories, override.Source) {
+				continue
+			}
+			merged := make([]string, 0, len(record.GroupedCategories))
+			for _, category := range record.GroupedCategories {
+				if category == override.Source {
+					category = override.Target
+				}
+				if !containsString(merged, category) {
+					merged = append(merged, category)
+				}
+			}
+			record.GroupedCategories = merged
+		}
+	}
+}
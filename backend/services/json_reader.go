@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// JSONToCSV converts JSON records to CSV. data is either an array of objects or,
+// with ndjson, one object per line. The header is the union of all keys in the
+// order they first appear; objects missing a key get an empty value. Numbers keep
+// their original formatting, null becomes empty and nested values are written as
+// compact JSON.
+func JSONToCSV(data []byte, ndjson bool) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if !ndjson {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JSON: %w", err)
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return nil, fmt.Errorf("expected a JSON array of objects")
+		}
+	}
+
+	var headers []string
+	seen := make(map[string]bool)
+	var rows []map[string]string
+	for {
+		if !ndjson && !dec.More() {
+			break
+		}
+		keys, row, err := decodeJSONObject(dec)
+		if ndjson && err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", len(rows)+1, err)
+		}
+		for _, key := range keys {
+			if !seen[key] {
+				seen[key] = true
+				headers = append(headers, key)
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no records in JSON upload")
+	}
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("JSON records have no fields")
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(headers); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	line := make([]string, len(headers))
+	for _, row := range rows {
+		for i, header := range headers {
+			line[i] = row[header]
+		}
+		if err := writer.Write(line); err != nil {
+			return nil, fmt.Errorf("failed to write CSV: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeJSONObject reads the next object from dec, returning its keys in document
+// order and its values as strings. It returns io.EOF when the input is exhausted.
+func decodeJSONObject(dec *json.Decoder) ([]string, map[string]string, error) {
+	token, err := dec.Token()
+	if err == io.EOF {
+		return nil, nil, io.EOF
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, nil, fmt.Errorf("expected a JSON object")
+	}
+
+	var keys []string
+	row := make(map[string]string)
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		key := token.(string)
+
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, fmt.Errorf("invalid value for %q: %w", key, err)
+		}
+		if _, ok := row[key]; !ok {
+			keys = append(keys, key)
+		}
+		row[key], err = jsonValueString(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid value for %q: %w", key, err)
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return keys, row, nil
+}
+
+// jsonValueString renders a decoded JSON value as a CSV cell
+func jsonValueString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		if v {
+			return "true", nil
+		}
+		return "false", nil
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	}
+}
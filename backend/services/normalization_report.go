@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"csv-processor/models"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxTopNormalizations is how many of the most frequent normalizations a report lists
+const maxTopNormalizations = 20
+
+// buildNormalizationReport compares the original and cleaned values of records and
+// lists the canonical terms that the file's values were merged into. normalizer
+// may be nil.
+func buildNormalizationReport(records []*models.Record, normalizer *TermNormalizer) *models.TermNormalizationReport {
+	type change struct{ column, original, normalized string }
+	counts := make(map[change]int)
+	distinct := make(map[string]bool)
+	normalized := make(map[string]bool)
+	terms := make(map[string]bool) // lowercased cleaned values, as the normalizer stores them
+
+	for _, record := range records {
+		masked := make(map[string]bool, len(record.MaskedColumns))
+		for _, column := range record.MaskedColumns {
+			masked[column] = true
+		}
+		for column, cleaned := range record.CleanedData {
+			original, ok := record.OriginalData[column]
+			if !ok || column == categoryInputKey || masked[column] {
+				continue
+			}
+			distinct[original] = true
+			if cleaned != "" {
+				terms[strings.ToLower(cleaned)] = true
+			}
+			if cleaned != original {
+				normalized[original] = true
+				counts[change{column, original, cleaned}]++
+			}
+		}
+	}
+
+	report := &models.TermNormalizationReport{
+		DistinctTerms:     len(distinct),
+		NormalizedTerms:   len(normalized),
+		Merges:            make(map[string][]string),
+		TopNormalizations: make([]*models.NormalizationCount, 0, len(counts)),
+		GeneratedAt:       time.Now(),
+	}
+	for c, count := range counts {
+		report.TopNormalizations = append(report.TopNormalizations, &models.NormalizationCount{
+			Column: c.column, Original: c.original, Normalized: c.normalized, Count: count,
+		})
+	}
+	sort.Slice(report.TopNormalizations, func(i, j int) bool {
+		a, b := report.TopNormalizations[i], report.TopNormalizations[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Original < b.Original
+	})
+	if len(report.TopNormalizations) > maxTopNormalizations {
+		report.TopNormalizations = report.TopNormalizations[:maxTopNormalizations]
+	}
+
+	if normalizer != nil {
+		for canonical, variations := range normalizer.GetCanonicalTerms() {
+			for _, variation := range variations {
+				if terms[variation] && variation != canonical {
+					report.Merges[canonical] = append(report.Merges[canonical], variation)
+				}
+			}
+			sort.Strings(report.Merges[canonical])
+		}
+		for canonical, variations := range report.Merges {
+			if len(variations) == 0 {
+				delete(report.Merges, canonical)
+			}
+		}
+	}
+	return report
+}
+
+// UpdateCSVFileNormalizationReport stores the normalization report of a processed file
+func (s *DBService) UpdateCSVFileNormalizationReport(ctx context.Context, fileID int, report *models.TermNormalizationReport) error {
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal normalization report: %w", err)
+	}
+
+	query := `UPDATE csv_files SET normalization_report = $1 WHERE id = $2`
+	if _, err := s.db.ExecContext(ctx, query, string(reportJSON), fileID); err != nil {
+		return fmt.Errorf("failed to update normalization report: %w", err)
+	}
+	return nil
+}
+
+// GetNormalizationReport returns the normalization report of a file, or nil when
+// the file has not been processed yet
+func (s *DBService) GetNormalizationReport(fileID int) (*models.TermNormalizationReport, error) {
+	var reportJSON []byte
+	err := s.db.QueryRow(`SELECT normalization_report FROM csv_files WHERE id = $1`, fileID).Scan(&reportJSON)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("CSV file not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get normalization report: %w", err)
+	}
+	if reportJSON == nil {
+		return nil, nil
+	}
+
+	report := &models.TermNormalizationReport{}
+	if err := json.Unmarshal(reportJSON, report); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal normalization report: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// benchmarkTitles are the base occupation titles of the benchmark corpus: software
+// engineering variants and doctor specialties, with a few other common roles
+var benchmarkTitles = []string{
+	"software engineer", "software developer", "backend developer", "frontend developer",
+	"full stack developer", "web developer", "mobile developer", "devops engineer",
+	"site reliability engineer", "data engineer", "machine learning engineer", "qa engineer",
+	"embedded software engineer", "cloud engineer", "platform engineer", "security engineer",
+	"cardiologist", "neurologist", "pediatrician", "dermatologist", "psychiatrist",
+	"orthopedic surgeon", "general practitioner", "oncologist", "radiologist",
+	"anesthesiologist", "emergency physician", "family physician", "ophthalmologist",
+	"gastroenterologist", "endocrinologist", "pulmonologist", "nephrologist", "urologist",
+	"registered nurse", "pharmacist", "accountant", "project manager", "product manager",
+	"attorney", "teacher", "sales representative",
+}
+
+// benchmarkSeniorities and benchmarkQualifiers are combined with the base titles
+var (
+	benchmarkSeniorities = []string{"", "junior", "senior", "lead", "principal", "staff", "chief", "associate", "head", "consultant"}
+	benchmarkQualifiers  = []string{"", "ii", "iii", "remote", "contract", "intern", "trainee", "locum", "part time", "apprentice"}
+)
+
+// occupationCorpus returns n occupation titles built from the base titles with
+// seniorities and qualifiers. Once every combination has been used, titles get typos
+// the way hand-typed data does. The corpus is the same on every call.
+func occupationCorpus(n int) []string {
+	rng := rand.New(rand.NewSource(42))
+	combinations := len(benchmarkTitles) * len(benchmarkSeniorities) * len(benchmarkQualifiers)
+
+	corpus := make([]string, n)
+	for i := range corpus {
+		c := i % combinations
+		title := benchmarkTitles[c%len(benchmarkTitles)]
+		c /= len(benchmarkTitles)
+		parts := []string{benchmarkSeniorities[c%len(benchmarkSeniorities)], title, benchmarkQualifiers[c/len(benchmarkSeniorities)]}
+		term := strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+		for typos := i / combinations; typos > 0; typos-- {
+			term = addTypo(rng, term)
+		}
+		corpus[i] = term
+	}
+	return corpus
+}
+
+// addTypo swaps, drops, doubles or replaces one letter of term
+func addTypo(rng *rand.Rand, term string) string {
+	if len(term) < 2 {
+		return term
+	}
+	b := []byte(term)
+	i := rng.Intn(len(b) - 1)
+	switch rng.Intn(4) {
+	case 0:
+		b[i], b[i+1] = b[i+1], b[i]
+	case 1:
+		b = append(b[:i], b[i+1:]...)
+	case 2:
+		b = append(b[:i+1], b[i:]...)
+	default:
+		b[i] = byte('a' + rng.Intn(26))
+	}
+	return string(b)
+}
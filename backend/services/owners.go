@@ -0,0 +1,45 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// OwnerScope limits queries to the files of one owner. All lifts the limit and is
+// only granted to admins.
+type OwnerScope struct {
+	Owner string
+	All   bool
+}
+
+// condition returns an SQL condition restricting column to the scope's owner,
+// appending its argument to args, or "" when every owner is visible
+func (o OwnerScope) condition(column string, args *[]interface{}) string {
+	if o.All {
+		return ""
+	}
+	*args = append(*args, o.Owner)
+	return fmt.Sprintf("%s = $%d", column, len(*args))
+}
+
+// FileExists reports whether a file exists, whoever owns it
+func (s *DBService) FileExists(fileID int) (bool, error) {
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM csv_files WHERE id = $1)`, fileID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check file: %w", err)
+	}
+	return exists, nil
+}
+
+// FileVisible reports whether a file exists and belongs to the scope's owner
+func (s *DBService) FileVisible(fileID int, scope OwnerScope) (bool, error) {
+	var owner string
+	err := s.db.QueryRow(`SELECT owner FROM csv_files WHERE id = $1`, fileID).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check file owner: %w", err)
+	}
+	return scope.All || owner == scope.Owner, nil
+}
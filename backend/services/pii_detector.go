@@ -0,0 +1,169 @@
+package services
+
+import (
+	"csv-processor/models"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PIIType is the kind of personal data a column holds
+type PIIType string
+
+const (
+	PIINone    PIIType = "none"
+	PIIEmail   PIIType = "email"
+	PIIPhone   PIIType = "phone"
+	PIIName    PIIType = "name"
+	PIIAddress PIIType = "address"
+)
+
+// piiSampleSize is how many records of a file are read to classify its columns
+const piiSampleSize = 100
+
+var (
+	emailValuePattern   = regexp.MustCompile(`^[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}$`)
+	phoneValuePattern   = regexp.MustCompile(`^(\+|00)?[\d\s().\-]{7,20}$`)
+	dateValuePattern    = regexp.MustCompile(`^\d{1,4}[-/.]\d{1,2}[-/.]\d{1,4}$`)
+	addressValuePattern = regexp.MustCompile(`(?i)^\d+[a-z]?\s+.*\b(street|st|avenue|ave|road|rd|boulevard|blvd|lane|ln|drive|dr|way|court|ct|place|pl|terrace|square|sq)\b\.?`)
+)
+
+// piiHeaderTypes classifies column names, checked in order against the column's
+// name in lower case with every run of other characters turned into "_"
+var piiHeaderTypes = []struct {
+	piiType PIIType
+	pattern *regexp.Regexp
+}{
+	{PIIEmail, regexp.MustCompile(`(^|_)e_?mail(_|$)`)},
+	{PIIPhone, regexp.MustCompile(`(^|_)(phone|telephone|tel|mobile|cell|fax)(_|$)`)},
+	{PIIAddress, regexp.MustCompile(`(^|_)(address|street|zip|zipcode|postcode|postal)(_|$)`)},
+	{PIIName, regexp.MustCompile(`^((first|last|full|middle|given|family|maiden|customer|contact|employee|patient|client|person)_?)?name$|(^|_)(surname|forename)(_|$)`)},
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// PIIDetector flags the columns of a file that likely hold personal data, so
+// clients can warn before displaying them
+type PIIDetector struct {
+	minValueShare float64 // share of sampled values a value pattern must match
+}
+
+// NewPIIDetector creates a detector classifying a column by its values once most
+// of them match one pattern
+func NewPIIDetector() *PIIDetector {
+	return &PIIDetector{minValueShare: 0.8}
+}
+
+// Detect classifies each header from its name and sampled raw values. Values
+// decide when they clearly match one kind; otherwise the name does, and names are
+// the only clue for personal names.
+func (d *PIIDetector) Detect(headers []string, sample []map[string]string) map[string]PIIType {
+	types := make(map[string]PIIType, len(headers))
+	for _, header := range headers {
+		if piiType := d.classifyValues(header, sample); piiType != PIINone {
+			types[header] = piiType
+			continue
+		}
+		types[header] = classifyHeader(header)
+	}
+	return types
+}
+
+// classifyHeader classifies a column by its name alone
+func classifyHeader(header string) PIIType {
+	normalized := strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(header), "_"), "_")
+	for _, candidate := range piiHeaderTypes {
+		if candidate.pattern.MatchString(normalized) {
+			return candidate.piiType
+		}
+	}
+	return PIINone
+}
+
+// classifyValues classifies a column by the non-empty values sampled from it
+func (d *PIIDetector) classifyValues(header string, sample []map[string]string) PIIType {
+	counts := make(map[PIIType]int)
+	total := 0
+	for _, row := range sample {
+		value := strings.TrimSpace(row[header])
+		if value == "" {
+			continue
+		}
+		total++
+		counts[classifyValue(value)]++
+	}
+	if total == 0 {
+		return PIINone
+	}
+	for _, piiType := range []PIIType{PIIEmail, PIIPhone, PIIAddress} {
+		if float64(counts[piiType]) >= d.minValueShare*float64(total) {
+			return piiType
+		}
+	}
+	return PIINone
+}
+
+// classifyValue recognizes an email, phone number or street address. Bare digit
+// strings are left alone, as they are more often IDs than phone numbers.
+func classifyValue(value string) PIIType {
+	switch {
+	case emailValuePattern.MatchString(value):
+		return PIIEmail
+	case addressValuePattern.MatchString(value):
+		return PIIAddress
+	case phoneValuePattern.MatchString(value) && !dateValuePattern.MatchString(value) &&
+		strings.ContainsAny(value, "+ ()-.") && isPhoneLength(value):
+		return PIIPhone
+	}
+	return PIINone
+}
+
+// isPhoneLength reports whether value has as many digits as a phone number
+func isPhoneLength(value string) bool {
+	digits := 0
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
+
+// detectPIIColumns classifies the columns of processed records from the raw values
+// of the first few, returning only the columns flagged as personal data. Columns
+// whose raw values weren't kept are sampled from their masked cleaned values.
+func detectPIIColumns(detector *PIIDetector, records []*models.Record) map[string]PIIType {
+	if len(records) == 0 {
+		return nil
+	}
+	headers := make([]string, 0, len(records[0].CleanedData))
+	for header := range records[0].CleanedData {
+		headers = append(headers, header)
+	}
+	sort.Strings(headers)
+
+	n := len(records)
+	if n > piiSampleSize {
+		n = piiSampleSize
+	}
+	sample := make([]map[string]string, n)
+	for i, record := range records[:n] {
+		row := make(map[string]string, len(headers))
+		for _, header := range headers {
+			if value, ok := record.OriginalData[header]; ok {
+				row[header] = value
+			} else {
+				row[header] = record.CleanedData[header]
+			}
+		}
+		sample[i] = row
+	}
+
+	flagged := make(map[string]PIIType)
+	for header, piiType := range detector.Detect(headers, sample) {
+		if piiType != PIINone {
+			flagged[header] = piiType
+		}
+	}
+	return flagged
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"csv-processor/models"
+	"reflect"
+	"testing"
+)
+
+func TestPIIDetectorDetect(t *testing.T) {
+	headers := []string{"Contact", "Mobile", "Home", "Customer Name", "Filename", "Username", "Employee ID", "Hired", "Note"}
+	sample := []map[string]string{
+		{"Contact": "ada@example.com", "Mobile": "+44 20 7946 0958", "Home": "12 Baker Street", "Customer Name": "Ada", "Employee ID": "4412345678", "Hired": "2024-01-31", "Note": "call back"},
+		{"Contact": "grace@example.org", "Mobile": "(555) 123-4567", "Home": "221b Baker St.", "Customer Name": "Grace", "Employee ID": "4412345679", "Hired": "31.01.2024", "Note": "ada@example.com"},
+		{"Contact": "linus@example.net", "Mobile": "", "Home": "1600 Pennsylvania Avenue", "Customer Name": "Linus", "Employee ID": "4412345680", "Hired": "01/31/2024", "Note": ""},
+		{"Contact": "n/a", "Mobile": "555-0100 ext", "Home": "3 Abbey Road", "Customer Name": "Alan", "Employee ID": "4412345681", "Hired": "2024-02-01", "Note": "vip"},
+		{"Contact": "margaret@example.com", "Mobile": "555 0199 123", "Home": "unknown", "Customer Name": "Margaret", "Employee ID": "4412345682", "Hired": "2024-02-02", "Note": ""},
+	}
+	want := map[string]PIIType{
+		"Contact":       PIIEmail,   // 4 of 5 values
+		"Mobile":        PIIPhone,   // by name, as only 3 of 4 values look like one
+		"Home":          PIIAddress, // 4 of 5 values
+		"Customer Name": PIIName,
+		"Filename":      PIINone,
+		"Username":      PIINone,
+		"Employee ID":   PIINone, // bare digits are IDs, not phone numbers
+		"Hired":         PIINone, // dates are not phone numbers
+		"Note":          PIINone, // one email in three values
+	}
+	if got := NewPIIDetector().Detect(headers, sample); !reflect.DeepEqual(got, want) {
+		t.Errorf("Detect() = %v, want %v", got, want)
+	}
+}
+
+func TestClassifyHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		want   PIIType
+	}{
+		{"E-mail", PIIEmail},
+		{"work_email", PIIEmail},
+		{"Phone Number", PIIPhone},
+		{"fax", PIIPhone},
+		{"Postal Code", PIIAddress},
+		{"Street", PIIAddress},
+		{"Name", PIIName},
+		{"LastName", PIIName},
+		{"surname", PIIName},
+		{"Company Name", PIINone},
+		{"Filename", PIINone},
+		{"Emailed", PIINone},
+		{"Telephony Vendor", PIINone},
+	}
+	for _, tt := range tests {
+		if got := classifyHeader(tt.header); got != tt.want {
+			t.Errorf("classifyHeader(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestDetectPIIColumns(t *testing.T) {
+	// The raw value decides; the masked cleaned value stands in when none was kept
+	records := []*models.Record{
+		{
+			OriginalData: map[string]string{"Reach": "ada@example.com"},
+			CleanedData:  map[string]string{"Reach": "a***@example.com", "Tel": "+1 555 010 0199", "Title": "Engineer"},
+		},
+	}
+	want := map[string]PIIType{"Reach": PIIEmail, "Tel": PIIPhone}
+	if got := detectPIIColumns(NewPIIDetector(), records); !reflect.DeepEqual(got, want) {
+		t.Errorf("detectPIIColumns() = %v, want %v", got, want)
+	}
+	if got := detectPIIColumns(NewPIIDetector(), nil); got != nil {
+		t.Errorf("detectPIIColumns(nil) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"csv-processor/models"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+var (
+	ssnPattern   = regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	phonePattern = regexp.MustCompile(`\+?\(?\d[\d\s().\-]{7,}\d`)
+)
+
+// maskedColumn is how one column is masked during a run
+type maskedColumn struct {
+	force         bool // mask values even when no PII pattern is found
+	storeOriginal bool
+}
+
+// resolveMasking decides which cleaned headers are masked. maskPII masks PII
+// patterns in every column; a column rule with mask set masks its whole value.
+func resolveMasking(headers []string, validators []*columnValidator, cfg *models.ProcessorConfig) map[string]*maskedColumn {
+	masked := make(map[string]*maskedColumn)
+	if cfg != nil && cfg.MaskPII {
+		for _, header := range headers {
+			masked[header] = &maskedColumn{storeOriginal: true}
+		}
+	}
+	for _, validator := range validators {
+		if !validator.rule.Mask && masked[validator.column] == nil {
+			continue
+		}
+		masked[validator.column] = &maskedColumn{
+			force:         validator.rule.Mask,
+			storeOriginal: validator.rule.StoreOriginal == nil || *validator.rule.StoreOriginal,
+		}
+	}
+	if len(masked) == 0 {
+		return nil
+	}
+	return masked
+}
+
+// maskingEnabled reports whether cfg asks for any column to be masked
+func maskingEnabled(cfg *models.ProcessorConfig) bool {
+	if cfg == nil {
+		return false
+	}
+	if cfg.MaskPII {
+		return true
+	}
+	for _, rule := range cfg.Validation {
+		if rule != nil && rule.Mask {
+			return true
+		}
+	}
+	return false
+}
+
+// maskPII redacts the emails, SSN-like numbers and phone numbers in value. With
+// force, a value without any of them is redacted as a whole. It reports whether
+// anything was redacted.
+func maskPII(value string, force bool) (string, bool) {
+	value = strings.TrimSpace(value)
+	masked := ssnPattern.ReplaceAllStringFunc(value, maskDigits)
+	masked = emailPattern.ReplaceAllStringFunc(masked, maskEmail)
+	masked = phonePattern.ReplaceAllStringFunc(masked, maskPhone)
+	if masked != value {
+		return masked, true
+	}
+	if force && value != "" {
+		return maskText(value), true
+	}
+	return value, false
+}
+
+// maskEmail keeps the first letter of the local part and the domain: j***@example.com
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	return maskText(email[:at]) + email[at:]
+}
+
+// maskPhone masks a phone number candidate holding 10 to 15 digits, the lengths of
+// national and international numbers; shorter runs are mostly dates and amounts
+func maskPhone(candidate string) string {
+	digits := countDigits(candidate)
+	if digits < 10 || digits > 15 {
+		return candidate
+	}
+	return maskDigits(candidate)
+}
+
+// countDigits counts the ASCII digits in s
+func countDigits(s string) int {
+	n := 0
+	for _, ch := range s {
+		if ch >= '0' && ch <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// maskDigits hides every digit but the last four, keeping separators: ***-**-6789
+func maskDigits(number string) string {
+	digits := countDigits(number)
+
+	var builder strings.Builder
+	seen := 0
+	for _, ch := range number {
+		if ch >= '0' && ch <= '9' {
+			seen++
+			if seen <= digits-4 {
+				ch = '*'
+			}
+		}
+		builder.WriteRune(ch)
+	}
+	return builder.String()
+}
+
+// maskText keeps only the first character of text
+func maskText(text string) string {
+	runes := []rune(text)
+	return string(runes[:1]) + "***"
+}
+
+// hashPII returns a keyed hash of a value, so masked values can still be joined on
+func hashPII(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// summarizeMasking counts masked values per column
+func summarizeMasking(records []*models.Record) map[string]int {
+	summary := make(map[string]int)
+	for _, record := range records {
+		for _, column := range record.MaskedColumns {
+			summary[column]++
+		}
+	}
+	return summary
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"csv-processor/models"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// profileColumns are the columns scanned by scanProfile
+const profileColumns = `id, name, options, version, created_at, updated_at`
+
+// ListProfiles returns every processing profile, by name
+func (s *DBService) ListProfiles() ([]*models.ProcessingProfile, error) {
+	rows, err := s.db.Query(`SELECT ` + profileColumns + ` FROM processing_profiles ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query processing profiles: %w", err)
+	}
+	defer rows.Close()
+
+	profiles := make([]*models.ProcessingProfile, 0)
+	for rows.Next() {
+		profile, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read processing profiles: %w", err)
+	}
+	return profiles, nil
+}
+
+// GetProfile returns the processing profile with the given name
+func (s *DBService) GetProfile(name string) (*models.ProcessingProfile, error) {
+	row := s.db.QueryRow(`SELECT `+profileColumns+` FROM processing_profiles WHERE name = $1`, name)
+	profile, err := scanProfile(row)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrProfileNotFound
+	}
+	return profile, err
+}
+
+// CreateProfile stores a new processing profile at version 1
+func (s *DBService) CreateProfile(name string, options *models.ProcessorConfig) (*models.ProcessingProfile, error) {
+	optionsJSON, err := marshalProfileOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO processing_profiles (name, options)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO NOTHING
+		RETURNING ` + profileColumns
+	profile, err := scanProfile(s.db.QueryRow(query, name, optionsJSON))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrProfileExists
+	}
+	return profile, err
+}
+
+// UpdateProfile replaces the options of a processing profile and bumps its version
+func (s *DBService) UpdateProfile(name string, options *models.ProcessorConfig) (*models.ProcessingProfile, error) {
+	optionsJSON, err := marshalProfileOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE processing_profiles
+		SET options = $1, version = version + 1, updated_at = NOW()
+		WHERE name = $2
+		RETURNING ` + profileColumns
+	profile, err := scanProfile(s.db.QueryRow(query, optionsJSON, name))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrProfileNotFound
+	}
+	return profile, err
+}
+
+// DeleteProfile removes a processing profile. Files processed with it keep their
+// snapshot of its options.
+func (s *DBService) DeleteProfile(name string) error {
+	result, err := s.db.Exec(`DELETE FROM processing_profiles WHERE name = $1`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete processing profile: %w", err)
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		return models.ErrProfileNotFound
+	}
+	return nil
+}
+
+// marshalProfileOptions encodes the options of a profile, which never name a profile
+// themselves
+func marshalProfileOptions(options *models.ProcessorConfig) (string, error) {
+	stored := *options
+	stored.Profile, stored.ProfileVersion = "", 0
+	encoded, err := json.Marshal(stored)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal profile options: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanProfile reads a processing profile selected with profileColumns
+func scanProfile(row rowScanner) (*models.ProcessingProfile, error) {
+	profile := &models.ProcessingProfile{}
+	var optionsJSON []byte
+	err := row.Scan(&profile.ID, &profile.Name, &optionsJSON, &profile.Version, &profile.CreatedAt, &profile.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan processing profile: %w", err)
+	}
+	if err := json.Unmarshal(optionsJSON, &profile.Options); err != nil {
+		return nil, fmt.Errorf("failed to decode profile options: %w", err)
+	}
+	return profile, nil
+}
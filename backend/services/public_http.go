@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned for URLs that lead to the server's own machine or
+// network instead of a public host
+var ErrPrivateAddress = errors.New("address is not public")
+
+// maxRedirects is how many redirects a public HTTP client follows
+const maxRedirects = 10
+
+// sharedAddressSpace is the carrier-grade NAT range, which net.IP doesn't count as
+// private but is no more reachable from outside
+var sharedAddressSpace = &net.IPNet{IP: net.IP{100, 64, 0, 0}, Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP reports whether ip belongs to a public host rather than to the loopback,
+// private, link-local (which holds cloud metadata services) or another special range
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// CheckPublicURL resolves the host of u and returns ErrPrivateAddress unless every
+// address it resolves to is public. It gives early feedback only: the answer can
+// change before a request is made, so clients from NewPublicHTTPClient check again
+// on every connection.
+func CheckPublicURL(ctx context.Context, u *url.URL) error {
+	host := u.Hostname()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrPrivateAddress, host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// refusePrivateDial is a net.Dialer Control function refusing connections to
+// addresses that aren't public. It sees the address actually dialled, after name
+// resolution, so neither redirects nor DNS answers that change between a check and
+// the request get around it.
+func refusePrivateDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// NewPublicHTTPClient returns a client for fetching URLs given by API callers. It
+// only connects to public addresses and follows redirects to http and https URLs
+// only. Proxies from the environment are not used, as they would connect on the
+// client's behalf.
+func NewPublicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: refusePrivateDial}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return CheckPublicURL(req.Context(), req.URL)
+		},
+	}
+}
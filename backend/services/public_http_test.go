@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.5", false},
+		{"172.16.3.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false}, // cloud metadata
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPublicURL(t *testing.T) {
+	for _, rawURL := range []string{"http://127.0.0.1:8080/data.csv", "http://localhost/data.csv", "http://[::1]/data.csv", "http://169.254.169.254/latest/meta-data/"} {
+		u, _ := url.Parse(rawURL)
+		if err := CheckPublicURL(context.Background(), u); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("CheckPublicURL(%s) = %v, want ErrPrivateAddress", rawURL, err)
+		}
+	}
+}
+
+func TestPublicHTTPClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("name\nAda\n"))
+	}))
+	defer server.Close()
+
+	client := NewPublicHTTPClient(5 * time.Second)
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Get(%s) error = %v, want ErrPrivateAddress", server.URL, err)
+	}
+
+	// Redirects are checked before following them; the redirecting server is reached
+	// through the unrestricted client standing in for a public host
+	redirect := httptest.NewServer(http.RedirectHandler(server.URL, http.StatusFound))
+	defer redirect.Close()
+	client.Transport = http.DefaultTransport
+	if _, err := client.Get(redirect.URL); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Get() redirected to %s error = %v, want ErrPrivateAddress", server.URL, err)
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"csv-processor/models"
+	"sync/atomic"
+	"time"
+)
+
+// QueryLimiter caps how many expensive queries run against the database at once.
+// Callers wait up to the queue timeout for a slot before giving up.
+type QueryLimiter struct {
+	slots    chan struct{}
+	timeout  time.Duration
+	inFlight int64
+	waiting  int64
+	rejected int64
+}
+
+func NewQueryLimiter(limit int, timeout time.Duration) *QueryLimiter {
+	if limit < 1 {
+		limit = 1
+	}
+	return &QueryLimiter{
+		slots:   make(chan struct{}, limit),
+		timeout: timeout,
+	}
+}
+
+// Acquire takes a slot and returns the function releasing it. It returns
+// models.ErrTooManyQueries when no slot frees up within the queue timeout.
+func (l *QueryLimiter) Acquire() (func(), error) {
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		atomic.AddInt64(&l.waiting, 1)
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		select {
+		case l.slots <- struct{}{}:
+			atomic.AddInt64(&l.waiting, -1)
+		case <-timer.C:
+			atomic.AddInt64(&l.waiting, -1)
+			atomic.AddInt64(&l.rejected, 1)
+			return nil, models.ErrTooManyQueries
+		}
+	}
+
+	atomic.AddInt64(&l.inFlight, 1)
+	return func() {
+		atomic.AddInt64(&l.inFlight, -1)
+		<-l.slots
+	}, nil
+}
+
+// Stats reports the limiter's current load
+func (l *QueryLimiter) Stats() *models.QueryLimiterStats {
+	return &models.QueryLimiterStats{
+		Limit:          cap(l.slots),
+		InFlight:       int(atomic.LoadInt64(&l.inFlight)),
+		Waiting:        int(atomic.LoadInt64(&l.waiting)),
+		Rejected:       atomic.LoadInt64(&l.rejected),
+		QueueTimeoutMs: l.timeout.Milliseconds(),
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+)
+
+// Encodings of the raw_content column
+const (
+	rawEncodingGzip     = "gzip"
+	rawEncodingIdentity = "identity"
+)
+
+// rawContentMigrationBatch is how many files CompressStoredRawContent reads at a time
+const rawContentMigrationBatch = 20
+
+// encodeRawContent compresses a raw upload for storage when compression is enabled.
+// Uploads gzip doesn't shrink are stored as they are.
+func (s *DBService) encodeRawContent(raw []byte) ([]byte, string, error) {
+	if !s.compressRaw || raw == nil {
+		return raw, rawEncodingIdentity, nil
+	}
+
+	var buf bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to compress raw content: %w", err)
+	}
+	if _, err := writer.Write(raw); err != nil {
+		return nil, "", fmt.Errorf("failed to compress raw content: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", fmt.Errorf("failed to compress raw content: %w", err)
+	}
+	if buf.Len() >= len(raw) {
+		return raw, rawEncodingIdentity, nil
+	}
+	return buf.Bytes(), rawEncodingGzip, nil
+}
+
+// decodeRawContent returns the raw upload stored with the given encoding
+func decodeRawContent(stored []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case rawEncodingIdentity:
+		return stored, nil
+	case rawEncodingGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(stored))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress raw content: %w", err)
+		}
+		defer reader.Close()
+		raw, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress raw content: %w", err)
+		}
+		return raw, nil
+	}
+	return nil, fmt.Errorf("unknown raw content encoding %q", encoding)
+}
+
+// logCompression logs how much compressing a file's raw upload saved
+func logCompression(fileID int, raw, stored []byte) {
+	if len(stored) == 0 {
+		return
+	}
+	log.Printf("Compressed raw content of file %d: %d -> %d bytes (%.1fx)",
+		fileID, len(raw), len(stored), float64(len(raw))/float64(len(stored)))
+}
+
+// CompressStoredRawContent compresses the raw uploads stored before compression was
+// enabled. It returns how many files were compressed; files gzip doesn't shrink stay
+// as they are.
+func (s *DBService) CompressStoredRawContent(ctx context.Context) (int, error) {
+	if !s.compressRaw {
+		return 0, nil
+	}
+
+	compressed, lastID := 0, 0
+	for {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT id, raw_content FROM csv_files
+			WHERE id > $1 AND raw_content_encoding = $2 AND raw_content IS NOT NULL
+			ORDER BY id
+			LIMIT $3
+		`, lastID, rawEncodingIdentity, rawContentMigrationBatch)
+		if err != nil {
+			return compressed, fmt.Errorf("failed to query raw content: %w", err)
+		}
+		type pending struct {
+			id  int
+			raw []byte
+		}
+		var batch []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.id, &p.raw); err != nil {
+				rows.Close()
+				return compressed, fmt.Errorf("failed to scan raw content: %w", err)
+			}
+			batch = append(batch, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return compressed, fmt.Errorf("failed to query raw content: %w", err)
+		}
+		if len(batch) == 0 {
+			return compressed, nil
+		}
+
+		for _, p := range batch {
+			lastID = p.id
+			stored, encoding, err := s.encodeRawContent(p.raw)
+			if err != nil {
+				return compressed, err
+			}
+			if encoding == rawEncodingIdentity {
+				continue
+			}
+			_, err = s.db.ExecContext(ctx, `
+				UPDATE csv_files SET raw_content = $1, raw_content_encoding = $2
+				WHERE id = $3 AND raw_content_encoding = $4
+			`, stored, encoding, p.id, rawEncodingIdentity)
+			if err != nil {
+				return compressed, fmt.Errorf("failed to store compressed raw content: %w", err)
+			}
+			logCompression(p.id, p.raw, stored)
+			compressed++
+		}
+	}
+}
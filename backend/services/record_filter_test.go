@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"csv-processor/database"
+	"csv-processor/models"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWhereClauseFieldFilters(t *testing.T) {
+	filter := &RecordFilter{
+		Equals:   map[string]string{"City": "Boston", `Note"; DROP TABLE records; --`: "x"},
+		HasValue: []string{"Email"},
+	}
+	if !filter.FiltersFields() {
+		t.Fatal("FiltersFields() = false for a filter on fields")
+	}
+
+	where, args, err := filter.whereClause([]int{7}, "plainto_tsquery", nil)
+	if err != nil {
+		t.Fatalf("whereClause() error: %v", err)
+	}
+	wantWhere := "WHERE csv_file_id = $1 AND " + activeGeneration("$1") +
+		" AND cleaned_data @> $2::jsonb" +
+		" AND cleaned_data ? $3 AND NOT cleaned_data @> jsonb_build_object($3::text, '')"
+	if where != wantWhere {
+		t.Errorf("whereClause() =\n%s\nwant\n%s", where, wantWhere)
+	}
+	// Every equality goes into one containment document; column names stay in the parameters
+	wantArgs := []interface{}{7, `{"City":"Boston","Note\"; DROP TABLE records; --":"x"}`, "Email"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("whereClause() args = %v, want %v", args, wantArgs)
+	}
+}
+
+func TestWhereClauseFieldFiltersAfterSearch(t *testing.T) {
+	filter := &RecordFilter{Query: "engineer", Group: "software engineer", Equals: map[string]string{"City": "Boston"}}
+	where, args, err := filter.whereClause([]int{7}, "plainto_tsquery", nil)
+	if err != nil {
+		t.Fatalf("whereClause() error: %v", err)
+	}
+	if !strings.HasSuffix(where, " AND cleaned_data @> $5::jsonb") {
+		t.Errorf("whereClause() doesn't end with the containment filter numbered after the search and group:\n%s", where)
+	}
+	if len(args) != 5 || args[4] != `{"City":"Boston"}` {
+		t.Errorf("whereClause() args = %v, want the containment document last", args)
+	}
+}
+
+// TestFieldFilterUsesIndex needs PostgreSQL, see testDBService. It stores 50,000
+// records and checks the planner serves a selective equality from the GIN index on
+// cleaned_data instead of scanning the file's records.
+func TestFieldFilterUsesIndex(t *testing.T) {
+	db := testDBService(t)
+	file, err := db.CreateCSVFile("field-filters.csv", 0, nil, "", "", "", nil, nil, "")
+	if err != nil {
+		t.Fatalf("CreateCSVFile() error: %v", err)
+	}
+	t.Cleanup(func() { db.DeleteCSVFile(file.ID, "test") })
+
+	records := make([]*models.Record, 50000)
+	for i := range records {
+		data := map[string]string{
+			"Name":  fmt.Sprintf("Person %d", i),
+			"City":  fmt.Sprintf("City %d", i%5000),
+			"Email": fmt.Sprintf("person%d@example.com", i),
+		}
+		records[i] = &models.Record{CSVFileID: file.ID, OriginalData: data, CleanedData: data, RowNumber: i + 1}
+	}
+	if _, err := db.ReplaceRecords(context.Background(), file.ID, 1, records); err != nil {
+		t.Fatalf("ReplaceRecords() error: %v", err)
+	}
+	if _, err := database.DB.Exec(`ANALYZE records`); err != nil {
+		t.Fatalf("ANALYZE error: %v", err)
+	}
+
+	filter := &RecordFilter{Equals: map[string]string{"City": "City 42"}}
+	where, args, err := filter.whereClause([]int{file.ID}, db.tsqueryFunc(), nil)
+	if err != nil {
+		t.Fatalf("whereClause() error: %v", err)
+	}
+	rows, err := database.DB.Query(`EXPLAIN SELECT id FROM records `+where, args...)
+	if err != nil {
+		t.Fatalf("EXPLAIN error: %v", err)
+	}
+	defer rows.Close()
+	var plan strings.Builder
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			t.Fatal(err)
+		}
+		plan.WriteString(line + "\n")
+	}
+
+	if !strings.Contains(plan.String(), "idx_records_cleaned_data") {
+		t.Errorf("selective field filter doesn't use the cleaned_data index:\n%s", plan.String())
+	}
+	if strings.Contains(plan.String(), "Seq Scan on records") {
+		t.Errorf("selective field filter scans records:\n%s", plan.String())
+	}
+
+	found, total, err := db.FilterRecords([]int{file.ID}, filter, 100, 0, nil)
+	if err != nil {
+		t.Fatalf("FilterRecords() error: %v", err)
+	}
+	if total != 10 || len(found) != 10 {
+		t.Errorf("FilterRecords() found %d of %d records, want 10", len(found), total)
+	}
+}
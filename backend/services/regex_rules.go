@@ -0,0 +1,150 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// maxPatternLength caps the source length of a regex rule
+	maxPatternLength = 500
+	// maxPatternInstructions caps the size of a compiled regex program
+	maxPatternInstructions = 5000
+	// maxRegexInputLength caps how much of a value regex rules look at
+	maxRegexInputLength = 1000
+	// regexMatchBudget is the time allowed for regex rules on a single value
+	regexMatchBudget = 5 * time.Millisecond
+)
+
+// RegexRule maps values matching a pattern to a group. Rules with a higher
+// priority are tried first; ties go to the longer pattern.
+type RegexRule struct {
+	Pattern  *regexp.Regexp
+	Category string
+	Priority int
+}
+
+// RegexRuleDefinition is the serialized form of a RegexRule
+type RegexRuleDefinition struct {
+	Pattern  string `json:"pattern"`
+	Category string `json:"category"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+// RulesFile is the layout of the optional grouping rules config file. Categories
+// add to or replace the built-in keyword definitions.
+type RulesFile struct {
+	Categories map[string][]string   `json:"categories,omitempty"`
+	Patterns   []RegexRuleDefinition `json:"patterns"`
+}
+
+// loadedRules is a rules file that passed validation
+type loadedRules struct {
+	Categories map[string][]string
+	RegexRules []*RegexRule
+}
+
+// CompileRegexRule validates and compiles a regex rule, rejecting patterns that are
+// too long or compile to an excessively large program
+func CompileRegexRule(def RegexRuleDefinition) (*RegexRule, error) {
+	if strings.TrimSpace(def.Category) == "" {
+		return nil, fmt.Errorf("pattern %q has no category", def.Pattern)
+	}
+	if def.Pattern == "" {
+		return nil, fmt.Errorf("empty pattern for category %q", def.Category)
+	}
+	if len(def.Pattern) > maxPatternLength {
+		return nil, fmt.Errorf("pattern %q is longer than %d characters", def.Pattern, maxPatternLength)
+	}
+
+	parsed, err := syntax.Parse(def.Pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", def.Pattern, err)
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", def.Pattern, err)
+	}
+	if len(prog.Inst) > maxPatternInstructions {
+		return nil, fmt.Errorf("pattern %q is too complex (%d instructions, max %d)",
+			def.Pattern, len(prog.Inst), maxPatternInstructions)
+	}
+
+	pattern, err := regexp.Compile(def.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", def.Pattern, err)
+	}
+
+	return &RegexRule{
+		Pattern:  pattern,
+		Category: strings.ToLower(strings.TrimSpace(def.Category)),
+		Priority: def.Priority,
+	}, nil
+}
+
+// loadRulesFile reads and validates the categories and regex rules of a JSON rules file
+func loadRulesFile(path string) (*loadedRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+
+	var file RulesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse rules file %s: %w", path, err)
+	}
+
+	for category, keywords := range file.Categories {
+		if strings.TrimSpace(category) == "" {
+			return nil, fmt.Errorf("rules file %s: category with empty name", path)
+		}
+		for i, keyword := range keywords {
+			if strings.TrimSpace(keyword) == "" {
+				return nil, fmt.Errorf("rules file %s, category %q: keyword #%d is empty", path, category, i+1)
+			}
+		}
+	}
+
+	loaded := &loadedRules{
+		Categories: file.Categories,
+		RegexRules: make([]*RegexRule, 0, len(file.Patterns)),
+	}
+	for i, def := range file.Patterns {
+		rule, err := CompileRegexRule(def)
+		if err != nil {
+			return nil, fmt.Errorf("rules file %s, pattern #%d: %w", path, i+1, err)
+		}
+		loaded.RegexRules = append(loaded.RegexRules, rule)
+	}
+
+	return loaded, nil
+}
+
+// sortRegexRules orders rules by priority, then pattern length, then pattern text
+func sortRegexRules(rules []*RegexRule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority > rules[j].Priority
+		}
+		pi, pj := rules[i].Pattern.String(), rules[j].Pattern.String()
+		if len(pi) != len(pj) {
+			return len(pi) > len(pj)
+		}
+		return pi < pj
+	})
+}
+
+// Definition returns the serialized form of a rule
+func (r *RegexRule) Definition() RegexRuleDefinition {
+	return RegexRuleDefinition{
+		Pattern:  r.Pattern.String(),
+		Category: r.Category,
+		Priority: r.Priority,
+	}
+}
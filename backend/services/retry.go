@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"csv-processor/database"
+	"csv-processor/models"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// transientSQLStates are the Postgres error codes worth retrying: the server went
+// away or asked us to try the transaction again
+var transientSQLStates = map[pq.ErrorCode]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// isTransient reports whether err is likely to go away on its own, e.g. during a
+// database failover or while the circuit breaker is open. Constraint violations and
+// bugs on our side are not.
+func isTransient(err error) bool {
+	if errors.Is(err, database.ErrCircuitOpen) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Class 08 covers every connection exception
+		return pqErr.Code.Class() == "08" || transientSQLStates[pqErr.Code]
+	}
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryPolicy retries operations failing with transient errors, doubling the
+// delay after each attempt
+type retryPolicy struct {
+	attempts  int // retries after the first try
+	baseDelay time.Duration
+	maxDelay  time.Duration
+
+	retries   int64 // retries made since startup
+	exhausted int64 // operations still failing after the last retry
+}
+
+// do runs fn until it succeeds, fails with a permanent error, runs out of retries
+// or ctx ends. onRetry is called before each retry.
+func (p *retryPolicy) do(ctx context.Context, fn func() error, onRetry func(err error, delay time.Duration)) error {
+	delay := p.baseDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isTransient(err) {
+			return err
+		}
+		if attempt >= p.attempts {
+			atomic.AddInt64(&p.exhausted, 1)
+			return err
+		}
+
+		atomic.AddInt64(&p.retries, 1)
+		onRetry(err, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		delay *= 2
+		if delay > p.maxDelay {
+			delay = p.maxDelay
+		}
+	}
+}
+
+// stats reports how often the policy had to retry
+func (p *retryPolicy) stats() *models.RetryStats {
+	return &models.RetryStats{
+		MaxAttempts: p.attempts,
+		Retries:     atomic.LoadInt64(&p.retries),
+		Exhausted:   atomic.LoadInt64(&p.exhausted),
+	}
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"csv-processor/models"
+	"fmt"
+)
+
+// ValidateRowFilter checks that a row filter is well-formed. Column references are
+// only resolved once the file's headers are known.
+func ValidateRowFilter(filter string) error {
+	_, err := parseCondition(filter)
+	return err
+}
+
+// resolveRowFilter compiles the configured row filter against the columns of a run,
+// including computed ones. It returns nil when every row is kept.
+func (p *CSVProcessor) resolveRowFilter(columns []string, cfg *models.ProcessorConfig) (exprNode, error) {
+	if cfg == nil || cfg.RowFilter == "" {
+		return nil, nil
+	}
+
+	filter, err := parseCondition(cfg.RowFilter)
+	if err != nil {
+		return nil, fmt.Errorf("row filter: %w", err)
+	}
+	err = bindColumns(filter, func(reference string) string {
+		return p.findHeader(columns, reference)
+	}, runDateFormat(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("row filter: %w", err)
+	}
+	return filter, nil
+}
+
+// keepRow reports whether a row's cleaned values pass the filter of a run. Rows the
+// filter can't be evaluated on, such as a non-numeric value compared with a number,
+// don't pass.
+func (run *processingRun) keepRow(cleanedData map[string]string) bool {
+	if run.rowFilter == nil {
+		return true
+	}
+	value, err := run.rowFilter.eval(cleanedData)
+	return err == nil && value.truth
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"csv-processor/models"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// lintCorpusSize is the number of stored values sampled when linting rules
+const lintCorpusSize = 5000
+
+// Lint checks the category definitions for keywords that are defined more than once,
+// keywords that appear inside another category's keywords (and so compete with them
+// in partial matching), and single-word keywords so generic that they match more than
+// maxFraction of the corpus.
+func (g *CategoryGrouper) Lint(corpus []string, maxFraction float64) *models.RuleLintReport {
+	report := &models.RuleLintReport{
+		DuplicateKeywords: make([]*models.KeywordConflict, 0),
+		ShadowedKeywords:  make([]*models.KeywordShadow, 0),
+		GenericKeywords:   make([]*models.GenericKeyword, 0),
+		CorpusSize:        len(corpus),
+		MaxFraction:       maxFraction,
+	}
+
+	definitions := g.GroupDefinitions()
+	categories := make([]string, 0, len(definitions))
+	for category := range definitions {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	// keyword -> categories defining it, in sorted category order
+	owners := make(map[string][]string)
+	keywords := make([]string, 0)
+	for _, category := range categories {
+		for _, keyword := range definitions[category] {
+			keyword = strings.ToLower(keyword)
+			if len(owners[keyword]) == 0 {
+				keywords = append(keywords, keyword)
+			}
+			if !containsString(owners[keyword], category) {
+				owners[keyword] = append(owners[keyword], category)
+			}
+		}
+	}
+	sort.Strings(keywords)
+
+	for _, keyword := range keywords {
+		if len(owners[keyword]) > 1 {
+			report.DuplicateKeywords = append(report.DuplicateKeywords, &models.KeywordConflict{
+				Keyword:    keyword,
+				Categories: owners[keyword],
+			})
+		}
+	}
+
+	for _, inner := range keywords {
+		for _, outer := range keywords {
+			if inner == outer || !containsWord(outer, inner) {
+				continue
+			}
+			for _, innerCategory := range owners[inner] {
+				for _, outerCategory := range owners[outer] {
+					if innerCategory == outerCategory {
+						continue
+					}
+					report.ShadowedKeywords = append(report.ShadowedKeywords, &models.KeywordShadow{
+						Keyword:           outer,
+						Category:          outerCategory,
+						ShadowedBy:        inner,
+						ShadowingCategory: innerCategory,
+					})
+				}
+			}
+		}
+	}
+
+	if len(corpus) > 0 {
+		lowered := make([]string, len(corpus))
+		for i, value := range corpus {
+			lowered[i] = strings.ToLower(value)
+		}
+
+		for _, keyword := range keywords {
+			if strings.Contains(keyword, " ") {
+				continue
+			}
+			matches := 0
+			for _, value := range lowered {
+				if containsWord(value, keyword) {
+					matches++
+				}
+			}
+			fraction := float64(matches) / float64(len(lowered))
+			if fraction > maxFraction {
+				report.GenericKeywords = append(report.GenericKeywords, &models.GenericKeyword{
+					Keyword:       keyword,
+					Categories:    owners[keyword],
+					MatchFraction: fraction,
+				})
+			}
+		}
+	}
+
+	return report
+}
+
+// LintRules lints the grouping rules against a sample of values stored in the database,
+// falling back to the keywords themselves when nothing has been uploaded yet
+func LintRules(grouper *CategoryGrouper, dbService *DBService, maxFraction float64) (*models.RuleLintReport, error) {
+	corpus, err := dbService.SampleCleanedValues(lintCorpusSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(corpus) == 0 {
+		for _, keywords := range categoryDefinitions {
+			corpus = append(corpus, keywords...)
+		}
+	}
+
+	return grouper.Lint(corpus, maxFraction), nil
+}
+
+// lintWarnings flattens a lint report into human readable messages
+func lintWarnings(report *models.RuleLintReport) []string {
+	warnings := make([]string, 0)
+	for _, conflict := range report.DuplicateKeywords {
+		warnings = append(warnings, fmt.Sprintf("keyword %q is defined in multiple categories: %s",
+			conflict.Keyword, strings.Join(conflict.Categories, ", ")))
+	}
+	for _, shadow := range report.ShadowedKeywords {
+		warnings = append(warnings, fmt.Sprintf("keyword %q (%s) contains %q from %s",
+			shadow.Keyword, shadow.Category, shadow.ShadowedBy, shadow.ShadowingCategory))
+	}
+	for _, generic := range report.GenericKeywords {
+		warnings = append(warnings, fmt.Sprintf("keyword %q (%s) matches %.1f%% of sampled values",
+			generic.Keyword, strings.Join(generic.Categories, ", "), generic.MatchFraction*100))
+	}
+	return warnings
+}
+
+// LogLintWarnings lints the grouping rules and logs every problem found
+func LogLintWarnings(grouper *CategoryGrouper, dbService *DBService, maxFraction float64) {
+	report, err := LintRules(grouper, dbService, maxFraction)
+	if err != nil {
+		log.Printf("WARN: could not lint category rules: %v", err)
+		return
+	}
+	for _, warning := range lintWarnings(report) {
+		log.Printf("WARN: category rules: %s", warning)
+	}
+}
+
+// containsWord reports whether word appears in text as a complete word (or phrase)
+func containsWord(text, word string) bool {
+	return strings.Contains(" "+text+" ", " "+word+" ")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
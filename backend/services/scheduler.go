@@ -0,0 +1,240 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"csv-processor/config"
+	"csv-processor/models"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+// Scheduler fires the import schedules that are due. Each tick starts at most
+// maxRunsPerTick imports, so schedules that all came due during downtime are
+// spread out over the following ticks.
+type Scheduler struct {
+	dbService      *DBService
+	processor      *AsyncProcessor
+	client         *http.Client
+	tick           time.Duration
+	maxRunsPerTick int
+	maxBytes       int64
+	zipLimits      ZipLimits
+	searchLanguage string
+}
+
+// NewScheduler returns a scheduler whose imports only connect to public addresses,
+// unless SCHEDULE_ALLOW_PRIVATE_URLS=true lets them reach the server's own network
+func NewScheduler(dbService *DBService, processor *AsyncProcessor) *Scheduler {
+	timeout := time.Duration(config.GetEnvInt("SCHEDULE_FETCH_TIMEOUT_SECONDS", 60)) * time.Second
+	client := NewPublicHTTPClient(timeout)
+	if config.GetEnv("SCHEDULE_ALLOW_PRIVATE_URLS", "false") == "true" {
+		client = &http.Client{Timeout: timeout}
+	}
+	return &Scheduler{
+		dbService:      dbService,
+		processor:      processor,
+		client:         client,
+		tick:           time.Duration(config.GetEnvInt("SCHEDULER_TICK_SECONDS", 30)) * time.Second,
+		maxRunsPerTick: config.GetEnvInt("SCHEDULER_MAX_RUNS_PER_TICK", 5),
+		maxBytes:       int64(config.GetEnvInt("SCHEDULE_MAX_BYTES", 100<<20)),
+		zipLimits:      ZipLimitsFromEnv(),
+		searchLanguage: config.GetEnv("SEARCH_LANGUAGE", ""),
+	}
+}
+
+// Run fires due schedules until ctx is cancelled. Imports it started keep processing
+// under ctx, so they stop with it too.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+
+	for {
+		s.runDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDue fires the schedules that are due now
+func (s *Scheduler) runDue(ctx context.Context) {
+	schedules, err := s.dbService.DueSchedules(ctx, s.maxRunsPerTick)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Error loading due import schedules: %v", err)
+		}
+		return
+	}
+
+	for _, schedule := range schedules {
+		if ctx.Err() != nil {
+			return
+		}
+		next, err := nextScheduleRun(schedule, time.Now())
+		if err != nil {
+			log.Printf("Error scheduling import schedule %d: %v", schedule.ID, err)
+			continue
+		}
+		claimed, err := s.dbService.ClaimScheduleRun(ctx, schedule, next)
+		if err != nil {
+			log.Printf("Error claiming import schedule %d: %v", schedule.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		s.fire(ctx, schedule)
+	}
+}
+
+// fire imports the URL of a schedule and records the run, once per file it created
+func (s *Scheduler) fire(ctx context.Context, schedule *models.ImportSchedule) {
+	processing, err := s.dbService.ScheduleImportProcessing(ctx, schedule.ID)
+	if err != nil {
+		log.Printf("Error checking import schedule %d: %v", schedule.ID, err)
+		return
+	}
+
+	fileIDs := []int{0}
+	status, errorMsg := "started", ""
+	if processing {
+		status = "skipped"
+		errorMsg = "previous import is still processing"
+	} else if fileIDs, err = s.importURL(ctx, schedule); err != nil {
+		fileIDs = []int{0}
+		status, errorMsg = "failed", err.Error()
+		log.Printf("Import schedule %d failed: %v", schedule.ID, err)
+	}
+
+	for _, fileID := range fileIDs {
+		if err := s.dbService.RecordScheduleRun(ctx, schedule.ID, fileID, status, errorMsg); err != nil {
+			log.Printf("Error recording run of import schedule %d: %v", schedule.ID, err)
+		}
+	}
+}
+
+// importURL downloads the CSV of a schedule and stores it like an upload with the
+// schedule's profile: checksums the server sent are verified, content that is
+// clearly not CSV is refused, workbooks are converted and zip archives are stored
+// as a file per CSV entry. It returns the IDs of the new files.
+func (s *Scheduler) importURL(ctx context.Context, schedule *models.ImportSchedule) ([]int, error) {
+	var cfg *models.ProcessorConfig
+	if schedule.Profile != "" {
+		profile, err := s.dbService.GetProfile(schedule.Profile)
+		if errors.Is(err, models.ErrProfileNotFound) {
+			return nil, fmt.Errorf("processing profile %q no longer exists", schedule.Profile)
+		}
+		if err != nil {
+			return nil, err
+		}
+		cfg = profile.Options
+		cfg.Profile, cfg.ProfileVersion = profile.Name, profile.Version
+	}
+
+	content, header, err := s.fetch(ctx, schedule.URL)
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := ParseContentChecksums(header.Get("X-Content-SHA256"), "X-Content-SHA256", header.Get("Content-MD5"))
+	if err != nil {
+		return nil, err
+	}
+	contentSHA256, err := VerifyContentChecksums(checksums, content)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := "import.csv"
+	if u, err := url.Parse(schedule.URL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		filename = path.Base(u.Path)
+	}
+	prepared, err := PrepareUpload(filename, content, UploadOptions{ZipLimits: s.zipLimits})
+	if err != nil {
+		return nil, err
+	}
+	archive := ""
+	if prepared.Archive {
+		archive = filename
+	}
+
+	// Either every part gets a file or none does
+	files := make([]*models.CSVFile, 0, len(prepared.Parts))
+	for _, part := range prepared.Parts {
+		fileSize, sha := int64(len(part.Raw)), contentSHA256
+		if prepared.Archive {
+			sha = "" // the checksum is of the archive, not of its entries
+		}
+		file, err := s.dbService.CreateCSVFile(part.Filename, fileSize, part.Raw, part.SheetName, s.searchLanguage, schedule.Owner, nil, cfg, sha)
+		if err != nil {
+			for _, created := range files {
+				if err := s.dbService.DeleteCSVFile(created.ID, "scheduler"); err != nil {
+					log.Printf("Error deleting file %d of a failed import: %v", created.ID, err)
+				}
+			}
+			return nil, err
+		}
+		files = append(files, file)
+
+		detail := map[string]interface{}{
+			"filename":   part.Filename,
+			"fileSize":   fileSize,
+			"scheduleId": schedule.ID,
+			"url":        schedule.URL,
+			"profile":    schedule.Profile,
+		}
+		if part.SheetName != "" {
+			detail["sheetName"] = part.SheetName
+		}
+		if archive != "" {
+			detail["archive"] = archive
+		}
+		s.dbService.RecordEvent(ctx, &models.FileEvent{
+			CSVFileID: file.ID,
+			EventType: models.FileEventUploaded,
+			Actor:     "scheduler",
+			Detail:    detail,
+		})
+	}
+
+	fileIDs := make([]int, len(files))
+	for i, file := range files {
+		s.processor.ProcessCSVAsync(ctx, file.ID, bytes.NewReader(prepared.Parts[i].Content), cfg)
+		fileIDs[i] = file.ID
+	}
+	return fileIDs, nil
+}
+
+// fetch downloads the body of rawURL along with the response headers, failing on
+// error statuses and bodies over maxBytes
+func (s *Scheduler) fetch(ctx context.Context, rawURL string) ([]byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("failed to download %s: %s", rawURL, resp.Status)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, s.maxBytes+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	if int64(len(content)) > s.maxBytes {
+		return nil, nil, fmt.Errorf("download is larger than %d bytes", s.maxBytes)
+	}
+	return content, resp.Header, nil
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"csv-processor/models"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// minScheduleInterval is the shortest interval an import schedule may use
+const minScheduleInterval = time.Minute
+
+// ValidateScheduleTiming checks that a schedule has either a cron expression or an
+// interval of at least a minute
+func ValidateScheduleTiming(cron, interval string) error {
+	switch {
+	case cron != "" && interval != "":
+		return fmt.Errorf("give either cron or interval, not both")
+	case cron != "":
+		_, err := parseCron(cron)
+		return err
+	case interval != "":
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return fmt.Errorf("invalid interval: %w", err)
+		}
+		if d < minScheduleInterval {
+			return fmt.Errorf("interval must be at least %s", minScheduleInterval)
+		}
+		return nil
+	}
+	return fmt.Errorf("cron or interval is required")
+}
+
+// nextScheduleRun returns when a schedule fires next after t. Runs missed while the
+// server was down collapse into the one due now, since the next run is always
+// counted from the present.
+func nextScheduleRun(schedule *models.ImportSchedule, t time.Time) (time.Time, error) {
+	if schedule.Cron != "" {
+		cron, err := parseCron(schedule.Cron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return cron.Next(t.UTC()), nil
+	}
+	d, err := time.ParseDuration(schedule.Interval)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid interval: %w", err)
+	}
+	return t.Add(d), nil
+}
+
+// scheduleColumns are the columns scanned by scanSchedule
+const scheduleColumns = `id, url, COALESCE(cron, ''), COALESCE(interval_seconds, 0), COALESCE(profile, ''), owner,
+	enabled, next_run_at, last_run_at, created_at`
+
+// scanSchedule reads an import schedule selected with scheduleColumns
+func scanSchedule(row rowScanner) (*models.ImportSchedule, error) {
+	schedule := &models.ImportSchedule{}
+	var intervalSeconds int
+	err := row.Scan(&schedule.ID, &schedule.URL, &schedule.Cron, &intervalSeconds, &schedule.Profile, &schedule.Owner,
+		&schedule.Enabled, &schedule.NextRunAt, &schedule.LastRunAt, &schedule.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if intervalSeconds > 0 {
+		schedule.Interval = (time.Duration(intervalSeconds) * time.Second).String()
+	}
+	return schedule, nil
+}
+
+// CreateSchedule stores an import schedule, due at its first run after now
+func (s *DBService) CreateSchedule(schedule *models.ImportSchedule) (*models.ImportSchedule, error) {
+	next, err := nextScheduleRun(schedule, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	var intervalSeconds int
+	if schedule.Interval != "" {
+		d, _ := time.ParseDuration(schedule.Interval)
+		intervalSeconds = int(d / time.Second)
+	}
+
+	query := `
+		INSERT INTO import_schedules (url, cron, interval_seconds, profile, owner, enabled, next_run_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, 0), NULLIF($4, ''), $5, $6, $7)
+		RETURNING ` + scheduleColumns
+	created, err := scanSchedule(s.db.QueryRow(query, schedule.URL, schedule.Cron, intervalSeconds, schedule.Profile,
+		schedule.Owner, schedule.Enabled, next))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create import schedule: %w", err)
+	}
+	return created, nil
+}
+
+// ListSchedules returns the import schedules visible in scope, oldest first
+func (s *DBService) ListSchedules(scope OwnerScope) ([]*models.ImportSchedule, error) {
+	rows, err := s.db.Query(`SELECT `+scheduleColumns+` FROM import_schedules WHERE $1 OR owner = $2 ORDER BY id`,
+		scope.All, scope.Owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query import schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := make([]*models.ImportSchedule, 0)
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan import schedule: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+// GetSchedule returns an import schedule, or an error if it isn't visible in scope
+func (s *DBService) GetSchedule(id int, scope OwnerScope) (*models.ImportSchedule, error) {
+	row := s.db.QueryRow(`SELECT `+scheduleColumns+` FROM import_schedules WHERE id = $1 AND ($2 OR owner = $3)`,
+		id, scope.All, scope.Owner)
+	schedule, err := scanSchedule(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("import schedule not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// DeleteSchedule removes an import schedule and its run history. Imported files stay.
+func (s *DBService) DeleteSchedule(id int) error {
+	if _, err := s.db.Exec(`DELETE FROM import_schedules WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete import schedule: %w", err)
+	}
+	return nil
+}
+
+// DueSchedules returns up to limit enabled schedules whose next run has come,
+// longest overdue first
+func (s *DBService) DueSchedules(ctx context.Context, limit int) ([]*models.ImportSchedule, error) {
+	query := `SELECT ` + scheduleColumns + `
+		FROM import_schedules
+		WHERE enabled AND next_run_at <= NOW()
+		ORDER BY next_run_at
+		LIMIT $1`
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []*models.ImportSchedule
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan import schedule: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+// ClaimScheduleRun moves a due schedule on to its next run. It reports false if the
+// schedule was changed or claimed since it was read.
+func (s *DBService) ClaimScheduleRun(ctx context.Context, schedule *models.ImportSchedule, next time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE import_schedules SET next_run_at = $1, last_run_at = NOW()
+		WHERE id = $2 AND next_run_at = $3 AND enabled
+	`, next, schedule.ID, schedule.NextRunAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim schedule run: %w", err)
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim schedule run: %w", err)
+	}
+	return claimed > 0, nil
+}
+
+// ScheduleImportProcessing reports whether an earlier import of a schedule is still
+// processing
+func (s *DBService) ScheduleImportProcessing(ctx context.Context, scheduleID int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM schedule_runs r JOIN csv_files f ON f.id = r.csv_file_id
+			WHERE r.schedule_id = $1 AND f.status = 'processing'
+		)
+	`
+	var processing bool
+	if err := s.db.QueryRowContext(ctx, query, scheduleID).Scan(&processing); err != nil {
+		return false, fmt.Errorf("failed to check schedule imports: %w", err)
+	}
+	return processing, nil
+}
+
+// RecordScheduleRun appends a run to a schedule's history. fileID is 0 when no file
+// was imported.
+func (s *DBService) RecordScheduleRun(ctx context.Context, scheduleID, fileID int, status, errorMsg string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO schedule_runs (schedule_id, csv_file_id, status, error_message)
+		VALUES ($1, NULLIF($2, 0), $3, NULLIF($4, ''))
+	`, scheduleID, fileID, status, errorMsg)
+	if err != nil {
+		return fmt.Errorf("failed to record schedule run: %w", err)
+	}
+	return nil
+}
+
+// GetScheduleRuns returns the latest runs of a schedule, newest first. Runs that
+// imported a file report the file's status, or deleted once it is gone.
+func (s *DBService) GetScheduleRuns(scheduleID, limit int) ([]*models.ScheduleRun, error) {
+	query := `
+		SELECT r.id, r.schedule_id, r.csv_file_id,
+		       CASE WHEN r.csv_file_id IS NULL THEN r.status ELSE COALESCE(f.status, 'deleted') END,
+		       COALESCE(r.error_message, f.error_message, ''), r.started_at
+		FROM schedule_runs r
+		LEFT JOIN csv_files f ON f.id = r.csv_file_id
+		WHERE r.schedule_id = $1
+		ORDER BY r.started_at DESC, r.id DESC
+		LIMIT $2
+	`
+	rows, err := s.db.Query(query, scheduleID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schedule runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := make([]*models.ScheduleRun, 0)
+	for rows.Next() {
+		run := &models.ScheduleRun{}
+		var fileID sql.NullInt64
+		if err := rows.Scan(&run.ID, &run.ScheduleID, &fileID, &run.Status, &run.ErrorMessage, &run.StartedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schedule run: %w", err)
+		}
+		if fileID.Valid {
+			id := int(fileID.Int64)
+			run.FileID = &id
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"csv-processor/models"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONSchema is the subset of JSON Schema used to validate records. Cleaned values
+// are always strings, so types are checked by whether the text parses as that type.
+type JSONSchema struct {
+	Type                 schemaTypes            `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Format               string                 `json:"format,omitempty"` // date, date-time, email
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes accepts both "type": "string" and "type": ["string", "null"]
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings")
+	}
+	*t = multiple
+	return nil
+}
+
+var supportedSchemaTypes = map[string]bool{
+	"string": true, "number": true, "integer": true, "boolean": true, "null": true,
+}
+
+var supportedSchemaFormats = map[string]bool{
+	"": true, "date": true, "date-time": true, "email": true,
+}
+
+// ParseJSONSchema parses a record schema, rejecting keywords this validator cannot check
+func ParseJSONSchema(data []byte) (*JSONSchema, error) {
+	var schema JSONSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	for _, t := range schema.Type {
+		if t != "object" {
+			return nil, fmt.Errorf("invalid schema: root type must be object, got %q", t)
+		}
+	}
+
+	for field, property := range schema.Properties {
+		if property == nil {
+			return nil, fmt.Errorf("invalid schema: property %q is null", field)
+		}
+		if len(property.Properties) > 0 {
+			return nil, fmt.Errorf("invalid schema: property %q: nested objects are not supported", field)
+		}
+		for _, t := range property.Type {
+			if !supportedSchemaTypes[t] {
+				return nil, fmt.Errorf("invalid schema: property %q: unsupported type %q", field, t)
+			}
+		}
+		if !supportedSchemaFormats[property.Format] {
+			return nil, fmt.Errorf("invalid schema: property %q: unsupported format %q", field, property.Format)
+		}
+		if property.Pattern != "" {
+			compiled, err := regexp.Compile(property.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid schema: property %q: %w", field, err)
+			}
+			property.pattern = compiled
+		}
+	}
+
+	return &schema, nil
+}
+
+// ValidateRecord checks the cleaned data of a record against the schema. Empty cells
+// count as missing: they fail required and skip every other check.
+func (s *JSONSchema) ValidateRecord(record *models.Record) []*models.SchemaViolation {
+	violations := make([]*models.SchemaViolation, 0)
+	add := func(field, message string) {
+		violations = append(violations, &models.SchemaViolation{RecordID: record.ID, Field: field, Error: message})
+	}
+
+	for _, field := range s.Required {
+		if strings.TrimSpace(record.CleanedData[field]) == "" {
+			add(field, "is required")
+		}
+	}
+
+	fields := make([]string, 0, len(record.CleanedData))
+	for field := range record.CleanedData {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		value := record.CleanedData[field]
+		property, ok := s.Properties[field]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties && field != categoryInputKey {
+				add(field, "is not allowed by the schema")
+			}
+			continue
+		}
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		if message := property.check(value); message != "" {
+			add(field, message)
+		}
+	}
+
+	return violations
+}
+
+// check validates a single non-empty value and returns what is wrong with it
+func (s *JSONSchema) check(value string) string {
+	if len(s.Type) > 0 {
+		matched := false
+		for _, t := range s.Type {
+			if valueHasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Sprintf("%q is not of type %s", value, strings.Join(s.Type, " or "))
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		allowed := false
+		for _, option := range s.Enum {
+			if fmt.Sprint(option) == value {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("%q is not one of the allowed values", value)
+		}
+	}
+
+	length := len([]rune(value))
+	if s.MinLength != nil && length < *s.MinLength {
+		return fmt.Sprintf("is shorter than %d characters", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		return fmt.Sprintf("is longer than %d characters", *s.MaxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(value) {
+		return fmt.Sprintf("%q does not match pattern %s", value, s.Pattern)
+	}
+
+	if s.Minimum != nil || s.Maximum != nil {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Sprintf("%q is not a number", value)
+		}
+		if s.Minimum != nil && number < *s.Minimum {
+			return fmt.Sprintf("%v is less than the minimum of %v", number, *s.Minimum)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			return fmt.Sprintf("%v is greater than the maximum of %v", number, *s.Maximum)
+		}
+	}
+
+	switch s.Format {
+	case "date":
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return fmt.Sprintf("%q is not a date (YYYY-MM-DD)", value)
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return fmt.Sprintf("%q is not an RFC 3339 date-time", value)
+		}
+	case "email":
+		if _, err := mail.ParseAddress(value); err != nil {
+			return fmt.Sprintf("%q is not an email address", value)
+		}
+	}
+
+	return ""
+}
+
+// valueHasType reports whether a cell's text can be read as the given schema type
+func valueHasType(value, schemaType string) bool {
+	switch schemaType {
+	case "string":
+		return true
+	case "number":
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	case "integer":
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	case "boolean":
+		_, err := strconv.ParseBool(strings.ToLower(value))
+		return err == nil
+	case "null":
+		return value == ""
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWhereClauseSearchLanguage(t *testing.T) {
+	filter := &RecordFilter{Query: "Haus"}
+
+	where, _, err := filter.whereClause([]int{1}, "plainto_tsquery", nil)
+	if err != nil {
+		t.Fatalf("whereClause() error: %v", err)
+	}
+	if !strings.Contains(where, "plainto_tsquery("+fileSearchConfig+", $2)") {
+		t.Errorf("single file search doesn't use the file's language:\n%s", where)
+	}
+
+	where, _, err = filter.whereClause([]int{1, 2}, "plainto_tsquery", nil)
+	if err != nil {
+		t.Fatalf("whereClause() error: %v", err)
+	}
+	if !strings.Contains(where, "plainto_tsquery("+recordSearchConfig+", $2)") {
+		t.Errorf("dataset search doesn't use the language of each record's file:\n%s", where)
+	}
+}
+
+// TestSearchGermanFixture needs PostgreSQL, see testDBService
+func TestSearchGermanFixture(t *testing.T) {
+	db := testDBService(t)
+	files := map[string]int{"german": storeFixture(t, db, "german.csv", "german"), "simple": storeFixture(t, db, "german.csv", "")}
+
+	tests := []struct {
+		query string
+		want  map[string]int // language -> records found
+	}{
+		{"Häuser", map[string]int{"german": 1, "simple": 1}},
+		{"Haus", map[string]int{"german": 1, "simple": 0}},       // stems to the same word as Häuser
+		{"Verkäufern", map[string]int{"german": 1, "simple": 0}}, // dative plural of Verkäufer
+		{"Katze", map[string]int{"german": 0, "simple": 0}},
+	}
+	for _, tt := range tests {
+		for language, fileID := range files {
+			_, total, err := db.SearchRecords(fileID, tt.query, 10, 0, nil, nil, nil)
+			if err != nil {
+				t.Fatalf("SearchRecords(%q) error: %v", tt.query, err)
+			}
+			if total != tt.want[language] {
+				t.Errorf("SearchRecords(%q) on the file indexed in %s found %d records, want %d", tt.query, language, total, tt.want[language])
+			}
+		}
+	}
+}
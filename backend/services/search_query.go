@@ -0,0 +1,159 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SearchQuery is a parsed web-style search: groups of terms separated by OR, where
+// every term of a group must match
+type SearchQuery struct {
+	Groups [][]SearchTerm
+}
+
+// SearchTerm is a word or quoted phrase, optionally negated with a leading "-"
+type SearchTerm struct {
+	Text    string
+	Negated bool
+}
+
+// ParseSearchQuery parses words, "quoted phrases", OR and -exclusions the way
+// websearch_to_tsquery reads them, rejecting queries it would silently misread
+func ParseSearchQuery(query string) (*SearchQuery, error) {
+	parsed := &SearchQuery{}
+	group := make([]SearchTerm, 0)
+	pendingOr := false
+
+	closeGroup := func() error {
+		if len(group) == 0 {
+			return fmt.Errorf("OR must be between two terms")
+		}
+		positive := false
+		for _, term := range group {
+			if !term.Negated {
+				positive = true
+			}
+		}
+		if !positive {
+			return fmt.Errorf("exclusions need at least one term to search for")
+		}
+		parsed.Groups = append(parsed.Groups, group)
+		group = make([]SearchTerm, 0)
+		return nil
+	}
+
+	rest := strings.TrimSpace(query)
+	for rest != "" {
+		negated := false
+		if strings.HasPrefix(rest, "-") {
+			negated = true
+			rest = rest[1:]
+		}
+
+		var text string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed quote")
+			}
+			text = strings.Join(strings.Fields(rest[1:end+1]), " ")
+			rest = rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, " \t\"")
+			if end < 0 {
+				end = len(rest)
+			}
+			text = rest[:end]
+			rest = rest[end:]
+		}
+		rest = strings.TrimSpace(rest)
+
+		if text == "" {
+			if negated {
+				return nil, fmt.Errorf("- must be followed by a term")
+			}
+			continue
+		}
+		if !negated && text == "OR" {
+			if pendingOr {
+				return nil, fmt.Errorf("OR must be between two terms")
+			}
+			if err := closeGroup(); err != nil {
+				return nil, err
+			}
+			pendingOr = true
+			continue
+		}
+		pendingOr = false
+		group = append(group, SearchTerm{Text: text, Negated: negated})
+	}
+
+	if pendingOr {
+		return nil, fmt.Errorf("OR must be between two terms")
+	}
+	if len(group) > 0 || len(parsed.Groups) == 0 {
+		if err := closeGroup(); err != nil {
+			return nil, err
+		}
+	}
+	return parsed, nil
+}
+
+// looksLikeValue reports whether a search term looks like a complete value, such as
+// an email, a phone or order number or a date, rather than words. Text search splits
+// these into fragments, so they are matched whole instead.
+func looksLikeValue(term string) bool {
+	return !strings.Contains(term, " ") && strings.ContainsAny(term, "0123456789@")
+}
+
+// hasValueTerms reports whether any term of the query looks like a complete value
+func (q *SearchQuery) hasValueTerms() bool {
+	for _, group := range q.Groups {
+		for _, term := range group {
+			if looksLikeValue(term.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// likePredicate builds a SQL predicate matching the query literally against the
+// cleaned data and group of a record, appending its parameters to args. Terms that
+// look like complete values must equal the cleaned value of one of valueColumns:
+// each column is a @> containment test, which the GIN indexes on cleaned_data serve,
+// where a substring match reads every record of the file. Without valueColumns every
+// term is matched as a substring.
+func (q *SearchQuery) likePredicate(args []interface{}, valueColumns []string) (string, []interface{}) {
+	groups := make([]string, 0, len(q.Groups))
+	for _, group := range q.Groups {
+		conditions := make([]string, 0, len(group))
+		for _, term := range group {
+			var condition string
+			if looksLikeValue(term.Text) && len(valueColumns) > 0 {
+				contained := make([]string, 0, len(valueColumns))
+				for _, column := range valueColumns {
+					value, _ := json.Marshal(map[string]string{column: term.Text})
+					args = append(args, string(value))
+					contained = append(contained, fmt.Sprintf("cleaned_data @> $%d::jsonb", len(args)))
+				}
+				condition = "(" + strings.Join(contained, " OR ") + ")"
+			} else {
+				args = append(args, "%"+escapeLike(term.Text)+"%")
+				condition = fmt.Sprintf("(cleaned_data::text ILIKE $%d OR COALESCE(grouped_category, '') ILIKE $%d)", len(args), len(args))
+			}
+			if term.Negated {
+				condition = "NOT " + condition
+			}
+			conditions = append(conditions, condition)
+		}
+		groups = append(groups, "("+strings.Join(conditions, " AND ")+")")
+	}
+	return "(" + strings.Join(groups, " OR ") + ")", args
+}
+
+// SearchSyntaxHelp describes the search syntax for error responses
+const SearchSyntaxHelp = `Search syntax: words must all match, "quoted phrases" match exactly, ` +
+	`OR between terms matches either side, and a leading - excludes a word or phrase (e.g. "project manager" OR director -intern). ` +
+	`Terms with digits or an @, such as emails and order numbers, must equal a whole value; use mode=substring to find them inside values`
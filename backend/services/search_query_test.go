@@ -0,0 +1,123 @@
+package services
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    [][]SearchTerm
+		wantErr string
+	}{
+		{query: "manager", want: [][]SearchTerm{{{Text: "manager"}}}},
+		{query: "project manager", want: [][]SearchTerm{{{Text: "project"}, {Text: "manager"}}}},
+		{query: `"project   manager"`, want: [][]SearchTerm{{{Text: "project manager"}}}},
+		{query: "developer OR designer", want: [][]SearchTerm{{{Text: "developer"}}, {{Text: "designer"}}}},
+		{query: "project -intern", want: [][]SearchTerm{{{Text: "project"}, {Text: "intern", Negated: true}}}},
+		{
+			query: `"project manager" OR director -"vice president"`,
+			want:  [][]SearchTerm{{{Text: "project manager"}}, {{Text: "director"}, {Text: "vice president", Negated: true}}},
+		},
+		{query: "or", want: [][]SearchTerm{{{Text: "or"}}}},
+		{query: `"project manager`, wantErr: "unclosed quote"},
+		{query: "OR manager", wantErr: "OR must be between two terms"},
+		{query: "manager OR", wantErr: "OR must be between two terms"},
+		{query: "manager OR OR director", wantErr: "OR must be between two terms"},
+		{query: "-intern", wantErr: "exclusions need at least one term"},
+		{query: "manager -", wantErr: "- must be followed by a term"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			parsed, err := ParseSearchQuery(tt.query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseSearchQuery(%q) error = %v, want one mentioning %q", tt.query, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSearchQuery(%q) unexpected error: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(parsed.Groups, tt.want) {
+				t.Errorf("ParseSearchQuery(%q) = %+v, want %+v", tt.query, parsed.Groups, tt.want)
+			}
+		})
+	}
+}
+
+func TestLikePredicate(t *testing.T) {
+	parsed, err := ParseSearchQuery(`"project manager" OR developer -intern`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	predicate, args := parsed.likePredicate([]interface{}{1, "query"}, nil)
+
+	want := "(((cleaned_data::text ILIKE $3 OR COALESCE(grouped_category, '') ILIKE $3)) OR " +
+		"((cleaned_data::text ILIKE $4 OR COALESCE(grouped_category, '') ILIKE $4) AND " +
+		"NOT (cleaned_data::text ILIKE $5 OR COALESCE(grouped_category, '') ILIKE $5)))"
+	if predicate != want {
+		t.Errorf("likePredicate() =\n%s\nwant\n%s", predicate, want)
+	}
+	if wantArgs := []interface{}{1, "query", "%project manager%", "%developer%", "%intern%"}; !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("likePredicate() args = %v, want %v", args, wantArgs)
+	}
+}
+
+func TestLikePredicateValueTerms(t *testing.T) {
+	parsed, err := ParseSearchQuery("ada@example.com 50%")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	predicate, args := parsed.likePredicate(nil, []string{"Email", "Name"})
+	want := "(((cleaned_data @> $1::jsonb OR cleaned_data @> $2::jsonb) AND (cleaned_data @> $3::jsonb OR cleaned_data @> $4::jsonb)))"
+	if predicate != want {
+		t.Errorf("likePredicate() =\n%s\nwant\n%s", predicate, want)
+	}
+	wantArgs := []interface{}{`{"Email":"ada@example.com"}`, `{"Name":"ada@example.com"}`, `{"Email":"50%"}`, `{"Name":"50%"}`}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("likePredicate() args = %v, want %v", args, wantArgs)
+	}
+
+	// Without value columns, the same terms are substrings with wildcards escaped
+	_, args = parsed.likePredicate(nil, nil)
+	if wantArgs := []interface{}{"%ada@example.com%", `%50\%%`}; !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("likePredicate() args = %v, want %v", args, wantArgs)
+	}
+}
+
+// TestSearchSyntaxFixture needs PostgreSQL, see testDBService
+func TestSearchSyntaxFixture(t *testing.T) {
+	db := testDBService(t)
+	fileID := storeFixture(t, db, "people.csv", "english")
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`"project manager"`, []string{"Ada"}},
+		{"project manager", []string{"Ada", "Grace"}},
+		{"developer OR designer", []string{"Linus", "Margaret"}},
+		{`"project manager" OR developer`, []string{"Ada", "Linus"}},
+		{"project -intern", []string{"Ada", "Grace"}},
+		{`manager -"manager of projects"`, []string{"Ada"}},
+	}
+	for _, tt := range tests {
+		records, _, err := db.SearchRecords(fileID, tt.query, 10, 0, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("SearchRecords(%q) error: %v", tt.query, err)
+		}
+		var names []string
+		for _, record := range records {
+			names = append(names, record.CleanedData["Name"])
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("SearchRecords(%q) = %v, want %v", tt.query, names, tt.want)
+		}
+	}
+}
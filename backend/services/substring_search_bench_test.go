@@ -0,0 +1,65 @@
+package services
+
+import (
+	"csv-processor/database"
+	"testing"
+)
+
+// BenchmarkSubstringSearch_1M finds an order number fragment among 1,000,000 records
+// with mode=substring, once through the pg_trgm index and once with index scans
+// disabled, which is how the ILIKE search ran before the index. It needs PostgreSQL,
+// see testDBService. Storing the records takes a minute or two.
+func BenchmarkSubstringSearch_1M(b *testing.B) {
+	db := testDBService(b)
+	if installed, err := db.HasTrigramSupport(); err != nil || !installed {
+		b.Skip("pg_trgm is not installed")
+	}
+
+	file, err := db.CreateCSVFile("substring-search.csv", 0, nil, "", "", "", nil, nil, "")
+	if err != nil {
+		b.Fatalf("CreateCSVFile() error: %v", err)
+	}
+	b.Cleanup(func() { db.DeleteCSVFile(file.ID, "test") })
+	_, err = database.DB.Exec(`
+		INSERT INTO records (csv_file_id, original_data, cleaned_data, row_number)
+		SELECT $1, data, data, i
+		FROM generate_series(1, 1000000) AS i,
+		     LATERAL (SELECT jsonb_build_object(
+		         'Name', 'Person ' || i,
+		         'Order', 'ORD-' || lpad(i::text, 7, '0'),
+		         'City', 'City ' || (i % 5000)) AS data) AS row_data`, file.ID)
+	if err != nil {
+		b.Fatalf("failed to store the records: %v", err)
+	}
+	if _, err := database.DB.Exec(`ANALYZE records`); err != nil {
+		b.Fatalf("ANALYZE error: %v", err)
+	}
+
+	filter := &RecordFilter{Query: "ORD-004242", Substring: true}
+	where, args, err := filter.whereClause([]int{file.ID}, db.tsqueryFunc(), nil)
+	if err != nil {
+		b.Fatalf("whereClause() error: %v", err)
+	}
+	search := func(b *testing.B, indexScans bool) {
+		matches := 0
+		for i := 0; i < b.N; i++ {
+			tx, err := database.DB.Begin()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if !indexScans {
+				if _, err := tx.Exec(`SET LOCAL enable_bitmapscan = off; SET LOCAL enable_indexscan = off`); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := tx.QueryRow(`SELECT COUNT(*) FROM records `+where, args...).Scan(&matches); err != nil {
+				b.Fatal(err)
+			}
+			tx.Rollback()
+		}
+		b.ReportMetric(float64(matches), "matches")
+	}
+
+	b.Run("TrigramIndex", func(b *testing.B) { search(b, true) })
+	b.Run("SeqScan", func(b *testing.B) { search(b, false) })
+}
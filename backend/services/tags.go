@@ -0,0 +1,67 @@
+package services
+
+import (
+	"csv-processor/models"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// NormalizeTags trims and lowercases tags, dropping blanks and duplicates while
+// keeping the first occurrence order
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// UpdateCSVFileTags replaces the tags of a file
+func (s *DBService) UpdateCSVFileTags(fileID int, tags []string) error {
+	result, err := s.db.Exec(`UPDATE csv_files SET tags = $1 WHERE id = $2`, pq.Array(tags), fileID)
+	if err != nil {
+		return fmt.Errorf("failed to update tags: %w", err)
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return fmt.Errorf("CSV file not found")
+	}
+	return nil
+}
+
+// GetTagCounts lists every tag in use with the number of files carrying it, most
+// used first
+func (s *DBService) GetTagCounts(scope OwnerScope) ([]*models.TagCount, error) {
+	var args []interface{}
+	where := ""
+	if condition := scope.condition("owner", &args); condition != "" {
+		where = "WHERE " + condition
+	}
+	rows, err := s.db.Query(`
+		SELECT tag, COUNT(*)
+		FROM csv_files, unnest(tags) AS tag
+		`+where+`
+		GROUP BY tag
+		ORDER BY COUNT(*) DESC, tag
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make([]*models.TagCount, 0)
+	for rows.Next() {
+		count := &models.TagCount{}
+		if err := rows.Scan(&count.Tag, &count.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
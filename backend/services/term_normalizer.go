@@ -0,0 +1,473 @@
+package services
+
+import (
+	"csv-processor/config"
+	"csv-processor/models"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minFuzzyTermLength keeps short terms (mostly acronyms) out of fuzzy matching
+const minFuzzyTermLength = 4
+
+// trieNode is a node of the variation trie. canonical is set when the path from
+// the root spells a known variation.
+type trieNode struct {
+	children  map[rune]*trieNode
+	canonical string
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{children: make(map[rune]*trieNode)}
+}
+
+// TermNormalizer learns the canonical spelling of terms as they are seen and maps
+// typos and variants of a known term onto it
+type TermNormalizer struct {
+	root            *trieNode           // variation -> canonical term
+	canonicalTerms  map[string]struct{} // learned canonical terms
+	termVariations  map[string][]string // canonical term -> variations mapped to it
+	fuzzyMatchCache map[string]string   // term -> result of the last fuzzy search
+	threshold       float64
+	mu              sync.RWMutex
+
+	persist       func(mappings map[string]string) error // called after automatic merges
+	stopAutoMerge chan struct{}
+	autoMergeDone chan struct{}
+}
+
+func NewTermNormalizer() *TermNormalizer {
+	return &TermNormalizer{
+		root:            newTrieNode(),
+		canonicalTerms:  make(map[string]struct{}),
+		termVariations:  make(map[string][]string),
+		fuzzyMatchCache: make(map[string]string),
+		threshold:       config.GetEnvFloat("TERM_SIMILARITY_THRESHOLD", 0.8),
+	}
+}
+
+// NormalizeTerm returns the canonical form of term. Terms that are not close to
+// any known term become canonical themselves.
+func (n *TermNormalizer) NormalizeTerm(term string) string {
+	key := strings.ToLower(strings.TrimSpace(term))
+	if key == "" {
+		return ""
+	}
+
+	n.mu.RLock()
+	if canonical, ok := n.lookup(key); ok {
+		n.mu.RUnlock()
+		return canonical
+	}
+	match, cached := n.fuzzyMatchCache[key]
+	if !cached {
+		match, _ = n.findBestFuzzyMatch(key)
+	}
+	n.mu.RUnlock()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// Another goroutine may have learned the term in the meantime
+	if canonical, ok := n.lookup(key); ok {
+		return canonical
+	}
+	if match == "" {
+		n.canonicalTerms[key] = struct{}{}
+		n.insert(key, key)
+		return key
+	}
+	n.fuzzyMatchCache[key] = match
+	n.termVariations[match] = append(n.termVariations[match], key)
+	n.insert(key, match)
+	return match
+}
+
+// AddCanonicalTerm registers term as canonical so its variants normalize to it
+func (n *TermNormalizer) AddCanonicalTerm(term string) {
+	key := strings.ToLower(strings.TrimSpace(term))
+	if key == "" {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.lookup(key); ok {
+		return
+	}
+	n.canonicalTerms[key] = struct{}{}
+	n.insert(key, key)
+}
+
+// ExplainTerm reports how NormalizeTerm would treat term without learning from it
+func (n *TermNormalizer) ExplainTerm(term string) *models.TermNormalization {
+	key := strings.ToLower(strings.TrimSpace(term))
+	explanation := &models.TermNormalization{Canonical: key, MatchType: "new"}
+	if key == "" {
+		return explanation
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if canonical, ok := n.lookup(key); ok {
+		explanation.Canonical = canonical
+		explanation.MatchType = "known"
+		return explanation
+	}
+	if match, score := n.findBestFuzzyMatch(key); match != "" {
+		explanation.Canonical = match
+		explanation.MatchType = "fuzzy"
+		explanation.Similarity = score
+	}
+	return explanation
+}
+
+// Reset forgets every learned term and returns how many canonical terms and
+// variations were discarded
+func (n *TermNormalizer) Reset() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	discarded := len(n.canonicalTerms)
+	for _, variations := range n.termVariations {
+		discarded += len(variations)
+	}
+
+	n.root = newTrieNode()
+	n.canonicalTerms = make(map[string]struct{})
+	n.termVariations = make(map[string][]string)
+	n.fuzzyMatchCache = make(map[string]string)
+	return discarded
+}
+
+// findBestFuzzyMatch returns the most similar canonical term at or above the
+// similarity threshold, with its score. Callers must hold the lock.
+func (n *TermNormalizer) findBestFuzzyMatch(term string) (string, float64) {
+	if len(term) < minFuzzyTermLength {
+		return "", 0
+	}
+
+	bestMatch := ""
+	bestScore := 0.0
+	for candidate := range n.canonicalTerms {
+		if len(candidate) < minFuzzyTermLength {
+			continue
+		}
+		// Skip candidates whose length alone rules out a close match
+		if abs(len(candidate)-len(term))*3 > maxInt(len(candidate), len(term)) {
+			continue
+		}
+		score := calculateSimilarity(term, candidate)
+		if score >= n.threshold && (score > bestScore || (score == bestScore && candidate < bestMatch)) {
+			bestMatch = candidate
+			bestScore = score
+		}
+	}
+	return bestMatch, bestScore
+}
+
+// GetCanonicalTerms returns every canonical term with the variations mapped to it
+func (n *TermNormalizer) GetCanonicalTerms() map[string][]string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	result := make(map[string][]string, len(n.canonicalTerms))
+	for term := range n.canonicalTerms {
+		result[term] = append([]string{}, n.termVariations[term]...)
+	}
+	return result
+}
+
+// MergeSimilarTerms folds canonical terms that are similar to each other into a
+// single canonical term and returns how many terms were merged away. The term with
+// more variations survives.
+func (n *TermNormalizer) MergeSimilarTerms() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	terms := make([]string, 0, len(n.canonicalTerms))
+	for term := range n.canonicalTerms {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	merged := 0
+	for i, a := range terms {
+		if _, ok := n.canonicalTerms[a]; !ok || len(a) < minFuzzyTermLength {
+			continue
+		}
+		for _, b := range terms[i+1:] {
+			if _, ok := n.canonicalTerms[b]; !ok || len(b) < minFuzzyTermLength {
+				continue
+			}
+			if calculateSimilarity(a, b) < n.threshold {
+				continue
+			}
+
+			keep, drop := a, b
+			if len(n.termVariations[b]) > len(n.termVariations[a]) {
+				keep, drop = b, a
+			}
+			n.mergeInto(drop, keep)
+			merged++
+			if drop == a {
+				break
+			}
+		}
+	}
+
+	if merged > 0 {
+		n.fuzzyMatchCache = make(map[string]string)
+	}
+	return merged
+}
+
+// Mappings returns every known term, canonical terms included, with the canonical
+// term it normalizes to
+func (n *TermNormalizer) Mappings() map[string]string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	mappings := make(map[string]string)
+	for term := range n.canonicalTerms {
+		mappings[term] = term
+		for _, variation := range n.termVariations[term] {
+			mappings[variation] = term
+		}
+	}
+	return mappings
+}
+
+// SetPersistFunc sets the function that stores the mappings after automatic merges
+func (n *TermNormalizer) SetPersistFunc(persist func(mappings map[string]string) error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.persist = persist
+}
+
+// StartAutoMerge merges similar terms every interval in the background until
+// StopAutoMerge is called. It does nothing if auto-merging is already running.
+func (n *TermNormalizer) StartAutoMerge(interval time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopAutoMerge != nil || interval <= 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	n.stopAutoMerge = stop
+	n.autoMergeDone = done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				n.autoMerge()
+			}
+		}
+	}()
+}
+
+// StopAutoMerge stops auto-merging and waits for a merge in progress to finish
+func (n *TermNormalizer) StopAutoMerge() {
+	n.mu.Lock()
+	stop, done := n.stopAutoMerge, n.autoMergeDone
+	n.stopAutoMerge, n.autoMergeDone = nil, nil
+	n.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// autoMerge runs one automatic merge and persists the result when anything changed
+func (n *TermNormalizer) autoMerge() {
+	merged := n.MergeSimilarTerms()
+	if merged == 0 {
+		return
+	}
+	log.Printf("Auto-merge folded %d similar terms", merged)
+
+	n.mu.RLock()
+	persist := n.persist
+	n.mu.RUnlock()
+	if persist == nil {
+		return
+	}
+	if err := persist(n.Mappings()); err != nil {
+		log.Printf("Error persisting term normalizations: %v", err)
+	}
+}
+
+// mergeInto moves a canonical term and its variations under another canonical term
+func (n *TermNormalizer) mergeInto(drop, keep string) {
+	variations := append([]string{drop}, n.termVariations[drop]...)
+	for _, variation := range variations {
+		n.insert(variation, keep)
+	}
+	n.termVariations[keep] = append(n.termVariations[keep], variations...)
+	delete(n.termVariations, drop)
+	delete(n.canonicalTerms, drop)
+}
+
+// insert records that key normalizes to canonical
+func (n *TermNormalizer) insert(key, canonical string) {
+	node := n.root
+	for _, ch := range key {
+		child, ok := node.children[ch]
+		if !ok {
+			child = newTrieNode()
+			node.children[ch] = child
+		}
+		node = child
+	}
+	node.canonical = canonical
+}
+
+// lookup returns the canonical term stored for key
+func (n *TermNormalizer) lookup(key string) (string, bool) {
+	node := n.root
+	for _, ch := range key {
+		child, ok := node.children[ch]
+		if !ok {
+			return "", false
+		}
+		node = child
+	}
+	return node.canonical, node.canonical != ""
+}
+
+// calculateSimilarity scores two terms between 0 and 1 by combining longest common
+// subsequence, edit distance, word overlap and trigram similarity. Word overlap only
+// says something about multi-word terms, so single words are scored without it.
+func calculateSimilarity(s1, s2 string) float64 {
+	if s1 == s2 {
+		return 1
+	}
+	if len(s1) == 0 || len(s2) == 0 {
+		return 0
+	}
+
+	lcs := float64(2*longestCommonSubsequence(s1, s2)) / float64(len(s1)+len(s2))
+	edit := 1 - float64(levenshteinDistance(s1, s2))/float64(maxInt(len(s1), len(s2)))
+	trigram := trigramSimilarity(s1, s2)
+	if !strings.Contains(s1, " ") && !strings.Contains(s2, " ") {
+		return 0.425*lcs + 0.425*edit + 0.15*trigram
+	}
+	tokens := tokenOverlap(s1, s2)
+
+	return 0.34*lcs + 0.34*edit + 0.17*tokens + 0.15*trigram
+}
+
+// trigramSimilarity compares the trigram sets of two terms the way pg_trgm does:
+// each word is padded with two leading spaces and one trailing space, and the score
+// is the number of shared trigrams over the number of distinct trigrams.
+func trigramSimilarity(s1, s2 string) float64 {
+	set1 := paddedTrigrams(s1)
+	set2 := paddedTrigrams(s2)
+
+	common := 0
+	for gram := range set1 {
+		if _, ok := set2[gram]; ok {
+			common++
+		}
+	}
+	union := len(set1) + len(set2) - common
+	if union == 0 {
+		return 0
+	}
+	return float64(common) / float64(union)
+}
+
+// paddedTrigrams returns the pg_trgm-style trigram set of a term
+func paddedTrigrams(s string) map[string]struct{} {
+	grams := make(map[string]struct{})
+	for _, word := range strings.Fields(strings.ToLower(s)) {
+		padded := "  " + word + " "
+		for i := 0; i+3 <= len(padded); i++ {
+			grams[padded[i:i+3]] = struct{}{}
+		}
+	}
+	return grams
+}
+
+// longestCommonSubsequence returns the length of the longest common subsequence
+func longestCommonSubsequence(s1, s2 string) int {
+	var buf [dpStackRows]int
+	prev, curr := dpRows(buf[:], len(s2)+1)
+	for i := 1; i <= len(s1); i++ {
+		for j := 1; j <= len(s2); j++ {
+			if s1[i-1] == s2[j-1] {
+				curr[j] = prev[j-1] + 1
+			} else if prev[j] > curr[j-1] {
+				curr[j] = prev[j]
+			} else {
+				curr[j] = curr[j-1]
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(s2)]
+}
+
+// tokenOverlap returns the Jaccard similarity of the words in two terms. Words of
+// minFuzzyTermLength or more that are one edit apart count as the same word.
+func tokenOverlap(s1, s2 string) float64 {
+	words1 := uniqueWords(s1)
+	words2 := uniqueWords(s2)
+
+	used := make([]bool, len(words2))
+	common := 0
+	for _, w1 := range words1 {
+		for j, w2 := range words2 {
+			if used[j] {
+				continue
+			}
+			if w1 == w2 || (len(w1) >= minFuzzyTermLength && len(w2) >= minFuzzyTermLength &&
+				abs(len(w1)-len(w2)) <= 1 && levenshteinDistance(w1, w2) <= 1) {
+				used[j] = true
+				common++
+				break
+			}
+		}
+	}
+
+	union := len(words1) + len(words2) - common
+	if union == 0 {
+		return 0
+	}
+	return float64(common) / float64(union)
+}
+
+// uniqueWords returns the distinct words of s in order
+func uniqueWords(s string) []string {
+	seen := make(map[string]struct{})
+	words := make([]string, 0)
+	for _, word := range strings.Fields(s) {
+		if _, ok := seen[word]; ok {
+			continue
+		}
+		seen[word] = struct{}{}
+		words = append(words, word)
+	}
+	return words
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
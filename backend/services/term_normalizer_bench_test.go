@@ -0,0 +1,228 @@
+package services
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// newBenchmarkNormalizer returns a normalizer with the default threshold, whatever
+// TERM_SIMILARITY_THRESHOLD is set to
+func newBenchmarkNormalizer() *TermNormalizer {
+	normalizer := NewTermNormalizer()
+	normalizer.threshold = 0.8
+	return normalizer
+}
+
+// unseenTerms returns n misspelled corpus titles that are all different from each
+// other and from the terms in seen
+func unseenTerms(corpus []string, seen map[string]struct{}, n int) []string {
+	rng := rand.New(rand.NewSource(11))
+	terms := make([]string, 0, n)
+	for i := 0; len(terms) < n; i++ {
+		term := addTypo(rng, addTypo(rng, corpus[i%len(corpus)]))
+		if _, ok := seen[term]; ok {
+			continue
+		}
+		seen[term] = struct{}{}
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// benchmarkNormalizeTerm normalizes terms never seen before against a normalizer
+// that knows n canonical titles. Each one is compared with every known term, so
+// learning a file of n distinct terms costs n times this: O(n²).
+func benchmarkNormalizeTerm(b *testing.B, n int) {
+	corpus := occupationCorpus(n)
+	seen := make(map[string]struct{}, n)
+	for _, term := range corpus {
+		seen[term] = struct{}{}
+	}
+	queries := unseenTerms(corpus, seen, b.N)
+
+	var normalizer *TermNormalizer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Normalized terms are learned, so start over before they add up
+		if i%n == 0 {
+			b.StopTimer()
+			normalizer = newBenchmarkNormalizer()
+			for _, term := range corpus {
+				normalizer.AddCanonicalTerm(term)
+			}
+			b.StartTimer()
+		}
+		normalizer.NormalizeTerm(queries[i])
+	}
+}
+
+func BenchmarkNormalizeTerm_100(b *testing.B) {
+	benchmarkNormalizeTerm(b, 100)
+}
+
+func BenchmarkNormalizeTerm_10000(b *testing.B) {
+	benchmarkNormalizeTerm(b, 10000)
+}
+
+// fuzzyBenchmarkSetup returns a normalizer knowing 2,000 canonical titles and
+// misspelled titles it doesn't know yet
+func fuzzyBenchmarkSetup() (*TermNormalizer, []string) {
+	normalizer := newBenchmarkNormalizer()
+	for _, term := range occupationCorpus(2000) {
+		normalizer.AddCanonicalTerm(term)
+	}
+
+	rng := rand.New(rand.NewSource(7))
+	queries := make([]string, 0, 500)
+	for _, term := range occupationCorpus(500) {
+		queries = append(queries, addTypo(rng, term+" "))
+	}
+	return normalizer, queries
+}
+
+// BenchmarkFuzzyMatch_ColdCache measures a fuzzy lookup of a term seen for the first
+// time, which scans every canonical term
+func BenchmarkFuzzyMatch_ColdCache(b *testing.B) {
+	normalizer, queries := fuzzyBenchmarkSetup()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// ExplainTerm runs the search without learning the term, so it stays cold
+		normalizer.ExplainTerm(queries[i%len(queries)])
+	}
+}
+
+// BenchmarkFuzzyMatch_WarmCache measures the lookup of a term already mapped by an
+// earlier fuzzy match
+func BenchmarkFuzzyMatch_WarmCache(b *testing.B) {
+	normalizer, queries := fuzzyBenchmarkSetup()
+	for _, query := range queries {
+		normalizer.NormalizeTerm(query)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		normalizer.NormalizeTerm(queries[i%len(queries)])
+	}
+}
+
+// BenchmarkMergeSimilarTerms_1000 folds together 1,000 canonical terms, a third of
+// them misspellings of the others
+func BenchmarkMergeSimilarTerms_1000(b *testing.B) {
+	rng := rand.New(rand.NewSource(3))
+	terms := occupationCorpus(700)
+	for _, term := range terms[:300] {
+		terms = append(terms, addTypo(rng, term))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	merged := 0
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		normalizer := newBenchmarkNormalizer()
+		for _, term := range terms {
+			normalizer.AddCanonicalTerm(term)
+		}
+		b.StartTimer()
+		merged = normalizer.MergeSimilarTerms()
+	}
+	b.ReportMetric(float64(merged), "merged")
+}
+
+// similarityPair is two multi-word titles and whether they name the same occupation
+type similarityPair struct {
+	s1, s2 string
+	same   bool
+}
+
+// labeledPairs returns 10,000 pairs of multi-word titles: half a title and a
+// misspelling of it, half two titles differing by one word, such as
+// "senior data engineer" and "lead data engineer"
+func labeledPairs() []similarityPair {
+	rng := rand.New(rand.NewSource(5))
+	corpus := occupationCorpus(len(benchmarkTitles) * len(benchmarkSeniorities) * len(benchmarkQualifiers))
+	multiWord := func(i int) string {
+		for !strings.Contains(corpus[i%len(corpus)], " ") {
+			i++
+		}
+		return corpus[i%len(corpus)]
+	}
+
+	pairs := make([]similarityPair, 0, 10000)
+	for i := 0; len(pairs) < 10000; i++ {
+		term := multiWord(i)
+		pairs = append(pairs, similarityPair{term, addTypo(rng, addTypo(rng, term)), true})
+		// The next seniority of the same title, then the next title of the same seniority
+		other := multiWord(i + len(benchmarkTitles))
+		if i%2 == 1 {
+			other = multiWord(i + 1)
+		}
+		if other != term {
+			pairs = append(pairs, similarityPair{term, other, false})
+		}
+	}
+	return pairs
+}
+
+// similarityWithoutTrigrams is calculateSimilarity as it was before trigram
+// similarity was added
+func similarityWithoutTrigrams(s1, s2 string) float64 {
+	if s1 == s2 {
+		return 1
+	}
+	if len(s1) == 0 || len(s2) == 0 {
+		return 0
+	}
+	lcs := float64(2*longestCommonSubsequence(s1, s2)) / float64(len(s1)+len(s2))
+	edit := 1 - float64(levenshteinDistance(s1, s2))/float64(maxInt(len(s1), len(s2)))
+	if !strings.Contains(s1, " ") && !strings.Contains(s2, " ") {
+		return 0.5*lcs + 0.5*edit
+	}
+	return 0.4*lcs + 0.4*edit + 0.2*tokenOverlap(s1, s2)
+}
+
+// benchmarkSimilarity scores the labeled pairs and reports the precision and recall
+// of treating pairs scoring at least the default threshold as the same occupation
+func benchmarkSimilarity(b *testing.B, similarity func(s1, s2 string) float64) {
+	pairs := labeledPairs()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pair := pairs[i%len(pairs)]
+		similarity(pair.s1, pair.s2)
+	}
+	b.StopTimer()
+
+	truePositives, falsePositives, positives := 0, 0, 0
+	for _, pair := range pairs {
+		matched := similarity(pair.s1, pair.s2) >= 0.8
+		switch {
+		case matched && pair.same:
+			truePositives++
+		case matched:
+			falsePositives++
+		}
+		if pair.same {
+			positives++
+		}
+	}
+	b.ReportMetric(float64(truePositives)/float64(maxInt(truePositives+falsePositives, 1)), "precision")
+	b.ReportMetric(float64(truePositives)/float64(positives), "recall")
+}
+
+func BenchmarkTrigramSimilarity_10000Pairs(b *testing.B) {
+	benchmarkSimilarity(b, trigramSimilarity)
+}
+
+// BenchmarkCalculateSimilarity_10000Pairs and BenchmarkCalculateSimilarity_WithoutTrigrams
+// compare the combination with and without trigram similarity
+func BenchmarkCalculateSimilarity_10000Pairs(b *testing.B) {
+	benchmarkSimilarity(b, calculateSimilarity)
+}
+
+func BenchmarkCalculateSimilarity_WithoutTrigrams(b *testing.B) {
+	benchmarkSimilarity(b, similarityWithoutTrigrams)
+}
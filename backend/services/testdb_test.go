@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"csv-processor/database"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testDBService connects to PostgreSQL for tests and benchmarks that need it,
+// skipping them unless TEST_DB is set. The connection uses the DB_* variables the
+// server reads.
+func testDBService(t testing.TB) *DBService {
+	t.Helper()
+	if os.Getenv("TEST_DB") == "" {
+		t.Skip("TEST_DB not set")
+	}
+	if err := database.InitDB(); err != nil {
+		t.Fatalf("InitDB() error: %v", err)
+	}
+	t.Cleanup(database.CloseDB)
+	return NewDBService()
+}
+
+// storeFixture processes a CSV file from testdata and stores its records as a new
+// file indexed in language, which is deleted when the test ends
+func storeFixture(t *testing.T, db *DBService, name, language string) int {
+	t.Helper()
+	content, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := db.CreateCSVFile(name, int64(len(content)), content, "", language, "", nil, nil, "")
+	if err != nil {
+		t.Fatalf("CreateCSVFile() error: %v", err)
+	}
+	t.Cleanup(func() { db.DeleteCSVFile(file.ID, "test") })
+
+	records, _, err := NewCSVProcessor(NewCategoryGrouper(nil)).ProcessCSV(context.Background(), strings.NewReader(string(content)), nil)
+	if err != nil {
+		t.Fatalf("ProcessCSV() error: %v", err)
+	}
+	for _, record := range records {
+		record.CSVFileID = file.ID
+	}
+	if _, err := db.ReplaceRecords(context.Background(), file.ID, 1, records); err != nil {
+		t.Fatalf("ReplaceRecords() error: %v", err)
+	}
+	return file.ID
+}
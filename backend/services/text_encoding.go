@@ -0,0 +1,40 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+)
+
+// DecodeUTF16 transcodes content starting with a UTF-16 byte order mark to UTF-8,
+// dropping the mark. Spreadsheet programs export "Unicode text" this way. Anything
+// else is returned unchanged.
+func DecodeUTF16(content []byte) []byte {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(content, utf16LEBOM):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(content, utf16BEBOM):
+		order = binary.BigEndian
+	default:
+		return content
+	}
+
+	body := content[2:]
+	units := make([]uint16, len(body)/2)
+	for i := range units {
+		units[i] = order.Uint16(body[2*i:])
+	}
+
+	decoded := make([]byte, 0, len(units)+len(units)/2)
+	for _, r := range utf16.Decode(units) {
+		decoded = utf8.AppendRune(decoded, r)
+	}
+	return decoded
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"csv-processor/models"
+	"errors"
+	"fmt"
+)
+
+// UploadPart is a file an upload is stored as. Zip archives and workbooks uploaded
+// with AllSheets are stored as several.
+type UploadPart struct {
+	Filename  string
+	SheetName string
+	Raw       []byte // kept for reprocessing
+	Content   []byte // CSV to process
+}
+
+// UploadOptions choose how the content of an upload is read
+type UploadOptions struct {
+	Sheet     string // workbook sheet, by name or zero-based index
+	AllSheets bool   // a file per non-empty workbook sheet
+	ZipLimits ZipLimits
+}
+
+// PreparedUpload is the CSV content an upload is stored as
+type PreparedUpload struct {
+	Parts    []*UploadPart
+	Skipped  []*models.SkippedEntry // archive entries and sheets not stored
+	Archive  bool                   // a zip archive, whose name each part records
+	Multiple bool                   // an archive or all sheets of a workbook
+	Warnings []string               // of a single part that looks wrong, from SniffCSV
+}
+
+// SheetChoiceError is returned for a workbook with several sheets holding data when
+// the upload chose neither a sheet nor all of them
+type SheetChoiceError struct {
+	Sheets []*models.SheetInfo
+}
+
+func (e *SheetChoiceError) Error() string {
+	return fmt.Sprintf("Workbook has %d sheets with data; choose one with sheet= or upload them all with allSheets=true", len(nonEmptySheets(e.Sheets)))
+}
+
+// NothingToStoreError is returned for an archive or workbook of which every entry
+// or sheet was skipped
+type NothingToStoreError struct {
+	Message string
+	Skipped []*models.SkippedEntry
+}
+
+func (e *NothingToStoreError) Error() string { return e.Message }
+
+// PrepareUpload reads uploaded bytes into the CSV files they are stored as: every
+// CSV entry of a zip archive, the chosen sheets of an Excel workbook, or the content
+// itself, transcoded from UTF-16. Content that is clearly not CSV is refused before
+// anything is stored, and archive entries like it are skipped.
+//
+// Errors wrapping models.ErrArchiveTooLarge are for archives over their limits.
+// Every other error means the content can't be stored as CSV; *SheetChoiceError and
+// *NothingToStoreError carry details.
+func PrepareUpload(filename string, data []byte, opts UploadOptions) (*PreparedUpload, error) {
+	isXLSX := IsXLSX(data)
+	if !isXLSX && IsZip(data) {
+		return prepareArchive(data, opts.ZipLimits)
+	}
+	if !isXLSX {
+		content := DecodeUTF16(data)
+		warnings, err := SniffCSV(content)
+		if err != nil {
+			return nil, fmt.Errorf("Upload rejected: %w", err)
+		}
+		return &PreparedUpload{
+			Parts:    []*UploadPart{{Filename: filename, Raw: data, Content: content}},
+			Warnings: warnings,
+		}, nil
+	}
+
+	if opts.Sheet != "" && opts.AllSheets {
+		return nil, errors.New("sheet and allSheets cannot be combined")
+	}
+	sheetName := opts.Sheet
+	if sheetName == "" {
+		// Several sheets with data must be chosen between explicitly
+		sheets, err := InspectXLSXSheets(data)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Excel workbook: %w", err)
+		}
+		if opts.AllSheets {
+			return prepareWorkbookSheets(filename, data, sheets)
+		}
+		nonEmpty := nonEmptySheets(sheets)
+		if len(nonEmpty) > 1 {
+			return nil, &SheetChoiceError{Sheets: sheets}
+		}
+		sheetName = sheets[0].Name
+		if len(nonEmpty) == 1 {
+			sheetName = nonEmpty[0].Name
+		}
+	} else {
+		var err error
+		if sheetName, err = XLSXSheetName(data, sheetName); err != nil {
+			return nil, fmt.Errorf("Error reading workbook: %w", err)
+		}
+	}
+	content, err := XLSXToCSV(data, sheetName)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading workbook: %w", err)
+	}
+	warnings, err := SniffCSV(content)
+	if err != nil {
+		return nil, fmt.Errorf("Upload rejected: %w", err)
+	}
+	return &PreparedUpload{
+		Parts:    []*UploadPart{{Filename: filename, SheetName: sheetName, Raw: data, Content: content}},
+		Warnings: warnings,
+	}, nil
+}
+
+// prepareArchive reads the CSV entries of a zip archive, each named after the
+// entry's path. The archive is read completely up front, so a corrupt or oversized
+// archive leaves nothing behind.
+func prepareArchive(archive []byte, limits ZipLimits) (*PreparedUpload, error) {
+	entries, skipped, err := ExtractZipCSVs(archive, limits)
+	if errors.Is(err, models.ErrArchiveTooLarge) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading archive: %w", err)
+	}
+	// Entries named .csv that hold something else are skipped like other files
+	prepared := &PreparedUpload{Archive: true, Multiple: true}
+	for _, entry := range entries {
+		content := DecodeUTF16(entry.Content)
+		if _, err := SniffCSV(content); err != nil {
+			skipped = append(skipped, &models.SkippedEntry{Path: entry.Path, Reason: err.Error()})
+			continue
+		}
+		prepared.Parts = append(prepared.Parts, &UploadPart{Filename: entry.Path, Raw: entry.Content, Content: content})
+	}
+	prepared.Skipped = skipped
+	if len(prepared.Parts) == 0 {
+		return nil, &NothingToStoreError{Message: "Archive contains no CSV files", Skipped: skipped}
+	}
+	return prepared, nil
+}
+
+// prepareWorkbookSheets reads every non-empty sheet of a workbook for uploads with
+// AllSheets. Each part keeps the whole workbook as its raw upload, so it is
+// reprocessed from its own sheet.
+func prepareWorkbookSheets(filename string, workbook []byte, sheets []*models.SheetInfo) (*PreparedUpload, error) {
+	prepared := &PreparedUpload{Multiple: true}
+	for _, sheet := range sheets {
+		if sheet.Rows == 0 {
+			prepared.Skipped = append(prepared.Skipped, &models.SkippedEntry{Path: sheet.Name, Reason: "empty sheet"})
+			continue
+		}
+		content, err := XLSXToCSV(workbook, sheet.Name)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading workbook: %w", err)
+		}
+		prepared.Parts = append(prepared.Parts, &UploadPart{Filename: filename, SheetName: sheet.Name, Raw: workbook, Content: content})
+	}
+	if len(prepared.Parts) == 0 {
+		return nil, &NothingToStoreError{Message: "Workbook has no sheets with data", Skipped: prepared.Skipped}
+	}
+	return prepared, nil
+}
+
+// nonEmptySheets returns the sheets holding at least one non-blank row
+func nonEmptySheets(sheets []*models.SheetInfo) []*models.SheetInfo {
+	var nonEmpty []*models.SheetInfo
+	for _, sheet := range sheets {
+		if sheet.Rows > 0 {
+			nonEmpty = append(nonEmpty, sheet)
+		}
+	}
+	return nonEmpty
+}
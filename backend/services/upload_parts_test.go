@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPrepareUpload(t *testing.T) {
+	t.Run("csv", func(t *testing.T) {
+		prepared, err := PrepareUpload("people.csv", []byte("\xff\xfen\x00a\x00m\x00e\x00\n\x00A\x00d\x00a\x00\n\x00"), UploadOptions{})
+		if err != nil {
+			t.Fatalf("PrepareUpload() error: %v", err)
+		}
+		if len(prepared.Parts) != 1 || prepared.Multiple || string(prepared.Parts[0].Content) != "name\nAda\n" {
+			t.Errorf("PrepareUpload() = %+v, want the transcoded CSV as the only part", prepared.Parts)
+		}
+	})
+
+	t.Run("not csv", func(t *testing.T) {
+		if _, err := PrepareUpload("photo.csv", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), UploadOptions{}); err == nil {
+			t.Error("PrepareUpload() of a PNG succeeded")
+		}
+	})
+
+	t.Run("archive", func(t *testing.T) {
+		archive := buildZip(t, [2]string{"a.csv", "name\nAda\n"}, [2]string{"b.csv", "\x00\x01\x02\x03\x04\x05"}, [2]string{"notes.txt", "hi"})
+		prepared, err := PrepareUpload("export.zip", archive, UploadOptions{ZipLimits: testZipLimits})
+		if err != nil {
+			t.Fatalf("PrepareUpload() error: %v", err)
+		}
+		if !prepared.Archive || len(prepared.Parts) != 1 || prepared.Parts[0].Filename != "a.csv" {
+			t.Errorf("PrepareUpload() parts = %+v, want a.csv only", prepared.Parts)
+		}
+		var skipped []string
+		for _, entry := range prepared.Skipped {
+			skipped = append(skipped, entry.Path)
+		}
+		if want := []string{"notes.txt", "b.csv"}; !reflect.DeepEqual(skipped, want) {
+			t.Errorf("skipped = %v, want %v", skipped, want)
+		}
+
+		var nothing *NothingToStoreError
+		if _, err := PrepareUpload("export.zip", buildZip(t, [2]string{"notes.txt", "hi"}), UploadOptions{ZipLimits: testZipLimits}); !errors.As(err, &nothing) {
+			t.Errorf("PrepareUpload() of an archive without CSV files error = %v, want NothingToStoreError", err)
+		}
+	})
+
+	t.Run("workbook", func(t *testing.T) {
+		workbook := buildXLSX(t, []string{"Empty", "People", "Teams"}, [][][]string{nil, {{"name"}, {"Ada"}}, {{"team"}, {"Core"}}})
+
+		var choice *SheetChoiceError
+		if _, err := PrepareUpload("book.xlsx", workbook, UploadOptions{}); !errors.As(err, &choice) {
+			t.Fatalf("PrepareUpload() of a workbook with two sheets error = %v, want SheetChoiceError", err)
+		}
+
+		prepared, err := PrepareUpload("book.xlsx", workbook, UploadOptions{Sheet: "Teams"})
+		if err != nil {
+			t.Fatalf("PrepareUpload() error: %v", err)
+		}
+		if part := prepared.Parts[0]; part.SheetName != "Teams" || string(part.Content) != "team\nCore\n" {
+			t.Errorf("PrepareUpload() sheet Teams = %q %q", part.SheetName, part.Content)
+		}
+
+		prepared, err = PrepareUpload("book.xlsx", workbook, UploadOptions{AllSheets: true})
+		if err != nil {
+			t.Fatalf("PrepareUpload() error: %v", err)
+		}
+		if !prepared.Multiple || prepared.Archive || len(prepared.Parts) != 2 || len(prepared.Skipped) != 1 {
+			t.Errorf("PrepareUpload() with AllSheets = %d parts, %d skipped, want 2 and 1", len(prepared.Parts), len(prepared.Skipped))
+		}
+
+		if _, err := PrepareUpload("book.xlsx", workbook, UploadOptions{Sheet: "People", AllSheets: true}); err == nil {
+			t.Error("PrepareUpload() with a sheet and AllSheets succeeded")
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CheckAndIncrementUploadQuota counts an upload from ip on date, reporting whether
+// the address had already made limit uploads that day. Uploads over the limit are
+// not counted, so the count never passes it.
+func (s *DBService) CheckAndIncrementUploadQuota(ip string, date time.Time, limit int) (bool, error) {
+	query := `
+		INSERT INTO upload_quota_log (ip_address, upload_count, date)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (ip_address, date) DO UPDATE
+		SET upload_count = upload_quota_log.upload_count + 1
+		WHERE upload_quota_log.upload_count < $3
+		RETURNING upload_count
+	`
+	var count int
+	err := s.db.QueryRow(query, ip, date.Format("2006-01-02"), limit).Scan(&count)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to count upload: %w", err)
+	}
+	return false, nil
+}
+
+// DeleteOldUploadQuotas removes the upload counts of days before the one before
+// today, which no quota check reads any more
+func (s *DBService) DeleteOldUploadQuotas(ctx context.Context) (int64, error) {
+	cutoff := time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	result, err := s.db.ExecContext(ctx, `DELETE FROM upload_quota_log WHERE date < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old upload quotas: %w", err)
+	}
+	return result.RowsAffected()
+}
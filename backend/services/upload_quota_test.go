@@ -0,0 +1,55 @@
+package services
+
+import (
+	"csv-processor/database"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckAndIncrementUploadQuota(t *testing.T) {
+	db := testDBService(t)
+	ip := "quota-test-" + time.Now().Format("150405.000000")
+	day := time.Date(2001, 2, 3, 12, 0, 0, 0, time.UTC)
+	t.Cleanup(func() { database.DB.Exec(`DELETE FROM upload_quota_log WHERE ip_address = $1`, ip) })
+
+	// Concurrent uploads must not get past the limit between the check and the count
+	const limit = 3
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			exceeded, err := db.CheckAndIncrementUploadQuota(ip, day, limit)
+			if err != nil {
+				t.Errorf("CheckAndIncrementUploadQuota() error: %v", err)
+				return
+			}
+			if !exceeded {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != limit {
+		t.Errorf("%d of 10 uploads allowed, want %d", allowed, limit)
+	}
+
+	var count int
+	if err := database.DB.QueryRow(`SELECT upload_count FROM upload_quota_log WHERE ip_address = $1`, ip).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != limit {
+		t.Errorf("upload_count = %d, want it to stop at %d", count, limit)
+	}
+
+	// The next day starts over
+	exceeded, err := db.CheckAndIncrementUploadQuota(ip, day.AddDate(0, 0, 1), limit)
+	if err != nil || exceeded {
+		t.Errorf("CheckAndIncrementUploadQuota() the next day = %v, %v, want allowed", exceeded, err)
+	}
+}
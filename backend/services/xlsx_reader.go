@@ -0,0 +1,334 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"csv-processor/models"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+// xlsxText holds either a plain <t> or rich text runs (<r><t>)
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var builder strings.Builder
+	for _, run := range t.Runs {
+		builder.WriteString(run.Text)
+	}
+	return builder.String()
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string    `xml:"r,attr"`
+			Type   string    `xml:"t,attr"`
+			Value  string    `xml:"v"`
+			Inline *xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// IsXLSX reports whether data is an Excel workbook rather than plain CSV
+func IsXLSX(data []byte) bool {
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return false
+	}
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false
+	}
+	for _, f := range reader.File {
+		if f.Name == "xl/workbook.xml" {
+			return true
+		}
+	}
+	return false
+}
+
+// InspectXLSXSheets returns the sheets of a workbook in workbook order with the
+// number of non-blank rows of each, header included
+func InspectXLSXSheets(data []byte) ([]*models.SheetInfo, error) {
+	reader, workbook, err := openXLSX(data)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := readSharedStrings(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	sheets := make([]*models.SheetInfo, len(workbook.Sheets))
+	for i, sheet := range workbook.Sheets {
+		rows, err := readSheetRows(reader, workbook, i, shared)
+		if err != nil {
+			return nil, err
+		}
+		info := &models.SheetInfo{Name: sheet.Name, Index: i}
+		for _, row := range rows {
+			for _, value := range row {
+				if strings.TrimSpace(value) != "" {
+					info.Rows++
+					break
+				}
+			}
+		}
+		sheets[i] = info
+	}
+	return sheets, nil
+}
+
+// XLSXSheetName returns the name of the sheet selected by name or zero-based index.
+// Names are matched exactly, then case-insensitively, before trying an index.
+func XLSXSheetName(data []byte, selector string) (string, error) {
+	_, workbook, err := openXLSX(data)
+	if err != nil {
+		return "", err
+	}
+	index, err := workbook.findSheet(selector)
+	if err != nil {
+		return "", err
+	}
+	return workbook.Sheets[index].Name, nil
+}
+
+// XLSXToCSV converts a single sheet of a workbook to CSV. The sheet is selected as
+// by XLSXSheetName; an empty selector selects the first sheet.
+func XLSXToCSV(data []byte, sheetName string) ([]byte, error) {
+	reader, workbook, err := openXLSX(data)
+	if err != nil {
+		return nil, err
+	}
+	sheetIndex := 0
+	if sheetName != "" {
+		if sheetIndex, err = workbook.findSheet(sheetName); err != nil {
+			return nil, err
+		}
+	}
+
+	// Shared strings are optional (workbooks with only numbers omit them)
+	shared, err := readSharedStrings(reader)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := readSheetRows(reader, workbook, sheetIndex, shared)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	for _, row := range rows {
+		if err := writer.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// openXLSX opens a workbook and reads its list of sheets
+func openXLSX(data []byte) (*zip.Reader, *xlsxWorkbook, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid xlsx file: %w", err)
+	}
+
+	var workbook xlsxWorkbook
+	if err := decodeZipXML(reader, "xl/workbook.xml", &workbook); err != nil {
+		return nil, nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, nil, fmt.Errorf("workbook has no sheets")
+	}
+	return reader, &workbook, nil
+}
+
+// findSheet returns the index of the sheet selected by name or zero-based index
+func (w *xlsxWorkbook) findSheet(selector string) (int, error) {
+	for i, sheet := range w.Sheets {
+		if sheet.Name == selector {
+			return i, nil
+		}
+	}
+	// Fall back to a case-insensitive match
+	for i, sheet := range w.Sheets {
+		if strings.EqualFold(sheet.Name, selector) {
+			return i, nil
+		}
+	}
+	if index, err := strconv.Atoi(selector); err == nil && index >= 0 && index < len(w.Sheets) {
+		return index, nil
+	}
+
+	names := make([]string, len(w.Sheets))
+	for i, sheet := range w.Sheets {
+		names[i] = sheet.Name
+	}
+	return 0, fmt.Errorf("sheet %q not found (available: %s)", selector, strings.Join(names, ", "))
+}
+
+// readSharedStrings reads the workbook's string table, which is optional
+func readSharedStrings(reader *zip.Reader) (*xlsxSharedStrings, error) {
+	var shared xlsxSharedStrings
+	if err := decodeZipXML(reader, "xl/sharedStrings.xml", &shared); err != nil && !isMissingPart(err) {
+		return nil, err
+	}
+	return &shared, nil
+}
+
+// readSheetRows returns the cell values of a sheet, every row padded to the width of
+// the widest
+func readSheetRows(reader *zip.Reader, workbook *xlsxWorkbook, sheetIndex int, shared *xlsxSharedStrings) ([][]string, error) {
+	var rels xlsxRelationships
+	if err := decodeZipXML(reader, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	sheetPath := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[sheetIndex].RID {
+			sheetPath = rel.Target
+		}
+	}
+	if sheetPath == "" {
+		return nil, fmt.Errorf("sheet %q has no worksheet part", workbook.Sheets[sheetIndex].Name)
+	}
+	if strings.HasPrefix(sheetPath, "/") {
+		sheetPath = strings.TrimPrefix(sheetPath, "/")
+	} else {
+		sheetPath = path.Join("xl", sheetPath)
+	}
+
+	var sheet xlsxSheet
+	if err := decodeZipXML(reader, sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	width := 0
+	for _, row := range sheet.Rows {
+		values := make([]string, 0, len(row.Cells))
+		for _, cell := range row.Cells {
+			col := len(values)
+			if cell.Ref != "" {
+				col = columnIndex(cell.Ref)
+			}
+			for len(values) < col {
+				values = append(values, "")
+			}
+
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				if idx, err := strconv.Atoi(cell.Value); err == nil && idx >= 0 && idx < len(shared.Items) {
+					value = shared.Items[idx].String()
+				}
+			case "inlineStr":
+				if cell.Inline != nil {
+					value = cell.Inline.String()
+				}
+			}
+			values = append(values, value)
+		}
+		if len(values) > width {
+			width = len(values)
+		}
+		rows = append(rows, values)
+	}
+	for i := range rows {
+		for len(rows[i]) < width {
+			rows[i] = append(rows[i], "")
+		}
+	}
+	return rows, nil
+}
+
+// ToCSVContent returns CSV bytes for an upload, converting Excel workbooks using the
+// given sheet and UTF-16 text to UTF-8, and passing anything else through unchanged
+func ToCSVContent(data []byte, sheetName string) ([]byte, error) {
+	if !IsXLSX(data) {
+		return DecodeUTF16(data), nil
+	}
+	return XLSXToCSV(data, sheetName)
+}
+
+type missingPartError struct {
+	name string
+}
+
+func (e *missingPartError) Error() string {
+	return fmt.Sprintf("xlsx part %s not found", e.name)
+}
+
+func isMissingPart(err error) bool {
+	_, ok := err.(*missingPartError)
+	return ok
+}
+
+// decodeZipXML decodes the named part of a zip archive into v
+func decodeZipXML(reader *zip.Reader, name string, v interface{}) error {
+	for _, f := range reader.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		defer rc.Close()
+
+		if err := xml.NewDecoder(io.LimitReader(rc, 512<<20)).Decode(v); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		return nil
+	}
+	return &missingPartError{name: name}
+}
+
+// columnIndex converts a cell reference like "C7" to a zero-based column index
+func columnIndex(ref string) int {
+	col := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+	}
+	return col - 1
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"csv-processor/models"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildXLSX returns a minimal workbook with a sheet per name, each holding the
+// given rows as inline strings
+func buildXLSX(t *testing.T, names []string, sheets [][][]string) []byte {
+	t.Helper()
+	var workbook, rels strings.Builder
+	workbook.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	parts := map[string]string{}
+	for i, name := range names {
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, name, i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+
+		var sheet strings.Builder
+		sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+		for r, row := range sheets[i] {
+			fmt.Fprintf(&sheet, `<row r="%d">`, r+1)
+			for c, value := range row {
+				fmt.Fprintf(&sheet, `<c r="%c%d" t="inlineStr"><is><t>%s</t></is></c>`, 'A'+c, r+1, value)
+			}
+			sheet.WriteString(`</row>`)
+		}
+		sheet.WriteString(`</sheetData></worksheet>`)
+		parts[fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)] = sheet.String()
+	}
+	workbook.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`</Relationships>`)
+	parts["xl/workbook.xml"] = workbook.String()
+	parts["xl/_rels/workbook.xml.rels"] = rels.String()
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testWorkbook(t *testing.T) []byte {
+	return buildXLSX(t, []string{"People", "Notes", "Teams"}, [][][]string{
+		{{"name", "title"}, {"Ada", "Engineer"}, {"", ""}, {"Grace", "Admiral"}},
+		{},
+		{{"team"}, {"Compilers"}},
+	})
+}
+
+func TestInspectXLSXSheets(t *testing.T) {
+	sheets, err := InspectXLSXSheets(testWorkbook(t))
+	if err != nil {
+		t.Fatalf("InspectXLSXSheets() error: %v", err)
+	}
+	want := []models.SheetInfo{
+		{Name: "People", Index: 0, Rows: 3},
+		{Name: "Notes", Index: 1, Rows: 0},
+		{Name: "Teams", Index: 2, Rows: 2},
+	}
+	if len(sheets) != len(want) {
+		t.Fatalf("InspectXLSXSheets() returned %d sheets, want %d", len(sheets), len(want))
+	}
+	for i, sheet := range sheets {
+		if *sheet != want[i] {
+			t.Errorf("sheet %d = %+v, want %+v", i, *sheet, want[i])
+		}
+	}
+}
+
+func TestXLSXSheetName(t *testing.T) {
+	workbook := testWorkbook(t)
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{"Teams", "Teams"},
+		{"teams", "Teams"},
+		{"1", "Notes"},
+		{"0", "People"},
+	}
+	for _, tt := range tests {
+		got, err := XLSXSheetName(workbook, tt.selector)
+		if err != nil || got != tt.want {
+			t.Errorf("XLSXSheetName(%q) = %q, %v, want %q", tt.selector, got, err, tt.want)
+		}
+	}
+
+	for _, selector := range []string{"Budget", "3", "-1"} {
+		_, err := XLSXSheetName(workbook, selector)
+		if err == nil || !strings.Contains(err.Error(), "People, Notes, Teams") {
+			t.Errorf("XLSXSheetName(%q) error = %v, want one listing the sheets", selector, err)
+		}
+	}
+}
+
+func TestXLSXToCSV(t *testing.T) {
+	workbook := testWorkbook(t)
+	tests := []struct {
+		sheet string
+		want  string
+	}{
+		{"", "name,title\nAda,Engineer\n,\nGrace,Admiral\n"},
+		{"teams", "team\nCompilers\n"},
+		{"1", ""},
+	}
+	for _, tt := range tests {
+		got, err := XLSXToCSV(workbook, tt.sheet)
+		if err != nil {
+			t.Fatalf("XLSXToCSV(%q) error: %v", tt.sheet, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("XLSXToCSV(%q) = %q, want %q", tt.sheet, got, tt.want)
+		}
+	}
+}
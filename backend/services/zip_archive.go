@@ -0,0 +1,129 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"csv-processor/config"
+	"csv-processor/models"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ZipLimits caps what an uploaded archive may expand to
+type ZipLimits struct {
+	MaxEntrySize int64 // uncompressed bytes of one CSV entry
+	MaxTotalSize int64 // uncompressed bytes of all CSV entries together
+	MaxEntries   int   // CSV entries per archive
+}
+
+// ZipLimitsFromEnv reads the archive limits from ZIP_MAX_ENTRY_SIZE,
+// ZIP_MAX_TOTAL_SIZE and ZIP_MAX_ENTRIES
+func ZipLimitsFromEnv() ZipLimits {
+	return ZipLimits{
+		MaxEntrySize: int64(config.GetEnvInt("ZIP_MAX_ENTRY_SIZE", 100<<20)),
+		MaxTotalSize: int64(config.GetEnvInt("ZIP_MAX_TOTAL_SIZE", 500<<20)),
+		MaxEntries:   config.GetEnvInt("ZIP_MAX_ENTRIES", 100),
+	}
+}
+
+// ZipEntry is a CSV file extracted from an archive
+type ZipEntry struct {
+	Path    string
+	Content []byte
+}
+
+// IsZip reports whether data is a zip archive. Excel workbooks are zip archives
+// too, so check IsXLSX first.
+func IsZip(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04")) || bytes.HasPrefix(data, []byte("PK\x05\x06"))
+}
+
+// ExtractZipCSVs reads every CSV entry of a zip archive into memory, in archive
+// order, and reports the other entries as skipped. Directories are ignored. Any
+// corrupt entry, entry path escaping the archive or exceeded limit fails the whole
+// archive, so nothing has to be undone after a partial extraction.
+func ExtractZipCSVs(data []byte, limits ZipLimits) ([]*ZipEntry, []*models.SkippedEntry, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid zip archive: %w", err)
+	}
+
+	var entries []*ZipEntry
+	var skipped []*models.SkippedEntry
+	var total int64
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name, err := safeEntryPath(f.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if reason := skipEntryReason(name); reason != "" {
+			skipped = append(skipped, &models.SkippedEntry{Path: name, Reason: reason})
+			continue
+		}
+
+		if len(entries) == limits.MaxEntries {
+			return nil, nil, fmt.Errorf("%w: more than %d CSV files", models.ErrArchiveTooLarge, limits.MaxEntries)
+		}
+		// The declared size is checked up front and the actual one while reading,
+		// as the header can lie
+		if f.UncompressedSize64 > uint64(limits.MaxEntrySize) {
+			return nil, nil, fmt.Errorf("%w: %s is larger than %d bytes", models.ErrArchiveTooLarge, name, limits.MaxEntrySize)
+		}
+		content, err := readZipEntry(f, limits.MaxEntrySize)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		total += int64(len(content))
+		if total > limits.MaxTotalSize {
+			return nil, nil, fmt.Errorf("%w: CSV files expand to more than %d bytes", models.ErrArchiveTooLarge, limits.MaxTotalSize)
+		}
+		entries = append(entries, &ZipEntry{Path: name, Content: content})
+	}
+	return entries, skipped, nil
+}
+
+// safeEntryPath cleans an entry path, rejecting absolute paths and paths that
+// climb out of the archive (zip slip)
+func safeEntryPath(name string) (string, error) {
+	cleaned := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") ||
+		(len(cleaned) >= 2 && cleaned[1] == ':') {
+		return "", fmt.Errorf("invalid zip archive: unsafe entry path %q", name)
+	}
+	return cleaned, nil
+}
+
+// skipEntryReason says why an entry is not processed, or "" for CSV files
+func skipEntryReason(name string) string {
+	if strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), "._") {
+		return "macOS metadata"
+	}
+	if !strings.EqualFold(path.Ext(name), ".csv") {
+		return "not a CSV file"
+	}
+	return ""
+}
+
+// readZipEntry decompresses an entry, failing once it exceeds maxSize. Reading to
+// the end also verifies the entry's checksum.
+func readZipEntry(f *zip.File, maxSize int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(io.LimitReader(rc, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > maxSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", models.ErrArchiveTooLarge, maxSize)
+	}
+	return content, nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"csv-processor/models"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// buildZip returns a zip archive holding the given entries in order
+func buildZip(t *testing.T, entries ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := writer.Create(entry[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(entry[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+var testZipLimits = ZipLimits{MaxEntrySize: 1 << 20, MaxTotalSize: 2 << 20, MaxEntries: 10}
+
+func TestExtractZipCSVs(t *testing.T) {
+	archive := buildZip(t,
+		[2]string{"people.csv", "name\nAda\n"},
+		[2]string{"reports/", ""},
+		[2]string{"reports/2024/Q1.CSV", "name\nGrace\n"},
+		[2]string{"notes.txt", "not data"},
+		[2]string{"__MACOSX/._people.csv", "metadata"},
+		[2]string{"reports/._Q1.csv", "metadata"},
+	)
+	if !IsZip(archive) {
+		t.Fatal("IsZip() = false for a zip archive")
+	}
+
+	entries, skipped, err := ExtractZipCSVs(archive, testZipLimits)
+	if err != nil {
+		t.Fatalf("ExtractZipCSVs() error: %v", err)
+	}
+	var paths, contents []string
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+		contents = append(contents, string(entry.Content))
+	}
+	if want := []string{"people.csv", "reports/2024/Q1.CSV"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("entries = %v, want %v", paths, want)
+	}
+	if want := []string{"name\nAda\n", "name\nGrace\n"}; !reflect.DeepEqual(contents, want) {
+		t.Errorf("contents = %q, want %q", contents, want)
+	}
+
+	wantSkipped := []*models.SkippedEntry{
+		{Path: "notes.txt", Reason: "not a CSV file"},
+		{Path: "__MACOSX/._people.csv", Reason: "macOS metadata"},
+		{Path: "reports/._Q1.csv", Reason: "macOS metadata"},
+	}
+	if !reflect.DeepEqual(skipped, wantSkipped) {
+		t.Errorf("skipped = %+v, want %+v", skipped, wantSkipped)
+	}
+}
+
+func TestExtractZipCSVsRejects(t *testing.T) {
+	large := strings.Repeat("x", 600<<10)
+	tests := []struct {
+		name      string
+		archive   []byte
+		tooLarge  bool
+		wantInErr string
+	}{
+		{"not an archive", []byte("name\nAda\n"), false, "invalid zip archive"},
+		{"climbs out of the archive", buildZip(t, [2]string{"../evil.csv", "x"}), false, "unsafe entry path"},
+		{"absolute path", buildZip(t, [2]string{"/etc/evil.csv", "x"}), false, "unsafe entry path"},
+		{"windows drive", buildZip(t, [2]string{`C:\evil.csv`, "x"}), false, "unsafe entry path"},
+		{"entry too large", buildZip(t, [2]string{"big.csv", strings.Repeat("x", 2<<20)}), true, "big.csv"},
+		{"total too large", buildZip(t, [2]string{"a.csv", large}, [2]string{"b.csv", large}, [2]string{"c.csv", large}, [2]string{"d.csv", large}), true, "expand to more than"},
+		{"too many entries", buildZip(t, repeatEntries(11)...), true, "more than 10 CSV files"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ExtractZipCSVs(tt.archive, testZipLimits)
+			if err == nil {
+				t.Fatal("ExtractZipCSVs() accepted the archive")
+			}
+			if errors.Is(err, models.ErrArchiveTooLarge) != tt.tooLarge {
+				t.Errorf("errors.Is(%v, ErrArchiveTooLarge) = %v, want %v", err, !tt.tooLarge, tt.tooLarge)
+			}
+			if !strings.Contains(err.Error(), tt.wantInErr) {
+				t.Errorf("error = %q, want it to mention %q", err, tt.wantInErr)
+			}
+		})
+	}
+}
+
+// repeatEntries returns n small CSV entries
+func repeatEntries(n int) [][2]string {
+	entries := make([][2]string, n)
+	for i := range entries {
+		entries[i] = [2]string{strings.Repeat("a", i+1) + ".csv", "name\nAda\n"}
+	}
+	return entries
+}
@@ -40,7 +40,8 @@ function FileUpload({ onUploadSuccess }) {
       });
 
       if (!response.ok) {
-        throw new Error('Upload failed');
+        const body = await response.json().catch(() => null);
+        throw new Error(body?.message ?? 'Upload failed');
       }
 
       const result = await response.json();
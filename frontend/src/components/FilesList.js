@@ -6,9 +6,14 @@ function FilesList({ onSelectFile }) {
 
   useEffect(() => {
     fetchFiles();
-    // Poll for status updates every 2 seconds
-    const interval = setInterval(fetchFiles, 2000);
-    return () => clearInterval(interval);
+    // Refresh whenever the server reports a status change, with a slow poll as backup
+    const events = new EventSource('/api/events');
+    events.onmessage = fetchFiles;
+    const interval = setInterval(fetchFiles, 30000);
+    return () => {
+      events.close();
+      clearInterval(interval);
+    };
   }, []);
 
   const fetchFiles = async () => {